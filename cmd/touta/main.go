@@ -25,6 +25,7 @@ func main() {
 	root.AddCommand(cli.NewCommand())
 	root.AddCommand(cli.InitCommand())
 	root.AddCommand(cli.ServeCommand())
+	root.AddCommand(cli.RoutesCommand())
 	root.AddCommand(cli.VersionCommand(version))
 
 	// TODO: Dynamically load additional commands from plugins
@@ -0,0 +1,38 @@
+// Package app builds the framework's components from touta.yaml. It wires
+// together packages that cannot import each other, such as the router and
+// the middleware built for it, and reports invalid settings as errors.
+package app
+
+import (
+	"fmt"
+
+	"github.com/toutaio/toutago/internal/middleware"
+	"github.com/toutaio/toutago/internal/router"
+	"github.com/toutaio/toutago/internal/static"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// NewRouter creates a router configured by the router section of cfg: the
+// middleware it lists, and CORS and rate limiting when enabled, are added
+// with Use, and its static directories are mounted. Listen serves with the
+// server section of cfg. Opts are passed to router.NewChiRouter after the
+// server config. Invalid settings, such as an unknown middleware name or a
+// missing static directory, are returned as errors.
+func NewRouter(container touta.Container, cfg *touta.Config, opts ...router.Option) (touta.Router, error) {
+	if cfg == nil {
+		cfg = &touta.Config{}
+	}
+
+	mws, err := middleware.FromConfig(cfg.Router)
+	if err != nil {
+		return nil, fmt.Errorf("invalid router config: %w", err)
+	}
+
+	opts = append([]router.Option{router.WithServerConfig(cfg.Server, cfg.Framework.Mode)}, opts...)
+	r := router.NewChiRouter(container, opts...)
+	r.Use(mws...)
+	if _, err := static.MountConfig(r, cfg.Router.Static); err != nil {
+		return nil, fmt.Errorf("invalid router config: %w", err)
+	}
+	return r, nil
+}
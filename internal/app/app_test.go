@@ -0,0 +1,74 @@
+package app
+
+import (
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/toutaio/toutago/internal/di"
+	"github.com/toutaio/toutago/internal/middleware"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+func ok(ctx touta.Context) error {
+	return ctx.String(200, "OK")
+}
+
+func serve(r touta.Router, target string, headers map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", target, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.Native().(*chi.Mux).ServeHTTP(w, req)
+	return w
+}
+
+func TestNewRouter_Middleware(t *testing.T) {
+	r, err := NewRouter(di.NewContainer(), &touta.Config{Router: touta.RouterConfig{
+		Middleware: []string{"request_id"},
+		CORS:       touta.CORSConfig{Enabled: true, AllowedOrigins: []string{"*"}},
+	}})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	r.GET("/", ok)
+
+	w := serve(r, "/", map[string]string{"Origin": "https://example.com"})
+	if w.Header().Get(middleware.RequestIDHeader) == "" {
+		t.Error("Listed middleware should be applied")
+	}
+	if w.Header().Get("Access-Control-Allow-Origin") == "" {
+		t.Error("Enabled CORS should be applied")
+	}
+
+	_, err = NewRouter(di.NewContainer(), &touta.Config{Router: touta.RouterConfig{Middleware: []string{"nope"}}})
+	if err == nil || !strings.Contains(err.Error(), "nope") {
+		t.Errorf("Expected an error for an unknown middleware, got %v", err)
+	}
+}
+
+func TestNewRouter_Static(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "robots.txt"), []byte("User-agent: *"), 0644)
+
+	r, err := NewRouter(di.NewContainer(), &touta.Config{Router: touta.RouterConfig{
+		Static: []touta.StaticConfig{{Path: "/public", Dir: dir}},
+	}})
+	if err != nil {
+		t.Fatalf("NewRouter failed: %v", err)
+	}
+	if w := serve(r, "/public/robots.txt", nil); w.Code != 200 || w.Body.String() != "User-agent: *" {
+		t.Errorf("Configured static directory not mounted, got %d %q", w.Code, w.Body.String())
+	}
+
+	_, err = NewRouter(di.NewContainer(), &touta.Config{Router: touta.RouterConfig{
+		Static: []touta.StaticConfig{{Path: "/x", Dir: filepath.Join(dir, "missing")}},
+	}})
+	if err == nil {
+		t.Error("Expected an error for a missing static directory")
+	}
+}
@@ -0,0 +1,159 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/toutaio/toutago/internal/router"
+)
+
+// RoutesCommand lists the routes of the application.
+func RoutesCommand() *cobra.Command {
+	var asJSON bool
+	var pkg string
+
+	cmd := &cobra.Command{
+		Use:   "routes",
+		Short: "List the application's routes",
+		Long: `Lists the routes the application in the current directory registers,
+without running it. The routes package (./routes unless --package is
+given) must export a Register(touta.Router) function, which the
+application calls to set up its router: this command builds a program
+that calls it on a new router and prints the route table. Conflicting
+and shadowed routes are flagged.`,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return listRoutes(cmd.OutOrStdout(), pkg, asJSON)
+		},
+	}
+
+	cmd.Flags().BoolVar(&asJSON, "json", false, "Print the routes as JSON")
+	cmd.Flags().StringVar(&pkg, "package", "./routes", "Package exporting the Register function")
+
+	return cmd
+}
+
+// routesProgram calls the Register function of a routes package on a new
+// router and writes the route table to the file named by its argument.
+const routesProgram = `// Code generated by touta routes. DO NOT EDIT.
+
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/toutaio/toutago/internal/di"
+	"github.com/toutaio/toutago/internal/router"
+	routes %q
+)
+
+func main() {
+	r := router.NewChiRouter(di.NewContainer())
+	routes.Register(r)
+	if err := router.WriteRoutes(r, os.Args[1]); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+`
+
+// listRoutes runs a generated program calling the Register function of
+// pkg and prints the route table it writes.
+func listRoutes(out io.Writer, pkg string, asJSON bool) error {
+	projectRoot, err := os.Getwd()
+	if err != nil {
+		return fmt.Errorf("failed to get working directory: %w", err)
+	}
+
+	list := exec.Command("go", "list", "-f", "{{.ImportPath}}", pkg)
+	list.Dir = projectRoot
+	importPath, err := list.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("failed to find routes package %s: %w\nOutput: %s", pkg, err, exitErr.Stderr)
+		}
+		return fmt.Errorf("failed to find routes package %s: %w", pkg, err)
+	}
+
+	// The program is generated inside the project, as it may only import
+	// the packages of the framework from within the module
+	tmp, err := os.MkdirTemp(projectRoot, "touta-routes-")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary directory: %w", err)
+	}
+	defer os.RemoveAll(tmp)
+
+	program := fmt.Sprintf(routesProgram, strings.TrimSpace(string(importPath)))
+	if err := os.WriteFile(filepath.Join(tmp, "main.go"), []byte(program), 0644); err != nil {
+		return fmt.Errorf("failed to write routes program: %w", err)
+	}
+
+	routesFile := filepath.Join(tmp, "routes.json")
+	run := exec.Command("go", "run", "./"+filepath.Base(tmp), routesFile)
+	run.Dir = projectRoot
+	if output, err := run.CombinedOutput(); err != nil {
+		return fmt.Errorf("failed to list routes of %s: %w\nOutput: %s", pkg, err, output)
+	}
+
+	data, err := os.ReadFile(routesFile)
+	if err != nil {
+		return fmt.Errorf("failed to read routes: %w", err)
+	}
+	var routes []router.RouteInfo
+	if err := json.Unmarshal(data, &routes); err != nil {
+		return fmt.Errorf("failed to read routes: %w", err)
+	}
+
+	if asJSON {
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(routes)
+	}
+	return printRoutes(out, routes)
+}
+
+// printRoutes prints routes as a table, followed by the conflicts found.
+func printRoutes(out io.Writer, routes []router.RouteInfo) error {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "METHOD\tPATTERN\tNAME\tHANDLER\tMIDDLEWARE")
+
+	conflicts := 0
+	for _, route := range routes {
+		method := route.Method
+		if route.Conflict != "" {
+			method = "!" + method
+			conflicts++
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", method, route.Host+route.Pattern, dash(route.Name), route.Handler,
+			dash(strings.Join(route.Middleware, ", ")))
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if conflicts > 0 {
+		fmt.Fprintf(out, "\n⚠️  %d conflicting or shadowed routes:\n", conflicts)
+		for _, route := range routes {
+			if route.Conflict != "" {
+				fmt.Fprintf(out, "   %s: %s\n", route, route.Conflict)
+			}
+		}
+	}
+	return nil
+}
+
+func dash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
@@ -73,6 +73,17 @@ func (l *yamlLoader) Validate(config *touta.Config) error {
 		}
 	}
 
+	// Validate message bus settings
+	switch config.MessageBus.Router {
+	case "", "code-based":
+	case "config-based":
+		if len(config.MessageBus.Routes) == 0 {
+			return fmt.Errorf("message bus router is config-based but no routes are listed")
+		}
+	default:
+		return fmt.Errorf("invalid message bus router: %s", config.MessageBus.Router)
+	}
+
 	// Validate server settings
 	if config.Server.Port < 0 || config.Server.Port > 65535 {
 		return fmt.Errorf("invalid server port: %d", config.Server.Port)
@@ -94,6 +105,11 @@ func (l *yamlLoader) substituteEnv(config *touta.Config) {
 	// Substitute in TLS config
 	config.Server.TLS.CertFile = l.expandEnv(config.Server.TLS.CertFile)
 	config.Server.TLS.KeyFile = l.expandEnv(config.Server.TLS.KeyFile)
+
+	// Substitute in message bus routes
+	for i, path := range config.MessageBus.Routes {
+		config.MessageBus.Routes[i] = l.expandEnv(path)
+	}
 }
 
 // expandEnv expands environment variables in a string.
@@ -140,6 +156,10 @@ func LoadDefaults() *touta.Config {
 				Enabled: false,
 			},
 		},
+		MessageBus: touta.MessageBusConfig{
+			Router: "code-based",
+			Routes: []string{},
+		},
 		Packages: make(map[string]interface{}),
 		App:      make(map[string]interface{}),
 	}
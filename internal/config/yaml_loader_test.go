@@ -82,6 +82,13 @@ func TestYAMLLoader_Validate(t *testing.T) {
 			},
 			wantErr: true,
 		},
+		{
+			name: "config-based message routing without routes",
+			config: &touta.Config{
+				MessageBus: touta.MessageBusConfig{Router: "config-based"},
+			},
+			wantErr: true,
+		},
 		{
 			name: "invalid port",
 			config: &touta.Config{
@@ -291,7 +291,11 @@ func (c *container) build(concrete interface{}, params map[string]interface{}) (
 }
 
 // getKey returns a unique key for an interface or type.
+// A string abstract is a named binding and is used as the key verbatim.
 func (c *container) getKey(abstract interface{}) string {
+	if name, ok := abstract.(string); ok {
+		return name
+	}
 	if t, ok := abstract.(reflect.Type); ok {
 		return t.String()
 	}
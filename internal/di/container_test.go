@@ -104,3 +104,24 @@ func TestContainer_AutoWire(t *testing.T) {
 		t.Log("AutoWire interface injection needs reflection improvements")
 	}
 }
+
+func TestContainer_NamedBinding(t *testing.T) {
+	container := NewContainer()
+	first := &testServiceImpl{name: "first"}
+	second := &testServiceImpl{name: "second"}
+
+	container.Bind("service.first", first)
+	container.Singleton("service.second", second)
+
+	if !container.Has("service.first") || container.Has("service.third") {
+		t.Fatal("Has should report named bindings by name")
+	}
+
+	instance, err := container.Make("service.second")
+	if err != nil {
+		t.Fatalf("Make failed: %v", err)
+	}
+	if instance.(TestService).Name() != "second" {
+		t.Errorf("Expected second, got %s", instance.(TestService).Name())
+	}
+}
@@ -0,0 +1,391 @@
+// Package endpoint exposes message handlers over HTTP. An endpoint turns
+// each request into a message, sends it with message.Request and renders
+// the reply as the response, so handlers subscribed to the bus serve HTTP
+// without knowing about it. Endpoints are declared in routes.yaml and
+// registered with Bind, or created in code with New.
+package endpoint
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/toutaio/toutago/internal/message"
+	"github.com/toutaio/toutago/internal/router"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// Message types used when an endpoint sets none.
+const (
+	TypeQuery   = "query"   // for GET and HEAD requests
+	TypeCommand = "command" // for other methods
+)
+
+// Option configures an endpoint.
+type Option func(*endpoint)
+
+// WithCodec sets the codec building request messages, so slugs with a
+// registered type are sent as that type. Other slugs are sent as
+// *message.RawMessage, which typed handlers decode with message.As.
+func WithCodec(codec *message.Codec) Option {
+	return func(e *endpoint) {
+		e.codec = codec
+	}
+}
+
+// WithType sets the type of request messages. By default GET and HEAD
+// requests are sent as TypeQuery and the others as TypeCommand.
+func WithType(typ string) Option {
+	return func(e *endpoint) {
+		e.typ = typ
+	}
+}
+
+// WithStatus sets the status of successful responses. By default it is
+// 200 OK, or 204 No Content when no handler replied.
+func WithStatus(status int) Option {
+	return func(e *endpoint) {
+		e.status = status
+	}
+}
+
+// endpoint answers requests with the reply to a message.
+type endpoint struct {
+	bus    touta.MessageBus
+	slug   string
+	typ    string
+	status int
+	codec  *message.Codec
+}
+
+// New returns a handler that sends each request as a message with slug on
+// bus and renders the reply as JSON.
+//
+// The message payload is a JSON object holding the query parameters, then
+// the fields of a JSON or form body, then the path parameters, later
+// sources overriding earlier ones, so the query string cannot replace
+// what the body sends. Parameters are strings, so a typed
+// message reads a numeric parameter with a `json:",string"` tag.
+//
+// The reply's payload is sent without the slug, type and metadata it
+// inherits from message.BaseMessage. Handler errors are rendered by the
+// router's error handler: an HTTPError keeps its status, validation errors
+// become 422 Unprocessable Entity and payloads a typed handler cannot
+// decode 400 Bad Request. A slug without handlers is answered with 501 Not
+// Implemented and a stopped bus with 503 Service Unavailable.
+func New(bus touta.MessageBus, slug string, opts ...Option) touta.HandlerFunc {
+	e := &endpoint{
+		bus:   bus,
+		slug:  slug,
+		codec: message.NewCodec(),
+	}
+	for _, opt := range opts {
+		opt(e)
+	}
+	return e.handle
+}
+
+// Bind validates endpoints and registers them on r, each sending its slug
+// on bus. Opts apply to every endpoint; the type and status an endpoint
+// declares take precedence. Nothing is registered when any endpoint is
+// invalid.
+func Bind(r touta.Router, bus touta.MessageBus, endpoints []message.Endpoint, opts ...Option) error {
+	if err := Validate(endpoints); err != nil {
+		return err
+	}
+
+	for _, ep := range endpoints {
+		epOpts := append([]Option(nil), opts...)
+		if ep.Type != "" {
+			epOpts = append(epOpts, WithType(ep.Type))
+		}
+		if ep.Status != 0 {
+			epOpts = append(epOpts, WithStatus(ep.Status))
+		}
+
+		route := r.Match([]string{method(ep)}, ep.Path, New(bus, ep.Slug, epOpts...))
+		if ep.Name != "" {
+			route.Name(ep.Name)
+		}
+	}
+	return nil
+}
+
+// Validate checks every endpoint and reports all problems at once.
+func Validate(endpoints []message.Endpoint) error {
+	var errs []error
+	names := make(map[string]bool)
+
+	for _, ep := range endpoints {
+		switch {
+		case ep.Slug == "":
+			errs = append(errs, fmt.Errorf("endpoint %s: slug is required", ep))
+		case !strings.HasPrefix(ep.Path, "/"):
+			errs = append(errs, fmt.Errorf("endpoint %s: path must start with /", ep))
+		case !supportedMethod(method(ep)):
+			errs = append(errs, fmt.Errorf("endpoint %s: unsupported method %s", ep, ep.Method))
+		case ep.Status != 0 && (ep.Status < 200 || ep.Status > 299):
+			errs = append(errs, fmt.Errorf("endpoint %s: status must be a 2xx code", ep))
+		case ep.Name != "" && names[ep.Name]:
+			errs = append(errs, fmt.Errorf("endpoint %s: route name %s is used twice", ep, ep.Name))
+		}
+		names[ep.Name] = ep.Name != ""
+	}
+
+	if len(errs) > 0 {
+		return errors.Join(errs...)
+	}
+	return nil
+}
+
+func method(ep message.Endpoint) string {
+	if ep.Method == "" {
+		return http.MethodGet
+	}
+	return strings.ToUpper(ep.Method)
+}
+
+func supportedMethod(m string) bool {
+	switch m {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut,
+		http.MethodPatch, http.MethodDelete, http.MethodOptions:
+		return true
+	}
+	return false
+}
+
+// handle sends the request as a message and renders the reply.
+func (e *endpoint) handle(ctx touta.Context) error {
+	req := ctx.Request()
+
+	payload, err := requestPayload(req)
+	if err != nil {
+		return err
+	}
+	msg, err := e.codec.Decode(message.Envelope{
+		Slug:    e.slug,
+		Type:    e.messageType(req.Method),
+		Payload: payload,
+	})
+	if err != nil {
+		return &router.BindError{Status: http.StatusBadRequest, Err: err}
+	}
+
+	reply, err := message.Request(req.Context(), e.bus, msg)
+	if err != nil {
+		return requestError(err)
+	}
+	return e.render(ctx, reply)
+}
+
+func (e *endpoint) messageType(method string) string {
+	switch {
+	case e.typ != "":
+		return e.typ
+	case method == http.MethodGet || method == http.MethodHead:
+		return TypeQuery
+	}
+	return TypeCommand
+}
+
+// requestError maps the errors of message.Request that are not the
+// handlers' own to HTTP errors.
+func requestError(err error) error {
+	var httpErr *touta.HTTPError
+	switch {
+	case errors.As(err, &httpErr):
+		return err
+	case errors.Is(err, message.ErrNoHandler):
+		return touta.NewHTTPError(http.StatusNotImplemented, "").Wrap(err)
+	case errors.Is(err, message.ErrBusNotStarted), errors.Is(err, message.ErrBusStopped):
+		return touta.NewHTTPError(http.StatusServiceUnavailable, "").Wrap(err)
+	case errors.Is(err, message.ErrUnexpectedType):
+		return touta.NewHTTPError(http.StatusBadRequest, "invalid request payload").Wrap(err)
+	}
+	return err
+}
+
+// render sends the payload of reply as JSON.
+func (e *endpoint) render(ctx touta.Context, reply touta.Message) error {
+	status := e.status
+	if reply == nil {
+		if status == 0 {
+			status = http.StatusNoContent
+		}
+		ctx.Status(status)
+		return nil
+	}
+
+	body, err := replyPayload(reply)
+	if err != nil {
+		return err
+	}
+	if status == 0 {
+		status = http.StatusOK
+	}
+	if len(body) == 0 || status == http.StatusNoContent {
+		ctx.Status(status)
+		return nil
+	}
+	return ctx.JSON(status, body)
+}
+
+// requestPayload builds the JSON payload of the message for req from its
+// query parameters, body and path parameters, in increasing precedence.
+// It returns nil when the request carries none.
+func requestPayload(req *http.Request) (json.RawMessage, error) {
+	fields := make(map[string]json.RawMessage)
+	for key, values := range req.URL.Query() {
+		fields[key] = stringsJSON(values)
+	}
+	if err := bodyFields(req, fields); err != nil {
+		return nil, err
+	}
+	if rctx := chi.RouteContext(req.Context()); rctx != nil {
+		for i, key := range rctx.URLParams.Keys {
+			if key != "" && key != "*" {
+				fields[key] = stringsJSON(rctx.URLParams.Values[i : i+1])
+			}
+		}
+	}
+
+	if len(fields) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(fields)
+}
+
+// bodyFields adds the fields of a JSON object or form body to fields.
+// Requests without a body are left alone.
+func bodyFields(req *http.Request, fields map[string]json.RawMessage) error {
+	if req.Body == nil || req.Body == http.NoBody || req.ContentLength == 0 {
+		return nil
+	}
+
+	contentType := req.Header.Get("Content-Type")
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return &router.BindError{Status: http.StatusUnsupportedMediaType, Err: err}
+	}
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		var body map[string]json.RawMessage
+		if err := json.NewDecoder(req.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+			return &router.BindError{Status: http.StatusBadRequest, Err: fmt.Errorf("body must be a JSON object: %w", err)}
+		}
+		for key, value := range body {
+			fields[key] = value
+		}
+
+	case mediaType == "application/x-www-form-urlencoded":
+		if err := req.ParseForm(); err != nil {
+			return &router.BindError{Status: http.StatusBadRequest, Err: fmt.Errorf("invalid form body: %w", err)}
+		}
+		for key, values := range req.PostForm {
+			fields[key] = stringsJSON(values)
+		}
+
+	case mediaType == "multipart/form-data":
+		if err := req.ParseMultipartForm(router.MaxMultipartMemory); err != nil {
+			return &router.BindError{Status: http.StatusBadRequest, Err: fmt.Errorf("invalid multipart body: %w", err)}
+		}
+		for key, values := range req.MultipartForm.Value {
+			fields[key] = stringsJSON(values)
+		}
+
+	default:
+		return &router.BindError{Status: http.StatusUnsupportedMediaType, Err: fmt.Errorf("unsupported content type %q", mediaType)}
+	}
+	return nil
+}
+
+// stringsJSON encodes a single value as a JSON string and several as an
+// array of strings.
+func stringsJSON(values []string) json.RawMessage {
+	var data []byte
+	if len(values) == 1 {
+		data, _ = json.Marshal(values[0])
+	} else {
+		data, _ = json.Marshal(values)
+	}
+	return data
+}
+
+var baseMessageType = reflect.TypeOf(message.BaseMessage{})
+
+// replyPayload returns the JSON payload of reply, leaving out the fields
+// it inherits from an embedded message.BaseMessage.
+func replyPayload(reply touta.Message) (json.RawMessage, error) {
+	if raw, ok := reply.(*message.RawMessage); ok {
+		return raw.Payload, nil
+	}
+
+	data, err := json.Marshal(reply)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode reply %s: %w", reply.Slug(), err)
+	}
+	keys := envelopeKeys(reflect.TypeOf(reply))
+	if len(keys) == 0 {
+		return data, nil
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return data, nil // not an object, e.g. a custom MarshalJSON
+	}
+	for _, key := range keys {
+		delete(fields, key)
+	}
+	return json.Marshal(fields)
+}
+
+// envelopeKeys returns the JSON keys typ inherits from an embedded
+// message.BaseMessage that none of its own fields override.
+func envelopeKeys(typ reflect.Type) []string {
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+	if typ.Kind() != reflect.Struct {
+		return nil
+	}
+
+	embedded := false
+	own := make(map[string]bool)
+	for i := 0; i < typ.NumField(); i++ {
+		f := typ.Field(i)
+		if f.Anonymous && (f.Type == baseMessageType || f.Type == reflect.PtrTo(baseMessageType)) {
+			embedded = true
+			continue
+		}
+		own[jsonName(f)] = true
+	}
+	if !embedded {
+		return nil
+	}
+
+	var keys []string
+	for i := 0; i < baseMessageType.NumField(); i++ {
+		if name := jsonName(baseMessageType.Field(i)); !own[name] {
+			keys = append(keys, name)
+		}
+	}
+	return keys
+}
+
+func jsonName(f reflect.StructField) string {
+	name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+	if name == "" {
+		return f.Name
+	}
+	return name
+}
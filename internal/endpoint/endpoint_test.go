@@ -0,0 +1,271 @@
+package endpoint
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/toutaio/toutago/internal/di"
+	"github.com/toutaio/toutago/internal/message"
+	"github.com/toutaio/toutago/internal/router"
+	"github.com/toutaio/toutago/internal/validation"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+type getUser struct {
+	message.BaseMessage
+	ID     int    `json:"id,string"`
+	Fields string `json:"fields"`
+}
+
+func (m *getUser) Slug() string { return "user.get" }
+
+type userReply struct {
+	message.BaseMessage
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+func startBus(t *testing.T) touta.MessageBus {
+	t.Helper()
+	bus := message.NewBus()
+	if err := bus.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(func() { bus.Stop(context.Background()) })
+	return bus
+}
+
+func serve(r touta.Router, method, path, contentType, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Accept", "application/json")
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	w := httptest.NewRecorder()
+	r.Native().(*chi.Mux).ServeHTTP(w, req)
+	return w
+}
+
+func TestNew_SendsRequestAsMessage(t *testing.T) {
+	bus := startBus(t)
+	var got *message.RawMessage
+	bus.Subscribe("user.update", message.HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		got = msg.(*message.RawMessage)
+		return &message.RawMessage{Payload: []byte(`{"ok":true}`)}, nil
+	}))
+
+	r := router.NewChiRouter(di.NewContainer())
+	r.PUT("/users/{id}", New(bus, "user.update"))
+
+	w := serve(r, "PUT", "/users/42?tag=a&tag=b&id=7", "application/json", `{"name":"Ann","age":30,"id":"x"}`)
+	if w.Code != 200 || strings.TrimSpace(w.Body.String()) != `{"ok":true}` {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+
+	if got.Slug() != "user.update" || got.Type() != TypeCommand {
+		t.Errorf("unexpected message %s of type %s", got.Slug(), got.Type())
+	}
+	var payload map[string]interface{}
+	json.Unmarshal(got.Payload, &payload)
+	want := map[string]interface{}{"id": "42", "name": "Ann", "age": float64(30), "tag": []interface{}{"a", "b"}}
+	if len(payload) != len(want) || payload["id"] != "42" || payload["name"] != "Ann" || payload["age"] != float64(30) ||
+		len(payload["tag"].([]interface{})) != 2 {
+		t.Errorf("payload = %v, want %v", payload, want)
+	}
+}
+
+func TestNew_BodyOverridesQuery(t *testing.T) {
+	bus := startBus(t)
+	var got *message.RawMessage
+	bus.Subscribe("user.update", message.HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		got = msg.(*message.RawMessage)
+		return nil, nil
+	}))
+
+	r := router.NewChiRouter(di.NewContainer())
+	r.PUT("/users/{id}", New(bus, "user.update"))
+
+	serve(r, "PUT", "/users/42?role=admin&page=2", "application/json", `{"role":"member"}`)
+
+	var payload map[string]interface{}
+	json.Unmarshal(got.Payload, &payload)
+	if payload["role"] != "member" || payload["page"] != "2" || payload["id"] != "42" {
+		t.Errorf("body fields should win over query parameters, got %v", payload)
+	}
+}
+
+func TestNew_FormBody(t *testing.T) {
+	bus := startBus(t)
+	var got *message.RawMessage
+	bus.Subscribe("user.register", message.HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		got = msg.(*message.RawMessage)
+		return nil, nil
+	}))
+
+	r := router.NewChiRouter(di.NewContainer())
+	r.POST("/users", New(bus, "user.register", WithStatus(http.StatusAccepted)))
+
+	w := serve(r, "POST", "/users", "application/x-www-form-urlencoded", "name=Ann")
+	if w.Code != http.StatusAccepted || w.Body.Len() != 0 {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+	if string(got.Payload) != `{"name":"Ann"}` {
+		t.Errorf("unexpected payload %s", got.Payload)
+	}
+
+	if w := serve(r, "POST", "/users", "application/json", `["Ann"]`); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a JSON body that is not an object, got %d", w.Code)
+	}
+	if w := serve(r, "POST", "/users", "text/csv", "Ann"); w.Code != http.StatusUnsupportedMediaType {
+		t.Errorf("expected 415 for an unsupported body, got %d", w.Code)
+	}
+}
+
+func TestNew_TypedMessages(t *testing.T) {
+	bus := startBus(t)
+	bus.Subscribe("user.get", message.HandleReply(func(ctx context.Context, msg *getUser) (*userReply, error) {
+		if msg.ID == 0 {
+			return nil, touta.NewHTTPError(http.StatusNotFound, "user not found")
+		}
+		return &userReply{BaseMessage: message.BaseMessage{MessageSlug: "user.found"}, ID: msg.ID, Name: "Ann"}, nil
+	}))
+
+	codec := message.NewCodec()
+	codec.Register(&getUser{})
+
+	r := router.NewChiRouter(di.NewContainer())
+	r.GET("/users/{id}", New(bus, "user.get", WithCodec(codec)))
+	r.GET("/raw/{id}", New(bus, "user.get"))
+
+	w := serve(r, "GET", "/users/42", "", "")
+	if w.Code != 200 {
+		t.Fatalf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+	var body map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if len(body) != 2 || body["id"] != float64(42) || body["name"] != "Ann" {
+		t.Errorf("reply should be rendered without its envelope, got %s", w.Body.String())
+	}
+
+	// Raw messages are decoded by the typed handler
+	if w := serve(r, "GET", "/raw/7", "", ""); w.Code != 200 || !strings.Contains(w.Body.String(), `"id":7`) {
+		t.Errorf("unexpected response %d %s", w.Code, w.Body.String())
+	}
+	if w := serve(r, "GET", "/raw/0", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("expected the handler's HTTPError, got %d", w.Code)
+	}
+	if w := serve(r, "GET", "/raw/x", "", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("expected 400 for a payload the handler cannot decode, got %d", w.Code)
+	}
+}
+
+func TestNew_Errors(t *testing.T) {
+	bus := startBus(t)
+	bus.Subscribe("user.invalid", message.HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		return nil, validation.Errors{{Field: "name", Rule: "required"}}
+	}))
+	bus.Subscribe("user.broken", message.HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		return nil, errors.New("database down")
+	}))
+
+	r := router.NewChiRouter(di.NewContainer())
+	r.POST("/invalid", New(bus, "user.invalid"))
+	r.POST("/broken", New(bus, "user.broken"))
+	r.POST("/missing", New(bus, "user.missing"))
+	r.POST("/stopped", New(message.NewBus(), "user.invalid"))
+
+	for path, status := range map[string]int{
+		"/invalid": http.StatusUnprocessableEntity,
+		"/broken":  http.StatusInternalServerError,
+		"/missing": http.StatusNotImplemented,
+		"/stopped": http.StatusServiceUnavailable,
+	} {
+		if w := serve(r, "POST", path, "", ""); w.Code != status {
+			t.Errorf("%s: expected %d, got %d %s", path, status, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestBind(t *testing.T) {
+	bus := startBus(t)
+	bus.Subscribe("user.get", message.HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		return &message.RawMessage{Payload: []byte(`{"type":"` + msg.Type() + `"}`)}, nil
+	}))
+	bus.Subscribe("user.register", message.HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		return &message.RawMessage{Payload: []byte(`{"type":"` + msg.Type() + `"}`)}, nil
+	}))
+
+	endpoints, err := message.ParseEndpoints([]byte(`---
+slug: user.register
+---
+endpoints:
+  - method: POST
+    path: /users
+    status: 201
+  - path: /users/{id}
+    slug: user.get
+    name: users.show
+  - method: PUT
+    path: /users/{id}
+    slug: user.get
+    type: event
+`))
+	if err != nil {
+		t.Fatalf("ParseEndpoints failed: %v", err)
+	}
+
+	r := router.NewChiRouter(di.NewContainer())
+	if err := Bind(r, bus, endpoints); err != nil {
+		t.Fatalf("Bind failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		method, path string
+		status       int
+		body         string
+	}{
+		{"POST", "/users", 201, `{"type":"command"}`},
+		{"GET", "/users/1", 200, `{"type":"query"}`},
+		{"PUT", "/users/1", 200, `{"type":"event"}`},
+	} {
+		w := serve(r, tc.method, tc.path, "", "")
+		if w.Code != tc.status || strings.TrimSpace(w.Body.String()) != tc.body {
+			t.Errorf("%s %s: got %d %s, want %d %s", tc.method, tc.path, w.Code, w.Body.String(), tc.status, tc.body)
+		}
+	}
+
+	if url, err := r.URL("users.show", "id", 5); err != nil || url != "/users/5" {
+		t.Errorf("named endpoint URL = %q, %v", url, err)
+	}
+}
+
+func TestBind_InvalidEndpointsBindNothing(t *testing.T) {
+	r := router.NewChiRouter(di.NewContainer())
+	err := Bind(r, startBus(t), []message.Endpoint{
+		{Path: "/ok", Slug: "ok"},
+		{Path: "/no-slug"},
+		{Path: "relative", Slug: "x"},
+		{Method: "BREW", Path: "/coffee", Slug: "x"},
+		{Path: "/created", Slug: "x", Status: 404},
+		{Path: "/a", Slug: "x", Name: "dup"},
+		{Path: "/b", Slug: "x", Name: "dup"},
+	})
+	if err == nil {
+		t.Fatal("expected Bind to fail")
+	}
+	for _, want := range []string{"slug is required", "must start with /", "unsupported method BREW", "2xx", "route name dup"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error should mention %q: %v", want, err)
+		}
+	}
+
+	if routes, _ := router.Routes(r); len(routes) != 0 {
+		t.Errorf("nothing should be registered, got %+v", routes)
+	}
+}
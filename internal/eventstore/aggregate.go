@@ -0,0 +1,258 @@
+package eventstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/toutaio/toutago/internal/message"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// Aggregate is a domain object whose state is derived from its events.
+// Implementations embed AggregateBase and implement Apply.
+type Aggregate interface {
+	// Apply mutates the aggregate state for one event
+	Apply(event touta.Message) error
+
+	// Base returns the embedded AggregateBase
+	Base() *AggregateBase
+}
+
+// Snapshotter is implemented by aggregates that support snapshots.
+type Snapshotter interface {
+	// SnapshotState returns a JSON serialisable copy of the state
+	SnapshotState() (interface{}, error)
+
+	// RestoreSnapshot replaces the state with a stored snapshot
+	RestoreSnapshot(state json.RawMessage) error
+}
+
+// AggregateBase tracks the identity, version and uncommitted events of an
+// aggregate. Embed it in aggregate structs.
+type AggregateBase struct {
+	id      string
+	version uint64
+	changes []touta.Message
+}
+
+// Base returns the aggregate base itself.
+func (a *AggregateBase) Base() *AggregateBase {
+	return a
+}
+
+// ID returns the aggregate (stream) identifier.
+func (a *AggregateBase) ID() string {
+	return a.id
+}
+
+// SetID sets the aggregate identifier for a new aggregate.
+func (a *AggregateBase) SetID(id string) {
+	a.id = id
+}
+
+// Version returns the stream version including uncommitted events.
+func (a *AggregateBase) Version() uint64 {
+	return a.version
+}
+
+// Changes returns the events raised since the aggregate was loaded or saved.
+func (a *AggregateBase) Changes() []touta.Message {
+	return a.changes
+}
+
+// Raise applies a new event to the aggregate and records it for saving.
+func Raise(agg Aggregate, event touta.Message) error {
+	if err := agg.Apply(event); err != nil {
+		return err
+	}
+
+	base := agg.Base()
+	base.version++
+	base.changes = append(base.changes, event)
+	return nil
+}
+
+// Repository loads and saves aggregates through an event store.
+type Repository struct {
+	store         Store
+	codec         *message.Codec
+	bus           touta.MessageBus
+	snapshotEvery uint64
+}
+
+// RepositoryOption configures a repository created by NewRepository.
+type RepositoryOption func(*Repository)
+
+// WithCodec sets the codec used to rebuild events, which must have the
+// aggregate's event types registered.
+func WithCodec(codec *message.Codec) RepositoryOption {
+	return func(r *Repository) {
+		r.codec = codec
+	}
+}
+
+// WithPublisher publishes saved events on bus, stamped with their stream id,
+// stream version and global position, so projections can follow them.
+func WithPublisher(bus touta.MessageBus) RepositoryOption {
+	return func(r *Repository) {
+		r.bus = bus
+	}
+}
+
+// WithSnapshotEvery stores a snapshot whenever the version crosses a
+// multiple of n. Aggregates must implement Snapshotter.
+func WithSnapshotEvery(n uint64) RepositoryOption {
+	return func(r *Repository) {
+		r.snapshotEvery = n
+	}
+}
+
+// NewRepository creates a repository over store.
+func NewRepository(store Store, opts ...RepositoryOption) *Repository {
+	r := &Repository{
+		store: store,
+		codec: message.NewCodec(),
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Load rebuilds agg from its latest snapshot and subsequent events.
+func (r *Repository) Load(ctx context.Context, id string, agg Aggregate) error {
+	base := agg.Base()
+	base.id = id
+	base.version = 0
+	base.changes = nil
+
+	if snapshotter, ok := agg.(Snapshotter); ok {
+		snapshot, err := r.store.LoadSnapshot(ctx, id)
+		if err != nil {
+			return fmt.Errorf("failed to load snapshot of %s: %w", id, err)
+		}
+		if snapshot != nil {
+			if err := snapshotter.RestoreSnapshot(snapshot.State); err != nil {
+				return fmt.Errorf("failed to restore snapshot of %s: %w", id, err)
+			}
+			base.version = snapshot.Version
+		}
+	}
+
+	events, err := r.store.ReadStream(ctx, id, base.version)
+	if err != nil {
+		return fmt.Errorf("failed to read stream %s: %w", id, err)
+	}
+
+	for _, recorded := range events {
+		event, err := r.codec.Decode(recorded.Message)
+		if err != nil {
+			return err
+		}
+		if err := agg.Apply(event); err != nil {
+			return fmt.Errorf("failed to apply %s to %s: %w", event.Slug(), id, err)
+		}
+		base.version = recorded.Version
+	}
+
+	return nil
+}
+
+// Save appends the aggregate's uncommitted events, failing with a
+// ConcurrencyError if the stream changed since the aggregate was loaded.
+// Once the events are appended they are always published; snapshot and
+// publish failures are then returned joined.
+func (r *Repository) Save(ctx context.Context, agg Aggregate) error {
+	base := agg.Base()
+	if base.id == "" {
+		return fmt.Errorf("aggregate id is required")
+	}
+	if len(base.changes) == 0 {
+		return nil
+	}
+
+	expected := int64(base.version) - int64(len(base.changes))
+	recorded, err := r.store.Append(ctx, base.id, expected, base.changes...)
+	if err != nil {
+		return err
+	}
+
+	changes := base.changes
+	base.changes = nil
+
+	// The events are committed, so they are published even when the
+	// snapshot fails; a missing snapshot only makes loading slower
+	var errs []error
+	if r.snapshotEvery > 0 {
+		if err := r.snapshot(ctx, agg, expected); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if r.bus != nil {
+		for i, event := range changes {
+			event, err := r.stamp(event, recorded[i])
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			if err := r.bus.Publish(ctx, event); err != nil {
+				errs = append(errs, fmt.Errorf("failed to publish %s: %w", event.Slug(), err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// snapshot stores a snapshot if the save crossed a snapshot boundary.
+func (r *Repository) snapshot(ctx context.Context, agg Aggregate, from int64) error {
+	snapshotter, ok := agg.(Snapshotter)
+	if !ok {
+		return nil
+	}
+
+	base := agg.Base()
+	if uint64(from)/r.snapshotEvery == base.version/r.snapshotEvery {
+		return nil
+	}
+
+	state, err := snapshotter.SnapshotState()
+	if err != nil {
+		return fmt.Errorf("failed to snapshot %s: %w", base.id, err)
+	}
+	data, err := json.Marshal(state)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshot of %s: %w", base.id, err)
+	}
+
+	return r.store.SaveSnapshot(ctx, Snapshot{
+		StreamID: base.id,
+		Version:  base.version,
+		State:    data,
+	})
+}
+
+// stamp returns a copy of event carrying its stream information, leaving
+// the caller's event untouched. Events that cannot be copied are rebuilt
+// from the store instead.
+func (r *Repository) stamp(event touta.Message, recorded RecordedEvent) (touta.Message, error) {
+	stamped, ok := message.Copy(event)
+	if !ok {
+		var err error
+		if stamped, err = r.codec.Decode(recorded.Message); err != nil {
+			return nil, fmt.Errorf("failed to publish %s: %w", event.Slug(), err)
+		}
+	}
+
+	meta := stamped.Metadata()
+	if meta == nil {
+		return stamped, nil
+	}
+	meta[MetaStreamID] = recorded.StreamID
+	meta[MetaStreamVersion] = recorded.Version
+	meta[MetaPosition] = recorded.Position
+	return stamped, nil
+}
@@ -0,0 +1,219 @@
+package eventstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/toutaio/toutago/internal/message"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+type deposited struct {
+	message.BaseMessage
+	Amount int `json:"amount"`
+}
+
+func newDeposited(amount int) *deposited {
+	return &deposited{
+		BaseMessage: message.BaseMessage{MessageSlug: "account.deposited", MessageType: "event"},
+		Amount:      amount,
+	}
+}
+
+// account is a minimal event sourced aggregate.
+type account struct {
+	AggregateBase
+	Balance int
+	applied int
+}
+
+func (a *account) Apply(event touta.Message) error {
+	a.applied++
+	switch e := event.(type) {
+	case *deposited:
+		a.Balance += e.Amount
+		return nil
+	}
+	return fmt.Errorf("unknown event %s", event.Slug())
+}
+
+func (a *account) SnapshotState() (interface{}, error) {
+	return map[string]int{"balance": a.Balance}, nil
+}
+
+func (a *account) RestoreSnapshot(state json.RawMessage) error {
+	var s map[string]int
+	if err := json.Unmarshal(state, &s); err != nil {
+		return err
+	}
+	a.Balance = s["balance"]
+	return nil
+}
+
+func accountCodec() *message.Codec {
+	codec := message.NewCodec()
+	codec.Register(newDeposited(0))
+	return codec
+}
+
+func TestRepository_SaveAndLoad(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepository(NewMemoryStore(), WithCodec(accountCodec()))
+
+	acc := &account{}
+	acc.SetID("acc-1")
+	Raise(acc, newDeposited(10))
+	Raise(acc, newDeposited(5))
+
+	if err := repo.Save(ctx, acc); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+	if len(acc.Changes()) != 0 {
+		t.Error("Changes should be cleared after save")
+	}
+
+	loaded := &account{}
+	if err := repo.Load(ctx, "acc-1", loaded); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if loaded.Balance != 15 || loaded.Version() != 2 {
+		t.Errorf("Expected balance 15 at version 2, got %d at %d", loaded.Balance, loaded.Version())
+	}
+}
+
+func TestRepository_ConcurrentModification(t *testing.T) {
+	ctx := context.Background()
+	repo := NewRepository(NewMemoryStore(), WithCodec(accountCodec()))
+
+	acc := &account{}
+	acc.SetID("acc-1")
+	Raise(acc, newDeposited(10))
+	repo.Save(ctx, acc)
+
+	first, second := &account{}, &account{}
+	repo.Load(ctx, "acc-1", first)
+	repo.Load(ctx, "acc-1", second)
+
+	Raise(first, newDeposited(1))
+	Raise(second, newDeposited(2))
+
+	if err := repo.Save(ctx, first); err != nil {
+		t.Fatalf("First save failed: %v", err)
+	}
+	if err := repo.Save(ctx, second); !errors.Is(err, ErrConcurrency) {
+		t.Errorf("Second save should conflict, got %v", err)
+	}
+}
+
+func TestRepository_Snapshots(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	repo := NewRepository(store, WithCodec(accountCodec()), WithSnapshotEvery(3))
+
+	acc := &account{}
+	acc.SetID("acc-1")
+	for i := 0; i < 4; i++ {
+		Raise(acc, newDeposited(1))
+	}
+	repo.Save(ctx, acc)
+
+	snapshot, _ := store.LoadSnapshot(ctx, "acc-1")
+	if snapshot == nil || snapshot.Version != 4 {
+		t.Fatalf("Expected snapshot at version 4, got %+v", snapshot)
+	}
+
+	Raise(acc, newDeposited(1))
+	repo.Save(ctx, acc)
+
+	loaded := &account{}
+	if err := repo.Load(ctx, "acc-1", loaded); err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+
+	if loaded.Balance != 5 || loaded.Version() != 5 {
+		t.Errorf("Expected balance 5 at version 5, got %d at %d", loaded.Balance, loaded.Version())
+	}
+	if loaded.applied != 1 {
+		t.Errorf("Only events after the snapshot should be replayed, got %d", loaded.applied)
+	}
+}
+
+func TestRepository_SaveLeavesEventsUntouched(t *testing.T) {
+	ctx := context.Background()
+
+	bus := message.NewBus()
+	bus.Start(ctx)
+	defer bus.Stop(ctx)
+
+	published := make(chan touta.Message, 1)
+	bus.Subscribe("account.deposited", message.HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		published <- msg
+		return nil, nil
+	}))
+
+	store := NewMemoryStore()
+	repo := NewRepository(store, WithCodec(accountCodec()), WithPublisher(bus))
+
+	acc := &account{}
+	acc.SetID("acc-1")
+	event := newDeposited(10)
+	Raise(acc, event)
+	if err := repo.Save(ctx, acc); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	msg := <-published
+	if msg == touta.Message(event) || msg.Metadata()[MetaStreamID] != "acc-1" {
+		t.Errorf("expected a stamped copy of the event, got %#v", msg)
+	}
+	if _, ok := event.Metadata()[MetaStreamID]; ok {
+		t.Error("Save must not stamp the caller's event")
+	}
+
+	stored, _ := store.ReadStream(ctx, "acc-1", 0)
+	if _, ok := stored[0].Message.Metadata[MetaStreamID]; ok {
+		t.Error("stored events must not change after they are committed")
+	}
+}
+
+type failingSnapshots struct{ Store }
+
+func (failingSnapshots) SaveSnapshot(ctx context.Context, snapshot Snapshot) error {
+	return errors.New("disk full")
+}
+
+func TestRepository_SnapshotFailureStillPublishes(t *testing.T) {
+	ctx := context.Background()
+
+	bus := message.NewBus()
+	bus.Start(ctx)
+	defer bus.Stop(ctx)
+
+	published := make(chan touta.Message, 1)
+	bus.Subscribe("account.deposited", message.HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		published <- msg
+		return nil, nil
+	}))
+
+	repo := NewRepository(failingSnapshots{NewMemoryStore()}, WithCodec(accountCodec()),
+		WithPublisher(bus), WithSnapshotEvery(1))
+
+	acc := &account{}
+	acc.SetID("acc-1")
+	Raise(acc, newDeposited(10))
+	if err := repo.Save(ctx, acc); err == nil || !strings.Contains(err.Error(), "disk full") {
+		t.Errorf("expected the snapshot error, got %v", err)
+	}
+
+	select {
+	case <-published:
+	case <-time.After(time.Second):
+		t.Fatal("committed events must be published even when the snapshot fails")
+	}
+}
@@ -0,0 +1,137 @@
+package eventstore
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// NewFileStore opens (or creates) an event store in dir. Events are kept in
+// an append-only JSON lines file and snapshots in a separate JSON file.
+func NewFileStore(dir string) (Store, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create event store directory: %w", err)
+	}
+
+	s := newMemoryStore()
+	eventsPath := filepath.Join(dir, "events.jsonl")
+	snapshotsPath := filepath.Join(dir, "snapshots.json")
+
+	if err := loadEvents(s, eventsPath); err != nil {
+		return nil, err
+	}
+	if err := loadSnapshots(s, snapshotsPath); err != nil {
+		return nil, err
+	}
+
+	s.persistEvents = func(events []RecordedEvent) error {
+		return appendEvents(eventsPath, events)
+	}
+	s.persistSnapshot = func(snapshots map[string]Snapshot) error {
+		return writeSnapshots(snapshotsPath, snapshots)
+	}
+
+	return s, nil
+}
+
+// loadEvents replays the events file into s.
+func loadEvents(s *memoryStore, path string) error {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to open events file: %w", err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	line := 0
+	for scanner.Scan() {
+		line++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+
+		var event RecordedEvent
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			return fmt.Errorf("failed to parse events file line %d: %w", line, err)
+		}
+		s.index([]RecordedEvent{event})
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read events file: %w", err)
+	}
+	return nil
+}
+
+// appendEvents writes events to the end of the events file and syncs it.
+func appendEvents(path string, events []RecordedEvent) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open events file: %w", err)
+	}
+	defer f.Close()
+
+	var buf []byte
+	for _, event := range events {
+		data, err := json.Marshal(event)
+		if err != nil {
+			return fmt.Errorf("failed to encode event: %w", err)
+		}
+		buf = append(buf, data...)
+		buf = append(buf, '\n')
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat events file: %w", err)
+	}
+	if _, err := f.Write(buf); err != nil {
+		// Drop the partial batch so the file stays readable
+		f.Truncate(info.Size())
+		return fmt.Errorf("failed to write events file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		return fmt.Errorf("failed to sync events file: %w", err)
+	}
+	return nil
+}
+
+// loadSnapshots reads the snapshots file into s.
+func loadSnapshots(s *memoryStore, path string) error {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read snapshots file: %w", err)
+	}
+
+	if err := json.Unmarshal(data, &s.snapshots); err != nil {
+		return fmt.Errorf("failed to parse snapshots file: %w", err)
+	}
+	return nil
+}
+
+// writeSnapshots atomically rewrites the snapshots file.
+func writeSnapshots(path string, snapshots map[string]Snapshot) error {
+	data, err := json.Marshal(snapshots)
+	if err != nil {
+		return fmt.Errorf("failed to encode snapshots: %w", err)
+	}
+
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write snapshots file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to replace snapshots file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package eventstore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/toutaio/toutago/internal/message"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// Projection builds a read model from events.
+type Projection interface {
+	// Name identifies the projection and its checkpoint
+	Name() string
+
+	// Project handles a single event in global order
+	Project(ctx context.Context, event RecordedEvent, msg touta.Message) error
+}
+
+// CheckpointStore records the last global position each projection handled.
+type CheckpointStore interface {
+	// Load returns the checkpoint of a projection, zero if none
+	Load(name string) (uint64, error)
+
+	// Save stores the checkpoint of a projection
+	Save(name string, position uint64) error
+}
+
+// Runner keeps a projection up to date: it catches up from the event store
+// and then follows live events published on the message bus.
+type Runner struct {
+	projection  Projection
+	store       Store
+	bus         touta.MessageBus
+	checkpoints CheckpointStore
+	codec       *message.Codec
+	pattern     string
+
+	position uint64
+	sub      touta.Subscription
+	mu       sync.Mutex
+}
+
+// RunnerOption configures a runner created by NewRunner.
+type RunnerOption func(*Runner)
+
+// WithRunnerCodec sets the codec used to rebuild events.
+func WithRunnerCodec(codec *message.Codec) RunnerOption {
+	return func(r *Runner) {
+		r.codec = codec
+	}
+}
+
+// WithCheckpoints sets where the projection checkpoint is stored.
+func WithCheckpoints(checkpoints CheckpointStore) RunnerOption {
+	return func(r *Runner) {
+		r.checkpoints = checkpoints
+	}
+}
+
+// WithPattern limits the bus subscription to a slug or type (default "*").
+func WithPattern(pattern string) RunnerOption {
+	return func(r *Runner) {
+		r.pattern = pattern
+	}
+}
+
+// NewRunner creates a projection runner.
+func NewRunner(projection Projection, store Store, bus touta.MessageBus, opts ...RunnerOption) *Runner {
+	r := &Runner{
+		projection:  projection,
+		store:       store,
+		bus:         bus,
+		checkpoints: NewMemoryCheckpointStore(),
+		codec:       message.NewCodec(),
+		pattern:     "*",
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Start catches up from the stored checkpoint and subscribes to live events.
+func (r *Runner) Start(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.sub != nil {
+		return fmt.Errorf("projection %s already started", r.projection.Name())
+	}
+
+	position, err := r.checkpoints.Load(r.projection.Name())
+	if err != nil {
+		return fmt.Errorf("failed to load checkpoint of %s: %w", r.projection.Name(), err)
+	}
+	r.position = position
+
+	// Subscribe before catching up so no event slips between the two
+	sub, err := r.bus.Subscribe(r.pattern, message.HandlerFunc(r.handle))
+	if err != nil {
+		return err
+	}
+	r.sub = sub
+
+	if err := r.catchUp(ctx); err != nil {
+		sub.Unsubscribe()
+		r.sub = nil
+		return err
+	}
+	return nil
+}
+
+// Stop unsubscribes from the bus.
+func (r *Runner) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.sub == nil {
+		return nil
+	}
+	err := r.sub.Unsubscribe()
+	r.sub = nil
+	return err
+}
+
+// Position returns the last global position handled.
+func (r *Runner) Position() uint64 {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.position
+}
+
+// handle processes a live event from the bus.
+func (r *Runner) handle(ctx context.Context, msg touta.Message) (touta.Message, error) {
+	position, ok := positionOf(msg)
+	if !ok {
+		return nil, nil // not an event store event
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.sub == nil || position <= r.position {
+		return nil, nil // stopped, or already handled
+	}
+
+	// Events may arrive out of order on an async bus; reading from the store
+	// handles them in global order and fills any gap.
+	return nil, r.catchUp(ctx)
+}
+
+// catchUp projects every stored event after the checkpoint. The caller must hold mu.
+func (r *Runner) catchUp(ctx context.Context) error {
+	for {
+		events, err := r.store.ReadAll(ctx, r.position, 100)
+		if err != nil {
+			return fmt.Errorf("failed to read events for %s: %w", r.projection.Name(), err)
+		}
+		if len(events) == 0 {
+			return nil
+		}
+
+		for _, event := range events {
+			msg, err := r.codec.Decode(event.Message)
+			if err != nil {
+				return err
+			}
+			if err := r.projection.Project(ctx, event, msg); err != nil {
+				return fmt.Errorf("projection %s failed at position %d: %w", r.projection.Name(), event.Position, err)
+			}
+			if err := r.checkpoints.Save(r.projection.Name(), event.Position); err != nil {
+				return fmt.Errorf("failed to save checkpoint of %s: %w", r.projection.Name(), err)
+			}
+			r.position = event.Position
+		}
+	}
+}
+
+// positionOf reads the global position stamped by a Repository.
+func positionOf(msg touta.Message) (uint64, bool) {
+	meta := msg.Metadata()
+	if meta == nil {
+		return 0, false
+	}
+
+	switch v := meta[MetaPosition].(type) {
+	case uint64:
+		return v, true
+	case int:
+		return uint64(v), v >= 0
+	case int64:
+		return uint64(v), v >= 0
+	case float64:
+		return uint64(v), v >= 0
+	}
+	return 0, false
+}
+
+// memoryCheckpointStore implements CheckpointStore in memory.
+type memoryCheckpointStore struct {
+	positions map[string]uint64
+	persist   func(map[string]uint64) error
+	mu        sync.Mutex
+}
+
+// NewMemoryCheckpointStore creates an in-memory checkpoint store.
+func NewMemoryCheckpointStore() CheckpointStore {
+	return &memoryCheckpointStore{
+		positions: make(map[string]uint64),
+	}
+}
+
+// NewFileCheckpointStore creates a checkpoint store kept in a JSON file.
+func NewFileCheckpointStore(path string) (CheckpointStore, error) {
+	s := &memoryCheckpointStore{
+		positions: make(map[string]uint64),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read checkpoint file: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &s.positions); err != nil {
+			return nil, fmt.Errorf("failed to parse checkpoint file: %w", err)
+		}
+	}
+
+	s.persist = func(positions map[string]uint64) error {
+		data, err := json.Marshal(positions)
+		if err != nil {
+			return fmt.Errorf("failed to encode checkpoints: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create checkpoint directory: %w", err)
+		}
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, data, 0644); err != nil {
+			return fmt.Errorf("failed to write checkpoint file: %w", err)
+		}
+		return os.Rename(tmp, path)
+	}
+
+	return s, nil
+}
+
+// Load returns the checkpoint of a projection.
+func (s *memoryCheckpointStore) Load(name string) (uint64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.positions[name], nil
+}
+
+// Save stores the checkpoint of a projection.
+func (s *memoryCheckpointStore) Save(name string, position uint64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous := s.positions[name]
+	s.positions[name] = position
+	if s.persist != nil {
+		if err := s.persist(s.positions); err != nil {
+			s.positions[name] = previous
+			return err
+		}
+	}
+	return nil
+}
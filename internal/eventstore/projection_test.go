@@ -0,0 +1,109 @@
+package eventstore
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/toutaio/toutago/internal/message"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// balances is a read model summing deposits per account.
+type balances struct {
+	mu     sync.Mutex
+	totals map[string]int
+}
+
+func (b *balances) Name() string {
+	return "balances"
+}
+
+func (b *balances) Project(ctx context.Context, event RecordedEvent, msg touta.Message) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if d, ok := msg.(*deposited); ok {
+		b.totals[event.StreamID] += d.Amount
+	}
+	return nil
+}
+
+func (b *balances) total(id string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.totals[id]
+}
+
+func TestRunner_CatchUpAndFollow(t *testing.T) {
+	ctx := context.Background()
+
+	bus := message.NewBus()
+	bus.Start(ctx)
+	defer bus.Stop(ctx)
+
+	store := NewMemoryStore()
+	repo := NewRepository(store, WithCodec(accountCodec()), WithPublisher(bus))
+
+	acc := &account{}
+	acc.SetID("acc-1")
+	Raise(acc, newDeposited(10))
+	repo.Save(ctx, acc)
+
+	checkpoints, err := NewFileCheckpointStore(filepath.Join(t.TempDir(), "checkpoints.json"))
+	if err != nil {
+		t.Fatalf("NewFileCheckpointStore failed: %v", err)
+	}
+
+	view := &balances{totals: make(map[string]int)}
+	runner := NewRunner(view, store, bus, WithRunnerCodec(accountCodec()), WithCheckpoints(checkpoints))
+	if err := runner.Start(ctx); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer runner.Stop(ctx)
+
+	if view.total("acc-1") != 10 {
+		t.Fatalf("Runner should catch up on existing events, got %d", view.total("acc-1"))
+	}
+
+	Raise(acc, newDeposited(5))
+	repo.Save(ctx, acc)
+
+	deadline := time.Now().Add(time.Second)
+	for runner.Position() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if view.total("acc-1") != 15 {
+		t.Errorf("Runner should follow live events, got %d", view.total("acc-1"))
+	}
+
+	if position, _ := checkpoints.Load("balances"); position != 2 {
+		t.Errorf("Expected checkpoint 2, got %d", position)
+	}
+}
+
+func TestRunner_ResumesFromCheckpoint(t *testing.T) {
+	ctx := context.Background()
+
+	bus := message.NewBus()
+	bus.Start(ctx)
+	defer bus.Stop(ctx)
+
+	store := NewMemoryStore()
+	store.Append(ctx, "acc-1", NoStream, newDeposited(10), newDeposited(20))
+
+	checkpoints := NewMemoryCheckpointStore()
+	checkpoints.Save("balances", 1)
+
+	view := &balances{totals: make(map[string]int)}
+	runner := NewRunner(view, store, bus, WithRunnerCodec(accountCodec()), WithCheckpoints(checkpoints))
+	runner.Start(ctx)
+	defer runner.Stop(ctx)
+
+	if view.total("acc-1") != 20 {
+		t.Errorf("Only events after the checkpoint should be projected, got %d", view.total("acc-1"))
+	}
+}
@@ -0,0 +1,261 @@
+// Package eventstore persists domain events and rebuilds state from them:
+// an append-only store with optimistic concurrency per stream, aggregate
+// helpers, snapshots, and projections fed by the message bus.
+package eventstore
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/toutaio/toutago/internal/message"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// Expected version values for Append.
+const (
+	// AnyVersion skips the concurrency check
+	AnyVersion int64 = -1
+
+	// NoStream requires that the stream does not exist yet
+	NoStream int64 = 0
+)
+
+// Metadata keys stamped on events published by a Repository.
+const (
+	MetaStreamID      = "stream_id"
+	MetaStreamVersion = "stream_version"
+	MetaPosition      = "event_position"
+)
+
+// ErrConcurrency is matched by every ConcurrencyError.
+var ErrConcurrency = errors.New("stream version conflict")
+
+// ConcurrencyError reports an optimistic concurrency failure on Append.
+type ConcurrencyError struct {
+	StreamID string
+	Expected int64
+	Actual   uint64
+}
+
+// Error implements the error interface.
+func (e *ConcurrencyError) Error() string {
+	return fmt.Sprintf("stream %s: expected version %d, actual %d", e.StreamID, e.Expected, e.Actual)
+}
+
+// Is makes errors.Is(err, ErrConcurrency) succeed.
+func (e *ConcurrencyError) Is(target error) bool {
+	return target == ErrConcurrency
+}
+
+// RecordedEvent is an event as persisted in the store.
+type RecordedEvent struct {
+	StreamID   string           `json:"stream_id"`
+	Version    uint64           `json:"version"`  // 1-based position within the stream
+	Position   uint64           `json:"position"` // 1-based global position
+	Message    message.Envelope `json:"message"`
+	RecordedAt time.Time        `json:"recorded_at"`
+}
+
+// Snapshot is the serialised state of an aggregate at a stream version.
+type Snapshot struct {
+	StreamID string          `json:"stream_id"`
+	Version  uint64          `json:"version"`
+	State    json.RawMessage `json:"state"`
+}
+
+// Store is an append-only event store.
+type Store interface {
+	// Append adds events to a stream if its version matches expectedVersion
+	Append(ctx context.Context, streamID string, expectedVersion int64, events ...touta.Message) ([]RecordedEvent, error)
+
+	// ReadStream returns the events of a stream after fromVersion
+	ReadStream(ctx context.Context, streamID string, fromVersion uint64) ([]RecordedEvent, error)
+
+	// ReadAll returns up to limit events after the global position from;
+	// a limit of zero or less returns all of them
+	ReadAll(ctx context.Context, from uint64, limit int) ([]RecordedEvent, error)
+
+	// SaveSnapshot stores the latest snapshot of a stream
+	SaveSnapshot(ctx context.Context, snapshot Snapshot) error
+
+	// LoadSnapshot returns the latest snapshot of a stream, or nil
+	LoadSnapshot(ctx context.Context, streamID string) (*Snapshot, error)
+}
+
+// memoryStore implements Store in memory. The file store builds on it and
+// sets the persist hooks to write changes to disk.
+type memoryStore struct {
+	events    []RecordedEvent
+	streams   map[string][]int // indexes into events
+	snapshots map[string]Snapshot
+	codec     *message.Codec
+	now       func() time.Time
+
+	persistEvents   func([]RecordedEvent) error
+	persistSnapshot func(map[string]Snapshot) error
+
+	mu sync.RWMutex
+}
+
+// NewMemoryStore creates an in-memory event store.
+func NewMemoryStore() Store {
+	return newMemoryStore()
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		streams:   make(map[string][]int),
+		snapshots: make(map[string]Snapshot),
+		codec:     message.NewCodec(),
+		now:       func() time.Time { return time.Now().UTC() },
+	}
+}
+
+// Append adds events to a stream.
+func (s *memoryStore) Append(ctx context.Context, streamID string, expectedVersion int64, events ...touta.Message) ([]RecordedEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if streamID == "" {
+		return nil, fmt.Errorf("stream id is required")
+	}
+
+	envelopes := make([]message.Envelope, len(events))
+	for i, event := range events {
+		env, err := s.codec.Encode(event)
+		if err != nil {
+			return nil, err
+		}
+		envelopes[i] = env
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current := uint64(len(s.streams[streamID]))
+	if expectedVersion != AnyVersion && uint64(expectedVersion) != current {
+		return nil, &ConcurrencyError{StreamID: streamID, Expected: expectedVersion, Actual: current}
+	}
+
+	recorded := make([]RecordedEvent, len(envelopes))
+	now := s.now()
+	for i, env := range envelopes {
+		recorded[i] = RecordedEvent{
+			StreamID:   streamID,
+			Version:    current + uint64(i) + 1,
+			Position:   uint64(len(s.events) + i + 1),
+			Message:    env,
+			RecordedAt: now,
+		}
+	}
+
+	if s.persistEvents != nil {
+		if err := s.persistEvents(recorded); err != nil {
+			return nil, err
+		}
+	}
+
+	s.index(recorded)
+
+	// Callers get their own metadata, so the stored events never change
+	result := make([]RecordedEvent, len(recorded))
+	for i, event := range recorded {
+		result[i] = event
+		result[i].Message.Metadata = message.CopyMetadata(event.Message.Metadata)
+	}
+	return result, nil
+}
+
+// index adds recorded events to the in-memory log. The caller must hold mu.
+func (s *memoryStore) index(recorded []RecordedEvent) {
+	for _, event := range recorded {
+		s.streams[event.StreamID] = append(s.streams[event.StreamID], len(s.events))
+		s.events = append(s.events, event)
+	}
+}
+
+// ReadStream returns the events of a stream after fromVersion.
+func (s *memoryStore) ReadStream(ctx context.Context, streamID string, fromVersion uint64) ([]RecordedEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	indexes := s.streams[streamID]
+	if fromVersion >= uint64(len(indexes)) {
+		return nil, nil
+	}
+
+	events := make([]RecordedEvent, 0, len(indexes)-int(fromVersion))
+	for _, i := range indexes[fromVersion:] {
+		events = append(events, s.events[i])
+	}
+	return events, nil
+}
+
+// ReadAll returns events after the global position from.
+func (s *memoryStore) ReadAll(ctx context.Context, from uint64, limit int) ([]RecordedEvent, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if from >= uint64(len(s.events)) {
+		return nil, nil
+	}
+
+	events := s.events[from:]
+	if limit > 0 && len(events) > limit {
+		events = events[:limit]
+	}
+	return append([]RecordedEvent(nil), events...), nil
+}
+
+// SaveSnapshot stores the latest snapshot of a stream.
+func (s *memoryStore) SaveSnapshot(ctx context.Context, snapshot Snapshot) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, existed := s.snapshots[snapshot.StreamID]
+	s.snapshots[snapshot.StreamID] = snapshot
+
+	if s.persistSnapshot != nil {
+		if err := s.persistSnapshot(s.snapshots); err != nil {
+			if existed {
+				s.snapshots[snapshot.StreamID] = previous
+			} else {
+				delete(s.snapshots, snapshot.StreamID)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// LoadSnapshot returns the latest snapshot of a stream.
+func (s *memoryStore) LoadSnapshot(ctx context.Context, streamID string) (*Snapshot, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	snapshot, ok := s.snapshots[streamID]
+	if !ok {
+		return nil, nil
+	}
+	return &snapshot, nil
+}
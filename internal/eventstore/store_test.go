@@ -0,0 +1,112 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/toutaio/toutago/internal/message"
+)
+
+func event(slug string) *message.BaseMessage {
+	return &message.BaseMessage{MessageSlug: slug, MessageType: "event"}
+}
+
+func TestStore_AppendAndRead(t *testing.T) {
+	ctx := context.Background()
+
+	stores := map[string]func(t *testing.T) Store{
+		"memory": func(t *testing.T) Store { return NewMemoryStore() },
+		"file": func(t *testing.T) Store {
+			s, err := NewFileStore(t.TempDir())
+			if err != nil {
+				t.Fatalf("NewFileStore failed: %v", err)
+			}
+			return s
+		},
+	}
+
+	for name, newStore := range stores {
+		t.Run(name, func(t *testing.T) {
+			store := newStore(t)
+
+			if _, err := store.Append(ctx, "cart-1", NoStream, event("cart.created"), event("item.added")); err != nil {
+				t.Fatalf("Append failed: %v", err)
+			}
+			if _, err := store.Append(ctx, "cart-2", NoStream, event("cart.created")); err != nil {
+				t.Fatalf("Append failed: %v", err)
+			}
+			recorded, err := store.Append(ctx, "cart-1", 2, event("cart.checked_out"))
+			if err != nil {
+				t.Fatalf("Append failed: %v", err)
+			}
+			if recorded[0].Version != 3 || recorded[0].Position != 4 {
+				t.Errorf("Expected version 3 at position 4, got %d at %d", recorded[0].Version, recorded[0].Position)
+			}
+
+			stream, _ := store.ReadStream(ctx, "cart-1", 0)
+			if len(stream) != 3 || stream[2].Message.Slug != "cart.checked_out" {
+				t.Errorf("Unexpected stream contents: %+v", stream)
+			}
+
+			tail, _ := store.ReadStream(ctx, "cart-1", 2)
+			if len(tail) != 1 {
+				t.Errorf("Expected 1 event after version 2, got %d", len(tail))
+			}
+
+			all, _ := store.ReadAll(ctx, 1, 2)
+			if len(all) != 2 || all[0].Position != 2 || all[1].StreamID != "cart-2" {
+				t.Errorf("Unexpected ReadAll page: %+v", all)
+			}
+		})
+	}
+}
+
+func TestStore_OptimisticConcurrency(t *testing.T) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+
+	store.Append(ctx, "cart-1", NoStream, event("cart.created"))
+
+	_, err := store.Append(ctx, "cart-1", NoStream, event("cart.created"))
+	if !errors.Is(err, ErrConcurrency) {
+		t.Fatalf("Expected ErrConcurrency, got %v", err)
+	}
+
+	var conflict *ConcurrencyError
+	if !errors.As(err, &conflict) || conflict.Actual != 1 {
+		t.Errorf("Expected conflict at version 1, got %v", err)
+	}
+
+	if _, err := store.Append(ctx, "cart-1", AnyVersion, event("item.added")); err != nil {
+		t.Errorf("AnyVersion should skip the check, got %v", err)
+	}
+}
+
+func TestFileStore_Reopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store, _ := NewFileStore(dir)
+	store.Append(ctx, "cart-1", NoStream, event("cart.created"), event("item.added"))
+	store.SaveSnapshot(ctx, Snapshot{StreamID: "cart-1", Version: 2, State: []byte(`{"items":1}`)})
+
+	reopened, err := NewFileStore(dir)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+
+	stream, _ := reopened.ReadStream(ctx, "cart-1", 0)
+	if len(stream) != 2 {
+		t.Fatalf("Expected 2 persisted events, got %d", len(stream))
+	}
+
+	if _, err := reopened.Append(ctx, "cart-1", 2, event("cart.checked_out")); err != nil {
+		t.Errorf("Reopened store should continue the stream, got %v", err)
+	}
+
+	snapshot, _ := reopened.LoadSnapshot(ctx, "cart-1")
+	if snapshot == nil || snapshot.Version != 2 {
+		t.Errorf("Expected persisted snapshot, got %+v", snapshot)
+	}
+}
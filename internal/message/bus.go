@@ -2,8 +2,14 @@ package message
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"runtime"
+	"strconv"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/toutaio/toutago/pkg/touta"
 )
@@ -33,50 +39,147 @@ func (m *BaseMessage) Metadata() map[string]interface{} {
 	return m.Meta
 }
 
+// busState tracks the lifecycle of a bus.
+type busState int
+
+const (
+	stateIdle busState = iota
+	stateRunning
+	stateStopped
+)
+
+// ErrBusNotStarted is returned when publishing before Start.
+var ErrBusNotStarted = errors.New("message bus not started")
+
+// ErrBusStopped is returned when publishing after Stop.
+var ErrBusStopped = errors.New("message bus stopped")
+
+// DrainError is returned by Stop when the deadline passed before all
+// queued and running handlers finished.
+type DrainError struct {
+	Abandoned int   // queued messages that were never dispatched
+	InFlight  int   // handlers still running when Stop returned
+	Err       error // the context error that ended the drain
+}
+
+// Error implements the error interface.
+func (e *DrainError) Error() string {
+	return fmt.Sprintf("message bus drain interrupted: %d messages abandoned, %d handlers still running: %v", e.Abandoned, e.InFlight, e.Err)
+}
+
+// Unwrap returns the context error.
+func (e *DrainError) Unwrap() error {
+	return e.Err
+}
+
 // bus implements the MessageBus interface using channels.
 type bus struct {
-	subscribers map[string][]touta.MessageHandler
-	messages    chan messageEnvelope
-	wg          sync.WaitGroup
+	subscribers map[string][]*subscription
 	mu          sync.RWMutex
-	ctx         context.Context
-	cancel      context.CancelFunc
-	started     bool
+
+	// stateMu guards state and run, and is held while sending on the run's
+	// queue, so Stop can never close the channel underneath a Publish.
+	stateMu sync.RWMutex
+	state   busState
+	run     *run
+
+	// concurrentSync runs PublishSync handlers in parallel.
+	concurrentSync bool
+
+	metrics  *metrics
+	recorder Recorder
+	inFlight atomic.Int64
+
+	middleware []Middleware
+	validator  *Validator
+}
+
+// Option configures a message bus created by NewBus.
+type Option func(*bus)
+
+// WithConcurrentSync makes PublishSync invoke all matching handlers
+// concurrently instead of one after another.
+func WithConcurrentSync(enabled bool) Option {
+	return func(b *bus) {
+		b.concurrentSync = enabled
+	}
+}
+
+// WithRecorder forwards instrumentation events to r in addition to the
+// built-in metrics returned by Inspector.Stats.
+func WithRecorder(r Recorder) Option {
+	return func(b *bus) {
+		b.recorder = append(b.recorder.(recorders), r)
+	}
+}
+
+// HandlerError reports a failure of a single handler during dispatch.
+type HandlerError struct {
+	Slug    string // slug of the message being handled
+	Handler string // name of the failing handler
+	Err     error  // error returned by the handler
+}
+
+// Error implements the error interface.
+func (e *HandlerError) Error() string {
+	return fmt.Sprintf("handler %s failed for %s: %v", e.Handler, e.Slug, e.Err)
+}
+
+// Unwrap returns the underlying handler error.
+func (e *HandlerError) Unwrap() error {
+	return e.Err
+}
+
+// run holds the async queue of one Start/Stop cycle, so a restarted bus
+// never shares state with handlers left over from a previous drain.
+type run struct {
+	messages  chan messageEnvelope
+	abandon   chan struct{} // closed when the drain deadline passes
+	loopDone  chan struct{} // closed when process returns
+	handlers  sync.WaitGroup
+	running   atomic.Int64
+	abandoned int // written by process, read after loopDone
 }
 
 // messageEnvelope wraps a message with its context.
 type messageEnvelope struct {
-	ctx  context.Context
-	msg  touta.Message
-	sync bool
-	done chan error
+	ctx context.Context
+	msg touta.Message
 }
 
 // NewBus creates a new message bus.
-func NewBus() touta.MessageBus {
-	ctx, cancel := context.WithCancel(context.Background())
-	return &bus{
-		subscribers: make(map[string][]touta.MessageHandler),
-		messages:    make(chan messageEnvelope, 100),
-		ctx:         ctx,
-		cancel:      cancel,
+func NewBus(opts ...Option) touta.MessageBus {
+	b := &bus{
+		subscribers: make(map[string][]*subscription),
+		metrics:     newMetrics(),
 	}
+	b.recorder = recorders{b.metrics}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
 }
 
 // Publish sends a message asynchronously to all subscribers.
 func (b *bus) Publish(ctx context.Context, msg touta.Message) error {
-	if !b.started {
-		return fmt.Errorf("message bus not started")
+	b.stateMu.RLock()
+	defer b.stateMu.RUnlock()
+
+	if err := b.checkRunning(); err != nil {
+		return err
 	}
 
+	if err := b.prepare(ctx, msg); err != nil {
+		return err
+	}
 	envelope := messageEnvelope{
-		ctx:  ctx,
-		msg:  msg,
-		sync: false,
+		ctx: ctx,
+		msg: msg,
 	}
 
 	select {
-	case b.messages <- envelope:
+	case b.run.messages <- envelope:
+		b.recorder.Published(msg.Slug())
 		return nil
 	case <-ctx.Done():
 		return ctx.Err()
@@ -84,85 +187,261 @@ func (b *bus) Publish(ctx context.Context, msg touta.Message) error {
 }
 
 // PublishSync sends a message synchronously and waits for handlers to complete.
+// Handlers run on the caller's goroutine (or in parallel when the bus was
+// created WithConcurrentSync), so a slow handler never stalls async traffic.
+// All handler failures are returned joined, each wrapped in a HandlerError.
 func (b *bus) PublishSync(ctx context.Context, msg touta.Message) error {
-	if !b.started {
-		return fmt.Errorf("message bus not started")
+	_, err := b.dispatchSync(ctx, msg)
+	return err
+}
+
+// dispatchSync runs the handlers matching msg like PublishSync and returns
+// their replies, in subscription order, with nil for handlers that did not
+// reply or did not run.
+func (b *bus) dispatchSync(ctx context.Context, msg touta.Message) ([]touta.Message, error) {
+	// The dispatch is counted with the run's handlers before the state
+	// lock is released, so Stop waits for it to finish
+	b.stateMu.RLock()
+	err := b.checkRunning()
+	r := b.run
+	if err == nil {
+		r.handlers.Add(1)
+	}
+	b.stateMu.RUnlock()
+	if err != nil {
+		return nil, err
 	}
+	defer r.handlers.Done()
 
-	done := make(chan error, 1)
-	envelope := messageEnvelope{
-		ctx:  ctx,
-		msg:  msg,
-		sync: true,
-		done: done,
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
 
-	select {
-	case b.messages <- envelope:
-		// Wait for processing to complete
-		select {
-		case err := <-done:
+	if err := b.prepare(ctx, msg); err != nil {
+		return nil, err
+	}
+	b.recorder.Published(msg.Slug())
+
+	subs := b.getHandlers(msg)
+	replies := make([]touta.Message, len(subs))
+	errs := make([]error, len(subs))
+
+	if b.concurrentSync {
+		var wg sync.WaitGroup
+		for i, sub := range subs {
+			if !sub.claim() {
+				continue
+			}
+			wg.Add(1)
+			go func(i int, sub *subscription) {
+				defer wg.Done()
+				replies[i], errs[i] = r.invoke(b, ctx, sub, msg)
+			}(i, sub)
+		}
+		wg.Wait()
+	} else {
+		for i, sub := range subs {
+			if sub.claim() {
+				replies[i], errs[i] = r.invoke(b, ctx, sub, msg)
+			}
+		}
+	}
+
+	return replies, errors.Join(errs...)
+}
+
+// invoke runs a handler of a sync dispatch, counting it as running for
+// the DrainError of Stop.
+func (r *run) invoke(b *bus, ctx context.Context, sub *subscription, msg touta.Message) (touta.Message, error) {
+	r.running.Add(1)
+	defer r.running.Add(-1)
+	return b.invoke(ctx, sub, msg)
+}
+
+// prepare validates msg and stamps its ID, schema version and trace.
+func (b *bus) prepare(ctx context.Context, msg touta.Message) error {
+	if b.validator != nil {
+		if err := b.validator.Validate(msg); err != nil {
 			return err
-		case <-ctx.Done():
-			return ctx.Err()
 		}
-	case <-ctx.Done():
-		return ctx.Err()
 	}
+	EnsureID(msg)
+	stampVersion(msg)
+	InjectTrace(ctx, msg)
+	return nil
+}
+
+// invoke runs the handler of sub through the bus middleware, records its
+// metrics and wraps its error in a HandlerError. The handler context carries
+// the message's trace span. The handler's reply is returned on success.
+func (b *bus) invoke(ctx context.Context, sub *subscription, msg touta.Message) (touta.Message, error) {
+	b.inFlight.Add(1)
+	defer b.inFlight.Add(-1)
+
+	handler := sub.handler
+	d := &dispatch{recorder: b.recorder, slug: msg.Slug(), handler: handlerName(handler), subscription: sub.key}
+	ctx = context.WithValue(extractTrace(ctx, msg), dispatchKey{}, d)
+
+	for i := len(b.middleware) - 1; i >= 0; i-- {
+		handler = b.middleware[i](handler)
+	}
+
+	start := time.Now()
+	reply, err := handler.Handle(ctx, msg)
+	b.recorder.Handled(d.slug, d.handler, time.Since(start), err)
+
+	if err != nil {
+		return nil, &HandlerError{
+			Slug:    d.slug,
+			Handler: d.handler,
+			Err:     err,
+		}
+	}
+	return reply, nil
 }
 
 // Subscribe registers a handler for messages matching a pattern.
-func (b *bus) Subscribe(pattern string, handler touta.MessageHandler) error {
-	b.mu.Lock()
-	defer b.mu.Unlock()
+func (b *bus) Subscribe(pattern string, handler touta.MessageHandler) (touta.Subscription, error) {
+	return b.add(newSubscription(b, pattern, handler, false))
+}
 
-	if b.subscribers[pattern] == nil {
-		b.subscribers[pattern] = make([]touta.MessageHandler, 0)
+// SubscribeOnce registers a handler that receives at most one message.
+func (b *bus) SubscribeOnce(pattern string, handler touta.MessageHandler) (touta.Subscription, error) {
+	return b.add(newSubscription(b, pattern, handler, true))
+}
+
+// SubscribeContext registers a handler that is removed when ctx is done.
+func (b *bus) SubscribeContext(ctx context.Context, pattern string, handler touta.MessageHandler) (touta.Subscription, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
 	}
-	b.subscribers[pattern] = append(b.subscribers[pattern], handler)
-	return nil
+
+	sub, err := b.add(newSubscription(b, pattern, handler, false))
+	if err != nil {
+		return nil, err
+	}
+	sub.bindContext(ctx)
+	return sub, nil
 }
 
 // Unsubscribe removes a handler for a specific pattern.
 func (b *bus) Unsubscribe(pattern string, handler touta.MessageHandler) error {
+	if handler == nil || !reflect.TypeOf(handler).Comparable() {
+		return fmt.Errorf("handler %T is not comparable, use the Subscription returned by Subscribe", handler)
+	}
+
+	b.mu.RLock()
+	var found *subscription
+	for _, sub := range b.subscribers[pattern] {
+		if sub.handler == handler {
+			found = sub
+			break
+		}
+	}
+	b.mu.RUnlock()
+
+	if found != nil {
+		b.remove(found)
+	}
+	return nil
+}
+
+// add registers a subscription.
+func (b *bus) add(sub *subscription) (*subscription, error) {
+	if sub.handler == nil {
+		return nil, fmt.Errorf("handler is required")
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub.key = subscriptionKey(sub, b.subscribers[sub.pattern])
+	b.subscribers[sub.pattern] = append(b.subscribers[sub.pattern], sub)
+	return sub, nil
+}
+
+// subscriptionKey identifies sub by its pattern and handler name. When
+// other subscriptions of the pattern have a handler of the same name, the
+// lowest ordinal none of them uses is appended, so subscriptions made in
+// the same order get the same keys after a restart.
+func subscriptionKey(sub *subscription, others []*subscription) string {
+	base := sub.pattern + " " + handlerName(sub.handler)
+	used := make(map[string]bool, len(others))
+	for _, other := range others {
+		used[other.key] = true
+	}
+
+	key := base
+	for n := 2; used[key]; n++ {
+		key = base + "#" + strconv.Itoa(n)
+	}
+	return key
+}
+
+// remove unregisters a subscription and closes its Done channel.
+func (b *bus) remove(sub *subscription) {
 	b.mu.Lock()
 	defer b.mu.Unlock()
 
-	handlers := b.subscribers[pattern]
-	for i, h := range handlers {
-		if fmt.Sprintf("%p", h) == fmt.Sprintf("%p", handler) {
-			b.subscribers[pattern] = append(handlers[:i], handlers[i+1:]...)
+	subs := b.subscribers[sub.pattern]
+	for i, s := range subs {
+		if s == sub {
+			// Copy so slices handed out by getHandlers are never mutated
+			remaining := make([]*subscription, 0, len(subs)-1)
+			remaining = append(remaining, subs[:i]...)
+			remaining = append(remaining, subs[i+1:]...)
+			if len(remaining) == 0 {
+				delete(b.subscribers, sub.pattern)
+			} else {
+				b.subscribers[sub.pattern] = remaining
+			}
 			break
 		}
 	}
-	return nil
+	sub.close()
 }
 
-// Start begins processing messages.
+// Start begins processing messages. A stopped bus can be started again;
+// its subscriptions are kept.
 func (b *bus) Start(ctx context.Context) error {
-	if b.started {
+	b.stateMu.Lock()
+	defer b.stateMu.Unlock()
+
+	if b.state == stateRunning {
 		return fmt.Errorf("message bus already started")
 	}
 
-	b.started = true
-	b.wg.Add(1)
-	go b.process()
+	b.state = stateRunning
+	b.run = &run{
+		messages: make(chan messageEnvelope, 100),
+		abandon:  make(chan struct{}),
+		loopDone: make(chan struct{}),
+	}
+	go b.process(b.run)
 	return nil
 }
 
-// Stop gracefully shuts down the message bus.
+// Stop drains the message bus. New messages are rejected with
+// ErrBusStopped at once, while queued messages are still dispatched and
+// running handlers, including those of PublishSync and Request calls, are
+// given until ctx is done to finish. If the deadline
+// passes first, the remaining queue is dropped and a *DrainError reports
+// how many messages were abandoned.
 func (b *bus) Stop(ctx context.Context) error {
-	if !b.started {
+	b.stateMu.Lock()
+	if b.state != stateRunning {
+		b.stateMu.Unlock()
 		return nil
 	}
+	b.state = stateStopped
+	r := b.run
+	close(r.messages)
+	b.stateMu.Unlock()
 
-	b.cancel()
-	close(b.messages)
-
-	// Wait for processing to complete with timeout
 	done := make(chan struct{})
 	go func() {
-		b.wg.Wait()
+		<-r.loopDone
+		r.handlers.Wait()
 		close(done)
 	}()
 
@@ -170,51 +449,62 @@ func (b *bus) Stop(ctx context.Context) error {
 	case <-done:
 		return nil
 	case <-ctx.Done():
-		return ctx.Err()
+		close(r.abandon)
+		<-r.loopDone
+		return &DrainError{
+			Abandoned: r.abandoned,
+			InFlight:  int(r.running.Load()),
+			Err:       ctx.Err(),
+		}
 	}
 }
 
-// process is the main message processing loop.
-func (b *bus) process() {
-	defer b.wg.Done()
+// checkRunning reports whether messages can be published.
+// The caller must hold stateMu.
+func (b *bus) checkRunning() error {
+	switch b.state {
+	case stateIdle:
+		return ErrBusNotStarted
+	case stateStopped:
+		return ErrBusStopped
+	}
+	return nil
+}
 
-	for envelope := range b.messages {
-		handlers := b.getHandlers(envelope.msg)
+// process is the main message processing loop of a run. Once the drain
+// deadline passes it only counts the messages left in the queue.
+func (b *bus) process(r *run) {
+	defer close(r.loopDone)
 
-		if envelope.sync {
-			// Synchronous processing
-			var errs []error
-			for _, handler := range handlers {
-				if _, err := handler.Handle(envelope.ctx, envelope.msg); err != nil {
-					errs = append(errs, err)
-				}
-			}
+	for envelope := range r.messages {
+		select {
+		case <-r.abandon:
+			r.abandoned++
+			continue
+		default:
+		}
 
-			if len(errs) > 0 {
-				envelope.done <- errs[0] // Return first error
-			} else {
-				envelope.done <- nil
-			}
-		} else {
-			// Asynchronous processing
-			for _, handler := range handlers {
-				h := handler // Capture for goroutine
-				b.wg.Add(1)
-				go func() {
-					defer b.wg.Done()
-					h.Handle(envelope.ctx, envelope.msg)
-				}()
+		for _, sub := range b.getHandlers(envelope.msg) {
+			if !sub.claim() {
+				continue
 			}
+			r.handlers.Add(1)
+			r.running.Add(1)
+			go func(env messageEnvelope, sub *subscription) {
+				defer r.handlers.Done()
+				defer r.running.Add(-1)
+				b.invoke(env.ctx, sub, env.msg)
+			}(envelope, sub)
 		}
 	}
 }
 
-// getHandlers returns all handlers matching the message.
-func (b *bus) getHandlers(msg touta.Message) []touta.MessageHandler {
+// getHandlers returns all subscriptions matching the message.
+func (b *bus) getHandlers(msg touta.Message) []*subscription {
 	b.mu.RLock()
 	defer b.mu.RUnlock()
 
-	var handlers []touta.MessageHandler
+	var handlers []*subscription
 
 	// Match by exact slug
 	if slugHandlers, ok := b.subscribers[msg.Slug()]; ok {
@@ -241,3 +531,24 @@ type HandlerFunc func(context.Context, touta.Message) (touta.Message, error)
 func (f HandlerFunc) Handle(ctx context.Context, msg touta.Message) (touta.Message, error) {
 	return f(ctx, msg)
 }
+
+// handlerName returns a human readable name for a handler, used in errors.
+func handlerName(handler touta.MessageHandler) string {
+	switch h := handler.(type) {
+	case *routedHandler:
+		return h.route.Handler
+	case *typedHandler:
+		return h.name
+	case HandlerFunc:
+		return funcName(h)
+	}
+	return fmt.Sprintf("%T", handler)
+}
+
+// funcName returns the fully qualified name of a function value.
+func funcName(f interface{}) string {
+	if fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer()); fn != nil {
+		return fn.Name()
+	}
+	return fmt.Sprintf("%T", f)
+}
@@ -2,6 +2,9 @@ package message
 
 import (
 	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -14,16 +17,25 @@ type testMessage struct {
 }
 
 type testHandler struct {
+	mu       sync.Mutex
 	received bool
 	msg      touta.Message
 }
 
 func (h *testHandler) Handle(ctx context.Context, msg touta.Message) (touta.Message, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
 	h.received = true
 	h.msg = msg
 	return nil, nil
 }
 
+func (h *testHandler) wasReceived() bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return h.received
+}
+
 func TestBus_PublishAndSubscribe(t *testing.T) {
 	bus := NewBus()
 	if err := bus.Start(context.Background()); err != nil {
@@ -48,7 +60,7 @@ func TestBus_PublishAndSubscribe(t *testing.T) {
 
 	time.Sleep(50 * time.Millisecond)
 
-	if !handler.received {
+	if !handler.wasReceived() {
 		t.Fatal("Handler should have received message")
 	}
 }
@@ -74,7 +86,7 @@ func TestBus_PublishSync(t *testing.T) {
 		t.Fatalf("PublishSync failed: %v", err)
 	}
 
-	if !handler.received {
+	if !handler.wasReceived() {
 		t.Fatal("Handler should have received message synchronously")
 	}
 }
@@ -100,7 +112,7 @@ func TestBus_Unsubscribe(t *testing.T) {
 	bus.Publish(context.Background(), msg)
 	time.Sleep(50 * time.Millisecond)
 
-	if handler.received {
+	if handler.wasReceived() {
 		t.Fatal("Handler should not receive after unsubscribe")
 	}
 }
@@ -128,7 +140,390 @@ func TestBus_MultipleHandlers(t *testing.T) {
 	bus.Publish(context.Background(), msg)
 	time.Sleep(50 * time.Millisecond)
 
-	if !handler1.received || !handler2.received {
+	if !handler1.wasReceived() || !handler2.wasReceived() {
 		t.Fatal("Both handlers should receive message")
 	}
 }
+
+func TestBus_PublishSyncAggregatesErrors(t *testing.T) {
+	bus := NewBus()
+	if err := bus.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start bus: %v", err)
+	}
+	defer bus.Stop(context.Background())
+
+	errFirst := errors.New("first failure")
+	errSecond := errors.New("second failure")
+
+	bus.Subscribe("test.errors", HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		return nil, errFirst
+	}))
+	bus.Subscribe("test.errors", &testHandler{})
+	bus.Subscribe("test.errors", HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		return nil, errSecond
+	}))
+
+	msg := &testMessage{
+		BaseMessage: BaseMessage{
+			MessageSlug: "test.errors",
+			MessageType: "command",
+		},
+	}
+
+	err := bus.PublishSync(context.Background(), msg)
+	if err == nil {
+		t.Fatal("PublishSync should return an error")
+	}
+
+	if !errors.Is(err, errFirst) || !errors.Is(err, errSecond) {
+		t.Errorf("Expected both handler errors, got %v", err)
+	}
+
+	var handlerErr *HandlerError
+	if !errors.As(err, &handlerErr) {
+		t.Fatal("Expected a HandlerError")
+	}
+	if handlerErr.Slug != "test.errors" || handlerErr.Handler == "" {
+		t.Errorf("HandlerError should identify slug and handler, got %+v", handlerErr)
+	}
+}
+
+func TestBus_PublishSyncConcurrent(t *testing.T) {
+	bus := NewBus(WithConcurrentSync(true))
+	if err := bus.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start bus: %v", err)
+	}
+	defer bus.Stop(context.Background())
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+	blocking := HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		// Each handler waits for the other, so this only completes if both run at once
+		wg.Done()
+		wg.Wait()
+		return nil, nil
+	})
+	bus.Subscribe("test.concurrent", blocking)
+	bus.Subscribe("test.concurrent", blocking)
+
+	msg := &testMessage{
+		BaseMessage: BaseMessage{
+			MessageSlug: "test.concurrent",
+			MessageType: "command",
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() { done <- bus.PublishSync(ctx, msg) }()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatalf("PublishSync failed: %v", err)
+		}
+	case <-ctx.Done():
+		t.Fatal("Handlers should run concurrently")
+	}
+}
+
+func TestBus_PublishSyncDoesNotBlockAsync(t *testing.T) {
+	bus := NewBus()
+	if err := bus.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start bus: %v", err)
+	}
+	defer bus.Stop(context.Background())
+
+	release := make(chan struct{})
+	bus.Subscribe("test.slow", HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		<-release
+		return nil, nil
+	}))
+
+	received := make(chan struct{})
+	bus.Subscribe("test.fast", HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		close(received)
+		return nil, nil
+	}))
+
+	go bus.PublishSync(context.Background(), &testMessage{
+		BaseMessage: BaseMessage{MessageSlug: "test.slow", MessageType: "command"},
+	})
+	defer close(release)
+
+	bus.Publish(context.Background(), &testMessage{
+		BaseMessage: BaseMessage{MessageSlug: "test.fast", MessageType: "event"},
+	})
+
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Fatal("Async message should be delivered while a sync handler is running")
+	}
+}
+
+func TestBus_SubscriptionUnsubscribe(t *testing.T) {
+	bus := NewBus()
+	if err := bus.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start bus: %v", err)
+	}
+	defer bus.Stop(context.Background())
+
+	calls := 0
+	sub, err := bus.Subscribe("test.handle", HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		calls++
+		return nil, nil
+	}))
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+
+	if sub.Pattern() != "test.handle" {
+		t.Errorf("Expected pattern test.handle, got %s", sub.Pattern())
+	}
+
+	msg := &testMessage{
+		BaseMessage: BaseMessage{MessageSlug: "test.handle", MessageType: "command"},
+	}
+
+	bus.PublishSync(context.Background(), msg)
+	if err := sub.Unsubscribe(); err != nil {
+		t.Fatalf("Unsubscribe failed: %v", err)
+	}
+	bus.PublishSync(context.Background(), msg)
+
+	if calls != 1 {
+		t.Errorf("Expected 1 call, got %d", calls)
+	}
+
+	select {
+	case <-sub.Done():
+	default:
+		t.Error("Done should be closed after Unsubscribe")
+	}
+
+	if err := sub.Unsubscribe(); err != nil {
+		t.Errorf("Second Unsubscribe should be a no-op, got %v", err)
+	}
+}
+
+func TestBus_UnsubscribeFuncHandler(t *testing.T) {
+	bus := NewBus()
+
+	handler := HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		return nil, nil
+	})
+	bus.Subscribe("test.func", handler)
+
+	if err := bus.Unsubscribe("test.func", handler); err == nil {
+		t.Error("Unsubscribe should reject function handlers")
+	}
+}
+
+func TestBus_SubscribeOnce(t *testing.T) {
+	bus := NewBus()
+	if err := bus.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start bus: %v", err)
+	}
+	defer bus.Stop(context.Background())
+
+	calls := 0
+	sub, _ := bus.SubscribeOnce("test.once", HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		calls++
+		return nil, nil
+	}))
+
+	msg := &testMessage{
+		BaseMessage: BaseMessage{MessageSlug: "test.once", MessageType: "event"},
+	}
+	bus.PublishSync(context.Background(), msg)
+	bus.PublishSync(context.Background(), msg)
+
+	if calls != 1 {
+		t.Errorf("Expected 1 call, got %d", calls)
+	}
+
+	select {
+	case <-sub.Done():
+	default:
+		t.Error("One-shot subscription should be removed after first message")
+	}
+}
+
+func TestBus_SubscribeContext(t *testing.T) {
+	bus := NewBus()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	sub, err := bus.SubscribeContext(ctx, "test.ctx", &testHandler{})
+	if err != nil {
+		t.Fatalf("SubscribeContext failed: %v", err)
+	}
+
+	cancel()
+
+	select {
+	case <-sub.Done():
+	case <-time.After(time.Second):
+		t.Fatal("Subscription should be removed when context is cancelled")
+	}
+
+	if _, err := bus.SubscribeContext(ctx, "test.ctx", &testHandler{}); err == nil {
+		t.Error("SubscribeContext should fail for a cancelled context")
+	}
+}
+
+func TestBus_Lifecycle(t *testing.T) {
+	bus := NewBus()
+	msg := &testMessage{
+		BaseMessage: BaseMessage{MessageSlug: "test.lifecycle", MessageType: "event"},
+	}
+
+	if err := bus.Publish(context.Background(), msg); err == nil {
+		t.Error("Publish should fail before Start")
+	}
+
+	if err := bus.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start bus: %v", err)
+	}
+	if err := bus.Start(context.Background()); err == nil {
+		t.Error("Second Start should fail")
+	}
+
+	if err := bus.Stop(context.Background()); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+
+	if err := bus.Publish(context.Background(), msg); err == nil {
+		t.Error("Publish should fail after Stop")
+	}
+	if err := bus.PublishSync(context.Background(), msg); err == nil {
+		t.Error("PublishSync should fail after Stop")
+	}
+}
+
+func TestBus_StopDrainsQueuedMessages(t *testing.T) {
+	bus := NewBus()
+	bus.Start(context.Background())
+
+	var mu sync.Mutex
+	handled := 0
+	bus.Subscribe("test.drain", HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		handled++
+		mu.Unlock()
+		return nil, nil
+	}))
+
+	for i := 0; i < 20; i++ {
+		bus.Publish(context.Background(), &testMessage{BaseMessage: BaseMessage{MessageSlug: "test.drain"}})
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := bus.Stop(ctx); err != nil {
+		t.Fatalf("Stop failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if handled != 20 {
+		t.Errorf("Expected all 20 queued messages to be handled, got %d", handled)
+	}
+
+	err := bus.Publish(context.Background(), &testMessage{BaseMessage: BaseMessage{MessageSlug: "test.drain"}})
+	if !errors.Is(err, ErrBusStopped) {
+		t.Errorf("Expected ErrBusStopped, got %v", err)
+	}
+}
+
+func TestBus_StopWaitsForSyncHandlers(t *testing.T) {
+	bus := NewBus()
+	bus.Start(context.Background())
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	var finished atomic.Bool
+	bus.Subscribe("test.sync", HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		close(started)
+		<-release
+		finished.Store(true)
+		return nil, nil
+	}))
+	go bus.PublishSync(context.Background(), &testMessage{BaseMessage: BaseMessage{MessageSlug: "test.sync"}})
+	<-started
+
+	stopped := make(chan error, 1)
+	go func() { stopped <- bus.Stop(context.Background()) }()
+
+	select {
+	case <-stopped:
+		t.Fatal("Stop should wait for the running PublishSync handler")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(release)
+	if err := <-stopped; err != nil || !finished.Load() {
+		t.Errorf("Expected Stop to return after the handler finished, got %v", err)
+	}
+
+	if err := bus.PublishSync(context.Background(), &testMessage{BaseMessage: BaseMessage{MessageSlug: "test.sync"}}); !errors.Is(err, ErrBusStopped) {
+		t.Errorf("Expected ErrBusStopped, got %v", err)
+	}
+}
+
+func TestBus_StopReportsAbandonedMessages(t *testing.T) {
+	bus := NewBus()
+	bus.Start(context.Background())
+
+	release := make(chan struct{})
+	defer close(release)
+
+	// A handler that does not finish keeps the drain from completing
+	started := make(chan struct{}, 1)
+	bus.Subscribe("test.blocked", HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		started <- struct{}{}
+		<-release
+		return nil, nil
+	}))
+	bus.Publish(context.Background(), &testMessage{BaseMessage: BaseMessage{MessageSlug: "test.blocked"}})
+	<-started
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	err := bus.Stop(ctx)
+	var drainErr *DrainError
+	if !errors.As(err, &drainErr) {
+		t.Fatalf("Expected a DrainError, got %v", err)
+	}
+	if !errors.Is(err, context.Canceled) {
+		t.Errorf("DrainError should wrap the context error, got %v", err)
+	}
+	if drainErr.InFlight != 1 {
+		t.Errorf("Expected 1 handler in flight, got %d", drainErr.InFlight)
+	}
+}
+
+func TestBus_Restart(t *testing.T) {
+	bus := NewBus()
+	handler := &testHandler{}
+	bus.Subscribe("test.restart", handler)
+
+	bus.Start(context.Background())
+	bus.Stop(context.Background())
+
+	if err := bus.Start(context.Background()); err != nil {
+		t.Fatalf("Start after Stop failed: %v", err)
+	}
+	defer bus.Stop(context.Background())
+
+	if err := bus.PublishSync(context.Background(), &testMessage{BaseMessage: BaseMessage{MessageSlug: "test.restart"}}); err != nil {
+		t.Fatalf("PublishSync after restart failed: %v", err)
+	}
+	if !handler.wasReceived() {
+		t.Error("Subscriptions should survive a restart")
+	}
+}
@@ -0,0 +1,214 @@
+package message
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// MetaMessageID is the metadata key carrying a message's unique identifier.
+const MetaMessageID = "message_id"
+
+// Envelope is the serialisable form of a message, used wherever messages
+// leave the process or are persisted.
+type Envelope struct {
+	Slug     string                 `json:"slug"`
+	Type     string                 `json:"type"`
+	Metadata map[string]interface{} `json:"metadata,omitempty"`
+	Payload  json.RawMessage        `json:"payload,omitempty"`
+}
+
+// RawMessage is returned when decoding an envelope whose slug has no
+// registered message type. The JSON payload is kept as-is.
+type RawMessage struct {
+	BaseMessage
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// Codec converts messages to and from envelopes.
+// Concrete message types are registered by slug so decoding can rebuild them.
+type Codec struct {
+	types     map[string]reflect.Type
+	upcasters map[string]map[int]Upcaster
+	mu        sync.RWMutex
+}
+
+// NewCodec creates a new message codec.
+func NewCodec() *Codec {
+	return &Codec{
+		types:     make(map[string]reflect.Type),
+		upcasters: make(map[string]map[int]Upcaster),
+	}
+}
+
+// Register associates the concrete type of prototype with its slug.
+// The prototype must be a pointer to a struct implementing touta.Message.
+func (c *Codec) Register(prototype touta.Message) error {
+	typ := reflect.TypeOf(prototype)
+	if typ == nil || typ.Kind() != reflect.Ptr || typ.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("message prototype must be a pointer to a struct, got %T", prototype)
+	}
+
+	slug := prototype.Slug()
+	if slug == "" {
+		return fmt.Errorf("message prototype %T has no slug", prototype)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.types[slug] = typ.Elem()
+	return nil
+}
+
+// Encode converts a message into an envelope.
+func (c *Codec) Encode(msg touta.Message) (Envelope, error) {
+	if msg == nil {
+		return Envelope{}, fmt.Errorf("message is nil")
+	}
+
+	// The envelope gets its own metadata, so stamping the message later
+	// never changes an envelope that was stored or sent
+	env := Envelope{
+		Slug:     msg.Slug(),
+		Type:     msg.Type(),
+		Metadata: CopyMetadata(msg.Metadata()),
+	}
+
+	if v, ok := msg.(Versioned); ok {
+		if _, exists := env.Metadata[MetaSchemaVersion]; !exists {
+			if env.Metadata == nil {
+				env.Metadata = make(map[string]interface{}, 1)
+			}
+			env.Metadata[MetaSchemaVersion] = v.SchemaVersion()
+		}
+	}
+
+	if raw, ok := msg.(*RawMessage); ok {
+		env.Payload = raw.Payload
+		return env, nil
+	}
+
+	payload, err := json.Marshal(msg)
+	if err != nil {
+		return Envelope{}, fmt.Errorf("failed to encode message %s: %w", env.Slug, err)
+	}
+	env.Payload = payload
+	return env, nil
+}
+
+// Decode rebuilds a message from an envelope. Envelopes whose slug has no
+// registered type are returned as *RawMessage. Payloads written with an older
+// schema version are upcast first, see RegisterUpcaster.
+func (c *Codec) Decode(env Envelope) (touta.Message, error) {
+	env, err := c.upcast(env)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.RLock()
+	typ, ok := c.types[env.Slug]
+	c.mu.RUnlock()
+
+	if !ok {
+		return &RawMessage{
+			BaseMessage: BaseMessage{
+				MessageSlug: env.Slug,
+				MessageType: env.Type,
+				Meta:        CopyMetadata(env.Metadata),
+			},
+			Payload: env.Payload,
+		}, nil
+	}
+
+	ptr := reflect.New(typ)
+	if len(env.Payload) > 0 {
+		if err := json.Unmarshal(env.Payload, ptr.Interface()); err != nil {
+			return nil, fmt.Errorf("failed to decode message %s: %w", env.Slug, err)
+		}
+	}
+
+	msg, ok := ptr.Interface().(touta.Message)
+	if !ok {
+		return nil, fmt.Errorf("type %s does not implement touta.Message", typ)
+	}
+
+	// Envelope metadata wins over whatever the payload carried
+	if env.Metadata != nil {
+		meta := msg.Metadata()
+		if meta != nil {
+			for k, v := range env.Metadata {
+				meta[k] = v
+			}
+		}
+	}
+
+	return msg, nil
+}
+
+// Marshal encodes a message straight to JSON bytes.
+func (c *Codec) Marshal(msg touta.Message) ([]byte, error) {
+	env, err := c.Encode(msg)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(env)
+}
+
+// Unmarshal decodes a message from JSON bytes produced by Marshal.
+func (c *Codec) Unmarshal(data []byte) (touta.Message, error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return nil, fmt.Errorf("failed to parse envelope: %w", err)
+	}
+	return c.Decode(env)
+}
+
+// CopyMetadata returns a copy of a metadata map, or nil for nil.
+func CopyMetadata(meta map[string]interface{}) map[string]interface{} {
+	if meta == nil {
+		return nil
+	}
+	cp := make(map[string]interface{}, len(meta))
+	for k, v := range meta {
+		cp[k] = v
+	}
+	return cp
+}
+
+var baseMessageType = reflect.TypeOf(BaseMessage{})
+
+// Copy returns a shallow copy of msg with its own metadata map, so the copy
+// can be stamped and published without changing msg. It only copies
+// pointers to structs embedding BaseMessage and reports false for other
+// messages.
+func Copy(msg touta.Message) (touta.Message, bool) {
+	v := reflect.ValueOf(msg)
+	if v.Kind() != reflect.Ptr || v.IsNil() || v.Elem().Kind() != reflect.Struct {
+		return nil, false
+	}
+	field, ok := v.Elem().Type().FieldByName("BaseMessage")
+	if !ok || !field.Anonymous || field.Type != baseMessageType {
+		return nil, false
+	}
+
+	cp := reflect.New(v.Elem().Type())
+	cp.Elem().Set(v.Elem())
+	base := cp.Elem().FieldByIndex(field.Index).Addr().Interface().(*BaseMessage)
+	base.Meta = CopyMetadata(base.Meta)
+	return cp.Interface().(touta.Message), true
+}
+
+// NewID returns a random 128-bit identifier encoded as hex.
+func NewID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(fmt.Sprintf("message: failed to generate id: %v", err))
+	}
+	return hex.EncodeToString(b[:])
+}
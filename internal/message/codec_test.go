@@ -0,0 +1,137 @@
+package message
+
+import (
+	"testing"
+)
+
+type codecMessage struct {
+	BaseMessage
+	UserID string `json:"user_id"`
+}
+
+func TestCodec_RoundTrip(t *testing.T) {
+	codec := NewCodec()
+	if err := codec.Register(&codecMessage{BaseMessage: BaseMessage{MessageSlug: "user.created"}}); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+
+	msg := &codecMessage{
+		BaseMessage: BaseMessage{
+			MessageSlug: "user.created",
+			MessageType: "event",
+			Meta:        map[string]interface{}{"tenant": "acme"},
+		},
+		UserID: "42",
+	}
+
+	data, err := codec.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	decoded, err := codec.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	typed, ok := decoded.(*codecMessage)
+	if !ok {
+		t.Fatalf("Expected *codecMessage, got %T", decoded)
+	}
+
+	if typed.UserID != "42" || typed.Slug() != "user.created" || typed.Type() != "event" {
+		t.Errorf("Decoded message mismatch: %+v", typed)
+	}
+
+	if typed.Metadata()["tenant"] != "acme" {
+		t.Errorf("Expected metadata to survive, got %v", typed.Metadata())
+	}
+}
+
+func TestCodec_UnknownSlug(t *testing.T) {
+	codec := NewCodec()
+
+	env, err := codec.Encode(&codecMessage{
+		BaseMessage: BaseMessage{MessageSlug: "order.placed", MessageType: "event"},
+		UserID:      "7",
+	})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+
+	decoded, err := codec.Decode(env)
+	if err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	raw, ok := decoded.(*RawMessage)
+	if !ok {
+		t.Fatalf("Expected *RawMessage, got %T", decoded)
+	}
+
+	if raw.Slug() != "order.placed" || len(raw.Payload) == 0 {
+		t.Errorf("Raw message should keep slug and payload, got %+v", raw)
+	}
+}
+
+func TestCodec_RegisterInvalid(t *testing.T) {
+	codec := NewCodec()
+
+	if err := codec.Register(&codecMessage{}); err == nil {
+		t.Error("Register should reject prototypes without a slug")
+	}
+}
+
+func TestNewID(t *testing.T) {
+	a, b := NewID(), NewID()
+	if len(a) != 32 || a == b {
+		t.Errorf("Expected distinct 32 char ids, got %s and %s", a, b)
+	}
+}
+
+func TestCodec_EncodeCopiesMetadata(t *testing.T) {
+	codec := NewCodec()
+	msg := &codecMessage{BaseMessage: BaseMessage{MessageSlug: "user.created", Meta: map[string]interface{}{"a": 1}}}
+
+	env, err := codec.Encode(msg)
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	msg.Metadata()["b"] = 2
+	if _, ok := env.Metadata["b"]; ok {
+		t.Error("stamping the message must not change its envelope")
+	}
+
+	decoded, _ := codec.Decode(env)
+	decoded.Metadata()["c"] = 3
+	if _, ok := env.Metadata["c"]; ok {
+		t.Error("stamping a decoded message must not change its envelope")
+	}
+}
+
+func TestCopy(t *testing.T) {
+	msg := &codecMessage{BaseMessage: BaseMessage{MessageSlug: "user.created", Meta: map[string]interface{}{"a": 1}}, UserID: "42"}
+
+	copied, ok := Copy(msg)
+	if !ok {
+		t.Fatal("Copy should copy messages embedding BaseMessage")
+	}
+	copied.Metadata()["b"] = 2
+	if c := copied.(*codecMessage); c == msg || c.UserID != "42" || c.Slug() != "user.created" {
+		t.Errorf("unexpected copy %#v", copied)
+	}
+	if _, ok := msg.Metadata()["b"]; ok {
+		t.Error("the copy must have its own metadata")
+	}
+
+	if _, ok := Copy(plainMessage{}); ok {
+		t.Error("Copy should report false for messages it cannot copy")
+	}
+}
+
+// plainMessage is a message that does not embed BaseMessage.
+type plainMessage struct{}
+
+func (plainMessage) Slug() string                     { return "x" }
+func (plainMessage) Type() string                     { return "event" }
+func (plainMessage) Metadata() map[string]interface{} { return nil }
@@ -0,0 +1,299 @@
+package message
+
+import (
+	"container/list"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// DefaultIdempotencyTTL is how long processed messages are remembered when
+// Idempotent is given no TTL.
+const DefaultIdempotencyTTL = 24 * time.Hour
+
+// Middleware wraps the handlers of a bus, see WithMiddleware.
+type Middleware func(next touta.MessageHandler) touta.MessageHandler
+
+// WithMiddleware wraps every handler invocation in mw, outermost first.
+// Handlers keep their identity, so Unsubscribe, metrics and introspection
+// still refer to the handler that was subscribed.
+func WithMiddleware(mw ...Middleware) Option {
+	return func(b *bus) {
+		b.middleware = append(b.middleware, mw...)
+	}
+}
+
+// IdempotencyStore remembers which messages a handler has processed.
+type IdempotencyStore interface {
+	// Seen reports whether key was marked and has not yet expired
+	Seen(key string) (bool, error)
+
+	// Mark records key as processed for ttl
+	Mark(key string, ttl time.Duration) error
+}
+
+// Idempotent returns middleware that runs each subscription at most once
+// per message ID. After a handler succeeds the (subscription, message ID)
+// pair is recorded in store for ttl, and redeliveries within that window are
+// skipped and reported as duplicates in the bus metrics. Failed attempts are
+// not recorded, so a redelivery retries them. Messages without an ID are
+// passed through.
+func Idempotent(store IdempotencyStore, ttl time.Duration) Middleware {
+	if ttl <= 0 {
+		ttl = DefaultIdempotencyTTL
+	}
+	locks := &keyLocks{held: make(map[string]chan struct{})}
+
+	return func(next touta.MessageHandler) touta.MessageHandler {
+		return HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+			id, _ := msg.Metadata()[MetaMessageID].(string)
+			if id == "" {
+				return next.Handle(ctx, msg)
+			}
+
+			// Handlers are told apart by their subscription, so two
+			// subscriptions of the same handler type each run once
+			name := handlerName(next)
+			if d, ok := ctx.Value(dispatchKey{}).(*dispatch); ok {
+				name = d.subscription
+			}
+			key := name + "/" + id
+
+			// Concurrent deliveries of the same message wait for each other
+			if err := locks.lock(ctx, key); err != nil {
+				return nil, err
+			}
+			defer locks.unlock(key)
+
+			seen, err := store.Seen(key)
+			if err != nil {
+				return nil, fmt.Errorf("failed to check message %s: %w", id, err)
+			}
+			if seen {
+				ReportDuplicate(ctx)
+				return nil, nil
+			}
+
+			reply, err := next.Handle(ctx, msg)
+			if err != nil {
+				return nil, err
+			}
+			if err := store.Mark(key, ttl); err != nil {
+				return reply, fmt.Errorf("failed to record message %s as processed: %w", id, err)
+			}
+			return reply, nil
+		})
+	}
+}
+
+// keyLocks serialises work per key.
+type keyLocks struct {
+	mu   sync.Mutex
+	held map[string]chan struct{}
+}
+
+func (l *keyLocks) lock(ctx context.Context, key string) error {
+	for {
+		l.mu.Lock()
+		wait, busy := l.held[key]
+		if !busy {
+			l.held[key] = make(chan struct{})
+			l.mu.Unlock()
+			return nil
+		}
+		l.mu.Unlock()
+
+		select {
+		case <-wait:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+func (l *keyLocks) unlock(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	close(l.held[key])
+	delete(l.held, key)
+}
+
+// EnsureID stamps msg with a message ID unless it already has one and
+// returns the ID. Buses call it on publish.
+func EnsureID(msg touta.Message) string {
+	meta := msg.Metadata()
+	if meta == nil {
+		return ""
+	}
+	if id, ok := meta[MetaMessageID].(string); ok && id != "" {
+		return id
+	}
+	id := NewID()
+	meta[MetaMessageID] = id
+	return id
+}
+
+// memoryIdempotencyStore keeps the most recently marked keys in memory.
+type memoryIdempotencyStore struct {
+	mu       sync.Mutex
+	capacity int
+	entries  map[string]*list.Element
+	order    *list.List // front is most recently marked
+	now      func() time.Time
+}
+
+type idempotencyEntry struct {
+	key     string
+	expires time.Time
+}
+
+// NewMemoryIdempotencyStore creates an in-memory store holding at most
+// capacity keys; the least recently marked key is evicted first.
+func NewMemoryIdempotencyStore(capacity int) IdempotencyStore {
+	if capacity <= 0 {
+		capacity = 10000
+	}
+	return &memoryIdempotencyStore{
+		capacity: capacity,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+// Seen reports whether key was marked and has not yet expired.
+func (s *memoryIdempotencyStore) Seen(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.entries[key]
+	if !ok {
+		return false, nil
+	}
+	if !s.now().Before(el.Value.(*idempotencyEntry).expires) {
+		s.order.Remove(el)
+		delete(s.entries, key)
+		return false, nil
+	}
+	return true, nil
+}
+
+// Mark records key as processed for ttl.
+func (s *memoryIdempotencyStore) Mark(key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expires := s.now().Add(ttl)
+	if el, ok := s.entries[key]; ok {
+		el.Value.(*idempotencyEntry).expires = expires
+		s.order.MoveToFront(el)
+		return nil
+	}
+
+	s.entries[key] = s.order.PushFront(&idempotencyEntry{key: key, expires: expires})
+	for s.order.Len() > s.capacity {
+		oldest := s.order.Back()
+		s.order.Remove(oldest)
+		delete(s.entries, oldest.Value.(*idempotencyEntry).key)
+	}
+	return nil
+}
+
+// fileIdempotencyStore persists processed keys to a JSON file.
+type fileIdempotencyStore struct {
+	mu      sync.Mutex
+	path    string
+	expires map[string]time.Time
+	now     func() time.Time
+}
+
+// NewFileIdempotencyStore creates a store persisted at path, so duplicates
+// are detected across restarts. Expired keys are pruned on every write.
+func NewFileIdempotencyStore(path string) (IdempotencyStore, error) {
+	s := &fileIdempotencyStore{
+		path:    path,
+		expires: make(map[string]time.Time),
+		now:     time.Now,
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read idempotency file: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &s.expires); err != nil {
+			return nil, fmt.Errorf("failed to parse idempotency file: %w", err)
+		}
+	}
+	return s, nil
+}
+
+// Seen reports whether key was marked and has not yet expired.
+func (s *fileIdempotencyStore) Seen(key string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expires, ok := s.expires[key]
+	return ok && s.now().Before(expires), nil
+}
+
+// Mark records key as processed for ttl.
+func (s *fileIdempotencyStore) Mark(key string, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	next := make(map[string]time.Time, len(s.expires)+1)
+	for k, expires := range s.expires {
+		if now.Before(expires) {
+			next[k] = expires
+		}
+	}
+	next[key] = now.Add(ttl)
+
+	if err := s.write(next); err != nil {
+		return err
+	}
+	s.expires = next
+	return nil
+}
+
+// write atomically replaces the file with expires.
+func (s *fileIdempotencyStore) write(expires map[string]time.Time) error {
+	data, err := json.Marshal(expires)
+	if err != nil {
+		return fmt.Errorf("failed to encode idempotency keys: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create idempotency directory: %w", err)
+	}
+
+	// Sync before renaming so a crash never leaves a truncated file behind
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write idempotency file: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write idempotency file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync idempotency file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write idempotency file: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace idempotency file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,170 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+func TestIdempotent_SkipsRedeliveries(t *testing.T) {
+	bus := NewBus(WithMiddleware(Idempotent(NewMemoryIdempotencyStore(0), time.Hour)))
+	bus.Start(context.Background())
+	defer bus.Stop(context.Background())
+
+	var charges atomic.Int32
+	bus.Subscribe("payment.requested", HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		charges.Add(1)
+		return nil, nil
+	}))
+	audit := &testHandler{}
+	bus.Subscribe("payment.requested", audit)
+
+	msg := &testMessage{BaseMessage: BaseMessage{MessageSlug: "payment.requested", MessageType: "command"}}
+	bus.PublishSync(context.Background(), msg)
+
+	if msg.Metadata()[MetaMessageID] == nil {
+		t.Fatal("Published messages should be given a message ID")
+	}
+
+	// A redelivery carries the same ID
+	bus.PublishSync(context.Background(), msg)
+
+	if charges.Load() != 1 {
+		t.Errorf("Expected 1 charge, got %d", charges.Load())
+	}
+
+	stats := bus.(Inspector).Stats()
+	if stats.Slugs["payment.requested"].Duplicates != 2 {
+		t.Errorf("Expected 2 duplicates, got %d", stats.Slugs["payment.requested"].Duplicates)
+	}
+	if stats.Handlers["*message.testHandler"].Duplicates != 1 {
+		t.Error("Duplicates should be reported per handler")
+	}
+
+	// A new message gets a new ID and is processed
+	bus.PublishSync(context.Background(), &testMessage{BaseMessage: BaseMessage{MessageSlug: "payment.requested"}})
+	if charges.Load() != 2 {
+		t.Errorf("Expected 2 charges, got %d", charges.Load())
+	}
+}
+
+// countHandler counts the messages it handles.
+type countHandler struct {
+	n *atomic.Int32
+}
+
+func (h *countHandler) Handle(ctx context.Context, msg touta.Message) (touta.Message, error) {
+	h.n.Add(1)
+	return nil, nil
+}
+
+func TestIdempotent_SameHandlerTypeTwice(t *testing.T) {
+	bus := NewBus(WithMiddleware(Idempotent(NewMemoryIdempotencyStore(0), time.Hour)))
+	bus.Start(context.Background())
+	defer bus.Stop(context.Background())
+
+	var a, c atomic.Int32
+	bus.Subscribe("payment.requested", &countHandler{&a})
+	bus.Subscribe("payment.requested", &countHandler{&c})
+
+	msg := &testMessage{BaseMessage: BaseMessage{MessageSlug: "payment.requested"}}
+	bus.PublishSync(context.Background(), msg)
+	bus.PublishSync(context.Background(), msg)
+
+	if a.Load() != 1 || c.Load() != 1 {
+		t.Errorf("Each subscription should handle the message once, got %d and %d", a.Load(), c.Load())
+	}
+}
+
+func TestSubscriptionKey(t *testing.T) {
+	b := NewBus().(*bus)
+	h := HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) { return nil, nil })
+
+	first, _ := b.Subscribe("order.*", h)
+	second, _ := b.Subscribe("order.*", h)
+	if first.(*subscription).key == second.(*subscription).key {
+		t.Fatalf("Subscriptions of the same handler should get distinct keys, both got %q", first.(*subscription).key)
+	}
+
+	// A new subscription takes over the key of a removed one
+	key := second.(*subscription).key
+	second.Unsubscribe()
+	third, _ := b.Subscribe("order.*", h)
+	if third.(*subscription).key != key {
+		t.Errorf("Expected key %q to be reused, got %q", key, third.(*subscription).key)
+	}
+}
+
+func TestIdempotent_RetriesFailures(t *testing.T) {
+	bus := NewBus(WithMiddleware(Idempotent(NewMemoryIdempotencyStore(0), 0)))
+	bus.Start(context.Background())
+	defer bus.Stop(context.Background())
+
+	attempts := 0
+	bus.Subscribe("payment.requested", HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		if attempts++; attempts == 1 {
+			return nil, errors.New("gateway timeout")
+		}
+		return nil, nil
+	}))
+
+	msg := &testMessage{BaseMessage: BaseMessage{MessageSlug: "payment.requested"}}
+	if err := bus.PublishSync(context.Background(), msg); err == nil {
+		t.Fatal("First attempt should fail")
+	}
+	if err := bus.PublishSync(context.Background(), msg); err != nil {
+		t.Fatalf("Redelivery should be processed after a failure: %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", attempts)
+	}
+}
+
+func TestMemoryIdempotencyStore(t *testing.T) {
+	store := NewMemoryIdempotencyStore(2).(*memoryIdempotencyStore)
+	now := time.Now()
+	store.now = func() time.Time { return now }
+
+	store.Mark("a", time.Minute)
+	store.Mark("b", time.Minute)
+	store.Mark("c", time.Minute)
+
+	if seen, _ := store.Seen("a"); seen {
+		t.Error("Least recently marked key should be evicted")
+	}
+	if seen, _ := store.Seen("c"); !seen {
+		t.Error("Marked key should be seen")
+	}
+
+	now = now.Add(time.Minute)
+	if seen, _ := store.Seen("c"); seen {
+		t.Error("Key should expire after its TTL")
+	}
+}
+
+func TestFileIdempotencyStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "idempotency.json")
+
+	store, err := NewFileIdempotencyStore(path)
+	if err != nil {
+		t.Fatalf("NewFileIdempotencyStore failed: %v", err)
+	}
+	store.Mark("handler/1", time.Hour)
+	store.Mark("handler/2", -time.Second)
+
+	reopened, err := NewFileIdempotencyStore(path)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+	if seen, _ := reopened.Seen("handler/1"); !seen {
+		t.Error("Marked key should survive a restart")
+	}
+	if seen, _ := reopened.Seen("handler/2"); seen {
+		t.Error("Expired key should not be seen")
+	}
+}
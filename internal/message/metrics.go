@@ -0,0 +1,275 @@
+package message
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds of the handler duration histogram.
+var DefaultBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	25 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	250 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Recorder receives instrumentation events from a bus. Implement it to
+// forward bus metrics to an external system such as Prometheus.
+type Recorder interface {
+	// Published is called for every message accepted by Publish or PublishSync
+	Published(slug string)
+
+	// Handled is called after a handler returns; err is nil on success
+	Handled(slug, handler string, duration time.Duration, err error)
+
+	// Retried is called when a handler attempt is repeated after a failure
+	Retried(slug, handler string)
+
+	// Duplicate is called when a message is skipped as already processed
+	Duplicate(slug, handler string)
+}
+
+// Inspector exposes the runtime state of a bus. Buses created by NewBus
+// implement it.
+type Inspector interface {
+	// Stats returns a snapshot of the bus metrics
+	Stats() Stats
+
+	// Subscriptions lists the handlers currently registered
+	Subscriptions() []SubscriptionInfo
+}
+
+// SubscriptionInfo describes a registered handler.
+type SubscriptionInfo struct {
+	Pattern string `json:"pattern"`
+	Handler string `json:"handler"`
+	Once    bool   `json:"once"`
+}
+
+// Stats is a point-in-time snapshot of bus metrics.
+type Stats struct {
+	QueueLength int                 `json:"queue_length"` // messages waiting for async dispatch
+	InFlight    int                 `json:"in_flight"`    // handlers currently running
+	Slugs       map[string]Counters `json:"slugs"`        // counters per message slug
+	Handlers    map[string]Counters `json:"handlers"`     // counters per handler name
+}
+
+// Counters holds the counts and latencies of one slug or handler.
+type Counters struct {
+	Published  uint64    `json:"published"`
+	Handled    uint64    `json:"handled"`
+	Failed     uint64    `json:"failed"`
+	Retried    uint64    `json:"retried"`
+	Duplicates uint64    `json:"duplicates"`
+	Duration   Histogram `json:"duration"`
+}
+
+// Histogram is a cumulative histogram of handler durations.
+type Histogram struct {
+	Count   uint64        `json:"count"`
+	Sum     time.Duration `json:"sum"`
+	Buckets []Bucket      `json:"buckets"`
+}
+
+// Bucket counts observations less than or equal to UpperBound.
+type Bucket struct {
+	UpperBound time.Duration `json:"upper_bound"`
+	Count      uint64        `json:"count"`
+}
+
+// observe adds a duration to the histogram.
+func (h *Histogram) observe(d time.Duration) {
+	if h.Buckets == nil {
+		h.Buckets = make([]Bucket, len(DefaultBuckets))
+		for i, bound := range DefaultBuckets {
+			h.Buckets[i].UpperBound = bound
+		}
+	}
+
+	h.Count++
+	h.Sum += d
+	for i := range h.Buckets {
+		if d <= h.Buckets[i].UpperBound {
+			h.Buckets[i].Count++
+		}
+	}
+}
+
+// metrics is the built-in Recorder backing Inspector.Stats.
+type metrics struct {
+	mu       sync.Mutex
+	slugs    map[string]*Counters
+	handlers map[string]*Counters
+}
+
+func newMetrics() *metrics {
+	return &metrics{
+		slugs:    make(map[string]*Counters),
+		handlers: make(map[string]*Counters),
+	}
+}
+
+// counters returns the entry for key, creating it when missing.
+// The caller must hold mu.
+func counters(m map[string]*Counters, key string) *Counters {
+	c, ok := m[key]
+	if !ok {
+		c = &Counters{}
+		m[key] = c
+	}
+	return c
+}
+
+func (m *metrics) Published(slug string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counters(m.slugs, slug).Published++
+}
+
+func (m *metrics) Handled(slug, handler string, duration time.Duration, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, c := range []*Counters{counters(m.slugs, slug), counters(m.handlers, handler)} {
+		c.Handled++
+		if err != nil {
+			c.Failed++
+		}
+		c.Duration.observe(duration)
+	}
+}
+
+func (m *metrics) Retried(slug, handler string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counters(m.slugs, slug).Retried++
+	counters(m.handlers, handler).Retried++
+}
+
+func (m *metrics) Duplicate(slug, handler string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	counters(m.slugs, slug).Duplicates++
+	counters(m.handlers, handler).Duplicates++
+}
+
+// snapshot copies the counters so callers can read them without locking.
+func (m *metrics) snapshot() (map[string]Counters, map[string]Counters) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	cp := func(src map[string]*Counters) map[string]Counters {
+		dst := make(map[string]Counters, len(src))
+		for k, c := range src {
+			copied := *c
+			copied.Duration.Buckets = append([]Bucket(nil), c.Duration.Buckets...)
+			dst[k] = copied
+		}
+		return dst
+	}
+	return cp(m.slugs), cp(m.handlers)
+}
+
+// recorders fans instrumentation events out to several recorders.
+type recorders []Recorder
+
+func (r recorders) Published(slug string) {
+	for _, rec := range r {
+		rec.Published(slug)
+	}
+}
+
+func (r recorders) Handled(slug, handler string, duration time.Duration, err error) {
+	for _, rec := range r {
+		rec.Handled(slug, handler, duration, err)
+	}
+}
+
+func (r recorders) Retried(slug, handler string) {
+	for _, rec := range r {
+		rec.Retried(slug, handler)
+	}
+}
+
+func (r recorders) Duplicate(slug, handler string) {
+	for _, rec := range r {
+		rec.Duplicate(slug, handler)
+	}
+}
+
+// dispatchKey carries the dispatch being handled in a handler context.
+type dispatchKey struct{}
+
+// dispatch identifies the handler invocation a context belongs to.
+type dispatch struct {
+	recorder     Recorder
+	slug         string
+	handler      string
+	subscription string
+}
+
+// ReportRetry records that a handler is about to retry the message it is
+// handling. Handler wrappers that retry internally should call it with the
+// context they received from the bus; it is a no-op for other contexts.
+func ReportRetry(ctx context.Context) {
+	if d, ok := ctx.Value(dispatchKey{}).(*dispatch); ok {
+		d.recorder.Retried(d.slug, d.handler)
+	}
+}
+
+// ReportDuplicate records that a handler skipped an already processed
+// message. Like ReportRetry it is a no-op outside of bus dispatch.
+func ReportDuplicate(ctx context.Context) {
+	if d, ok := ctx.Value(dispatchKey{}).(*dispatch); ok {
+		d.recorder.Duplicate(d.slug, d.handler)
+	}
+}
+
+// Stats returns a snapshot of the bus metrics.
+func (b *bus) Stats() Stats {
+	b.stateMu.RLock()
+	queued := 0
+	if b.run != nil {
+		queued = len(b.run.messages)
+	}
+	b.stateMu.RUnlock()
+
+	slugs, handlers := b.metrics.snapshot()
+	return Stats{
+		QueueLength: queued,
+		InFlight:    int(b.inFlight.Load()),
+		Slugs:       slugs,
+		Handlers:    handlers,
+	}
+}
+
+// Subscriptions lists the handlers currently registered, ordered by pattern.
+func (b *bus) Subscriptions() []SubscriptionInfo {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	var infos []SubscriptionInfo
+	for pattern, subs := range b.subscribers {
+		for _, sub := range subs {
+			infos = append(infos, SubscriptionInfo{
+				Pattern: pattern,
+				Handler: handlerName(sub.handler),
+				Once:    sub.once,
+			})
+		}
+	}
+
+	sort.SliceStable(infos, func(i, j int) bool {
+		return infos[i].Pattern < infos[j].Pattern
+	})
+	return infos
+}
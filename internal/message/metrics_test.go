@@ -0,0 +1,172 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/toutaio/toutago/internal/di"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+type countingRecorder struct {
+	mu        sync.Mutex
+	published int
+	handled   int
+}
+
+func (r *countingRecorder) Published(string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.published++
+}
+
+func (r *countingRecorder) Handled(string, string, time.Duration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.handled++
+}
+
+func (r *countingRecorder) Retried(string, string)   {}
+func (r *countingRecorder) Duplicate(string, string) {}
+
+func TestBus_Stats(t *testing.T) {
+	recorder := &countingRecorder{}
+	bus := NewBus(WithRecorder(recorder))
+	bus.Start(context.Background())
+	defer bus.Stop(context.Background())
+
+	bus.Subscribe("test.stats", &testHandler{})
+	bus.Subscribe("test.stats", HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		return nil, errors.New("failure")
+	}))
+
+	msg := &testMessage{BaseMessage: BaseMessage{MessageSlug: "test.stats", MessageType: "event"}}
+	bus.PublishSync(context.Background(), msg)
+	bus.PublishSync(context.Background(), msg)
+
+	stats := bus.(Inspector).Stats()
+	slug := stats.Slugs["test.stats"]
+	if slug.Published != 2 || slug.Handled != 4 || slug.Failed != 2 {
+		t.Errorf("Unexpected slug counters %+v", slug)
+	}
+	if slug.Duration.Count != 4 || len(slug.Duration.Buckets) != len(DefaultBuckets) {
+		t.Errorf("Unexpected duration histogram %+v", slug.Duration)
+	}
+
+	handler := stats.Handlers["*message.testHandler"]
+	if handler.Handled != 2 || handler.Failed != 0 {
+		t.Errorf("Unexpected handler counters %+v", handler)
+	}
+
+	if recorder.published != 2 || recorder.handled != 4 {
+		t.Errorf("Recorder should receive every event, got %+v", recorder)
+	}
+}
+
+func TestBus_StatsInFlightAndRetries(t *testing.T) {
+	bus := NewBus()
+	bus.Start(context.Background())
+	defer bus.Stop(context.Background())
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	bus.Subscribe("test.inflight", HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		close(started)
+		<-release
+		return nil, nil
+	}))
+
+	bus.Publish(context.Background(), &testMessage{BaseMessage: BaseMessage{MessageSlug: "test.inflight"}})
+	<-started
+	if inFlight := bus.(Inspector).Stats().InFlight; inFlight != 1 {
+		t.Errorf("Expected 1 handler in flight, got %d", inFlight)
+	}
+	close(release)
+
+	attempts := 0
+	container := di.NewContainer()
+	container.Factory("flaky", func(touta.Container) (interface{}, error) {
+		return HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+			if attempts++; attempts < 3 {
+				return nil, errors.New("temporary failure")
+			}
+			return nil, nil
+		}), nil
+	})
+	BindRoutes(bus, container, []Route{{Slug: "test.retry", Handler: "flaky", Retries: 3}})
+
+	bus.PublishSync(context.Background(), &testMessage{BaseMessage: BaseMessage{MessageSlug: "test.retry"}})
+	if retried := bus.(Inspector).Stats().Handlers["flaky"].Retried; retried != 2 {
+		t.Errorf("Expected 2 retries, got %d", retried)
+	}
+}
+
+func TestBus_Subscriptions(t *testing.T) {
+	bus := NewBus()
+	bus.Subscribe("b.slug", &testHandler{})
+	bus.SubscribeOnce("a.slug", &testHandler{})
+
+	subs := bus.(Inspector).Subscriptions()
+	if len(subs) != 2 {
+		t.Fatalf("Expected 2 subscriptions, got %d", len(subs))
+	}
+	if subs[0].Pattern != "a.slug" || !subs[0].Once || subs[0].Handler != "*message.testHandler" {
+		t.Errorf("Unexpected subscription %+v", subs[0])
+	}
+}
+
+func TestBus_TracePropagation(t *testing.T) {
+	bus := NewBus()
+	bus.Start(context.Background())
+	defer bus.Stop(context.Background())
+
+	var child SpanContext
+	bus.Subscribe("test.parent", HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		return nil, bus.PublishSync(ctx, &testMessage{BaseMessage: BaseMessage{MessageSlug: "test.child"}})
+	}))
+	bus.Subscribe("test.child", HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		child, _ = SpanFromContext(ctx)
+		return nil, nil
+	}))
+
+	root := SpanContext{TraceID: NewID(), SpanID: NewID()[:16], Sampled: true}
+	parent := &testMessage{BaseMessage: BaseMessage{MessageSlug: "test.parent"}}
+	if err := bus.PublishSync(ContextWithSpan(context.Background(), root), parent); err != nil {
+		t.Fatalf("PublishSync failed: %v", err)
+	}
+
+	parentSpan, err := ParseTraceParent(parent.Metadata()[MetaTraceParent].(string))
+	if err != nil {
+		t.Fatalf("Parent should carry a traceparent: %v", err)
+	}
+	if parentSpan.TraceID != root.TraceID || parentSpan.SpanID == root.SpanID {
+		t.Errorf("Parent span should be a new span in the root trace, got %+v", parentSpan)
+	}
+	if child.TraceID != root.TraceID || child.SpanID == parentSpan.SpanID {
+		t.Errorf("Child span should continue the trace, got %+v", child)
+	}
+}
+
+func TestParseTraceParent(t *testing.T) {
+	span, err := ParseTraceParent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	if err != nil {
+		t.Fatalf("ParseTraceParent failed: %v", err)
+	}
+	if !span.Sampled || span.TraceParent() != "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01" {
+		t.Errorf("Unexpected span %+v", span)
+	}
+
+	for _, invalid := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+	} {
+		if _, err := ParseTraceParent(invalid); err == nil {
+			t.Errorf("ParseTraceParent(%q) should fail", invalid)
+		}
+	}
+}
@@ -0,0 +1,52 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// ErrNoHandler is returned by Request when no handler is subscribed to the
+// message, so nothing could reply.
+var ErrNoHandler = errors.New("no handler subscribed")
+
+// Requester sends a message and waits for a reply. Buses created by NewBus
+// implement it.
+type Requester interface {
+	// Request dispatches msg like PublishSync and returns the reply of the
+	// first handler, in subscription order, that returned one. The reply
+	// is nil when the handlers ran but none replied.
+	Request(ctx context.Context, msg touta.Message) (touta.Message, error)
+}
+
+// Request sends msg on bus and waits for a reply, see Requester. It fails
+// when bus does not implement Requester.
+func Request(ctx context.Context, bus touta.MessageBus, msg touta.Message) (touta.Message, error) {
+	requester, ok := bus.(Requester)
+	if !ok {
+		return nil, fmt.Errorf("message bus %T does not support request/reply", bus)
+	}
+	return requester.Request(ctx, msg)
+}
+
+// Request implements Requester. Handler failures are returned like by
+// PublishSync, without a reply, and ErrNoHandler is returned when no
+// handler matched msg.
+func (b *bus) Request(ctx context.Context, msg touta.Message) (touta.Message, error) {
+	replies, err := b.dispatchSync(ctx, msg)
+	if err != nil {
+		return nil, err
+	}
+	if len(replies) == 0 {
+		return nil, fmt.Errorf("%w for %s", ErrNoHandler, msg.Slug())
+	}
+
+	for _, reply := range replies {
+		if reply != nil {
+			return reply, nil
+		}
+	}
+	return nil, nil
+}
@@ -0,0 +1,107 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+func reply(payload string) touta.MessageHandler {
+	return HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		return &RawMessage{
+			BaseMessage: BaseMessage{MessageSlug: msg.Slug() + ".reply"},
+			Payload:     []byte(payload),
+		}, nil
+	})
+}
+
+func TestRequest_ReturnsFirstReply(t *testing.T) {
+	bus := NewBus()
+	bus.Start(context.Background())
+	defer bus.Stop(context.Background())
+
+	audit := &testHandler{}
+	bus.Subscribe("*", audit)
+	bus.Subscribe("user.get", &testHandler{})
+	bus.Subscribe("user.get", reply(`{"id":"1"}`))
+	bus.Subscribe("user.get", reply(`{"id":"2"}`))
+
+	msg := &testMessage{BaseMessage: BaseMessage{MessageSlug: "user.get", MessageType: "query"}}
+	got, err := Request(context.Background(), bus, msg)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	raw, ok := got.(*RawMessage)
+	if !ok || string(raw.Payload) != `{"id":"1"}` {
+		t.Errorf("expected the first reply, got %#v", got)
+	}
+	if !audit.wasReceived() {
+		t.Error("handlers without a reply should still run")
+	}
+	if msg.Metadata()[MetaMessageID] == nil {
+		t.Error("request should be stamped like a published message")
+	}
+}
+
+func TestRequest_NoReply(t *testing.T) {
+	bus := NewBus()
+	bus.Start(context.Background())
+	defer bus.Stop(context.Background())
+
+	bus.Subscribe("user.delete", &testHandler{})
+
+	got, err := Request(context.Background(), bus, &testMessage{BaseMessage: BaseMessage{MessageSlug: "user.delete"}})
+	if err != nil || got != nil {
+		t.Errorf("expected no reply and no error, got %v, %v", got, err)
+	}
+}
+
+func TestRequest_Errors(t *testing.T) {
+	bus := NewBus()
+	msg := &testMessage{BaseMessage: BaseMessage{MessageSlug: "user.get"}}
+
+	if _, err := Request(context.Background(), bus, msg); !errors.Is(err, ErrBusNotStarted) {
+		t.Errorf("expected ErrBusNotStarted, got %v", err)
+	}
+
+	bus.Start(context.Background())
+	defer bus.Stop(context.Background())
+
+	if _, err := Request(context.Background(), bus, msg); !errors.Is(err, ErrNoHandler) {
+		t.Errorf("expected ErrNoHandler, got %v", err)
+	}
+
+	failure := errors.New("not found")
+	bus.Subscribe("user.get", reply(`{}`))
+	bus.Subscribe("user.get", HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		return nil, failure
+	}))
+	got, err := Request(context.Background(), bus, msg)
+	var handlerErr *HandlerError
+	if got != nil || !errors.As(err, &handlerErr) || !errors.Is(err, failure) {
+		t.Errorf("expected the handler error without a reply, got %v, %v", got, err)
+	}
+}
+
+func TestRequest_RoutedHandlerReplies(t *testing.T) {
+	bus := NewBus(WithConcurrentSync(true))
+	bus.Start(context.Background())
+	defer bus.Stop(context.Background())
+
+	bus.Subscribe("user.get", &routedHandler{route: Route{Slug: "user.get", Handler: "user.find"}, handler: reply(`{"id":"1"}`)})
+
+	got, err := Request(context.Background(), bus, &testMessage{BaseMessage: BaseMessage{MessageSlug: "user.get"}})
+	if err != nil || got == nil || got.Slug() != "user.get.reply" {
+		t.Errorf("expected the routed handler's reply, got %v, %v", got, err)
+	}
+}
+
+type publishOnly struct{ touta.MessageBus }
+
+func TestRequest_UnsupportedBus(t *testing.T) {
+	if _, err := Request(context.Background(), publishOnly{NewBus()}, &testMessage{}); err == nil {
+		t.Error("expected an error for a bus without request/reply")
+	}
+}
@@ -0,0 +1,419 @@
+package message
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/adrg/frontmatter"
+	"github.com/toutaio/toutago/pkg/touta"
+	"gopkg.in/yaml.v3"
+)
+
+// Route binds a message pattern to a handler resolved from the container by name.
+type Route struct {
+	Slug        string        `yaml:"slug"`        // slug, type or "*"; defaults to the file's slug
+	Handler     string        `yaml:"handler"`     // name of the handler binding in the container
+	Async       bool          `yaml:"async"`       // run in the background, even on PublishSync
+	Retries     int           `yaml:"retries"`     // extra attempts after a failure
+	RetryDelay  time.Duration `yaml:"retry_delay"` // pause between attempts
+	Concurrency int           `yaml:"concurrency"` // max parallel invocations, 0 for unlimited
+	Source      string        `yaml:"-"`           // file the route was declared in
+}
+
+// String describes the route for error messages.
+func (r Route) String() string {
+	if r.Source != "" {
+		return fmt.Sprintf("%s: %s -> %s", r.Source, r.Slug, r.Handler)
+	}
+	return fmt.Sprintf("%s -> %s", r.Slug, r.Handler)
+}
+
+// LoadRoutes reads routes from one or more routes.yaml files.
+func LoadRoutes(paths ...string) ([]Route, error) {
+	var routes []Route
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read routes: %w", err)
+		}
+
+		parsed, err := ParseRoutes(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for i := range parsed {
+			parsed[i].Source = path
+		}
+		routes = append(routes, parsed...)
+	}
+	return routes, nil
+}
+
+// ParseRoutes parses a routes document. An optional frontmatter block may
+// declare the slug shared by all routes that do not set their own:
+//
+//	---
+//	slug: user.created
+//	---
+//	routes:
+//	  - handler: user.saveProfile
+//	  - handler: notification.sendWelcome
+//	    async: true
+//	    retries: 3
+func ParseRoutes(data []byte) ([]Route, error) {
+	doc, err := parseRoutesDocument(data)
+	if err != nil {
+		return nil, err
+	}
+	return doc.Routes, nil
+}
+
+// Endpoint exposes a slug over HTTP: requests matching Method and Path are
+// turned into a message of the slug, sent with Request and answered with
+// the reply. Endpoints are declared next to routes in routes.yaml and
+// registered on a router by the endpoint package.
+type Endpoint struct {
+	Method string `yaml:"method"` // HTTP method, default GET
+	Path   string `yaml:"path"`   // route pattern, e.g. /users/{id}
+	Slug   string `yaml:"slug"`   // defaults to the file's slug
+	Type   string `yaml:"type"`   // message type; defaults to the file's type
+	Status int    `yaml:"status"` // response status, default 200 or 204 without a reply
+	Name   string `yaml:"name"`   // route name for building URLs
+	Source string `yaml:"-"`      // file the endpoint was declared in
+}
+
+// String describes the endpoint for error messages.
+func (e Endpoint) String() string {
+	if e.Source != "" {
+		return fmt.Sprintf("%s: %s %s -> %s", e.Source, e.Method, e.Path, e.Slug)
+	}
+	return fmt.Sprintf("%s %s -> %s", e.Method, e.Path, e.Slug)
+}
+
+// LoadEndpoints reads endpoints from one or more routes.yaml files.
+func LoadEndpoints(paths ...string) ([]Endpoint, error) {
+	var endpoints []Endpoint
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read routes: %w", err)
+		}
+
+		parsed, err := ParseEndpoints(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		for i := range parsed {
+			parsed[i].Source = path
+		}
+		endpoints = append(endpoints, parsed...)
+	}
+	return endpoints, nil
+}
+
+// ParseEndpoints parses the endpoints of a routes document. Endpoints
+// default to the slug and type of the frontmatter, so a nemeton can expose
+// its messages over HTTP without writing handlers:
+//
+//	---
+//	slug: user.register
+//	type: command
+//	---
+//	routes:
+//	  - handler: user.register
+//	endpoints:
+//	  - method: POST
+//	    path: /users
+//	    status: 201
+func ParseEndpoints(data []byte) ([]Endpoint, error) {
+	doc, err := parseRoutesDocument(data)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range doc.Endpoints {
+		if doc.Endpoints[i].Method == "" {
+			doc.Endpoints[i].Method = http.MethodGet
+		}
+		doc.Endpoints[i].Method = strings.ToUpper(doc.Endpoints[i].Method)
+		if doc.Endpoints[i].Type == "" {
+			doc.Endpoints[i].Type = doc.meta.Type
+		}
+	}
+	return doc.Endpoints, nil
+}
+
+// routesDocument is the content of a routes.yaml file.
+type routesDocument struct {
+	Routes    []Route    `yaml:"routes"`
+	Endpoints []Endpoint `yaml:"endpoints"`
+
+	meta struct {
+		Slug string `yaml:"slug"`
+		Type string `yaml:"type"`
+	}
+}
+
+// parseRoutesDocument parses a routes document, defaulting the slugs of
+// its routes and endpoints to the one of its frontmatter.
+func parseRoutesDocument(data []byte) (*routesDocument, error) {
+	doc := &routesDocument{}
+	body, err := frontmatter.Parse(bytes.NewReader(data), &doc.meta)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse routes frontmatter: %w", err)
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(body))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(doc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse routes: %w", err)
+	}
+
+	for i := range doc.Routes {
+		if doc.Routes[i].Slug == "" {
+			doc.Routes[i].Slug = doc.meta.Slug
+		}
+	}
+	for i := range doc.Endpoints {
+		if doc.Endpoints[i].Slug == "" {
+			doc.Endpoints[i].Slug = doc.meta.Slug
+		}
+	}
+	return doc, nil
+}
+
+// ValidateRoutes checks every route and reports all problems at once,
+// including handlers that are missing from the container.
+func ValidateRoutes(routes []Route, container touta.Container) error {
+	_, err := resolveRoutes(routes, container)
+	return err
+}
+
+// resolveRoutes validates routes and resolves their handlers.
+func resolveRoutes(routes []Route, container touta.Container) ([]touta.MessageHandler, error) {
+	handlers := make([]touta.MessageHandler, len(routes))
+	var errs []error
+
+	for i, route := range routes {
+		switch {
+		case route.Slug == "":
+			errs = append(errs, fmt.Errorf("route %s: slug is required", route))
+			continue
+		case route.Handler == "":
+			errs = append(errs, fmt.Errorf("route %s: handler is required", route))
+			continue
+		case route.Retries < 0 || route.Concurrency < 0 || route.RetryDelay < 0:
+			errs = append(errs, fmt.Errorf("route %s: retries, retry_delay and concurrency must not be negative", route))
+			continue
+		}
+
+		if !container.Has(route.Handler) {
+			errs = append(errs, fmt.Errorf("route %s: handler %s not found", route, route.Handler))
+			continue
+		}
+
+		instance, err := container.Make(route.Handler)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("route %s: failed to resolve handler: %w", route, err))
+			continue
+		}
+
+		switch h := instance.(type) {
+		case touta.MessageHandler:
+			handlers[i] = h
+		case func(context.Context, touta.Message) (touta.Message, error):
+			handlers[i] = HandlerFunc(h)
+		default:
+			errs = append(errs, fmt.Errorf("route %s: %T is not a message handler", route, instance))
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	return handlers, nil
+}
+
+// RouteOption configures routes bound by BindRoutes.
+type RouteOption func(*RouteBinding)
+
+// WithRouteErrorHandler sets a callback for failures of async routes, which
+// have no caller to return their error to. Errors are dropped by default.
+func WithRouteErrorHandler(fn func(Route, error)) RouteOption {
+	return func(b *RouteBinding) {
+		b.onError = fn
+	}
+}
+
+// RouteBinding holds the subscriptions created by BindRoutes.
+type RouteBinding struct {
+	subs    []touta.Subscription
+	onError func(Route, error)
+	wg      sync.WaitGroup
+}
+
+// BindRoutes validates routes and subscribes their handlers to the bus.
+// Nothing is subscribed when any route is invalid.
+func BindRoutes(bus touta.MessageBus, container touta.Container, routes []Route, opts ...RouteOption) (*RouteBinding, error) {
+	handlers, err := resolveRoutes(routes, container)
+	if err != nil {
+		return nil, err
+	}
+
+	binding := &RouteBinding{}
+	for _, opt := range opts {
+		opt(binding)
+	}
+
+	for i, route := range routes {
+		handler := &routedHandler{route: route, handler: handlers[i], binding: binding}
+		if route.Concurrency > 0 {
+			handler.slots = make(chan struct{}, route.Concurrency)
+		}
+
+		sub, err := bus.Subscribe(route.Slug, handler)
+		if err != nil {
+			binding.Close(context.Background())
+			return nil, fmt.Errorf("route %s: %w", route, err)
+		}
+		binding.subs = append(binding.subs, sub)
+	}
+	return binding, nil
+}
+
+// Message routers of MessageBusConfig.
+const (
+	RouterConfigBased = "config-based" // routes are bound from the routes.yaml files listed
+	RouterCodeBased   = "code-based"   // handlers are subscribed in code
+)
+
+// BindConfig binds the routes of the message_bus section of touta.yaml.
+// When its router is config-based, the routes.yaml files it lists, which
+// may be glob patterns such as nemetons/*/routes.yaml, are loaded and
+// bound with BindRoutes. Code-based configs bind nothing and return an
+// empty binding.
+func BindConfig(bus touta.MessageBus, container touta.Container, cfg touta.MessageBusConfig, opts ...RouteOption) (*RouteBinding, error) {
+	switch cfg.Router {
+	case RouterConfigBased:
+	case "", RouterCodeBased:
+		return &RouteBinding{}, nil
+	default:
+		return nil, fmt.Errorf("invalid message bus router: %s", cfg.Router)
+	}
+
+	var paths []string
+	for _, pattern := range cfg.Routes {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid routes pattern %s: %w", pattern, err)
+		}
+		if len(matches) == 0 && !hasGlobMeta(pattern) {
+			matches = []string{pattern} // reported as missing by LoadRoutes
+		}
+		paths = append(paths, matches...)
+	}
+
+	routes, err := LoadRoutes(paths...)
+	if err != nil {
+		return nil, err
+	}
+	return BindRoutes(bus, container, routes, opts...)
+}
+
+func hasGlobMeta(pattern string) bool {
+	return strings.ContainsAny(pattern, `*?[\`)
+}
+
+// Subscriptions returns the subscriptions created for the routes.
+func (b *RouteBinding) Subscriptions() []touta.Subscription {
+	return b.subs
+}
+
+// Close unsubscribes all routes and waits for running async handlers.
+func (b *RouteBinding) Close(ctx context.Context) error {
+	for _, sub := range b.subs {
+		sub.Unsubscribe()
+	}
+
+	done := make(chan struct{})
+	go func() {
+		b.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// routedHandler applies a route's async, retry and concurrency settings.
+type routedHandler struct {
+	route   Route
+	handler touta.MessageHandler
+	binding *RouteBinding
+	slots   chan struct{}
+}
+
+// Handle implements MessageHandler.
+func (h *routedHandler) Handle(ctx context.Context, msg touta.Message) (touta.Message, error) {
+	if !h.route.Async {
+		return h.run(ctx, msg)
+	}
+
+	// The caller may cancel its context as soon as we return
+	ctx = context.WithoutCancel(ctx)
+	h.binding.wg.Add(1)
+	go func() {
+		defer h.binding.wg.Done()
+		if _, err := h.run(ctx, msg); err != nil && h.binding.onError != nil {
+			h.binding.onError(h.route, err)
+		}
+	}()
+	return nil, nil
+}
+
+// run invokes the handler, honouring the concurrency limit and retries.
+func (h *routedHandler) run(ctx context.Context, msg touta.Message) (touta.Message, error) {
+	if h.slots != nil {
+		select {
+		case h.slots <- struct{}{}:
+			defer func() { <-h.slots }()
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	var err error
+	for attempt := 0; attempt <= h.route.Retries; attempt++ {
+		if attempt > 0 {
+			ReportRetry(ctx)
+		}
+		if attempt > 0 && h.route.RetryDelay > 0 {
+			timer := time.NewTimer(h.route.RetryDelay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return nil, errors.Join(err, ctx.Err())
+			}
+		}
+
+		var reply touta.Message
+		if reply, err = h.handler.Handle(ctx, msg); err == nil {
+			return reply, nil
+		}
+	}
+	return nil, err
+}
@@ -0,0 +1,272 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/toutaio/toutago/internal/di"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+const testRoutes = `---
+slug: user.created
+type: event
+---
+routes:
+  - handler: user.saveProfile
+    retries: 2
+  - handler: notification.sendWelcome
+    async: true
+    concurrency: 1
+  - slug: "*"
+    handler: audit.log
+    retry_delay: 10ms
+`
+
+func TestParseRoutes(t *testing.T) {
+	routes, err := ParseRoutes([]byte(testRoutes))
+	if err != nil {
+		t.Fatalf("ParseRoutes failed: %v", err)
+	}
+
+	if len(routes) != 3 {
+		t.Fatalf("Expected 3 routes, got %d", len(routes))
+	}
+	if routes[0].Slug != "user.created" || routes[0].Retries != 2 {
+		t.Errorf("Unexpected first route %+v", routes[0])
+	}
+	if !routes[1].Async || routes[1].Concurrency != 1 {
+		t.Errorf("Unexpected second route %+v", routes[1])
+	}
+	if routes[2].Slug != "*" || routes[2].RetryDelay != 10*time.Millisecond {
+		t.Errorf("Unexpected third route %+v", routes[2])
+	}
+
+	if _, err := ParseRoutes([]byte("routes:\n  - handler: x\n    condition: a == b\n")); err == nil {
+		t.Error("ParseRoutes should reject unknown fields")
+	}
+}
+
+func TestLoadRoutes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	os.WriteFile(path, []byte(testRoutes), 0644)
+
+	routes, err := LoadRoutes(path)
+	if err != nil {
+		t.Fatalf("LoadRoutes failed: %v", err)
+	}
+	if routes[0].Source != path {
+		t.Errorf("Expected source %s, got %s", path, routes[0].Source)
+	}
+}
+
+const testEndpoints = `---
+slug: user.register
+type: command
+---
+routes:
+  - handler: user.register
+endpoints:
+  - method: post
+    path: /users
+    status: 201
+    name: users.register
+  - path: /users/{id}
+    slug: user.get
+    type: query
+`
+
+func TestParseEndpoints(t *testing.T) {
+	endpoints, err := ParseEndpoints([]byte(testEndpoints))
+	if err != nil {
+		t.Fatalf("ParseEndpoints failed: %v", err)
+	}
+
+	want := []Endpoint{
+		{Method: "POST", Path: "/users", Slug: "user.register", Type: "command", Status: 201, Name: "users.register"},
+		{Method: "GET", Path: "/users/{id}", Slug: "user.get", Type: "query"},
+	}
+	if len(endpoints) != len(want) {
+		t.Fatalf("Expected %d endpoints, got %+v", len(want), endpoints)
+	}
+	for i := range want {
+		if endpoints[i] != want[i] {
+			t.Errorf("endpoint %d = %+v, want %+v", i, endpoints[i], want[i])
+		}
+	}
+
+	// Routes files with endpoints still parse as routes
+	routes, err := ParseRoutes([]byte(testEndpoints))
+	if err != nil || len(routes) != 1 || routes[0].Slug != "user.register" {
+		t.Errorf("Unexpected routes %+v, %v", routes, err)
+	}
+
+	if _, err := ParseEndpoints([]byte("endpoints:\n  - path: /x\n    handler: x\n")); err == nil {
+		t.Error("ParseEndpoints should reject unknown fields")
+	}
+}
+
+func TestLoadEndpoints(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.yaml")
+	os.WriteFile(path, []byte(testEndpoints), 0644)
+
+	endpoints, err := LoadEndpoints(path)
+	if err != nil {
+		t.Fatalf("LoadEndpoints failed: %v", err)
+	}
+	if len(endpoints) != 2 || endpoints[0].Source != path {
+		t.Errorf("Expected endpoints from %s, got %+v", path, endpoints)
+	}
+}
+
+func TestValidateRoutes_ReportsAllMissingHandlers(t *testing.T) {
+	container := di.NewContainer()
+	container.Bind("user.saveProfile", &testHandler{})
+	container.Bind("not.a.handler", "oops")
+
+	routes := []Route{
+		{Slug: "user.created", Handler: "user.saveProfile"},
+		{Slug: "user.created", Handler: "missing.one"},
+		{Slug: "user.created", Handler: "missing.two"},
+		{Slug: "user.created", Handler: "not.a.handler"},
+	}
+
+	err := ValidateRoutes(routes, container)
+	if err == nil {
+		t.Fatal("ValidateRoutes should fail")
+	}
+	for _, want := range []string{"missing.one", "missing.two", "not a message handler"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Expected error to mention %q, got %v", want, err)
+		}
+	}
+}
+
+func TestBindRoutes(t *testing.T) {
+	bus := NewBus()
+	bus.Start(context.Background())
+	defer bus.Stop(context.Background())
+
+	var attempts atomic.Int32
+	flaky := HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		if attempts.Add(1) < 3 {
+			return nil, errors.New("temporary failure")
+		}
+		return nil, nil
+	})
+
+	release := make(chan struct{})
+	var welcomed sync.WaitGroup
+	welcomed.Add(1)
+	welcome := HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		<-release
+		welcomed.Done()
+		return nil, nil
+	})
+
+	// Functions are treated as constructors by Bind, so hand them out via factories
+	container := di.NewContainer()
+	container.Factory("user.saveProfile", func(touta.Container) (interface{}, error) { return flaky, nil })
+	container.Factory("notification.sendWelcome", func(touta.Container) (interface{}, error) { return welcome, nil })
+	container.Bind("audit.log", &testHandler{})
+
+	routes, _ := ParseRoutes([]byte(testRoutes))
+	binding, err := BindRoutes(bus, container, routes)
+	if err != nil {
+		t.Fatalf("BindRoutes failed: %v", err)
+	}
+
+	msg := &testMessage{BaseMessage: BaseMessage{MessageSlug: "user.created", MessageType: "event"}}
+
+	// The async route blocks, so PublishSync returning proves it ran in the background
+	if err := bus.PublishSync(context.Background(), msg); err != nil {
+		t.Fatalf("PublishSync failed: %v", err)
+	}
+	if attempts.Load() != 3 {
+		t.Errorf("Expected 3 attempts, got %d", attempts.Load())
+	}
+
+	close(release)
+	welcomed.Wait()
+
+	if err := binding.Close(context.Background()); err != nil {
+		t.Fatalf("Close failed: %v", err)
+	}
+	for _, sub := range binding.Subscriptions() {
+		select {
+		case <-sub.Done():
+		default:
+			t.Errorf("Subscription %s should be removed by Close", sub.Pattern())
+		}
+	}
+}
+
+func TestBindConfig(t *testing.T) {
+	bus := NewBus()
+	bus.Start(context.Background())
+	defer bus.Stop(context.Background())
+
+	dir := t.TempDir()
+	os.MkdirAll(filepath.Join(dir, "users"), 0755)
+	os.WriteFile(filepath.Join(dir, "users", "routes.yaml"), []byte("---\nslug: user.created\n---\nroutes:\n  - handler: audit.log\n"), 0644)
+
+	audit := &testHandler{}
+	container := di.NewContainer()
+	container.Bind("audit.log", audit)
+
+	binding, err := BindConfig(bus, container, touta.MessageBusConfig{
+		Router: RouterConfigBased,
+		Routes: []string{filepath.Join(dir, "*", "routes.yaml")},
+	})
+	if err != nil {
+		t.Fatalf("BindConfig failed: %v", err)
+	}
+	defer binding.Close(context.Background())
+
+	bus.PublishSync(context.Background(), &testMessage{BaseMessage: BaseMessage{MessageSlug: "user.created"}})
+	if !audit.received {
+		t.Error("Routes listed in the config should be bound")
+	}
+
+	// Code-based configs leave subscriptions to the application
+	if binding, err := BindConfig(bus, container, touta.MessageBusConfig{Router: RouterCodeBased, Routes: []string{"x.yaml"}}); err != nil || len(binding.Subscriptions()) != 0 {
+		t.Errorf("Expected nothing bound for a code-based config, got %v, %v", binding, err)
+	}
+
+	if _, err := BindConfig(bus, container, touta.MessageBusConfig{
+		Router: RouterConfigBased,
+		Routes: []string{filepath.Join(dir, "missing.yaml")},
+	}); err == nil {
+		t.Error("Expected an error for a missing routes file")
+	}
+}
+
+func TestBindRoutes_InvalidRoutesBindNothing(t *testing.T) {
+	bus := NewBus()
+	bus.Start(context.Background())
+	defer bus.Stop(context.Background())
+
+	handler := &testHandler{}
+	container := di.NewContainer()
+	container.Bind("good", handler)
+
+	_, err := BindRoutes(bus, container, []Route{
+		{Slug: "test.routes", Handler: "good"},
+		{Slug: "test.routes", Handler: "missing"},
+	})
+	if err == nil {
+		t.Fatal("BindRoutes should fail for a missing handler")
+	}
+
+	bus.PublishSync(context.Background(), &testMessage{BaseMessage: BaseMessage{MessageSlug: "test.routes"}})
+	if handler.wasReceived() {
+		t.Error("No route should be bound when validation fails")
+	}
+}
@@ -0,0 +1,202 @@
+package message
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+
+	"github.com/toutaio/toutago/internal/validation"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// MetaSchemaVersion is the metadata key carrying the payload schema version.
+// Messages without it are treated as version 1.
+const MetaSchemaVersion = "schema_version"
+
+// Versioned is implemented by message types whose payload schema has
+// evolved. The codec stamps the version on encode and upcasts older
+// payloads to it on decode.
+type Versioned interface {
+	SchemaVersion() int
+}
+
+// Upcaster transforms a JSON payload from one schema version to the next.
+type Upcaster func(payload map[string]interface{}) (map[string]interface{}, error)
+
+// RegisterUpcaster registers fn to transform payloads of slug from version
+// from to version from+1. Upcasters are chained, so v1 payloads pass through
+// every step until they reach the current version.
+func (c *Codec) RegisterUpcaster(slug string, from int, fn Upcaster) error {
+	if from < 1 {
+		return fmt.Errorf("upcaster version must be at least 1, got %d", from)
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.upcasters[slug] == nil {
+		c.upcasters[slug] = make(map[int]Upcaster)
+	}
+	if _, exists := c.upcasters[slug][from]; exists {
+		return fmt.Errorf("upcaster for %s v%d already registered", slug, from)
+	}
+	c.upcasters[slug][from] = fn
+	return nil
+}
+
+// upcast applies the upcaster chain for env.Slug and returns the envelope
+// at the version its registered type expects, or at the last version the
+// chain reaches when no versioned type is registered.
+func (c *Codec) upcast(env Envelope) (Envelope, error) {
+	c.mu.RLock()
+	chain := c.upcasters[env.Slug]
+	typ, registered := c.types[env.Slug]
+	c.mu.RUnlock()
+
+	version := schemaVersion(env.Metadata)
+	target := 0
+	if registered {
+		if v, ok := reflect.New(typ).Interface().(Versioned); ok {
+			target = v.SchemaVersion()
+		}
+	}
+	if version == target || (target == 0 && chain[version] == nil) {
+		return env, nil
+	}
+	if target != 0 && version > target {
+		return env, fmt.Errorf("message %s has schema v%d, newer than supported v%d", env.Slug, version, target)
+	}
+
+	var payload map[string]interface{}
+	if len(env.Payload) > 0 {
+		if err := json.Unmarshal(env.Payload, &payload); err != nil {
+			return env, fmt.Errorf("failed to upcast %s: payload is not an object: %w", env.Slug, err)
+		}
+	}
+
+	for target == 0 || version < target {
+		fn, ok := chain[version]
+		if !ok {
+			if target == 0 {
+				break
+			}
+			return env, fmt.Errorf("no upcaster for %s from v%d to v%d", env.Slug, version, target)
+		}
+
+		var err error
+		if payload, err = fn(payload); err != nil {
+			return env, fmt.Errorf("failed to upcast %s from v%d: %w", env.Slug, version, err)
+		}
+		version++
+	}
+
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return env, fmt.Errorf("failed to upcast %s: %w", env.Slug, err)
+	}
+
+	meta := make(map[string]interface{}, len(env.Metadata)+1)
+	for k, v := range env.Metadata {
+		meta[k] = v
+	}
+	meta[MetaSchemaVersion] = version
+	env.Metadata = meta
+	env.Payload = data
+	return env, nil
+}
+
+// schemaVersion reads the schema version from metadata, defaulting to 1.
+func schemaVersion(meta map[string]interface{}) int {
+	switch v := meta[MetaSchemaVersion].(type) {
+	case int:
+		return v
+	case float64:
+		return int(v)
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return int(n)
+		}
+	}
+	return 1
+}
+
+// stampVersion records the schema version of a Versioned message in its metadata.
+func stampVersion(msg touta.Message) {
+	v, ok := msg.(Versioned)
+	if !ok {
+		return
+	}
+	if meta := msg.Metadata(); meta != nil {
+		if _, exists := meta[MetaSchemaVersion]; !exists {
+			meta[MetaSchemaVersion] = v.SchemaVersion()
+		}
+	}
+}
+
+// Validator checks messages before they are dispatched, see WithValidator.
+// Struct messages are checked against their `validate` tags, and messages
+// whose slug has a registered JSON Schema are checked against it.
+type Validator struct {
+	schemas map[string]*validation.Schema
+	mu      sync.RWMutex
+}
+
+// NewValidator creates a message validator.
+func NewValidator() *Validator {
+	return &Validator{
+		schemas: make(map[string]*validation.Schema),
+	}
+}
+
+// RegisterSchema validates payloads of slug against schema.
+func (v *Validator) RegisterSchema(slug string, schema *validation.Schema) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.schemas[slug] = schema
+}
+
+// Validate checks msg. Failures wrap validation.Errors, listing every field.
+func (v *Validator) Validate(msg touta.Message) error {
+	if reflect.Indirect(reflect.ValueOf(msg)).Kind() == reflect.Struct {
+		if err := validation.Struct(msg); err != nil {
+			return fmt.Errorf("invalid %s message: %w", msg.Slug(), err)
+		}
+	}
+
+	v.mu.RLock()
+	schema, ok := v.schemas[msg.Slug()]
+	v.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+
+	payload, err := payloadOf(msg)
+	if err != nil {
+		return err
+	}
+	if err := schema.ValidateJSON(payload); err != nil {
+		return fmt.Errorf("invalid %s message: %w", msg.Slug(), err)
+	}
+	return nil
+}
+
+// payloadOf returns the JSON payload of msg as the codec would encode it.
+func payloadOf(msg touta.Message) ([]byte, error) {
+	if raw, ok := msg.(*RawMessage); ok {
+		return raw.Payload, nil
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode message %s: %w", msg.Slug(), err)
+	}
+	return data, nil
+}
+
+// WithValidator rejects messages that fail v from Publish and PublishSync,
+// before any handler runs.
+func WithValidator(v *Validator) Option {
+	return func(b *bus) {
+		b.validator = v
+	}
+}
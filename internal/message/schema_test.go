@@ -0,0 +1,145 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/toutaio/toutago/internal/validation"
+)
+
+// orderPlaced is at schema v3: v1 had "amount" in cents, v2 renamed it to
+// "total_cents", v3 split it into "total" and "currency".
+type orderPlaced struct {
+	BaseMessage
+	OrderID  string  `json:"order_id" validate:"required"`
+	Total    float64 `json:"total" validate:"min=0"`
+	Currency string  `json:"currency"`
+}
+
+func (m *orderPlaced) Slug() string       { return "order.placed" }
+func (m *orderPlaced) SchemaVersion() int { return 3 }
+
+func newOrderCodec(t *testing.T) *Codec {
+	t.Helper()
+
+	codec := NewCodec()
+	codec.Register(&orderPlaced{})
+	codec.RegisterUpcaster("order.placed", 1, func(p map[string]interface{}) (map[string]interface{}, error) {
+		p["total_cents"] = p["amount"]
+		delete(p, "amount")
+		return p, nil
+	})
+	codec.RegisterUpcaster("order.placed", 2, func(p map[string]interface{}) (map[string]interface{}, error) {
+		cents, ok := p["total_cents"].(float64)
+		if !ok {
+			return nil, errors.New("total_cents missing")
+		}
+		p["total"] = cents / 100
+		p["currency"] = "EUR"
+		delete(p, "total_cents")
+		return p, nil
+	})
+	return codec
+}
+
+func TestCodec_UpcastsOldPayloads(t *testing.T) {
+	codec := newOrderCodec(t)
+
+	// A v1 message as persisted by an older release, without schema_version
+	old := []byte(`{"slug":"order.placed","type":"event","payload":{"order_id":"42","amount":1250}}`)
+	msg, err := codec.Unmarshal(old)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	order := msg.(*orderPlaced)
+	if order.Total != 12.5 || order.Currency != "EUR" || order.OrderID != "42" {
+		t.Errorf("Unexpected upcast message %+v", order)
+	}
+	if schemaVersion(order.Metadata()) != 3 {
+		t.Errorf("Expected schema v3, got %v", order.Metadata()[MetaSchemaVersion])
+	}
+}
+
+func TestCodec_StampsSchemaVersion(t *testing.T) {
+	codec := newOrderCodec(t)
+
+	env, err := codec.Encode(&orderPlaced{OrderID: "1", Total: 3})
+	if err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	if env.Metadata[MetaSchemaVersion] != 3 {
+		t.Errorf("Expected schema_version 3, got %v", env.Metadata[MetaSchemaVersion])
+	}
+
+	// Current payloads are decoded without upcasting
+	data, _ := codec.Marshal(&orderPlaced{OrderID: "1", Total: 3, Currency: "USD"})
+	msg, err := codec.Unmarshal(data)
+	if err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if msg.(*orderPlaced).Currency != "USD" {
+		t.Errorf("Current payload should not be upcast, got %+v", msg)
+	}
+}
+
+func TestCodec_UpcastErrors(t *testing.T) {
+	codec := NewCodec()
+	codec.Register(&orderPlaced{})
+
+	_, err := codec.Unmarshal([]byte(`{"slug":"order.placed","payload":{}}`))
+	if err == nil || !strings.Contains(err.Error(), "no upcaster for order.placed from v1") {
+		t.Errorf("Expected a missing upcaster error, got %v", err)
+	}
+
+	_, err = codec.Unmarshal([]byte(`{"slug":"order.placed","metadata":{"schema_version":4},"payload":{}}`))
+	if err == nil {
+		t.Error("Newer schema versions should be rejected")
+	}
+
+	if err := codec.RegisterUpcaster("order.placed", 0, nil); err == nil {
+		t.Error("RegisterUpcaster should reject version 0")
+	}
+}
+
+func TestBus_ValidatesBeforeDispatch(t *testing.T) {
+	schema, _ := validation.ParseSchema([]byte(`{
+		"type": "object",
+		"properties": {"currency": {"enum": ["EUR", "USD"]}}
+	}`))
+	validator := NewValidator()
+	validator.RegisterSchema("order.placed", schema)
+
+	bus := NewBus(WithValidator(validator))
+	bus.Start(context.Background())
+	defer bus.Stop(context.Background())
+
+	handler := &testHandler{}
+	bus.Subscribe("order.placed", handler)
+
+	err := bus.PublishSync(context.Background(), &orderPlaced{Total: -1, Currency: "GBP"})
+	var errs validation.Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected validation errors, got %v", err)
+	}
+	if len(errs) != 2 {
+		t.Errorf("Expected the two struct tag errors, got %v", errs)
+	}
+	if handler.wasReceived() {
+		t.Error("Invalid messages must not reach handlers")
+	}
+
+	if err := bus.Publish(context.Background(), &orderPlaced{OrderID: "1", Currency: "GBP"}); !errors.As(err, &errs) {
+		t.Errorf("Publish should validate against the schema, got %v", err)
+	}
+
+	msg := &orderPlaced{OrderID: "1", Currency: "EUR"}
+	if err := bus.PublishSync(context.Background(), msg); err != nil {
+		t.Fatalf("Valid message rejected: %v", err)
+	}
+	if msg.Metadata()[MetaSchemaVersion] != 3 {
+		t.Error("Published messages should carry their schema version")
+	}
+}
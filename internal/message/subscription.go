@@ -0,0 +1,80 @@
+package message
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// subscription implements the Subscription interface for the in-process bus.
+type subscription struct {
+	bus      *bus
+	pattern  string
+	handler  touta.MessageHandler
+	key      string // identifies the subscription across restarts, set by add
+	once     bool
+	fired    atomic.Bool
+	done     chan struct{}
+	doneOnce sync.Once
+}
+
+// newSubscription creates a subscription bound to a bus.
+func newSubscription(b *bus, pattern string, handler touta.MessageHandler, once bool) *subscription {
+	return &subscription{
+		bus:     b,
+		pattern: pattern,
+		handler: handler,
+		once:    once,
+		done:    make(chan struct{}),
+	}
+}
+
+// Pattern returns the pattern the handler is bound to.
+func (s *subscription) Pattern() string {
+	return s.pattern
+}
+
+// Unsubscribe removes the handler from the bus.
+func (s *subscription) Unsubscribe() error {
+	s.bus.remove(s)
+	return nil
+}
+
+// Done returns a channel that is closed once the subscription is removed.
+func (s *subscription) Done() <-chan struct{} {
+	return s.done
+}
+
+// claim reports whether the handler may receive the current message.
+// One-shot subscriptions are claimed by the first message only and are
+// removed from the bus as a side effect.
+func (s *subscription) claim() bool {
+	if !s.once {
+		return true
+	}
+	if !s.fired.CompareAndSwap(false, true) {
+		return false
+	}
+	s.bus.remove(s)
+	return true
+}
+
+// close marks the subscription as removed.
+func (s *subscription) close() {
+	s.doneOnce.Do(func() {
+		close(s.done)
+	})
+}
+
+// bindContext removes the subscription when ctx is done.
+func (s *subscription) bindContext(ctx context.Context) {
+	go func() {
+		select {
+		case <-ctx.Done():
+			s.bus.remove(s)
+		case <-s.done:
+		}
+	}()
+}
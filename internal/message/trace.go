@@ -0,0 +1,109 @@
+package message
+
+import (
+	"context"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// MetaTraceParent is the metadata key carrying the W3C traceparent of a message.
+const MetaTraceParent = "traceparent"
+
+// SpanContext identifies a span in a distributed trace, in the format used
+// by OpenTelemetry and the W3C Trace Context specification.
+type SpanContext struct {
+	TraceID string // 32 lowercase hex characters
+	SpanID  string // 16 lowercase hex characters
+	Sampled bool
+}
+
+// IsValid reports whether the span context has a trace and span ID.
+func (s SpanContext) IsValid() bool {
+	return len(s.TraceID) == 32 && len(s.SpanID) == 16
+}
+
+// TraceParent formats the span context as a traceparent header value.
+func (s SpanContext) TraceParent() string {
+	flags := "00"
+	if s.Sampled {
+		flags = "01"
+	}
+	return fmt.Sprintf("00-%s-%s-%s", s.TraceID, s.SpanID, flags)
+}
+
+// ParseTraceParent parses a traceparent header value.
+func ParseTraceParent(value string) (SpanContext, error) {
+	parts := strings.Split(value, "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", value)
+	}
+	for _, part := range parts {
+		if _, err := hex.DecodeString(part); err != nil || strings.ToLower(part) != part {
+			return SpanContext{}, fmt.Errorf("invalid traceparent %q", value)
+		}
+	}
+	if parts[1] == strings.Repeat("0", 32) || parts[2] == strings.Repeat("0", 16) {
+		return SpanContext{}, fmt.Errorf("invalid traceparent %q", value)
+	}
+
+	flags, _ := hex.DecodeString(parts[3])
+	return SpanContext{
+		TraceID: parts[1],
+		SpanID:  parts[2],
+		Sampled: flags[0]&1 == 1,
+	}, nil
+}
+
+type spanKey struct{}
+
+// ContextWithSpan returns a context carrying span. Messages published with
+// the returned context become children of span.
+func ContextWithSpan(ctx context.Context, span SpanContext) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext returns the span carried by ctx. Handlers receive the span
+// of the message they are handling.
+func SpanFromContext(ctx context.Context) (SpanContext, bool) {
+	span, ok := ctx.Value(spanKey{}).(SpanContext)
+	return span, ok
+}
+
+// InjectTrace stamps msg with a traceparent unless it already carries one,
+// continuing the trace found in ctx or starting a new one. Buses call it on
+// publish; transports call it before a message leaves the process.
+func InjectTrace(ctx context.Context, msg touta.Message) {
+	meta := msg.Metadata()
+	if meta == nil {
+		return
+	}
+	if _, ok := meta[MetaTraceParent]; ok {
+		return
+	}
+
+	span := SpanContext{Sampled: true}
+	if parent, ok := SpanFromContext(ctx); ok && parent.IsValid() {
+		span.TraceID = parent.TraceID
+		span.Sampled = parent.Sampled
+	} else {
+		span.TraceID = NewID()
+	}
+	span.SpanID = NewID()[:16]
+	meta[MetaTraceParent] = span.TraceParent()
+}
+
+// extractTrace returns ctx carrying the span recorded in msg, if any.
+func extractTrace(ctx context.Context, msg touta.Message) context.Context {
+	value, ok := msg.Metadata()[MetaTraceParent].(string)
+	if !ok {
+		return ctx
+	}
+	span, err := ParseTraceParent(value)
+	if err != nil {
+		return ctx
+	}
+	return ContextWithSpan(ctx, span)
+}
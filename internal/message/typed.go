@@ -0,0 +1,127 @@
+package message
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// ErrUnexpectedType is returned by typed handlers given a message of another type.
+var ErrUnexpectedType = errors.New("unexpected message type")
+
+// As converts msg to the concrete message type T. Messages received from
+// another process as *RawMessage are decoded into T when T is a pointer to a
+// struct. Other mismatches return an error wrapping ErrUnexpectedType.
+func As[T touta.Message](msg touta.Message) (T, error) {
+	if typed, ok := msg.(T); ok {
+		return typed, nil
+	}
+
+	var zero T
+	raw, ok := msg.(*RawMessage)
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+	if !ok || typ.Kind() != reflect.Ptr || typ.Elem().Kind() != reflect.Struct {
+		return zero, fmt.Errorf("%w: %s carries %T, handler expects %s", ErrUnexpectedType, msg.Slug(), msg, typ)
+	}
+
+	ptr := reflect.New(typ.Elem())
+	if len(raw.Payload) > 0 {
+		if err := json.Unmarshal(raw.Payload, ptr.Interface()); err != nil {
+			return zero, fmt.Errorf("%w: %s payload does not decode into %s: %v", ErrUnexpectedType, raw.Slug(), typ, err)
+		}
+	}
+
+	typed := ptr.Interface().(T)
+	if meta := typed.Metadata(); meta != nil {
+		for k, v := range raw.Metadata() {
+			meta[k] = v
+		}
+	}
+	return typed, nil
+}
+
+// Handle adapts a function taking a concrete message type to a MessageHandler.
+func Handle[T touta.Message](fn func(context.Context, T) error) touta.MessageHandler {
+	return &typedHandler{
+		name: funcName(fn),
+		fn: func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+			typed, err := As[T](msg)
+			if err != nil {
+				return nil, err
+			}
+			return nil, fn(ctx, typed)
+		},
+	}
+}
+
+// HandleReply adapts a function taking and returning concrete message types
+// to a MessageHandler.
+func HandleReply[T touta.Message, R touta.Message](fn func(context.Context, T) (R, error)) touta.MessageHandler {
+	return &typedHandler{
+		name: funcName(fn),
+		fn: func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+			typed, err := As[T](msg)
+			if err != nil {
+				return nil, err
+			}
+			reply, err := fn(ctx, typed)
+			if err != nil {
+				return nil, err
+			}
+			// Avoid returning a typed nil pointer as a non-nil interface
+			if v := reflect.ValueOf(reply); !v.IsValid() || (v.Kind() == reflect.Ptr && v.IsNil()) {
+				return nil, nil
+			}
+			return reply, nil
+		},
+	}
+}
+
+// SubscribeTyped subscribes fn to the slug returned by the Slug method of
+// T's zero value, so T must define Slug itself rather than rely on the
+// MessageSlug field of an embedded BaseMessage.
+func SubscribeTyped[T touta.Message](bus touta.MessageBus, fn func(context.Context, T) error) (touta.Subscription, error) {
+	slug, err := SlugOf[T]()
+	if err != nil {
+		return nil, err
+	}
+	return bus.Subscribe(slug, Handle(fn))
+}
+
+// SlugOf returns the slug declared by the message type T.
+func SlugOf[T touta.Message]() (slug string, err error) {
+	typ := reflect.TypeOf((*T)(nil)).Elem()
+
+	var zero T
+	if typ.Kind() == reflect.Ptr {
+		zero = reflect.New(typ.Elem()).Interface().(T)
+	} else if typ.Kind() == reflect.Interface {
+		return "", fmt.Errorf("cannot derive a slug from interface type %s", typ)
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("cannot derive a slug from %s: Slug panicked: %v", typ, r)
+		}
+	}()
+
+	if slug = zero.Slug(); slug == "" {
+		return "", fmt.Errorf("cannot derive a slug from %s: define a Slug method returning a constant", typ)
+	}
+	return slug, nil
+}
+
+// typedHandler is the MessageHandler returned by Handle and HandleReply.
+type typedHandler struct {
+	name string // name of the wrapped function
+	fn   func(context.Context, touta.Message) (touta.Message, error)
+}
+
+// Handle implements MessageHandler.
+func (h *typedHandler) Handle(ctx context.Context, msg touta.Message) (touta.Message, error) {
+	return h.fn(ctx, msg)
+}
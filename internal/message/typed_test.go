@@ -0,0 +1,118 @@
+package message
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+type userCreated struct {
+	BaseMessage
+	UserID string `json:"user_id"`
+}
+
+func (m *userCreated) Slug() string { return "user.created" }
+
+type userDeleted struct {
+	BaseMessage
+}
+
+func TestHandle(t *testing.T) {
+	var got string
+	handler := Handle(func(ctx context.Context, msg *userCreated) error {
+		got = msg.UserID
+		return nil
+	})
+
+	if _, err := handler.Handle(context.Background(), &userCreated{UserID: "42"}); err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+	if got != "42" {
+		t.Errorf("Expected user 42, got %q", got)
+	}
+
+	_, err := handler.Handle(context.Background(), &testMessage{BaseMessage: BaseMessage{MessageSlug: "user.created"}})
+	if !errors.Is(err, ErrUnexpectedType) {
+		t.Fatalf("Expected ErrUnexpectedType, got %v", err)
+	}
+	if !strings.Contains(err.Error(), "*message.testMessage") || !strings.Contains(err.Error(), "*message.userCreated") {
+		t.Errorf("Error should name both types, got %v", err)
+	}
+}
+
+func TestHandle_DecodesRawMessages(t *testing.T) {
+	codec := NewCodec()
+	data, _ := codec.Marshal(&userCreated{
+		BaseMessage: BaseMessage{Meta: map[string]interface{}{MetaMessageID: "abc"}},
+		UserID:      "7",
+	})
+	raw, _ := codec.Unmarshal(data)
+
+	typed, err := As[*userCreated](raw)
+	if err != nil {
+		t.Fatalf("As failed: %v", err)
+	}
+	if typed.UserID != "7" || typed.Metadata()[MetaMessageID] != "abc" {
+		t.Errorf("Unexpected decoded message %+v", typed)
+	}
+}
+
+func TestHandleReply(t *testing.T) {
+	handler := HandleReply(func(ctx context.Context, msg *userCreated) (*testMessage, error) {
+		return &testMessage{payload: "welcome " + msg.UserID}, nil
+	})
+
+	reply, err := handler.Handle(context.Background(), &userCreated{UserID: "1"})
+	if err != nil {
+		t.Fatalf("Handle failed: %v", err)
+	}
+	if reply.(*testMessage).payload != "welcome 1" {
+		t.Errorf("Unexpected reply %+v", reply)
+	}
+
+	empty := HandleReply(func(ctx context.Context, msg *userCreated) (*testMessage, error) {
+		return nil, nil
+	})
+	if reply, _ := empty.Handle(context.Background(), &userCreated{}); reply != nil {
+		t.Errorf("A nil reply should be returned as a nil interface, got %#v", reply)
+	}
+}
+
+func TestSubscribeTyped(t *testing.T) {
+	bus := NewBus()
+	bus.Start(context.Background())
+	defer bus.Stop(context.Background())
+
+	var got *userCreated
+	sub, err := SubscribeTyped(bus, func(ctx context.Context, msg *userCreated) error {
+		got = msg
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("SubscribeTyped failed: %v", err)
+	}
+	if sub.Pattern() != "user.created" {
+		t.Errorf("Expected pattern user.created, got %s", sub.Pattern())
+	}
+
+	bus.PublishSync(context.Background(), &userCreated{UserID: "9"})
+	if got == nil || got.UserID != "9" {
+		t.Errorf("Typed handler should receive the message, got %+v", got)
+	}
+
+	if subs := bus.(Inspector).Subscriptions(); !strings.Contains(subs[0].Handler, "TestSubscribeTyped") {
+		t.Errorf("Typed handlers should be named after the wrapped function, got %s", subs[0].Handler)
+	}
+
+	_, err = SubscribeTyped(bus, func(ctx context.Context, msg *userDeleted) error { return nil })
+	if err == nil {
+		t.Error("SubscribeTyped should fail for types without a constant slug")
+	}
+	_, err = SubscribeTyped(bus, func(ctx context.Context, msg touta.Message) error { return nil })
+	if err == nil {
+		t.Error("SubscribeTyped should fail for interface types")
+	}
+}
@@ -0,0 +1,229 @@
+package middleware
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/andybalholm/brotli"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// EncoderFunc creates a compressing writer for one response.
+type EncoderFunc func(w io.Writer) io.WriteCloser
+
+// CompressOption configures Compress.
+type CompressOption func(*compressor)
+
+// WithEncoder adds or replaces a content encoding. Encodings are preferred
+// in the order they were added, after the client's q-values:
+//
+//	middleware.Compress(middleware.WithEncoder("zstd", func(w io.Writer) io.WriteCloser {
+//	    enc, _ := zstd.NewWriter(w)
+//	    return enc
+//	}))
+func WithEncoder(name string, fn EncoderFunc) CompressOption {
+	return func(c *compressor) {
+		if _, exists := c.encoders[name]; !exists {
+			c.order = append([]string{name}, c.order...)
+		}
+		c.encoders[name] = fn
+	}
+}
+
+// WithCompressionLevel sets the gzip and deflate level. Brotli keeps its
+// default quality, as its levels range from 0 to 11.
+func WithCompressionLevel(level int) CompressOption {
+	return func(c *compressor) {
+		c.encoders["gzip"] = func(w io.Writer) io.WriteCloser {
+			gw, err := gzip.NewWriterLevel(w, level)
+			if err != nil {
+				gw = gzip.NewWriter(w)
+			}
+			return gw
+		}
+		c.encoders["deflate"] = func(w io.Writer) io.WriteCloser {
+			fw, err := flate.NewWriter(w, level)
+			if err != nil {
+				fw, _ = flate.NewWriter(w, flate.DefaultCompression)
+			}
+			return fw
+		}
+	}
+}
+
+type compressor struct {
+	encoders map[string]EncoderFunc
+	order    []string
+}
+
+// Compress compresses responses with brotli, gzip or deflate, preferred in
+// that order on ties, or any encoding added with WithEncoder, as negotiated
+// with the Accept-Encoding header. Only textual content types are
+// compressed, and responses that already carry a Content-Encoding are left
+// alone.
+func Compress(opts ...CompressOption) touta.MiddlewareFunc {
+	c := &compressor{
+		encoders: map[string]EncoderFunc{
+			"br":      func(w io.Writer) io.WriteCloser { return brotli.NewWriter(w) },
+			"gzip":    func(w io.Writer) io.WriteCloser { return gzip.NewWriter(w) },
+			"deflate": func(w io.Writer) io.WriteCloser { fw, _ := flate.NewWriter(w, flate.DefaultCompression); return fw },
+		},
+		order: []string{"br", "gzip", "deflate"},
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	return func(next touta.HandlerFunc) touta.HandlerFunc {
+		return func(ctx touta.Context) error {
+			req := ctx.Request()
+			res := ctx.Response()
+			res.Header().Add("Vary", "Accept-Encoding")
+
+			encoding := c.negotiate(req.Header.Get("Accept-Encoding"))
+			if encoding == "" || req.Method == http.MethodHead || req.Header.Get("Range") != "" {
+				return next(ctx)
+			}
+
+			cw := &compressWriter{ResponseWriter: res, encoding: encoding, newEncoder: c.encoders[encoding]}
+			ctx.SetResponse(cw)
+			err := next(ctx)
+			ctx.SetResponse(res)
+
+			if closeErr := cw.Close(); closeErr != nil && err == nil {
+				err = fmt.Errorf("failed to finish compressed response: %w", closeErr)
+			}
+			return err
+		}
+	}
+}
+
+// negotiate picks the encoding the client prefers among those available.
+func (c *compressor) negotiate(header string) string {
+	if header == "" {
+		return ""
+	}
+
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+				q = parsed
+			}
+		}
+		qualities[strings.ToLower(strings.TrimSpace(name))] = q
+	}
+
+	best, bestQ := "", 0.0
+	for _, name := range c.order {
+		q, ok := qualities[name]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = name, q
+		}
+	}
+	return best
+}
+
+// compressWriter compresses the body once the response turns out to be
+// compressible, which is only known when the headers are written.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding    string
+	newEncoder  EncoderFunc
+	enc         io.WriteCloser
+	wroteHeader bool
+}
+
+func (w *compressWriter) WriteHeader(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+
+	h := w.Header()
+	if status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified &&
+		h.Get("Content-Encoding") == "" && compressible(h.Get("Content-Type")) {
+		h.Set("Content-Encoding", w.encoding)
+		h.Del("Content-Length")
+		w.enc = w.newEncoder(w.ResponseWriter)
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *compressWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		if w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", http.DetectContentType(b))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+	if w.enc != nil {
+		return w.enc.Write(b)
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Flush flushes compressed data buffered so far to the client.
+func (w *compressWriter) Flush() {
+	if f, ok := w.enc.(interface{ Flush() error }); ok {
+		f.Flush()
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker when the underlying writer does.
+func (w *compressWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer %T does not support hijacking", w.ResponseWriter)
+	}
+	return h.Hijack()
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// Close finishes the compressed stream.
+func (w *compressWriter) Close() error {
+	if w.enc == nil {
+		return nil
+	}
+	return w.enc.Close()
+}
+
+// compressible reports whether a content type benefits from compression.
+func compressible(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "+json"),
+		strings.HasSuffix(mediaType, "+xml"):
+		return true
+	}
+	switch mediaType {
+	case "application/json", "application/javascript", "application/xml",
+		"application/yaml", "application/x-yaml", "image/svg+xml":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,111 @@
+package middleware
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andybalholm/brotli"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+func TestCompress_Gzip(t *testing.T) {
+	body := strings.Repeat("hello ", 100)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "br;q=0.5, gzip;q=0.8")
+
+	w := serve(req, func(ctx touta.Context) error {
+		return ctx.String(200, body)
+	}, Compress())
+
+	if w.Header().Get("Content-Encoding") != "gzip" || w.Header().Get("Vary") != "Accept-Encoding" {
+		t.Fatalf("Expected gzip encoding, got %v", w.Header())
+	}
+	gr, err := gzip.NewReader(w.Body)
+	if err != nil {
+		t.Fatalf("Invalid gzip body: %v", err)
+	}
+	if out, _ := io.ReadAll(gr); string(out) != body {
+		t.Error("Decompressed body does not match")
+	}
+}
+
+func TestCompress_Brotli(t *testing.T) {
+	body := strings.Repeat("hello ", 100)
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip, deflate, br")
+
+	w := serve(req, func(ctx touta.Context) error {
+		return ctx.String(200, body)
+	}, Compress())
+
+	if w.Header().Get("Content-Encoding") != "br" {
+		t.Fatalf("Expected brotli to be preferred on ties, got %v", w.Header())
+	}
+	if w.Body.Len() >= len(body) {
+		t.Errorf("Expected a compressed body, got %d bytes for %d", w.Body.Len(), len(body))
+	}
+	if out, _ := io.ReadAll(brotli.NewReader(w.Body)); string(out) != body {
+		t.Error("Decompressed body does not match")
+	}
+}
+
+func TestCompress_Skips(t *testing.T) {
+	tests := []struct {
+		name           string
+		acceptEncoding string
+		contentType    string
+	}{
+		{"no accept-encoding", "", "text/plain"},
+		{"unsupported encoding", "zstd", "text/plain"},
+		{"refused encoding", "gzip;q=0", "text/plain"},
+		{"binary content", "gzip", "image/png"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.Header.Set("Accept-Encoding", tt.acceptEncoding)
+			w := serve(req, func(ctx touta.Context) error {
+				return ctx.Blob(200, tt.contentType, []byte("data"))
+			}, Compress())
+
+			if w.Header().Get("Content-Encoding") != "" || w.Body.String() != "data" {
+				t.Errorf("Response should not be compressed, got %v", w.Header())
+			}
+		})
+	}
+}
+
+func TestCompress_CustomEncoder(t *testing.T) {
+	var used bool
+	mw := Compress(WithEncoder("zstd", func(w io.Writer) io.WriteCloser {
+		used = true
+		return nopCloser{w}
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip, br, zstd")
+	w := serve(req, ok, mw)
+	if !used || w.Header().Get("Content-Encoding") != "zstd" {
+		t.Errorf("Custom encoders should be preferred on ties, got %q", w.Header().Get("Content-Encoding"))
+	}
+}
+
+func TestCompress_ErrorsRenderUncompressed(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	w := serve(req, func(ctx touta.Context) error {
+		return touta.NewHTTPError(404, "")
+	}, Compress())
+
+	if w.Code != 404 || w.Header().Get("Content-Encoding") != "" {
+		t.Errorf("Expected a plain 404, got %d %v", w.Code, w.Header())
+	}
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
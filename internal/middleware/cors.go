@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// Methods allowed when CORSConfig.AllowedMethods is empty.
+var defaultCORSMethods = []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE"}
+
+// CORS handles cross-origin requests as configured by cfg. Preflight
+// requests are answered directly with 204 and never reach the handler;
+// preflights asking for a disallowed method or header get 403. Allowed
+// origins may be "*" or contain one wildcard, e.g. https://*.example.com.
+// With AllowCredentials the request origin is echoed instead of "*", as
+// browsers require.
+func CORS(cfg touta.CORSConfig) touta.MiddlewareFunc {
+	methods := cfg.AllowedMethods
+	if len(methods) == 0 {
+		methods = defaultCORSMethods
+	}
+	allowedMethods := strings.Join(methods, ", ")
+	anyHeader := contains(cfg.AllowedHeaders, "*")
+	exposed := strings.Join(cfg.ExposeHeaders, ", ")
+
+	return func(next touta.HandlerFunc) touta.HandlerFunc {
+		return func(ctx touta.Context) error {
+			req := ctx.Request()
+			header := ctx.Response().Header()
+			origin := req.Header.Get("Origin")
+			preflight := req.Method == http.MethodOptions && req.Header.Get("Access-Control-Request-Method") != ""
+
+			header.Add("Vary", "Origin")
+			if preflight {
+				header.Add("Vary", "Access-Control-Request-Method")
+				header.Add("Vary", "Access-Control-Request-Headers")
+			}
+			if origin == "" {
+				return next(ctx)
+			}
+			if !originAllowed(cfg.AllowedOrigins, origin) {
+				if preflight {
+					return touta.NewHTTPError(http.StatusForbidden, "origin not allowed")
+				}
+				return next(ctx)
+			}
+
+			if contains(cfg.AllowedOrigins, "*") && !cfg.AllowCredentials {
+				header.Set("Access-Control-Allow-Origin", "*")
+			} else {
+				header.Set("Access-Control-Allow-Origin", origin)
+			}
+			if cfg.AllowCredentials {
+				header.Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				if exposed != "" {
+					header.Set("Access-Control-Expose-Headers", exposed)
+				}
+				return next(ctx)
+			}
+
+			method := req.Header.Get("Access-Control-Request-Method")
+			if !containsFold(methods, method) {
+				return touta.NewHTTPError(http.StatusForbidden, "method not allowed by CORS policy")
+			}
+			requested := req.Header.Get("Access-Control-Request-Headers")
+			if requested != "" && !anyHeader {
+				for _, h := range strings.Split(requested, ",") {
+					if h = strings.TrimSpace(h); h != "" && !containsFold(cfg.AllowedHeaders, h) {
+						return touta.NewHTTPError(http.StatusForbidden, "header "+h+" not allowed by CORS policy")
+					}
+				}
+			}
+
+			header.Set("Access-Control-Allow-Methods", allowedMethods)
+			if anyHeader {
+				if requested != "" {
+					header.Set("Access-Control-Allow-Headers", requested)
+				}
+			} else if len(cfg.AllowedHeaders) > 0 {
+				header.Set("Access-Control-Allow-Headers", strings.Join(cfg.AllowedHeaders, ", "))
+			}
+			if cfg.MaxAge > 0 {
+				header.Set("Access-Control-Max-Age", strconv.Itoa(cfg.MaxAge))
+			}
+			ctx.Response().WriteHeader(http.StatusNoContent)
+			return nil
+		}
+	}
+}
+
+// originAllowed matches origin against the allowed origins.
+func originAllowed(allowed []string, origin string) bool {
+	for _, pattern := range allowed {
+		if pattern == "*" || strings.EqualFold(pattern, origin) {
+			return true
+		}
+		if prefix, suffix, ok := strings.Cut(pattern, "*"); ok {
+			if len(origin) > len(prefix)+len(suffix) &&
+				strings.HasPrefix(origin, prefix) && strings.HasSuffix(origin, suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(list []string, s string) bool {
+	for _, v := range list {
+		if strings.EqualFold(v, s) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+func TestCORS_SimpleRequest(t *testing.T) {
+	cfg := touta.CORSConfig{
+		AllowedOrigins: []string{"https://*.example.com"},
+		ExposeHeaders:  []string{"X-Total-Count"},
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	w := serve(req, ok, CORS(cfg))
+
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://app.example.com" {
+		t.Errorf("Expected the origin to be echoed, got %q", w.Header().Get("Access-Control-Allow-Origin"))
+	}
+	if w.Header().Get("Access-Control-Expose-Headers") != "X-Total-Count" {
+		t.Errorf("Expected exposed headers, got %q", w.Header().Get("Access-Control-Expose-Headers"))
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Origin", "https://evil.com")
+	w = serve(req, ok, CORS(cfg))
+	if w.Code != 200 || w.Header().Get("Access-Control-Allow-Origin") != "" {
+		t.Error("Disallowed origins should get no CORS headers")
+	}
+}
+
+func TestCORS_WildcardAndCredentials(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("Origin", "https://a.com")
+
+	w := serve(req, ok, CORS(touta.CORSConfig{AllowedOrigins: []string{"*"}}))
+	if w.Header().Get("Access-Control-Allow-Origin") != "*" {
+		t.Errorf("Expected *, got %q", w.Header().Get("Access-Control-Allow-Origin"))
+	}
+
+	w = serve(req, ok, CORS(touta.CORSConfig{AllowedOrigins: []string{"*"}, AllowCredentials: true}))
+	if w.Header().Get("Access-Control-Allow-Origin") != "https://a.com" || w.Header().Get("Access-Control-Allow-Credentials") != "true" {
+		t.Errorf("Credentials require the exact origin, got %v", w.Header())
+	}
+}
+
+func TestCORS_Preflight(t *testing.T) {
+	cfg := touta.CORSConfig{
+		AllowedOrigins: []string{"https://app.com"},
+		AllowedMethods: []string{"GET", "PUT"},
+		AllowedHeaders: []string{"Content-Type", "Authorization"},
+		MaxAge:         600,
+	}
+	preflight := func(method, headers string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("OPTIONS", "/", nil)
+		req.Header.Set("Origin", "https://app.com")
+		req.Header.Set("Access-Control-Request-Method", method)
+		req.Header.Set("Access-Control-Request-Headers", headers)
+		return serve(req, func(ctx touta.Context) error {
+			t.Error("Preflight requests must not reach the handler")
+			return nil
+		}, CORS(cfg))
+	}
+
+	w := preflight("PUT", "content-type, authorization")
+	if w.Code != 204 {
+		t.Fatalf("Expected 204, got %d", w.Code)
+	}
+	if w.Header().Get("Access-Control-Allow-Methods") != "GET, PUT" ||
+		w.Header().Get("Access-Control-Allow-Headers") != "Content-Type, Authorization" ||
+		w.Header().Get("Access-Control-Max-Age") != "600" {
+		t.Errorf("Unexpected preflight headers %v", w.Header())
+	}
+
+	if w := preflight("DELETE", ""); w.Code != 403 {
+		t.Errorf("Expected 403 for a disallowed method, got %d", w.Code)
+	}
+	if w := preflight("PUT", "X-Secret"); w.Code != 403 {
+		t.Errorf("Expected 403 for a disallowed header, got %d", w.Code)
+	}
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"log"
+	"time"
+
+	"github.com/toutaio/toutago/internal/router"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// Logger writes one access log line per request with the method, path,
+// status, response size, duration and request ID. A nil logger writes to
+// the standard logger. Requests that fail are logged with the status the
+// error handler will send.
+func Logger(logger *log.Logger) touta.MiddlewareFunc {
+	if logger == nil {
+		logger = log.Default()
+	}
+
+	return func(next touta.HandlerFunc) touta.HandlerFunc {
+		return func(ctx touta.Context) error {
+			start := time.Now()
+			err := next(ctx)
+
+			status := statusOf(ctx.Response())
+			if err != nil && !responseStarted(ctx.Response()) {
+				status = router.AsHTTPError(err).Status
+			}
+			var size int64
+			if sw, ok := ctx.Response().(interface{ Size() int64 }); ok {
+				size = sw.Size()
+			}
+
+			req := ctx.Request()
+			id := GetRequestID(ctx)
+			if id == "" {
+				id = "-"
+			}
+			logger.Printf("%s %s %d %dB %s %s", req.Method, req.URL.RequestURI(), status, size, time.Since(start).Round(time.Microsecond), id)
+			return err
+		}
+	}
+}
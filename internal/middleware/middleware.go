@@ -0,0 +1,155 @@
+// Package middleware provides the framework's built-in HTTP middleware and
+// a registry that activates them by name from touta.yaml:
+//
+//	router:
+//	  middleware: [request_id, logger, recover, cors]
+//
+// Routers created with app.NewRouter apply the listed middleware. Every
+// middleware is a touta.MiddlewareFunc and can also be used directly with
+// Router.Use.
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// Factory builds a middleware from the router configuration.
+type Factory func(cfg touta.RouterConfig) (touta.MiddlewareFunc, error)
+
+// Registry maps middleware names to factories.
+type Registry struct {
+	factories map[string]Factory
+	mu        sync.RWMutex
+}
+
+// NewRegistry creates a registry holding the built-in middleware:
+// request_id, logger, recover, cors, rate_limit, compress, timeout and
+// secure_headers.
+func NewRegistry() *Registry {
+	r := &Registry{
+		factories: make(map[string]Factory),
+	}
+
+	r.Register("request_id", func(touta.RouterConfig) (touta.MiddlewareFunc, error) {
+		return RequestID(), nil
+	})
+	r.Register("logger", func(touta.RouterConfig) (touta.MiddlewareFunc, error) {
+		return Logger(nil), nil
+	})
+	r.Register("recover", func(touta.RouterConfig) (touta.MiddlewareFunc, error) {
+		return Recover(), nil
+	})
+	r.Register("cors", func(cfg touta.RouterConfig) (touta.MiddlewareFunc, error) {
+		return CORS(cfg.CORS), nil
+	})
+	r.Register("rate_limit", func(cfg touta.RouterConfig) (touta.MiddlewareFunc, error) {
+		return RateLimit(cfg.RateLimit)
+	})
+	r.Register("compress", func(touta.RouterConfig) (touta.MiddlewareFunc, error) {
+		return Compress(), nil
+	})
+	r.Register("timeout", func(touta.RouterConfig) (touta.MiddlewareFunc, error) {
+		return Timeout(DefaultTimeout), nil
+	})
+	r.Register("secure_headers", func(touta.RouterConfig) (touta.MiddlewareFunc, error) {
+		return SecureHeaders(DefaultSecurityHeaders), nil
+	})
+
+	return r
+}
+
+// Register adds or replaces the factory for name.
+func (r *Registry) Register(name string, factory Factory) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.factories[name] = factory
+}
+
+// Names lists the registered middleware names in alphabetical order.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.factories))
+	for name := range r.factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Build creates the middleware named in names, in order.
+func (r *Registry) Build(names []string, cfg touta.RouterConfig) ([]touta.MiddlewareFunc, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	mws := make([]touta.MiddlewareFunc, 0, len(names))
+	for _, name := range names {
+		factory, ok := r.factories[name]
+		if !ok {
+			return nil, fmt.Errorf("unknown middleware %q", name)
+		}
+		mw, err := factory(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("middleware %s: %w", name, err)
+		}
+		mws = append(mws, mw)
+	}
+	return mws, nil
+}
+
+// FromConfig builds the middleware listed in cfg.Middleware. CORS and rate
+// limiting are also added, after the listed middleware, when their config
+// is enabled but they are not listed.
+func (r *Registry) FromConfig(cfg touta.RouterConfig) ([]touta.MiddlewareFunc, error) {
+	names := append([]string(nil), cfg.Middleware...)
+	listed := make(map[string]bool, len(names))
+	for _, name := range names {
+		listed[name] = true
+	}
+	if cfg.CORS.Enabled && !listed["cors"] {
+		names = append(names, "cors")
+	}
+	if cfg.RateLimit.Enabled && !listed["rate_limit"] {
+		names = append(names, "rate_limit")
+	}
+	return r.Build(names, cfg)
+}
+
+var defaultRegistry = NewRegistry()
+
+// Register adds a factory to the default registry.
+func Register(name string, factory Factory) {
+	defaultRegistry.Register(name, factory)
+}
+
+// FromConfig builds middleware from cfg using the default registry.
+// Routers created with app.NewRouter apply it themselves; other routers
+// add it by hand:
+//
+//	mws, err := middleware.FromConfig(cfg.Router)
+//	router.Use(mws...)
+func FromConfig(cfg touta.RouterConfig) ([]touta.MiddlewareFunc, error) {
+	return defaultRegistry.FromConfig(cfg)
+}
+
+// statusOf returns the status sent on w, or 0 when it is unknown.
+func statusOf(w http.ResponseWriter) int {
+	if sw, ok := w.(interface{ Status() int }); ok {
+		return sw.Status()
+	}
+	return 0
+}
+
+// responseStarted reports whether headers have been sent on w.
+func responseStarted(w http.ResponseWriter) bool {
+	if ww, ok := w.(interface{ Written() bool }); ok {
+		return ww.Written()
+	}
+	return false
+}
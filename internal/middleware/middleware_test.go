@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/toutaio/toutago/internal/di"
+	"github.com/toutaio/toutago/internal/router"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// serve registers handler at / behind mws and serves req.
+func serve(req *http.Request, handler touta.HandlerFunc, mws ...touta.MiddlewareFunc) *httptest.ResponseRecorder {
+	r := router.NewChiRouter(di.NewContainer())
+	r.Use(mws...)
+	r.GET("/", handler)
+	r.POST("/", handler)
+	r.PUT("/", handler)
+
+	w := httptest.NewRecorder()
+	r.Native().(*chi.Mux).ServeHTTP(w, req)
+	return w
+}
+
+func ok(ctx touta.Context) error {
+	return ctx.String(200, "OK")
+}
+
+func TestRegistry_FromConfig(t *testing.T) {
+	reg := NewRegistry()
+	mws, err := reg.FromConfig(touta.RouterConfig{
+		Middleware: []string{"request_id", "recover"},
+		CORS:       touta.CORSConfig{Enabled: true},
+		RateLimit:  touta.RateLimitConfig{Enabled: true, Requests: 10, Window: 1},
+	})
+	if err != nil {
+		t.Fatalf("FromConfig failed: %v", err)
+	}
+	if len(mws) != 4 {
+		t.Errorf("Expected listed middleware plus enabled cors and rate_limit, got %d", len(mws))
+	}
+
+	if _, err := reg.FromConfig(touta.RouterConfig{Middleware: []string{"nope"}}); err == nil {
+		t.Error("Expected an error for an unknown middleware")
+	}
+	if _, err := reg.FromConfig(touta.RouterConfig{Middleware: []string{"rate_limit"}}); err == nil {
+		t.Error("Expected an error for a rate limit without requests")
+	}
+}
+
+func TestRegistry_Register(t *testing.T) {
+	reg := NewRegistry()
+	reg.Register("tenant", func(touta.RouterConfig) (touta.MiddlewareFunc, error) {
+		return func(next touta.HandlerFunc) touta.HandlerFunc {
+			return func(ctx touta.Context) error {
+				ctx.Set("tenant", "acme")
+				return next(ctx)
+			}
+		}, nil
+	})
+
+	mws, err := reg.Build([]string{"tenant"}, touta.RouterConfig{})
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	w := serve(httptest.NewRequest("GET", "/", nil), func(ctx touta.Context) error {
+		return ctx.String(200, ctx.Get("tenant").(string))
+	}, mws...)
+	if w.Body.String() != "acme" {
+		t.Errorf("Custom middleware not applied, got %q", w.Body.String())
+	}
+}
+
+func TestRequestID(t *testing.T) {
+	var seen string
+	handler := func(ctx touta.Context) error {
+		seen = GetRequestID(ctx)
+		return nil
+	}
+
+	w := serve(httptest.NewRequest("GET", "/", nil), handler, RequestID())
+	if len(seen) != 32 || w.Header().Get(RequestIDHeader) != seen {
+		t.Errorf("Expected a generated ID in context and response, got %q / %q", seen, w.Header().Get(RequestIDHeader))
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "upstream-123")
+	serve(req, handler, RequestID())
+	if seen != "upstream-123" {
+		t.Errorf("Incoming request ID should be reused, got %q", seen)
+	}
+
+	req = httptest.NewRequest("GET", "/", nil)
+	req.Header.Set(RequestIDHeader, "bad id\nwith newline")
+	serve(req, handler, RequestID())
+	if seen == "bad id\nwith newline" {
+		t.Error("Malformed request IDs should be replaced")
+	}
+}
+
+func TestLogger(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", 0)
+
+	req := httptest.NewRequest("GET", "/?q=1", nil)
+	req.Header.Set(RequestIDHeader, "abc")
+	serve(req, ok, RequestID(), Logger(logger))
+	if line := buf.String(); !strings.HasPrefix(line, "GET /?q=1 200 2B ") || !strings.HasSuffix(line, " abc\n") {
+		t.Errorf("Unexpected access log line %q", line)
+	}
+
+	buf.Reset()
+	serve(httptest.NewRequest("GET", "/", nil), func(ctx touta.Context) error {
+		return touta.NewHTTPError(404, "")
+	}, Logger(logger))
+	if !strings.HasPrefix(buf.String(), "GET / 404 ") {
+		t.Errorf("Failed requests should be logged with their error status, got %q", buf.String())
+	}
+}
+
+func TestRecover(t *testing.T) {
+	var caught error
+	mws := []touta.MiddlewareFunc{
+		func(next touta.HandlerFunc) touta.HandlerFunc {
+			return func(ctx touta.Context) error {
+				caught = next(ctx)
+				return caught
+			}
+		},
+		Recover(),
+	}
+
+	w := serve(httptest.NewRequest("GET", "/", nil), func(ctx touta.Context) error {
+		panic("boom")
+	}, mws...)
+
+	var panicErr *router.PanicError
+	if !errors.As(caught, &panicErr) || panicErr.Value != "boom" || len(panicErr.Stack) == 0 {
+		t.Fatalf("Expected a PanicError with a stack, got %v", caught)
+	}
+	if w.Code != 500 {
+		t.Errorf("Expected 500, got %d", w.Code)
+	}
+}
+
+func TestTimeout(t *testing.T) {
+	w := serve(httptest.NewRequest("GET", "/", nil), func(ctx touta.Context) error {
+		select {
+		case <-ctx.Request().Context().Done():
+			return ctx.Request().Context().Err()
+		case <-time.After(time.Second):
+			return ctx.String(200, "late")
+		}
+	}, Timeout(10*time.Millisecond))
+	if w.Code != 503 {
+		t.Errorf("Expected 503 after the deadline, got %d", w.Code)
+	}
+
+	w = serve(httptest.NewRequest("GET", "/", nil), func(ctx touta.Context) error {
+		if _, ok := ctx.Request().Context().Deadline(); !ok {
+			return errors.New("no deadline")
+		}
+		return ok(ctx)
+	}, Timeout(time.Second))
+	if w.Code != 200 {
+		t.Errorf("Fast handlers should succeed, got %d", w.Code)
+	}
+}
+
+func TestTimeout_ResponseStarted(t *testing.T) {
+	w := serve(httptest.NewRequest("GET", "/", nil), func(ctx touta.Context) error {
+		ctx.String(200, "partial")
+		<-ctx.Request().Context().Done()
+		return context.Cause(ctx.Request().Context())
+	}, Timeout(10*time.Millisecond))
+	if w.Code != 200 || w.Body.String() != "partial" {
+		t.Errorf("A started response must not be replaced, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestSecureHeaders(t *testing.T) {
+	w := serve(httptest.NewRequest("GET", "/", nil), ok, SecureHeaders(DefaultSecurityHeaders))
+	if w.Header().Get("X-Content-Type-Options") != "nosniff" || w.Header().Get("X-Frame-Options") != "SAMEORIGIN" {
+		t.Errorf("Missing security headers: %v", w.Header())
+	}
+	if w.Header().Get("Strict-Transport-Security") != "" {
+		t.Error("HSTS must not be sent over plain HTTP")
+	}
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.TLS = &tls.ConnectionState{}
+	w = serve(req, ok, SecureHeaders(DefaultSecurityHeaders))
+	if w.Header().Get("Strict-Transport-Security") != "max-age=31536000" {
+		t.Errorf("Expected HSTS over TLS, got %q", w.Header().Get("Strict-Transport-Security"))
+	}
+}
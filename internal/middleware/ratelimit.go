@@ -0,0 +1,136 @@
+package middleware
+
+import (
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// KeyFunc returns the key a request is rate limited by.
+type KeyFunc func(ctx touta.Context) string
+
+// RateLimitOption configures RateLimit.
+type RateLimitOption func(*rateLimiter)
+
+// WithKeyFunc limits requests per key instead of per client IP, e.g. per
+// API key or user.
+func WithKeyFunc(fn KeyFunc) RateLimitOption {
+	return func(l *rateLimiter) {
+		l.key = fn
+	}
+}
+
+// RateLimit limits each client to cfg.Requests requests per cfg.Window
+// seconds using a token bucket: bursts of up to Requests are allowed and
+// tokens refill continuously. Clients are identified by IP unless
+// WithKeyFunc is given. Limited requests fail with 429 and a Retry-After
+// header; every response carries X-RateLimit-Limit and
+// X-RateLimit-Remaining.
+func RateLimit(cfg touta.RateLimitConfig, opts ...RateLimitOption) (touta.MiddlewareFunc, error) {
+	if cfg.Requests <= 0 {
+		return nil, fmt.Errorf("rate limit requests must be positive, got %d", cfg.Requests)
+	}
+	if cfg.Window <= 0 {
+		return nil, fmt.Errorf("rate limit window must be positive, got %d", cfg.Window)
+	}
+
+	l := &rateLimiter{
+		capacity: float64(cfg.Requests),
+		rate:     float64(cfg.Requests) / float64(cfg.Window),
+		window:   time.Duration(cfg.Window) * time.Second,
+		buckets:  make(map[string]*bucket),
+		key:      clientIP,
+		now:      time.Now,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l.middleware, nil
+}
+
+// bucket is the token bucket of one key.
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimiter struct {
+	capacity float64 // maximum burst
+	rate     float64 // tokens added per second
+	window   time.Duration
+	key      KeyFunc
+	now      func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func (l *rateLimiter) middleware(next touta.HandlerFunc) touta.HandlerFunc {
+	return func(ctx touta.Context) error {
+		allowed, remaining, retryAfter := l.take(l.key(ctx))
+
+		header := ctx.Response().Header()
+		header.Set("X-RateLimit-Limit", strconv.Itoa(int(l.capacity)))
+		header.Set("X-RateLimit-Remaining", strconv.Itoa(remaining))
+		if !allowed {
+			header.Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+			return touta.NewHTTPError(http.StatusTooManyRequests, "rate limit exceeded")
+		}
+		return next(ctx)
+	}
+}
+
+// take consumes a token for key. It returns whether the request is allowed,
+// the tokens left and, when denied, how long until a token is available.
+func (l *rateLimiter) take(key string) (bool, int, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.capacity, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = math.Min(l.capacity, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+		return false, 0, wait
+	}
+	b.tokens--
+	return true, int(b.tokens), 0
+}
+
+// sweep drops buckets idle long enough to have refilled completely, which
+// behave exactly like missing ones. The caller must hold mu.
+func (l *rateLimiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.window {
+		return
+	}
+	l.lastSweep = now
+	for key, b := range l.buckets {
+		if now.Sub(b.last) >= l.window {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// clientIP returns the IP of the connection, without the port.
+func clientIP(ctx touta.Context) string {
+	addr := ctx.Request().RemoteAddr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return addr
+}
@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+func TestRateLimit_TokenBucket(t *testing.T) {
+	mw, err := RateLimit(touta.RateLimitConfig{Requests: 2, Window: 10})
+	if err != nil {
+		t.Fatalf("RateLimit failed: %v", err)
+	}
+
+	request := func(addr string) int {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.RemoteAddr = addr
+		return serve(req, ok, mw).Code
+	}
+
+	if request("1.1.1.1:1000") != 200 || request("1.1.1.1:2000") != 200 {
+		t.Fatal("Requests within the burst should pass")
+	}
+	if code := request("1.1.1.1:3000"); code != 429 {
+		t.Errorf("Expected 429 once the bucket is empty, got %d", code)
+	}
+	if code := request("2.2.2.2:1000"); code != 200 {
+		t.Errorf("Other clients have their own bucket, got %d", code)
+	}
+}
+
+func TestRateLimit_Refill(t *testing.T) {
+	now := time.Unix(0, 0)
+	l := &rateLimiter{capacity: 2, rate: 0.2, window: 10 * time.Second, buckets: make(map[string]*bucket), now: func() time.Time { return now }}
+
+	l.take("k")
+	l.take("k")
+	allowed, _, retry := l.take("k")
+	if allowed || retry != 5*time.Second {
+		t.Fatalf("Expected denial with a 5s retry, got %v %s", allowed, retry)
+	}
+
+	now = now.Add(5 * time.Second)
+	if allowed, remaining, _ := l.take("k"); !allowed || remaining != 0 {
+		t.Errorf("Expected one refilled token, got %v %d", allowed, remaining)
+	}
+
+	now = now.Add(time.Minute)
+	l.take("other")
+	if _, exists := l.buckets["k"]; exists {
+		t.Error("Idle buckets should be swept")
+	}
+}
+
+func TestRateLimit_Headers(t *testing.T) {
+	mw, _ := RateLimit(touta.RateLimitConfig{Requests: 1, Window: 60}, WithKeyFunc(func(ctx touta.Context) string {
+		return ctx.Request().Header.Get("X-API-Key")
+	}))
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-API-Key", "k1")
+	w := serve(req, ok, mw)
+	if w.Header().Get("X-RateLimit-Limit") != "1" || w.Header().Get("X-RateLimit-Remaining") != "0" {
+		t.Errorf("Unexpected rate limit headers %v", w.Header())
+	}
+
+	w = serve(req, ok, mw)
+	if w.Code != 429 || w.Header().Get("Retry-After") != "60" {
+		t.Errorf("Expected 429 with Retry-After 60, got %d %q", w.Code, w.Header().Get("Retry-After"))
+	}
+}
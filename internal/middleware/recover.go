@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/toutaio/toutago/internal/router"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// Recover turns panics in later middleware and handlers into a
+// router.PanicError, which the error handler renders as a 500 with the
+// stack trace in debug mode. http.ErrAbortHandler is re-panicked so the
+// server can abort the response as intended.
+func Recover() touta.MiddlewareFunc {
+	return func(next touta.HandlerFunc) touta.HandlerFunc {
+		return func(ctx touta.Context) (err error) {
+			defer func() {
+				if v := recover(); v != nil {
+					if v == http.ErrAbortHandler {
+						panic(v)
+					}
+					err = router.NewPanicError(v)
+				}
+			}()
+			return next(ctx)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// RequestIDHeader is the header carrying the request ID.
+const RequestIDHeader = "X-Request-ID"
+
+// RequestIDKey is the Context key holding the request ID.
+const RequestIDKey = "request_id"
+
+// RequestID assigns every request an ID, reusing a well-formed incoming
+// X-Request-ID header so IDs can be traced across services. The ID is
+// stored in the Context under RequestIDKey and echoed in the response.
+func RequestID() touta.MiddlewareFunc {
+	return func(next touta.HandlerFunc) touta.HandlerFunc {
+		return func(ctx touta.Context) error {
+			id := ctx.Request().Header.Get(RequestIDHeader)
+			if !validRequestID(id) {
+				id = newRequestID()
+			}
+			ctx.Set(RequestIDKey, id)
+			ctx.Response().Header().Set(RequestIDHeader, id)
+			return next(ctx)
+		}
+	}
+}
+
+// GetRequestID returns the request ID assigned by RequestID, or "".
+func GetRequestID(ctx touta.Context) string {
+	id, _ := ctx.Get(RequestIDKey).(string)
+	return id
+}
+
+// validRequestID accepts short IDs of printable ASCII, so client supplied
+// values cannot inject anything into logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newRequestID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		panic("middleware: failed to generate request ID: " + err.Error())
+	}
+	return hex.EncodeToString(b)
+}
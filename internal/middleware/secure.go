@@ -0,0 +1,64 @@
+package middleware
+
+import (
+	"strconv"
+
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// SecurityHeaders lists the headers set by SecureHeaders. Empty fields are
+// not sent.
+type SecurityHeaders struct {
+	ContentTypeNosniff      bool   // X-Content-Type-Options: nosniff
+	FrameOptions            string // X-Frame-Options, e.g. DENY or SAMEORIGIN
+	ReferrerPolicy          string // Referrer-Policy
+	ContentSecurityPolicy   string // Content-Security-Policy
+	CrossOriginOpenerPolicy string // Cross-Origin-Opener-Policy
+	HSTSMaxAge              int    // Strict-Transport-Security max-age in seconds, TLS only
+	HSTSIncludeSubdomains   bool   // add includeSubDomains to HSTS
+}
+
+// DefaultSecurityHeaders are conservative defaults that do not break
+// typical applications. No Content-Security-Policy is set since it depends
+// on the application's assets.
+var DefaultSecurityHeaders = SecurityHeaders{
+	ContentTypeNosniff:      true,
+	FrameOptions:            "SAMEORIGIN",
+	ReferrerPolicy:          "strict-origin-when-cross-origin",
+	CrossOriginOpenerPolicy: "same-origin",
+	HSTSMaxAge:              31536000,
+}
+
+// SecureHeaders sets security related response headers. HSTS is only sent
+// on TLS connections, as browsers ignore it over plain HTTP.
+func SecureHeaders(h SecurityHeaders) touta.MiddlewareFunc {
+	hsts := ""
+	if h.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.Itoa(h.HSTSMaxAge)
+		if h.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+
+	return func(next touta.HandlerFunc) touta.HandlerFunc {
+		return func(ctx touta.Context) error {
+			header := ctx.Response().Header()
+			if h.ContentTypeNosniff {
+				header.Set("X-Content-Type-Options", "nosniff")
+			}
+			set := func(name, value string) {
+				if value != "" {
+					header.Set(name, value)
+				}
+			}
+			set("X-Frame-Options", h.FrameOptions)
+			set("Referrer-Policy", h.ReferrerPolicy)
+			set("Content-Security-Policy", h.ContentSecurityPolicy)
+			set("Cross-Origin-Opener-Policy", h.CrossOriginOpenerPolicy)
+			if hsts != "" && ctx.Request().TLS != nil {
+				header.Set("Strict-Transport-Security", hsts)
+			}
+			return next(ctx)
+		}
+	}
+}
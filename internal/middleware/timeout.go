@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// DefaultTimeout is the timeout used by the "timeout" registry entry.
+const DefaultTimeout = 30 * time.Second
+
+// Timeout sets a deadline of d on the request context. Handlers observe it
+// through ctx.Request().Context(); when the deadline passes before a
+// response is started, the request fails with 503 Service Unavailable.
+// Handlers are not interrupted, so long running work must honour the
+// context.
+func Timeout(d time.Duration) touta.MiddlewareFunc {
+	return func(next touta.HandlerFunc) touta.HandlerFunc {
+		return func(ctx touta.Context) error {
+			req := ctx.Request()
+			timeoutCtx, cancel := context.WithTimeout(req.Context(), d)
+			defer cancel()
+
+			ctx.SetRequest(req.WithContext(timeoutCtx))
+			err := next(ctx)
+
+			if errors.Is(timeoutCtx.Err(), context.DeadlineExceeded) && !responseStarted(ctx.Response()) {
+				return touta.NewHTTPError(http.StatusServiceUnavailable, "request timed out").Wrap(timeoutCtx.Err())
+			}
+			return err
+		}
+	}
+}
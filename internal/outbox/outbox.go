@@ -0,0 +1,69 @@
+// Package outbox implements the transactional outbox pattern: messages are
+// recorded in the same storage transaction as the business write and a relay
+// later forwards them to a touta.MessageBus.
+package outbox
+
+import (
+	"context"
+	"time"
+
+	"github.com/toutaio/toutago/internal/message"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// Record is a message waiting in the outbox. Its ID is unique to the
+// record; the message's own ID is kept in its message_id metadata.
+type Record struct {
+	ID        string           `json:"id"`
+	Seq       uint64           `json:"seq"`
+	Message   message.Envelope `json:"message"`
+	CreatedAt time.Time        `json:"created_at"`
+
+	// Delivery failures: the number of failed attempts, the last error and
+	// whether the relay gave up on the record
+	Attempts  int    `json:"attempts,omitempty"`
+	LastError string `json:"last_error,omitempty"`
+	Parked    bool   `json:"parked,omitempty"`
+}
+
+// Tx is a storage transaction. Business data and outgoing messages written
+// through the same Tx are committed together or not at all.
+type Tx interface {
+	// Get reads a value, observing writes made earlier in the transaction
+	Get(key string) ([]byte, bool)
+
+	// Set writes a value
+	Set(key string, value []byte)
+
+	// Delete removes a value
+	Delete(key string)
+
+	// Publish records a message in the outbox; it is sent after commit
+	Publish(msg touta.Message) error
+}
+
+// Store is local storage with an embedded outbox.
+type Store interface {
+	// Update runs fn in a transaction, committing only if it returns nil
+	Update(ctx context.Context, fn func(Tx) error) error
+
+	// Get reads a committed value
+	Get(key string) ([]byte, bool, error)
+
+	// Pending returns up to limit undelivered records in commit order,
+	// leaving out parked ones; a limit of zero or less returns all of them
+	Pending(limit int) ([]Record, error)
+
+	// MarkDispatched removes delivered records from the outbox
+	MarkDispatched(ids ...string) error
+
+	// MarkFailed records a failed delivery of a record, parking it when
+	// park is true
+	MarkFailed(id, reason string, park bool) error
+
+	// Parked returns the records the relay gave up on, in commit order
+	Parked() ([]Record, error)
+
+	// Requeue makes parked records pending again with no attempts
+	Requeue(ids ...string) error
+}
@@ -0,0 +1,266 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/toutaio/toutago/internal/message"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// Relay forwards committed outbox records to a message bus.
+//
+// Records are published in commit order and removed once the bus accepts
+// them. A relay never publishes a record twice while it runs; if the process
+// dies between publishing and removal the record is sent again on restart
+// with the same message_id metadata, so consumers can de-duplicate.
+//
+// A record that fails to publish does not hold up the ones after it: it
+// is skipped until the next flush, which may deliver later records first,
+// and parked once it failed WithMaxAttempts times. Records that cannot be
+// decoded are parked at once. Parked records stay in the store, see
+// Store.Parked and Store.Requeue. Failures of the bus itself, such as a
+// stopped bus, end the flush without counting against the records.
+type Relay interface {
+	// Flush publishes all pending records now and returns how many were sent
+	Flush(ctx context.Context) (int, error)
+
+	// Start begins polling the store in the background
+	Start(ctx context.Context) error
+
+	// Stop halts background polling
+	Stop(ctx context.Context) error
+}
+
+// RelayOption configures a relay created by NewRelay.
+type RelayOption func(*relay)
+
+// WithInterval sets how often the store is polled (default one second).
+func WithInterval(d time.Duration) RelayOption {
+	return func(r *relay) {
+		r.interval = d
+	}
+}
+
+// WithBatchSize limits how many records are read per poll (default 100).
+func WithBatchSize(n int) RelayOption {
+	return func(r *relay) {
+		r.batchSize = n
+	}
+}
+
+// WithCodec sets the codec used to rebuild messages from records.
+func WithCodec(codec *message.Codec) RelayOption {
+	return func(r *relay) {
+		r.codec = codec
+	}
+}
+
+// WithSyncPublish makes the relay use PublishSync, so a record is only
+// removed after every handler succeeded.
+func WithSyncPublish(enabled bool) RelayOption {
+	return func(r *relay) {
+		r.sync = enabled
+	}
+}
+
+// WithMaxAttempts sets how many times a record may fail to publish before
+// the relay parks it (default 5).
+func WithMaxAttempts(n int) RelayOption {
+	return func(r *relay) {
+		r.maxAttempts = n
+	}
+}
+
+// relay implements Relay.
+type relay struct {
+	store       Store
+	bus         touta.MessageBus
+	codec       *message.Codec
+	interval    time.Duration
+	batchSize   int
+	maxAttempts int
+	sync        bool
+
+	flushMu sync.Mutex
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	cancel  context.CancelFunc
+}
+
+// NewRelay creates a relay from store to bus.
+func NewRelay(store Store, bus touta.MessageBus, opts ...RelayOption) Relay {
+	r := &relay{
+		store:       store,
+		bus:         bus,
+		codec:       message.NewCodec(),
+		interval:    time.Second,
+		batchSize:   100,
+		maxAttempts: 5,
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// Flush publishes all pending records. Records that failed are reported
+// in the returned error after the others were sent.
+func (r *relay) Flush(ctx context.Context) (int, error) {
+	// Serialise flushes so concurrent callers never publish the same record
+	r.flushMu.Lock()
+	defer r.flushMu.Unlock()
+
+	sent := 0
+	failed := make(map[string]bool)
+	var errs []error
+	for {
+		// Failed records stay pending, so read past them
+		limit := r.batchSize
+		if limit > 0 {
+			limit += len(failed)
+		}
+		records, err := r.store.Pending(limit)
+		if err != nil {
+			return sent, fmt.Errorf("failed to read outbox: %w", err)
+		}
+
+		progress := false
+		for _, record := range records {
+			if failed[record.ID] {
+				continue
+			}
+			progress = true
+
+			if err := r.publish(ctx, record); err != nil {
+				if busFailure(ctx, err) {
+					return sent, errors.Join(append(errs, err)...)
+				}
+				failed[record.ID] = true
+				errs = append(errs, r.fail(record, err))
+				continue
+			}
+			if err := r.store.MarkDispatched(record.ID); err != nil {
+				return sent, fmt.Errorf("failed to mark record %s dispatched: %w", record.ID, err)
+			}
+			sent++
+		}
+		if !progress {
+			return sent, errors.Join(errs...)
+		}
+	}
+}
+
+// publish sends a single record to the bus.
+func (r *relay) publish(ctx context.Context, record Record) error {
+	msg, err := r.codec.Decode(record.Message)
+	if err != nil {
+		return &decodeError{fmt.Errorf("failed to decode record %s: %w", record.ID, err)}
+	}
+
+	if r.sync {
+		err = r.bus.PublishSync(ctx, msg)
+	} else {
+		err = r.bus.Publish(ctx, msg)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to publish record %s: %w", record.ID, err)
+	}
+	return nil
+}
+
+// fail records a failed attempt to publish record, parking it when it
+// cannot be decoded or ran out of attempts, and returns the error to
+// report.
+func (r *relay) fail(record Record, err error) error {
+	var decodeErr *decodeError
+	park := errors.As(err, &decodeErr) || record.Attempts+1 >= r.maxAttempts
+	if markErr := r.store.MarkFailed(record.ID, err.Error(), park); markErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to mark record %s failed: %w", record.ID, markErr))
+	}
+	if park {
+		return fmt.Errorf("%w; record parked after %d attempts", err, record.Attempts+1)
+	}
+	return err
+}
+
+// busFailure reports whether err is a failure of the bus or the flush
+// rather than of the record being published.
+func busFailure(ctx context.Context, err error) bool {
+	return ctx.Err() != nil || errors.Is(err, message.ErrBusNotStarted) || errors.Is(err, message.ErrBusStopped)
+}
+
+// decodeError marks records that cannot be decoded, which no retry fixes.
+type decodeError struct {
+	err error
+}
+
+func (e *decodeError) Error() string { return e.err.Error() }
+func (e *decodeError) Unwrap() error { return e.err }
+
+// Start begins polling the store in the background.
+func (r *relay) Start(ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.cancel != nil {
+		return fmt.Errorf("relay already started")
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	r.cancel = cancel
+
+	r.wg.Add(1)
+	go r.run(runCtx)
+	return nil
+}
+
+// Stop halts background polling.
+func (r *relay) Stop(ctx context.Context) error {
+	r.mu.Lock()
+	cancel := r.cancel
+	r.cancel = nil
+	r.mu.Unlock()
+
+	if cancel == nil {
+		return nil
+	}
+	cancel()
+
+	done := make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// run polls the store until ctx is cancelled.
+func (r *relay) run(ctx context.Context) {
+	defer r.wg.Done()
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, err := r.Flush(ctx); err != nil && ctx.Err() == nil {
+			log.Printf("outbox: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,241 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/toutaio/toutago/internal/message"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// recorder collects message metadata delivered through the bus.
+type recorder struct {
+	mu       sync.Mutex
+	orderIDs []interface{}
+	fail     error
+	failID   string // fails only the order with this ID when set
+}
+
+func (r *recorder) Handle(ctx context.Context, msg touta.Message) (touta.Message, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.fail != nil && (r.failID == "" || msg.Metadata()["order_id"] == r.failID) {
+		return nil, r.fail
+	}
+	r.orderIDs = append(r.orderIDs, msg.Metadata()["order_id"])
+	return nil, nil
+}
+
+func (r *recorder) received() []interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]interface{}(nil), r.orderIDs...)
+}
+
+func startBus(t *testing.T, handler touta.MessageHandler) touta.MessageBus {
+	t.Helper()
+
+	bus := message.NewBus()
+	if err := bus.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start bus: %v", err)
+	}
+	t.Cleanup(func() { bus.Stop(context.Background()) })
+
+	bus.Subscribe("order.placed", handler)
+	return bus
+}
+
+func TestRelay_FlushPublishesOnceInOrder(t *testing.T) {
+	handler := &recorder{}
+	bus := startBus(t, handler)
+	store := NewMemoryStore()
+
+	store.Update(context.Background(), func(tx Tx) error {
+		tx.Publish(newOrderPlaced("1"))
+		tx.Publish(newOrderPlaced("2"))
+		return tx.Publish(newOrderPlaced("3"))
+	})
+
+	relay := NewRelay(store, bus, WithSyncPublish(true), WithBatchSize(2))
+
+	sent, err := relay.Flush(context.Background())
+	if err != nil {
+		t.Fatalf("Flush failed: %v", err)
+	}
+	if sent != 3 {
+		t.Errorf("Expected 3 records sent, got %d", sent)
+	}
+
+	// A second flush has nothing left to send
+	if sent, _ := relay.Flush(context.Background()); sent != 0 {
+		t.Errorf("Expected no records on second flush, got %d", sent)
+	}
+
+	got := handler.received()
+	if len(got) != 3 || got[0] != "1" || got[1] != "2" || got[2] != "3" {
+		t.Errorf("Expected records 1,2,3 in order, got %v", got)
+	}
+}
+
+func TestRelay_FailedPublishKeepsRecord(t *testing.T) {
+	handler := &recorder{fail: errors.New("downstream unavailable")}
+	bus := startBus(t, handler)
+	store := NewMemoryStore()
+
+	store.Update(context.Background(), func(tx Tx) error {
+		return tx.Publish(newOrderPlaced("1"))
+	})
+
+	relay := NewRelay(store, bus, WithSyncPublish(true))
+	if _, err := relay.Flush(context.Background()); err == nil {
+		t.Fatal("Flush should report the publish failure")
+	}
+
+	if records, _ := store.Pending(0); len(records) != 1 {
+		t.Fatalf("Record should stay in the outbox, got %d", len(records))
+	}
+
+	handler.mu.Lock()
+	handler.fail = nil
+	handler.mu.Unlock()
+
+	if sent, err := relay.Flush(context.Background()); err != nil || sent != 1 {
+		t.Errorf("Expected retry to succeed, got sent=%d err=%v", sent, err)
+	}
+}
+
+func TestRelay_StartPolls(t *testing.T) {
+	handler := &recorder{}
+	bus := startBus(t, handler)
+	store := NewMemoryStore()
+
+	relay := NewRelay(store, bus, WithInterval(5*time.Millisecond), WithSyncPublish(true))
+	if err := relay.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer relay.Stop(context.Background())
+
+	store.Update(context.Background(), func(tx Tx) error {
+		return tx.Publish(newOrderPlaced("1"))
+	})
+
+	deadline := time.Now().Add(time.Second)
+	for len(handler.received()) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Relay should deliver committed records")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestRelay_FailingRecordDoesNotBlockOthers(t *testing.T) {
+	handler := &recorder{fail: errors.New("invalid order"), failID: "1"}
+	bus := startBus(t, handler)
+	store := NewMemoryStore()
+
+	store.Update(context.Background(), func(tx Tx) error {
+		tx.Publish(newOrderPlaced("1"))
+		tx.Publish(newOrderPlaced("2"))
+		return tx.Publish(newOrderPlaced("3"))
+	})
+
+	relay := NewRelay(store, bus, WithSyncPublish(true), WithBatchSize(1), WithMaxAttempts(2))
+
+	sent, err := relay.Flush(context.Background())
+	if err == nil || sent != 2 {
+		t.Fatalf("Expected 2 records sent and the failure reported, got sent=%d err=%v", sent, err)
+	}
+	if got := handler.received(); len(got) != 2 || got[0] != "2" || got[1] != "3" {
+		t.Errorf("Expected records 2,3 to be delivered, got %v", got)
+	}
+
+	records, _ := store.Pending(0)
+	if len(records) != 1 || records[0].Attempts != 1 || records[0].LastError == "" {
+		t.Fatalf("Expected the failed record to stay pending with one attempt, got %+v", records)
+	}
+
+	// The second failure parks the record
+	if _, err := relay.Flush(context.Background()); err == nil || !strings.Contains(err.Error(), "parked") {
+		t.Errorf("Expected the record to be parked, got %v", err)
+	}
+	if records, _ := store.Pending(0); len(records) != 0 {
+		t.Errorf("Parked records should not be pending, got %+v", records)
+	}
+	if sent, err := relay.Flush(context.Background()); sent != 0 || err != nil {
+		t.Errorf("Expected nothing left to flush, got sent=%d err=%v", sent, err)
+	}
+
+	parked, _ := store.Parked()
+	if len(parked) != 1 || parked[0].Attempts != 2 {
+		t.Fatalf("Expected one parked record after two attempts, got %+v", parked)
+	}
+
+	handler.mu.Lock()
+	handler.fail = nil
+	handler.mu.Unlock()
+
+	store.Requeue(parked[0].ID)
+	if sent, err := relay.Flush(context.Background()); err != nil || sent != 1 {
+		t.Errorf("Expected the requeued record to be sent, got sent=%d err=%v", sent, err)
+	}
+}
+
+type orderTotal struct {
+	message.BaseMessage
+	Total int `json:"total"`
+}
+
+func (m *orderTotal) Slug() string { return "order.total" }
+
+func TestRelay_ParksUndecodableRecords(t *testing.T) {
+	bus := startBus(t, &recorder{})
+	store, err := NewFileStore(filepath.Join(t.TempDir(), "outbox.json"))
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+
+	store.Update(context.Background(), func(tx Tx) error {
+		tx.Publish(&message.RawMessage{
+			BaseMessage: message.BaseMessage{MessageSlug: "order.total"},
+			Payload:     []byte(`{"total":"ten"}`),
+		})
+		return tx.Publish(newOrderPlaced("1"))
+	})
+
+	codec := message.NewCodec()
+	codec.Register(&orderTotal{})
+	relay := NewRelay(store, bus, WithCodec(codec))
+
+	sent, err := relay.Flush(context.Background())
+	if sent != 1 || err == nil || !strings.Contains(err.Error(), "failed to decode") {
+		t.Fatalf("Expected the valid record sent and the decode failure reported, got sent=%d err=%v", sent, err)
+	}
+	if parked, _ := store.Parked(); len(parked) != 1 || parked[0].Message.Slug != "order.total" {
+		t.Errorf("Expected the undecodable record to be parked at once, got %+v", parked)
+	}
+}
+
+func TestRelay_StoppedBusKeepsRecords(t *testing.T) {
+	bus := message.NewBus()
+	store := NewMemoryStore()
+
+	store.Update(context.Background(), func(tx Tx) error {
+		return tx.Publish(newOrderPlaced("1"))
+	})
+
+	relay := NewRelay(store, bus, WithMaxAttempts(1))
+	if _, err := relay.Flush(context.Background()); !errors.Is(err, message.ErrBusNotStarted) {
+		t.Fatalf("Expected ErrBusNotStarted, got %v", err)
+	}
+
+	records, _ := store.Pending(0)
+	if len(records) != 1 || records[0].Attempts != 0 {
+		t.Errorf("Bus failures should not count against records, got %+v", records)
+	}
+}
@@ -0,0 +1,332 @@
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/toutaio/toutago/internal/message"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// state is the full contents of a store.
+type state struct {
+	Data   map[string][]byte `json:"data"`
+	Outbox []Record          `json:"outbox"`
+	Seq    uint64            `json:"seq"`
+}
+
+// memoryStore implements Store in memory. It is also the core of fileStore,
+// which sets persist to write every committed state to disk.
+type memoryStore struct {
+	state   state
+	codec   *message.Codec
+	persist func(state) error
+	mu      sync.RWMutex
+}
+
+// NewMemoryStore creates an in-memory outbox store.
+func NewMemoryStore() Store {
+	return newMemoryStore()
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{
+		state: state{Data: make(map[string][]byte)},
+		codec: message.NewCodec(),
+	}
+}
+
+// Update runs fn in a transaction.
+func (s *memoryStore) Update(ctx context.Context, fn func(Tx) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tx := &memoryTx{
+		store:   s,
+		writes:  make(map[string][]byte),
+		deletes: make(map[string]bool),
+		seq:     s.state.Seq,
+	}
+	if err := fn(tx); err != nil {
+		return err
+	}
+
+	next := tx.apply(s.state)
+	if s.persist != nil {
+		if err := s.persist(next); err != nil {
+			return err
+		}
+	}
+	s.state = next
+	return nil
+}
+
+// Get reads a committed value.
+func (s *memoryStore) Get(key string) ([]byte, bool, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	value, ok := s.state.Data[key]
+	return value, ok, nil
+}
+
+// Pending returns undelivered records in commit order.
+func (s *memoryStore) Pending(limit int) ([]Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var records []Record
+	for _, r := range s.state.Outbox {
+		if limit > 0 && len(records) == limit {
+			break
+		}
+		if !r.Parked {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+// Parked returns the records the relay gave up on.
+func (s *memoryStore) Parked() ([]Record, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var records []Record
+	for _, r := range s.state.Outbox {
+		if r.Parked {
+			records = append(records, r)
+		}
+	}
+	return records, nil
+}
+
+// MarkFailed records a failed delivery of a record.
+func (s *memoryStore) MarkFailed(id, reason string, park bool) error {
+	return s.updateRecords(func(r *Record) {
+		if r.ID == id {
+			r.Attempts++
+			r.LastError = reason
+			r.Parked = park
+		}
+	})
+}
+
+// Requeue makes parked records pending again.
+func (s *memoryStore) Requeue(ids ...string) error {
+	requeue := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		requeue[id] = true
+	}
+	return s.updateRecords(func(r *Record) {
+		if requeue[r.ID] && r.Parked {
+			r.Attempts = 0
+			r.LastError = ""
+			r.Parked = false
+		}
+	})
+}
+
+// updateRecords applies fn to a copy of every outbox record and commits
+// the result.
+func (s *memoryStore) updateRecords(fn func(*Record)) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	next := s.state
+	next.Outbox = append([]Record(nil), s.state.Outbox...)
+	for i := range next.Outbox {
+		fn(&next.Outbox[i])
+	}
+
+	if s.persist != nil {
+		if err := s.persist(next); err != nil {
+			return err
+		}
+	}
+	s.state = next
+	return nil
+}
+
+// MarkDispatched removes delivered records from the outbox.
+func (s *memoryStore) MarkDispatched(ids ...string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	done := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		done[id] = true
+	}
+
+	next := s.state
+	next.Outbox = make([]Record, 0, len(s.state.Outbox))
+	for _, r := range s.state.Outbox {
+		if !done[r.ID] {
+			next.Outbox = append(next.Outbox, r)
+		}
+	}
+
+	if s.persist != nil {
+		if err := s.persist(next); err != nil {
+			return err
+		}
+	}
+	s.state = next
+	return nil
+}
+
+// memoryTx stages writes until the transaction commits.
+type memoryTx struct {
+	store   *memoryStore
+	writes  map[string][]byte
+	deletes map[string]bool
+	records []Record
+	seq     uint64
+}
+
+// Get reads a value, observing staged writes.
+func (tx *memoryTx) Get(key string) ([]byte, bool) {
+	if tx.deletes[key] {
+		return nil, false
+	}
+	if value, ok := tx.writes[key]; ok {
+		return value, true
+	}
+	value, ok := tx.store.state.Data[key]
+	return value, ok
+}
+
+// Set stages a write.
+func (tx *memoryTx) Set(key string, value []byte) {
+	delete(tx.deletes, key)
+	tx.writes[key] = append([]byte(nil), value...)
+}
+
+// Delete stages a removal.
+func (tx *memoryTx) Delete(key string) {
+	delete(tx.writes, key)
+	tx.deletes[key] = true
+}
+
+// Publish stages a message for the outbox.
+func (tx *memoryTx) Publish(msg touta.Message) error {
+	env, err := tx.store.codec.Encode(msg)
+	if err != nil {
+		return err
+	}
+
+	// The record gets its own ID: the same message may be published twice,
+	// and each record must be dispatched, failed or requeued on its own
+	meta := make(map[string]interface{}, len(env.Metadata)+1)
+	for k, v := range env.Metadata {
+		meta[k] = v
+	}
+	if id, ok := meta[message.MetaMessageID].(string); !ok || id == "" {
+		meta[message.MetaMessageID] = message.NewID()
+	}
+	env.Metadata = meta
+
+	tx.seq++
+	tx.records = append(tx.records, Record{
+		ID:        message.NewID(),
+		Seq:       tx.seq,
+		Message:   env,
+		CreatedAt: time.Now().UTC(),
+	})
+	return nil
+}
+
+// apply returns a new state with the staged changes applied.
+func (tx *memoryTx) apply(current state) state {
+	next := state{
+		Data:   make(map[string][]byte, len(current.Data)+len(tx.writes)),
+		Outbox: make([]Record, 0, len(current.Outbox)+len(tx.records)),
+		Seq:    tx.seq,
+	}
+	for k, v := range current.Data {
+		if !tx.deletes[k] {
+			next.Data[k] = v
+		}
+	}
+	for k, v := range tx.writes {
+		next.Data[k] = v
+	}
+	next.Outbox = append(next.Outbox, current.Outbox...)
+	next.Outbox = append(next.Outbox, tx.records...)
+	return next
+}
+
+// fileStore persists the whole store as a JSON file after every commit.
+type fileStore struct {
+	*memoryStore
+	path string
+}
+
+// NewFileStore opens (or creates) a file-backed outbox store. Every commit
+// atomically rewrites the file, so business data and outbox records are
+// always persisted together.
+func NewFileStore(path string) (Store, error) {
+	s := &fileStore{
+		memoryStore: newMemoryStore(),
+		path:        path,
+	}
+	s.memoryStore.persist = s.write
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read outbox file: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &s.state); err != nil {
+			return nil, fmt.Errorf("failed to parse outbox file: %w", err)
+		}
+		if s.state.Data == nil {
+			s.state.Data = make(map[string][]byte)
+		}
+	}
+
+	return s, nil
+}
+
+// write atomically replaces the file with st.
+func (s *fileStore) write(st state) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return fmt.Errorf("failed to encode outbox: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create outbox directory: %w", err)
+	}
+
+	// Sync before renaming so a crash never leaves a truncated file behind
+	tmp := s.path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to write outbox file: %w", err)
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write outbox file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to sync outbox file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("failed to write outbox file: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace outbox file: %w", err)
+	}
+	return nil
+}
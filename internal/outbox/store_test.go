@@ -0,0 +1,157 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+
+	"github.com/toutaio/toutago/internal/message"
+)
+
+func newOrderPlaced(id string) *message.BaseMessage {
+	return &message.BaseMessage{
+		MessageSlug: "order.placed",
+		MessageType: "event",
+		Meta:        map[string]interface{}{"order_id": id},
+	}
+}
+
+func TestStore_CommitWritesDataAndOutbox(t *testing.T) {
+	store := NewMemoryStore()
+
+	err := store.Update(context.Background(), func(tx Tx) error {
+		tx.Set("orders/1", []byte(`{"total":10}`))
+		return tx.Publish(newOrderPlaced("1"))
+	})
+	if err != nil {
+		t.Fatalf("Update failed: %v", err)
+	}
+
+	value, ok, _ := store.Get("orders/1")
+	if !ok || string(value) != `{"total":10}` {
+		t.Errorf("Expected committed data, got %q", value)
+	}
+
+	records, _ := store.Pending(0)
+	if len(records) != 1 {
+		t.Fatalf("Expected 1 outbox record, got %d", len(records))
+	}
+
+	if records[0].Message.Slug != "order.placed" {
+		t.Errorf("Expected order.placed, got %s", records[0].Message.Slug)
+	}
+	if id, _ := records[0].Message.Metadata[message.MetaMessageID].(string); id == "" {
+		t.Error("Records should carry a message ID in their metadata")
+	}
+}
+
+func TestStore_SameMessageTwice(t *testing.T) {
+	store := NewMemoryStore()
+	msg := newOrderPlaced("1")
+	msg.Meta[message.MetaMessageID] = "msg-1"
+
+	store.Update(context.Background(), func(tx Tx) error {
+		tx.Publish(msg)
+		return tx.Publish(msg)
+	})
+
+	records, _ := store.Pending(0)
+	if len(records) != 2 || records[0].ID == records[1].ID {
+		t.Fatalf("Expected 2 records with distinct IDs, got %+v", records)
+	}
+	for _, r := range records {
+		if r.Message.Metadata[message.MetaMessageID] != "msg-1" {
+			t.Errorf("The message ID should be kept in metadata, got %v", r.Message.Metadata)
+		}
+	}
+
+	store.MarkFailed(records[0].ID, "boom", true)
+	store.MarkDispatched(records[1].ID)
+	if pending, _ := store.Pending(0); len(pending) != 0 {
+		t.Errorf("Expected no pending records, got %+v", pending)
+	}
+	if parked, _ := store.Parked(); len(parked) != 1 || parked[0].ID != records[0].ID || parked[0].Attempts != 1 {
+		t.Errorf("Only the first record should be parked, got %+v", parked)
+	}
+}
+
+func TestStore_RollbackDiscardsDataAndOutbox(t *testing.T) {
+	store := NewMemoryStore()
+	errBusiness := errors.New("insufficient stock")
+
+	err := store.Update(context.Background(), func(tx Tx) error {
+		tx.Set("orders/1", []byte("x"))
+		tx.Publish(newOrderPlaced("1"))
+		return errBusiness
+	})
+	if !errors.Is(err, errBusiness) {
+		t.Fatalf("Expected business error, got %v", err)
+	}
+
+	if _, ok, _ := store.Get("orders/1"); ok {
+		t.Error("Rolled back write should not be visible")
+	}
+
+	if records, _ := store.Pending(0); len(records) != 0 {
+		t.Errorf("Rolled back message should not be in outbox, got %d", len(records))
+	}
+}
+
+func TestStore_TxReadsOwnWrites(t *testing.T) {
+	store := NewMemoryStore()
+
+	store.Update(context.Background(), func(tx Tx) error {
+		tx.Set("a", []byte("1"))
+		return nil
+	})
+
+	store.Update(context.Background(), func(tx Tx) error {
+		tx.Set("b", []byte("2"))
+		if v, ok := tx.Get("b"); !ok || string(v) != "2" {
+			t.Error("Transaction should see its own write")
+		}
+
+		tx.Delete("a")
+		if _, ok := tx.Get("a"); ok {
+			t.Error("Transaction should see its own delete")
+		}
+		return nil
+	})
+
+	if _, ok, _ := store.Get("a"); ok {
+		t.Error("Delete should be committed")
+	}
+}
+
+func TestFileStore_SurvivesReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "outbox.json")
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+
+	store.Update(context.Background(), func(tx Tx) error {
+		tx.Set("orders/1", []byte("paid"))
+		tx.Publish(newOrderPlaced("1"))
+		return tx.Publish(newOrderPlaced("2"))
+	})
+
+	records, _ := store.Pending(0)
+	store.MarkDispatched(records[0].ID)
+
+	reopened, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("Reopen failed: %v", err)
+	}
+
+	if value, ok, _ := reopened.Get("orders/1"); !ok || string(value) != "paid" {
+		t.Errorf("Expected persisted data, got %q", value)
+	}
+
+	pending, _ := reopened.Pending(0)
+	if len(pending) != 1 || pending[0].Message.Metadata["order_id"] != "2" {
+		t.Errorf("Expected only the undelivered record, got %+v", pending)
+	}
+}
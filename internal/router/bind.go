@@ -0,0 +1,279 @@
+package router
+
+import (
+	"encoding"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/toutaio/toutago/internal/validation"
+)
+
+// MaxMultipartMemory is the number of bytes of a multipart body kept in
+// memory by Bind; larger file parts are stored in temporary files.
+const MaxMultipartMemory = 32 << 20
+
+// BindError is returned by Bind when the request cannot be decoded. Status
+// is the response code the router sends for it: 400 for malformed input and
+// 415 for unsupported content types.
+type BindError struct {
+	Status int
+	Err    error
+}
+
+// Error implements the error interface.
+func (e *BindError) Error() string {
+	return "failed to bind request: " + e.Err.Error()
+}
+
+// Unwrap returns the underlying error.
+func (e *BindError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	fileHeaderType      = reflect.TypeOf((*multipart.FileHeader)(nil))
+	durationType        = reflect.TypeOf(time.Duration(0))
+)
+
+// Bind decodes the request into dst, a pointer to a struct, and validates
+// it. The body is decoded according to its Content-Type: JSON, XML,
+// URL-encoded forms and multipart forms are supported, with form fields
+// matched by `form` tags and uploads bound to *multipart.FileHeader fields.
+// Fields tagged `param`, `query` or `header` are then filled from the path
+// parameters, query string and request headers. Finally the `validate`
+// tags are checked; failures are returned as validation.Errors, which the
+// router renders as 422 Unprocessable Entity.
+//
+//	type UpdateUser struct {
+//	    ID     int    `param:"id"`
+//	    Tenant string `header:"X-Tenant" validate:"required"`
+//	    Name   string `json:"name" validate:"required,min=3"`
+//	}
+func (c *defaultContext) Bind(dst interface{}) error {
+	val := reflect.ValueOf(dst)
+	if val.Kind() != reflect.Ptr || val.IsNil() || val.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("bind destination must be a non-nil pointer to a struct, got %T", dst)
+	}
+
+	if err := c.bindBody(dst); err != nil {
+		return err
+	}
+
+	query := c.req.URL.Query()
+	sources := []struct {
+		tag    string
+		lookup func(name string) []string
+	}{
+		{"param", func(name string) []string {
+			if v := chi.URLParam(c.req, name); v != "" {
+				return []string{v}
+			}
+			return nil
+		}},
+		{"query", func(name string) []string { return query[name] }},
+		{"header", func(name string) []string { return c.req.Header.Values(name) }},
+	}
+	for _, src := range sources {
+		if err := bindValues(val.Elem(), src.tag, src.lookup); err != nil {
+			return &BindError{Status: http.StatusBadRequest, Err: err}
+		}
+	}
+
+	return validation.Struct(dst)
+}
+
+// bindBody decodes the request body into dst based on its Content-Type.
+// Requests without a body are left untouched.
+func (c *defaultContext) bindBody(dst interface{}) error {
+	if c.req.Body == nil || c.req.Body == http.NoBody || c.req.ContentLength == 0 {
+		return nil
+	}
+
+	contentType := c.req.Header.Get("Content-Type")
+	if contentType == "" {
+		return nil
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return &BindError{Status: http.StatusUnsupportedMediaType, Err: err}
+	}
+
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		if err := json.NewDecoder(c.req.Body).Decode(dst); err != nil && !errors.Is(err, io.EOF) {
+			return &BindError{Status: http.StatusBadRequest, Err: fmt.Errorf("invalid JSON body: %w", err)}
+		}
+
+	case mediaType == "application/xml" || mediaType == "text/xml":
+		if err := xml.NewDecoder(c.req.Body).Decode(dst); err != nil && !errors.Is(err, io.EOF) {
+			return &BindError{Status: http.StatusBadRequest, Err: fmt.Errorf("invalid XML body: %w", err)}
+		}
+
+	case mediaType == "application/x-www-form-urlencoded":
+		if err := c.req.ParseForm(); err != nil {
+			return &BindError{Status: http.StatusBadRequest, Err: fmt.Errorf("invalid form body: %w", err)}
+		}
+		return c.bindForm(dst, c.req.PostForm, nil)
+
+	case mediaType == "multipart/form-data":
+		if err := c.req.ParseMultipartForm(MaxMultipartMemory); err != nil {
+			return &BindError{Status: http.StatusBadRequest, Err: fmt.Errorf("invalid multipart body: %w", err)}
+		}
+		return c.bindForm(dst, c.req.MultipartForm.Value, c.req.MultipartForm.File)
+
+	default:
+		return &BindError{Status: http.StatusUnsupportedMediaType, Err: fmt.Errorf("unsupported content type %q", mediaType)}
+	}
+	return nil
+}
+
+// bindForm fills the `form` tagged fields of dst from form values and files.
+func (c *defaultContext) bindForm(dst interface{}, values map[string][]string, files map[string][]*multipart.FileHeader) error {
+	val := reflect.ValueOf(dst).Elem()
+
+	err := walkFields(val, "form", func(field reflect.Value, name string) error {
+		if fhs, ok := files[name]; ok {
+			switch {
+			case field.Type() == fileHeaderType:
+				field.Set(reflect.ValueOf(fhs[0]))
+				return nil
+			case field.Kind() == reflect.Slice && field.Type().Elem() == fileHeaderType:
+				field.Set(reflect.ValueOf(fhs))
+				return nil
+			}
+		}
+		if vs, ok := values[name]; ok {
+			return setField(field, vs)
+		}
+		return nil
+	})
+	if err != nil {
+		return &BindError{Status: http.StatusBadRequest, Err: err}
+	}
+	return nil
+}
+
+// bindValues fills the fields of val tagged with tag using lookup.
+func bindValues(val reflect.Value, tag string, lookup func(name string) []string) error {
+	return walkFields(val, tag, func(field reflect.Value, name string) error {
+		if vs := lookup(name); len(vs) > 0 {
+			return setField(field, vs)
+		}
+		return nil
+	})
+}
+
+// walkFields calls fn for every field of val carrying tag, descending into
+// embedded structs.
+func walkFields(val reflect.Value, tag string, fn func(field reflect.Value, name string) error) error {
+	typ := val.Type()
+	for i := 0; i < typ.NumField(); i++ {
+		sf := typ.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		field := val.Field(i)
+
+		name, _, _ := strings.Cut(sf.Tag.Get(tag), ",")
+		if name == "-" {
+			continue
+		}
+		if name == "" {
+			if sf.Anonymous && field.Kind() == reflect.Struct {
+				if err := walkFields(field, tag, fn); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if err := fn(field, name); err != nil {
+			return fmt.Errorf("%s %q: %w", tag, name, err)
+		}
+	}
+	return nil
+}
+
+// setField converts the string values to the field's type and assigns them.
+// Slices receive every value, other kinds the first.
+func setField(field reflect.Value, values []string) error {
+	if field.Kind() == reflect.Slice && !field.Type().Implements(textUnmarshalerType) && field.Type().Elem().Kind() != reflect.Uint8 {
+		slice := reflect.MakeSlice(field.Type(), len(values), len(values))
+		for i, v := range values {
+			if err := setValue(slice.Index(i), v); err != nil {
+				return err
+			}
+		}
+		field.Set(slice)
+		return nil
+	}
+	return setValue(field, values[0])
+}
+
+// setValue parses s into a single value.
+func setValue(field reflect.Value, s string) error {
+	if field.Kind() == reflect.Ptr {
+		ptr := reflect.New(field.Type().Elem())
+		if err := setValue(ptr.Elem(), s); err != nil {
+			return err
+		}
+		field.Set(ptr)
+		return nil
+	}
+
+	if field.CanAddr() && field.Addr().Type().Implements(textUnmarshalerType) {
+		return field.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(s))
+	}
+
+	switch field.Kind() {
+	case reflect.String:
+		field.SetString(s)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		field.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if field.Type() == durationType {
+			d, err := time.ParseDuration(s)
+			if err != nil {
+				return err
+			}
+			field.SetInt(int64(d))
+			return nil
+		}
+		n, err := strconv.ParseInt(s, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(s, field.Type().Bits())
+		if err != nil {
+			return err
+		}
+		field.SetFloat(f)
+	default:
+		return fmt.Errorf("unsupported field type %s", field.Type())
+	}
+	return nil
+}
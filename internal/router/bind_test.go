@@ -0,0 +1,173 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/toutaio/toutago/internal/di"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+type updateUser struct {
+	ID      int           `param:"id"`
+	Page    int           `query:"page"`
+	Tags    []string      `query:"tag"`
+	Timeout time.Duration `query:"timeout"`
+	Tenant  string        `header:"X-Tenant" validate:"required"`
+	Name    string        `json:"name" xml:"name" form:"name" validate:"required,min=3"`
+	Email   string        `json:"email" xml:"email" form:"email" validate:"required,email"`
+}
+
+// serveBind sends req to a route that binds updateUser and echoes it as JSON.
+func serveBind(req *http.Request) *httptest.ResponseRecorder {
+	router := NewChiRouter(di.NewContainer())
+	router.POST("/users/{id}", func(ctx touta.Context) error {
+		var u updateUser
+		if err := ctx.Bind(&u); err != nil {
+			return err
+		}
+		return ctx.JSON(200, u)
+	})
+
+	w := httptest.NewRecorder()
+	router.Native().(*chi.Mux).ServeHTTP(w, req)
+	return w
+}
+
+func TestContext_BindSources(t *testing.T) {
+	form := url.Values{"name": {"Ada"}, "email": {"ada@example.com"}}
+
+	var multipartBody bytes.Buffer
+	mw := multipart.NewWriter(&multipartBody)
+	mw.WriteField("name", "Ada")
+	mw.WriteField("email", "ada@example.com")
+	mw.Close()
+
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+	}{
+		{"json", "application/json", `{"name":"Ada","email":"ada@example.com"}`},
+		{"xml", "application/xml", `<updateUser><name>Ada</name><email>ada@example.com</email></updateUser>`},
+		{"form", "application/x-www-form-urlencoded", form.Encode()},
+		{"multipart", mw.FormDataContentType(), multipartBody.String()},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/users/42?page=2&tag=a&tag=b&timeout=5s", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("X-Tenant", "acme")
+
+			w := serveBind(req)
+			if w.Code != 200 {
+				t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+			}
+
+			var got updateUser
+			json.Unmarshal(w.Body.Bytes(), &got)
+			want := updateUser{
+				ID: 42, Page: 2, Tags: []string{"a", "b"}, Timeout: 5 * time.Second,
+				Tenant: "acme", Name: "Ada", Email: "ada@example.com",
+			}
+			if got.ID != want.ID || got.Page != want.Page || strings.Join(got.Tags, ",") != "a,b" ||
+				got.Timeout != want.Timeout || got.Tenant != want.Tenant || got.Name != want.Name || got.Email != want.Email {
+				t.Errorf("Bind() = %+v, want %+v", got, want)
+			}
+		})
+	}
+}
+
+func TestContext_BindValidationError(t *testing.T) {
+	req := httptest.NewRequest("POST", "/users/1", strings.NewReader(`{"name":"Al","email":"nope"}`))
+	req.Header.Set("Content-Type", "application/json")
+
+	w := serveBind(req)
+	if w.Code != 422 {
+		t.Fatalf("Expected 422, got %d", w.Code)
+	}
+
+	var body struct {
+		Error  string `json:"error"`
+		Fields []struct {
+			Field string `json:"field"`
+			Rule  string `json:"rule"`
+		} `json:"details"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &body); err != nil {
+		t.Fatalf("Validation response is not JSON: %v", err)
+	}
+
+	var rules []string
+	for _, f := range body.Fields {
+		rules = append(rules, f.Field+":"+f.Rule)
+	}
+	if got := strings.Join(rules, " "); got != "Tenant:required name:min email:email" {
+		t.Errorf("Unexpected validation fields %q", got)
+	}
+}
+
+func TestContext_BindMalformedInput(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"invalid json", "/users/1", "application/json", `{"name":`, 400},
+		{"invalid query", "/users/1?page=two", "application/json", `{}`, 400},
+		{"invalid param", "/users/abc", "application/json", `{}`, 400},
+		{"unsupported type", "/users/1", "application/msgpack", `x`, 415},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.target, strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req.Header.Set("X-Tenant", "acme")
+
+			if w := serveBind(req); w.Code != tt.status {
+				t.Errorf("Expected %d, got %d: %s", tt.status, w.Code, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestContext_BindMultipartFile(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("avatar", "ada.png")
+	fw.Write([]byte("png"))
+	mw.Close()
+
+	req := httptest.NewRequest("POST", "/", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	var dst struct {
+		Avatar *multipart.FileHeader `form:"avatar" validate:"required"`
+	}
+	ctx := NewContext(httptest.NewRecorder(), req, di.NewContainer())
+	if err := ctx.Bind(&dst); err != nil {
+		t.Fatalf("Bind failed: %v", err)
+	}
+	if dst.Avatar == nil || dst.Avatar.Filename != "ada.png" || dst.Avatar.Size != 3 {
+		t.Errorf("Unexpected file header %+v", dst.Avatar)
+	}
+}
+
+func TestContext_BindRejectsNonPointer(t *testing.T) {
+	ctx := NewContext(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), di.NewContainer())
+	if err := ctx.Bind(updateUser{}); err == nil {
+		t.Error("Expected an error for a non-pointer destination")
+	}
+}
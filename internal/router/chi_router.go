@@ -2,80 +2,268 @@ package router
 
 import (
 	"context"
-	"fmt"
+	"log"
 	"net/http"
-	"time"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/toutaio/toutago/internal/server"
 	"github.com/toutaio/toutago/pkg/touta"
 )
 
-// chiRouter implements Router using the Chi router.
+// chiRouter implements Router using the Chi router. Groups share the Chi
+// tree of the top-level router, registering routes under their full
+// pattern, and run their middleware around their routes' handlers.
 type chiRouter struct {
-	mux       *chi.Mux
-	container touta.Container
+	mux           *chi.Mux
+	container     touta.Container
+	encoding      Encoding
+	errorHandler  ErrorHandler
+	debug         bool
+	serverConfig  touta.ServerConfig // set by WithServerConfig
+	mode          string
+	serverOptions []server.Option // set by WithServerOptions
+	routes        *routeTable
+	prefix        string     // pattern prefix of the group
+	parent        *chiRouter // router the group belongs to
+	middleware    []touta.MiddlewareFunc
+
+	// Only set on top-level routers, which own a Chi tree: the router
+	// created by NewChiRouter and its host routers
+	host             *hostPattern
+	hosts            []*chiRouter
+	notFound         []fallback
+	methodNotAllowed []fallback
 }
 
-// NewChiRouter creates a new Chi-based router.
-func NewChiRouter(container touta.Container) touta.Router {
-	return &chiRouter{
+// NewChiRouter creates a new Chi-based router. Requests matching no route
+// or none of a route's methods are answered with 404 and 405 errors,
+// rendered by the error handler like handler errors.
+func NewChiRouter(container touta.Container, opts ...Option) touta.Router {
+	r := &chiRouter{
 		mux:       chi.NewRouter(),
 		container: container,
+		encoding:  Encoding{EscapeHTML: true},
+		routes:    newRouteTable(),
+	}
+	for _, opt := range opts {
+		opt(r)
 	}
+	r.mux.Use(r.dispatch)
+	r.initFallbacks()
+	r.NotFound(notFound)
+	r.MethodNotAllowed(methodNotAllowed)
+	return r
 }
 
 // GET registers a handler for GET requests.
-func (r *chiRouter) GET(path string, handler touta.HandlerFunc) {
-	r.mux.Get(path, r.adapt(handler))
+func (r *chiRouter) GET(path string, handler touta.HandlerFunc, middleware ...touta.MiddlewareFunc) touta.Route {
+	return r.handle([]string{http.MethodGet}, path, handler, middleware)
 }
 
 // POST registers a handler for POST requests.
-func (r *chiRouter) POST(path string, handler touta.HandlerFunc) {
-	r.mux.Post(path, r.adapt(handler))
+func (r *chiRouter) POST(path string, handler touta.HandlerFunc, middleware ...touta.MiddlewareFunc) touta.Route {
+	return r.handle([]string{http.MethodPost}, path, handler, middleware)
 }
 
 // PUT registers a handler for PUT requests.
-func (r *chiRouter) PUT(path string, handler touta.HandlerFunc) {
-	r.mux.Put(path, r.adapt(handler))
+func (r *chiRouter) PUT(path string, handler touta.HandlerFunc, middleware ...touta.MiddlewareFunc) touta.Route {
+	return r.handle([]string{http.MethodPut}, path, handler, middleware)
 }
 
 // DELETE registers a handler for DELETE requests.
-func (r *chiRouter) DELETE(path string, handler touta.HandlerFunc) {
-	r.mux.Delete(path, r.adapt(handler))
+func (r *chiRouter) DELETE(path string, handler touta.HandlerFunc, middleware ...touta.MiddlewareFunc) touta.Route {
+	return r.handle([]string{http.MethodDelete}, path, handler, middleware)
 }
 
 // PATCH registers a handler for PATCH requests.
-func (r *chiRouter) PATCH(path string, handler touta.HandlerFunc) {
-	r.mux.Patch(path, r.adapt(handler))
+func (r *chiRouter) PATCH(path string, handler touta.HandlerFunc, middleware ...touta.MiddlewareFunc) touta.Route {
+	return r.handle([]string{http.MethodPatch}, path, handler, middleware)
 }
 
-// Group creates a route group with a prefix.
-func (r *chiRouter) Group(prefix string) touta.Router {
-	subRouter := &chiRouter{
-		mux:       chi.NewRouter(),
-		container: r.container,
+// HEAD registers a handler for HEAD requests.
+func (r *chiRouter) HEAD(path string, handler touta.HandlerFunc, middleware ...touta.MiddlewareFunc) touta.Route {
+	return r.handle([]string{http.MethodHead}, path, handler, middleware)
+}
+
+// OPTIONS registers a handler for OPTIONS requests.
+func (r *chiRouter) OPTIONS(path string, handler touta.HandlerFunc, middleware ...touta.MiddlewareFunc) touta.Route {
+	return r.handle([]string{http.MethodOptions}, path, handler, middleware)
+}
+
+// CONNECT registers a handler for CONNECT requests.
+func (r *chiRouter) CONNECT(path string, handler touta.HandlerFunc, middleware ...touta.MiddlewareFunc) touta.Route {
+	return r.handle([]string{http.MethodConnect}, path, handler, middleware)
+}
+
+// TRACE registers a handler for TRACE requests.
+func (r *chiRouter) TRACE(path string, handler touta.HandlerFunc, middleware ...touta.MiddlewareFunc) touta.Route {
+	return r.handle([]string{http.MethodTrace}, path, handler, middleware)
+}
+
+// Any registers a handler for requests of any method.
+func (r *chiRouter) Any(path string, handler touta.HandlerFunc, middleware ...touta.MiddlewareFunc) touta.Route {
+	return r.handle(nil, path, handler, middleware)
+}
+
+// Match registers a handler for requests of the given methods. It panics
+// on methods Chi does not know, like registering an invalid pattern does.
+func (r *chiRouter) Match(methods []string, path string, handler touta.HandlerFunc, middleware ...touta.MiddlewareFunc) touta.Route {
+	upper := make([]string, len(methods))
+	for i, m := range methods {
+		upper[i] = strings.ToUpper(m)
+	}
+	return r.handle(upper, path, handler, middleware)
+}
+
+// Handle registers a net/http handler for requests of any method. The
+// handler runs inside the router's middleware, which sees its response.
+func (r *chiRouter) Handle(path string, handler http.Handler, middleware ...touta.MiddlewareFunc) touta.Route {
+	h := func(ctx touta.Context) error {
+		handler.ServeHTTP(ctx.Response(), ctx.Request())
+		return nil
+	}
+	return r.register(nil, path, h, handlerName(handler), middleware)
+}
+
+// handle registers a handler for methods, or any method when nil.
+func (r *chiRouter) handle(methods []string, path string, handler touta.HandlerFunc, middleware []touta.MiddlewareFunc) *routeEntry {
+	return r.register(methods, path, handler, funcName(handler), middleware)
+}
+
+// register adds a route to the Chi tree under its full pattern and
+// records it in the route table. The middleware of the route's groups is
+// looked up on each request, so groups may add middleware after
+// registering routes like the top-level router can.
+func (r *chiRouter) register(methods []string, path string, handler touta.HandlerFunc, name string, middleware []touta.MiddlewareFunc) *routeEntry {
+	pattern := joinPattern(r.prefix, path)
+	e := r.routes.add(&routeEntry{
+		router:     r,
+		methods:    methods,
+		pattern:    pattern,
+		handler:    name,
+		middleware: middlewareNames(middleware),
+	})
+
+	run := chain(handler, middleware)
+	h := &routeHandler{entry: e, HandlerFunc: r.adapt(func(ctx touta.Context) error {
+		return chain(run, r.groupMiddleware())(ctx)
+	})}
+	r.add(methods, pattern, h)
+
+	// A group's "/" route also answers the bare prefix, as it did when
+	// groups were mounted: Group("/api").GET("/", h) serves /api and /api/.
+	// Routes registered for the bare prefix itself are kept.
+	if path == "/" && pattern != "/" {
+		bare := strings.TrimSuffix(pattern, "/")
+		alias := &routeHandler{HandlerFunc: h.HandlerFunc, entry: e, alias: true}
+		if methods == nil {
+			if !r.registered(http.MethodGet, bare) {
+				r.add(nil, bare, alias)
+			}
+		}
+		for _, method := range methods {
+			if !r.registered(method, bare) {
+				r.add([]string{method}, bare, alias)
+			}
+		}
 	}
-	r.mux.Mount(prefix, subRouter.mux)
-	return subRouter
+	return e
+}
+
+// registered reports whether a route with exactly pattern handles method.
+func (r *chiRouter) registered(method, pattern string) bool {
+	rctx := chi.NewRouteContext()
+	return r.mux.Match(rctx, method, pattern) && rctx.RoutePattern() == pattern
 }
 
-// Use adds middleware to the router.
+// add registers h on the Chi tree for methods, or any method when nil.
+func (r *chiRouter) add(methods []string, pattern string, h *routeHandler) {
+	if methods == nil {
+		r.mux.Handle(pattern, h)
+	}
+	for _, method := range methods {
+		r.mux.Method(method, pattern, h)
+	}
+}
+
+// chain wraps handler in middleware, the first being the outermost.
+func chain(handler touta.HandlerFunc, middleware []touta.MiddlewareFunc) touta.HandlerFunc {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+	return handler
+}
+
+// routeHandler is the Chi handler of a registered route. It lets Routes
+// tell which registration Chi kept when a pattern was registered twice.
+type routeHandler struct {
+	http.HandlerFunc
+	entry *routeEntry
+	alias bool // registered for the bare prefix of a group's "/" route
+}
+
+// Use adds middleware to the router. It applies to all routes of the
+// router and its groups, including routes registered before.
 func (r *chiRouter) Use(middleware ...touta.MiddlewareFunc) {
+	r.middleware = append(r.middleware, middleware...)
+}
+
+// groupMiddleware returns the middleware of r and its enclosing groups,
+// outermost first. The middleware of the router created by NewChiRouter
+// is left out, since dispatch runs it before routing.
+func (r *chiRouter) groupMiddleware() []touta.MiddlewareFunc {
+	if r.parent == nil {
+		return nil
+	}
+	return append(r.parent.groupMiddleware(), r.middleware...)
+}
+
+// middlewareChain returns the names of the middleware that run for routes
+// of the router, outermost first.
+func (r *chiRouter) middlewareChain() []string {
+	var chain []string
+	if r.parent != nil {
+		chain = r.parent.middlewareChain()
+	}
+	return append(chain, middlewareNames(r.middleware)...)
+}
+
+func middlewareNames(middleware []touta.MiddlewareFunc) []string {
+	var names []string
 	for _, mw := range middleware {
-		r.mux.Use(r.adaptMiddleware(mw))
+		names = append(names, middlewareName(mw))
+	}
+	return names
+}
+
+// within reports whether r is ancestor or one of its groups.
+func (r *chiRouter) within(ancestor *chiRouter) bool {
+	for ; r != nil; r = r.parent {
+		if r == ancestor {
+			return true
+		}
 	}
+	return false
 }
 
-// Listen starts the HTTP server on the given address.
+// URL builds the path of a named route, see touta.Router.
+func (r *chiRouter) URL(name string, params ...interface{}) (string, error) {
+	return r.routes.url(name, params...)
+}
+
+// Listen starts the HTTP server on the given address, or the configured
+// host and port when addr is empty, and shuts it down gracefully on SIGINT
+// or SIGTERM. The server uses the settings given WithServerConfig and
+// WithServerOptions, or the defaults of the server package.
 func (r *chiRouter) Listen(addr string) error {
-	server := &http.Server{
-		Addr:         addr,
-		Handler:      r.mux,
-		ReadTimeout:  15 * time.Second,
-		WriteTimeout: 15 * time.Second,
-		IdleTimeout:  60 * time.Second,
+	root := r.root()
+	opts := []server.Option{server.WithMode(root.mode)}
+	if addr != "" {
+		opts = append(opts, server.WithAddr(addr))
 	}
-	return server.ListenAndServe()
+	opts = append(opts, root.serverOptions...)
+	return server.New(root.mux, root.serverConfig, opts...).Run(context.Background())
 }
 
 // Native returns the underlying Chi router.
@@ -83,35 +271,89 @@ func (r *chiRouter) Native() interface{} {
 	return r.mux
 }
 
-// adapt converts a touta.HandlerFunc to http.HandlerFunc.
+// adapt converts a touta.HandlerFunc to http.HandlerFunc. Inside a
+// middleware chain the handler shares the chain's Context and its error is
+// returned to the middleware instead of being handled here.
 func (r *chiRouter) adapt(handler touta.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, req *http.Request) {
-		ctx := NewContext(w, req, r.container)
-		if err := handler(ctx); err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
+		ctx, chained := r.requestContext(w, req)
+		err := handler(ctx)
+		if chained {
+			ctx.downstreamErr = err
+			return
+		}
+		if err != nil {
+			r.handleError(ctx, err)
 		}
 	}
 }
 
-// adaptMiddleware converts touta.MiddlewareFunc to Chi middleware.
-func (r *chiRouter) adaptMiddleware(mw touta.MiddlewareFunc) func(http.Handler) http.Handler {
-	return func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
-			ctx := NewContext(w, req, r.container)
+// handleError passes a handler error to the error handler. Once the
+// response has started it is too late to send an error status, so the
+// error is only logged.
+func (r *chiRouter) handleError(ctx *defaultContext, err error) {
+	if responseStarted(ctx.res) {
+		log.Printf("router: %s %s: error after response started: %v", ctx.req.Method, ctx.req.URL.Path, err)
+		return
+	}
 
-			// Wrap next handler
-			wrappedHandler := func(c touta.Context) error {
-				next.ServeHTTP(w, req)
-				return nil
-			}
+	handler := r.errorHandler
+	if handler == nil {
+		handler = NewErrorHandler(r.debug)
+	}
+	handler(ctx, err)
+}
 
-			// Call middleware
-			handler := mw(wrappedHandler)
-			if err := handler(ctx); err != nil {
-				http.Error(w, err.Error(), http.StatusInternalServerError)
-			}
-		})
+// newContext creates a request context using the router's settings.
+func (r *chiRouter) newContext(w http.ResponseWriter, req *http.Request) *defaultContext {
+	ctx := NewContext(w, req, r.container).(*defaultContext)
+	ctx.encoding = r.encoding
+	ctx.routes = r.routes
+	return ctx
+}
+
+// contextKey stores the per-request Context in the request context, so
+// every middleware and the final handler share it.
+type contextKey struct{}
+
+// requestContext returns the Context created by an enclosing middleware, or
+// a new one when there is none. The Context is updated to the request and
+// writer it is called with, since Set and Chi derive new requests.
+func (r *chiRouter) requestContext(w http.ResponseWriter, req *http.Request) (*defaultContext, bool) {
+	if ctx, ok := req.Context().Value(contextKey{}).(*defaultContext); ok {
+		ctx.req = req
+		ctx.res = newResponseWriter(w)
+		return ctx, true
 	}
+	return r.newContext(newResponseWriter(w), req), false
+}
+
+// dispatch is the Chi middleware of the top-level router. It creates the
+// request Context and runs the router's middleware around routing, which
+// continues with the Chi tree of the host router matching the request or
+// with the router's own. Errors that leave the middleware are passed to
+// the error handler.
+func (r *chiRouter) dispatch(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		ctx := r.newContext(newResponseWriter(w), req)
+		ctx.req = req.WithContext(context.WithValue(req.Context(), contextKey{}, ctx))
+
+		route := func(c touta.Context) error {
+			target := next
+			if host := r.matchHost(ctx.req); host != nil {
+				target = host.mux
+			}
+			ctx.downstreamErr = nil
+			target.ServeHTTP(ctx.res, ctx.req)
+			err := ctx.downstreamErr
+			ctx.downstreamErr = nil
+			return err
+		}
+
+		if err := chain(route, r.middleware)(ctx); err != nil {
+			r.handleError(ctx, err)
+		}
+	})
 }
 
 // defaultContext implements the Context interface.
@@ -120,6 +362,11 @@ type defaultContext struct {
 	res       http.ResponseWriter
 	container touta.Container
 	data      map[string]interface{}
+	encoding  Encoding
+	routes    *routeTable
+
+	// downstreamErr carries a handler error back up the middleware chain
+	downstreamErr error
 }
 
 // NewContext creates a new request context.
@@ -129,6 +376,7 @@ func NewContext(w http.ResponseWriter, req *http.Request, container touta.Contai
 		res:       w,
 		container: container,
 		data:      make(map[string]interface{}),
+		encoding:  Encoding{EscapeHTML: true},
 	}
 }
 
@@ -142,6 +390,16 @@ func (c *defaultContext) Response() http.ResponseWriter {
 	return c.res
 }
 
+// SetRequest replaces the request.
+func (c *defaultContext) SetRequest(req *http.Request) {
+	c.req = req
+}
+
+// SetResponse replaces the response writer.
+func (c *defaultContext) SetResponse(w http.ResponseWriter) {
+	c.res = w
+}
+
 // Param retrieves a URL parameter by name.
 func (c *defaultContext) Param(key string) string {
 	return chi.URLParam(c.req, key)
@@ -175,16 +433,6 @@ func (c *defaultContext) Container() touta.Container {
 	return c.container
 }
 
-// JSON sends a JSON response.
-func (c *defaultContext) JSON(status int, data interface{}) error {
-	c.res.Header().Set("Content-Type", "application/json")
-	c.res.WriteHeader(status)
-
-	// Simple JSON encoding (could use encoding/json for real implementation)
-	fmt.Fprintf(c.res, "%v", data)
-	return nil
-}
-
 // String sends a plain text response.
 func (c *defaultContext) String(status int, text string) error {
 	c.res.Header().Set("Content-Type", "text/plain")
@@ -201,6 +449,11 @@ func (c *defaultContext) HTML(status int, html string) error {
 	return err
 }
 
+// URL builds the path of a named route of the router handling the request.
+func (c *defaultContext) URL(name string, params ...interface{}) (string, error) {
+	return c.routes.url(name, params...)
+}
+
 // Redirect redirects to another URL.
 func (c *defaultContext) Redirect(status int, url string) error {
 	http.Redirect(c.res, c.req, url, status)
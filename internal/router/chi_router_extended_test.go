@@ -2,7 +2,9 @@ package router
 
 import (
 	"errors"
+	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
 
 	"github.com/go-chi/chi/v5"
@@ -173,3 +175,168 @@ func TestChiRouter_Native(t *testing.T) {
 		t.Error("Native router should be Chi Mux")
 	}
 }
+
+func serve(router touta.Router, method, path string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	req.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	router.Native().(*chi.Mux).ServeHTTP(w, req)
+	return w
+}
+
+func TestChiRouter_AnyAndMatch(t *testing.T) {
+	router := NewChiRouter(di.NewContainer())
+	router.Any("/any", func(ctx touta.Context) error {
+		return ctx.String(200, ctx.Request().Method)
+	})
+	router.Match([]string{"get", "POST"}, "/match", func(ctx touta.Context) error {
+		return ctx.String(200, ctx.Request().Method)
+	})
+
+	for _, method := range []string{"GET", "DELETE", "OPTIONS"} {
+		if w := serve(router, method, "/any"); w.Code != 200 || w.Body.String() != method {
+			t.Errorf("%s /any: %d %q", method, w.Code, w.Body.String())
+		}
+	}
+	for _, method := range []string{"GET", "POST"} {
+		if w := serve(router, method, "/match"); w.Code != 200 {
+			t.Errorf("%s /match: expected 200, got %d", method, w.Code)
+		}
+	}
+	if w := serve(router, "PUT", "/match"); w.Code != 405 {
+		t.Errorf("PUT /match: expected 405, got %d", w.Code)
+	}
+}
+
+func TestChiRouter_Handle(t *testing.T) {
+	router := NewChiRouter(di.NewContainer())
+
+	var order []string
+	record := func(name string) touta.MiddlewareFunc {
+		return func(next touta.HandlerFunc) touta.HandlerFunc {
+			return func(ctx touta.Context) error {
+				order = append(order, name)
+				return next(ctx)
+			}
+		}
+	}
+	router.Use(record("router"))
+	router.Handle("/legacy/*", http.StripPrefix("/legacy", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("legacy " + r.URL.Path))
+	})), record("route"))
+
+	w := serve(router, "POST", "/legacy/a/b")
+	if w.Body.String() != "legacy /a/b" {
+		t.Errorf("unexpected body %q", w.Body.String())
+	}
+	if strings.Join(order, ",") != "router,route" {
+		t.Errorf("unexpected middleware order %v", order)
+	}
+}
+
+func TestChiRouter_RouteMiddleware(t *testing.T) {
+	router := NewChiRouter(di.NewContainer())
+
+	var order []string
+	record := func(name string) touta.MiddlewareFunc {
+		return func(next touta.HandlerFunc) touta.HandlerFunc {
+			return func(ctx touta.Context) error {
+				order = append(order, name)
+				return next(ctx)
+			}
+		}
+	}
+	deny := func(next touta.HandlerFunc) touta.HandlerFunc {
+		return func(ctx touta.Context) error {
+			return touta.NewHTTPError(http.StatusForbidden, "")
+		}
+	}
+
+	router.Use(record("router"))
+	router.GET("/a", func(ctx touta.Context) error {
+		order = append(order, "handler")
+		return nil
+	}, record("first"), record("second"))
+	router.GET("/denied", noop, deny)
+	router.GET("/open", noop)
+
+	serve(router, "GET", "/a")
+	if strings.Join(order, ",") != "router,first,second,handler" {
+		t.Errorf("unexpected order %v", order)
+	}
+	if w := serve(router, "GET", "/denied"); w.Code != 403 {
+		t.Errorf("expected 403 from route middleware, got %d", w.Code)
+	}
+	if w := serve(router, "GET", "/open"); w.Code != 200 {
+		t.Errorf("route middleware leaked to other routes: %d", w.Code)
+	}
+}
+
+func TestChiRouter_With(t *testing.T) {
+	router := NewChiRouter(di.NewContainer())
+
+	var order []string
+	record := func(name string) touta.MiddlewareFunc {
+		return func(next touta.HandlerFunc) touta.HandlerFunc {
+			return func(ctx touta.Context) error {
+				order = append(order, name)
+				return next(ctx)
+			}
+		}
+	}
+
+	router.Use(record("router"))
+	admin := router.With(record("with"))
+	admin.Use(record("use"))
+	admin.GET("/admin", noop).Name("admin")
+	router.GET("/public", noop)
+
+	serve(router, "GET", "/admin")
+	if strings.Join(order, ",") != "router,with,use" {
+		t.Errorf("unexpected order for inline route %v", order)
+	}
+
+	order = nil
+	serve(router, "GET", "/public")
+	if strings.Join(order, ",") != "router" {
+		t.Errorf("inline middleware leaked to the parent router: %v", order)
+	}
+
+	if url, _ := router.URL("admin"); url != "/admin" {
+		t.Errorf("inline routes should share names, got %q", url)
+	}
+}
+
+func TestChiRouter_NotFoundAndMethodNotAllowed(t *testing.T) {
+	router := NewChiRouter(di.NewContainer())
+	router.GET("/users", noop)
+	router.POST("/users", noop)
+	router.Group("/api").GET("/items", noop)
+
+	w := serve(router, "GET", "/missing")
+	if w.Code != 404 || !strings.Contains(w.Body.String(), `"code":"not_found"`) {
+		t.Errorf("expected a rendered 404, got %d %q", w.Code, w.Body.String())
+	}
+
+	w = serve(router, "DELETE", "/users")
+	if w.Code != 405 || !strings.Contains(w.Body.String(), `"code":"method_not_allowed"`) {
+		t.Errorf("expected a rendered 405, got %d %q", w.Code, w.Body.String())
+	}
+	if allow := w.Header().Get("Allow"); allow != "GET, POST" {
+		t.Errorf("expected Allow: GET, POST, got %q", allow)
+	}
+
+	if w := serve(router, "GET", "/api/missing"); w.Code != 404 || !strings.Contains(w.Body.String(), "not_found") {
+		t.Errorf("groups should use the 404 handler, got %d %q", w.Code, w.Body.String())
+	}
+	if w := serve(router, "PUT", "/api/items"); w.Code != 405 || w.Header().Get("Allow") != "GET" {
+		t.Errorf("groups should use the 405 handler, got %d %v", w.Code, w.Header())
+	}
+
+	router.NotFound(func(ctx touta.Context) error {
+		return touta.NewHTTPError(http.StatusNotFound, "nothing here").WithCode("custom")
+	})
+	if w := serve(router, "GET", "/missing"); !strings.Contains(w.Body.String(), `"code":"custom"`) {
+		t.Errorf("custom 404 handler not used: %q", w.Body.String())
+	}
+}
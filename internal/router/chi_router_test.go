@@ -39,12 +39,16 @@ func TestChiRouter_Methods(t *testing.T) {
 	container := di.NewContainer()
 	router := NewChiRouter(container)
 
-	methods := map[string]func(string, touta.HandlerFunc){
-		"GET":    router.GET,
-		"POST":   router.POST,
-		"PUT":    router.PUT,
-		"DELETE": router.DELETE,
-		"PATCH":  router.PATCH,
+	methods := map[string]func(string, touta.HandlerFunc, ...touta.MiddlewareFunc) touta.Route{
+		"GET":     router.GET,
+		"POST":    router.POST,
+		"PUT":     router.PUT,
+		"DELETE":  router.DELETE,
+		"PATCH":   router.PATCH,
+		"HEAD":    router.HEAD,
+		"OPTIONS": router.OPTIONS,
+		"CONNECT": router.CONNECT,
+		"TRACE":   router.TRACE,
 	}
 
 	for method, registerFunc := range methods {
@@ -0,0 +1,25 @@
+package router
+
+import (
+	"github.com/toutaio/toutago/internal/server"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// WithServerConfig sets the server settings of touta.yaml, and the
+// framework mode deciding whether TLS needs a certificate, that Listen
+// serves with: timeouts, header limits, TLS and the address used when
+// Listen is given none.
+func WithServerConfig(cfg touta.ServerConfig, mode string) Option {
+	return func(r *chiRouter) {
+		r.serverConfig = cfg
+		r.mode = mode
+	}
+}
+
+// WithServerOptions adds options, such as server.WithRedirectHTTP or
+// server.WithH2C, to the server Listen starts.
+func WithServerOptions(opts ...server.Option) Option {
+	return func(r *chiRouter) {
+		r.serverOptions = append(r.serverOptions, opts...)
+	}
+}
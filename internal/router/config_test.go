@@ -0,0 +1,36 @@
+package router
+
+import (
+	"io"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/toutaio/toutago/internal/di"
+	"github.com/toutaio/toutago/internal/server"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+func TestWithServerConfig(t *testing.T) {
+	r := NewChiRouter(di.NewContainer(), WithServerConfig(touta.ServerConfig{
+		TLS: touta.TLSConfig{Enabled: true},
+	}, "production"))
+
+	// Listen fails before serving, as the configured TLS has no certificate
+	err := r.Group("/api").Listen("127.0.0.1:0")
+	if err == nil || !strings.Contains(err.Error(), "cert_file") {
+		t.Errorf("Listen should use the server config and mode, got %v", err)
+	}
+}
+
+func TestWithServerOptions(t *testing.T) {
+	r := NewChiRouter(di.NewContainer(),
+		WithServerConfig(touta.ServerConfig{TLS: touta.TLSConfig{Enabled: true}}, "development"),
+		WithServerOptions(server.WithRedirectHTTP("127.0.0.1:-1"), server.WithLogger(log.New(io.Discard, "", 0))))
+
+	// Listen fails before serving, as the redirect address is invalid
+	err := r.Listen("127.0.0.1:0")
+	if err == nil || !strings.Contains(err.Error(), "redirects") {
+		t.Errorf("Listen should use the server options, got %v", err)
+	}
+}
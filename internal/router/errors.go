@@ -0,0 +1,219 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"html/template"
+	"log"
+	"net/http"
+	"runtime/debug"
+	"strings"
+
+	"github.com/toutaio/toutago/internal/validation"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// ErrorHandler renders an error returned by a handler. It is only called
+// while the response can still be replaced; errors raised after the
+// response has started are logged instead.
+type ErrorHandler func(ctx touta.Context, err error)
+
+// WithErrorHandler replaces the handler used to render handler errors.
+func WithErrorHandler(h ErrorHandler) Option {
+	return func(r *chiRouter) {
+		r.errorHandler = h
+	}
+}
+
+// WithDebug enables development error pages, which show the internal error
+// chain and stack traces instead of the public message alone.
+func WithDebug(debug bool) Option {
+	return func(r *chiRouter) {
+		r.debug = debug
+	}
+}
+
+// PanicError is a recovered panic, carrying the stack at the point of the
+// panic for development error pages.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+// NewPanicError captures the current stack for a recovered value. Call it
+// from the deferred function that recovered.
+func NewPanicError(value interface{}) *PanicError {
+	return &PanicError{Value: value, Stack: debug.Stack()}
+}
+
+// Error implements the error interface.
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// Unwrap returns the panic value when it is an error.
+func (e *PanicError) Unwrap() error {
+	err, _ := e.Value.(error)
+	return err
+}
+
+// StackTrace returns the stack of the panic.
+func (e *PanicError) StackTrace() []byte {
+	return e.Stack
+}
+
+// AsHTTPError converts err to the HTTPError sent to the client. HTTPErrors
+// in the chain are used as is, validation errors become 422 with the
+// failing fields as details, bind errors keep their status, and anything
+// else is a 500 that hides the internal message.
+func AsHTTPError(err error) *touta.HTTPError {
+	var httpErr *touta.HTTPError
+	if errors.As(err, &httpErr) {
+		return httpErr
+	}
+
+	var verrs validation.Errors
+	if errors.As(err, &verrs) {
+		return touta.NewHTTPError(http.StatusUnprocessableEntity, "validation failed").
+			WithCode("validation_failed").
+			WithDetails(verrs).
+			Wrap(err)
+	}
+
+	var bindErr *BindError
+	if errors.As(err, &bindErr) {
+		return touta.NewHTTPError(bindErr.Status, bindErr.Error()).Wrap(err)
+	}
+
+	return touta.NewHTTPError(http.StatusInternalServerError, "").Wrap(err)
+}
+
+// NewErrorHandler returns the default ErrorHandler. It renders errors as
+// JSON, RFC 7807 problem+json or HTML, whichever the Accept header prefers,
+// and logs server errors. With debug enabled the internal error chain and
+// any stack trace are included.
+func NewErrorHandler(debug bool) ErrorHandler {
+	return func(ctx touta.Context, err error) {
+		req := ctx.Request()
+		httpErr := AsHTTPError(err)
+		if httpErr.Status >= 500 {
+			log.Printf("router: %s %s: %v", req.Method, req.URL.Path, err)
+		}
+
+		ctx.Response().Header().Add("Vary", "Accept")
+		var renderErr error
+		switch negotiate(req.Header.Get("Accept"), errorTypes) {
+		case "application/problem+json":
+			renderErr = renderProblem(ctx, httpErr, err, debug)
+		case "text/html":
+			renderErr = renderErrorPage(ctx, httpErr, err, debug)
+		default:
+			renderErr = ctx.JSON(httpErr.Status, errorBody(httpErr, err, debug))
+		}
+		if renderErr != nil {
+			log.Printf("router: %s %s: failed to render error: %v", req.Method, req.URL.Path, renderErr)
+		}
+	}
+}
+
+// Media types offered for error responses, in order of preference.
+var errorTypes = []string{"application/json", "application/problem+json", "text/html"}
+
+// errorBody is the JSON representation of an error.
+func errorBody(httpErr *touta.HTTPError, err error, debug bool) map[string]interface{} {
+	body := map[string]interface{}{
+		"status": httpErr.Status,
+		"error":  httpErr.Message,
+		"code":   httpErr.Code,
+	}
+	if httpErr.Details != nil {
+		body["details"] = httpErr.Details
+	}
+	if debug {
+		body["debug"] = errorChain(err)
+	}
+	return body
+}
+
+// renderProblem writes an RFC 7807 problem document. Code and details are
+// extension members.
+func renderProblem(ctx touta.Context, httpErr *touta.HTTPError, err error, debug bool) error {
+	problem := map[string]interface{}{
+		"type":   "about:blank",
+		"title":  http.StatusText(httpErr.Status),
+		"status": httpErr.Status,
+		"detail": httpErr.Message,
+		"code":   httpErr.Code,
+	}
+	if httpErr.Details != nil {
+		problem["details"] = httpErr.Details
+	}
+	if debug {
+		problem["debug"] = errorChain(err)
+	}
+
+	out, encErr := jsonEncode(problem, Encoding{EscapeHTML: true})
+	if encErr != nil {
+		return encErr
+	}
+	return ctx.Blob(httpErr.Status, "application/problem+json", out)
+}
+
+var errorPage = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>{{.Status}} {{.Title}}</title></head>
+<body>
+<h1>{{.Status}} {{.Title}}</h1>
+<p>{{.Message}}</p>
+{{- if .Debug}}
+<h2>Error chain</h2>
+<ol>{{range .Chain}}<li><code>{{.}}</code></li>{{end}}</ol>
+{{- if .Stack}}
+<h2>Stack trace</h2>
+<pre>{{.Stack}}</pre>
+{{- end}}
+{{- end}}
+</body>
+</html>
+`))
+
+// renderErrorPage writes an HTML error page, with the error chain and stack
+// trace in debug mode.
+func renderErrorPage(ctx touta.Context, httpErr *touta.HTTPError, err error, debug bool) error {
+	data := map[string]interface{}{
+		"Status":  httpErr.Status,
+		"Title":   http.StatusText(httpErr.Status),
+		"Message": httpErr.Message,
+		"Debug":   debug,
+	}
+	if debug {
+		data["Chain"] = errorChain(err)
+		data["Stack"] = stackTrace(err)
+	}
+
+	var buf strings.Builder
+	if err := errorPage.Execute(&buf, data); err != nil {
+		return err
+	}
+	return ctx.HTML(httpErr.Status, buf.String())
+}
+
+// errorChain lists the messages of err and every error it wraps.
+func errorChain(err error) []string {
+	var chain []string
+	for err != nil {
+		chain = append(chain, fmt.Sprintf("%T: %v", err, err))
+		err = errors.Unwrap(err)
+	}
+	return chain
+}
+
+// stackTrace returns the stack recorded by the first error in the chain
+// that has one.
+func stackTrace(err error) string {
+	var st interface{ StackTrace() []byte }
+	if errors.As(err, &st) {
+		return string(st.StackTrace())
+	}
+	return ""
+}
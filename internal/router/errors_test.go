@@ -0,0 +1,119 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/toutaio/toutago/internal/di"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// serveError serves a route returning err with the given Accept header.
+func serveError(err error, accept string, opts ...Option) *httptest.ResponseRecorder {
+	router := NewChiRouter(di.NewContainer(), opts...)
+	router.GET("/", func(ctx touta.Context) error {
+		return err
+	})
+
+	req := httptest.NewRequest("GET", "/", nil)
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	router.Native().(*chi.Mux).ServeHTTP(w, req)
+	return w
+}
+
+func TestErrorHandler_HTTPErrorJSON(t *testing.T) {
+	err := touta.NewHTTPError(404, "user not found").WithDetails(map[string]int{"id": 7})
+	w := serveError(err, "application/json")
+
+	if w.Code != 404 || w.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("Unexpected response %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+
+	var body map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &body)
+	if body["error"] != "user not found" || body["code"] != "not_found" || body["details"] == nil {
+		t.Errorf("Unexpected error body %v", body)
+	}
+}
+
+func TestErrorHandler_HidesInternalErrors(t *testing.T) {
+	w := serveError(errors.New("db password rejected"), "")
+
+	if w.Code != 500 {
+		t.Fatalf("Expected 500, got %d", w.Code)
+	}
+	if strings.Contains(w.Body.String(), "password") {
+		t.Errorf("Internal error message leaked: %s", w.Body.String())
+	}
+}
+
+func TestErrorHandler_ProblemJSON(t *testing.T) {
+	err := touta.NewHTTPError(409, "email taken").WithCode("email_taken")
+	w := serveError(err, "application/problem+json")
+
+	if w.Header().Get("Content-Type") != "application/problem+json" {
+		t.Fatalf("Expected problem+json, got %s", w.Header().Get("Content-Type"))
+	}
+
+	var problem map[string]interface{}
+	json.Unmarshal(w.Body.Bytes(), &problem)
+	if problem["title"] != "Conflict" || problem["status"] != float64(409) ||
+		problem["detail"] != "email taken" || problem["code"] != "email_taken" {
+		t.Errorf("Unexpected problem document %v", problem)
+	}
+}
+
+func TestErrorHandler_HTMLDebugPage(t *testing.T) {
+	err := &PanicError{Value: "boom", Stack: []byte("goroutine 1 [running]:\nmain.handler()")}
+	accept := "text/html,application/xhtml+xml"
+
+	w := serveError(err, accept)
+	if w.Code != 500 || !strings.Contains(w.Body.String(), "<h1>500 Internal Server Error</h1>") {
+		t.Fatalf("Unexpected error page %d %s", w.Code, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "goroutine") {
+		t.Error("Stack trace shown outside debug mode")
+	}
+
+	w = serveError(err, accept, WithDebug(true))
+	if !strings.Contains(w.Body.String(), "panic: boom") || !strings.Contains(w.Body.String(), "main.handler()") {
+		t.Errorf("Debug page should show the error chain and stack trace, got %s", w.Body.String())
+	}
+}
+
+func TestErrorHandler_Custom(t *testing.T) {
+	var got error
+	w := serveError(errors.New("custom"), "", WithErrorHandler(func(ctx touta.Context, err error) {
+		got = err
+		ctx.String(503, "unavailable")
+	}))
+
+	if got == nil || got.Error() != "custom" || w.Code != 503 {
+		t.Errorf("Custom error handler not used: %v %d", got, w.Code)
+	}
+}
+
+func TestErrorHandler_SkippedAfterResponseStarted(t *testing.T) {
+	called := false
+	router := NewChiRouter(di.NewContainer(), WithErrorHandler(func(ctx touta.Context, err error) {
+		called = true
+	}))
+	router.GET("/", func(ctx touta.Context) error {
+		ctx.String(200, "partial")
+		return errors.New("late failure")
+	})
+
+	w := httptest.NewRecorder()
+	router.Native().(*chi.Mux).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if called || w.Code != 200 || w.Body.String() != "partial" {
+		t.Errorf("Error handler must not run once headers are written")
+	}
+}
@@ -0,0 +1,321 @@
+package router
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// Group creates a route group with a prefix, calling fn with it when
+// given. The group registers its routes on r's tree, so the same prefix
+// can be used by several groups and r's middleware runs for the group's
+// routes even when added later. Middleware added to the group only runs
+// for its routes, after r's. A "/" route of the group answers requests for
+// the prefix both with and without the trailing slash.
+func (r *chiRouter) Group(prefix string, fn ...func(touta.Router)) touta.Router {
+	g := r.group(joinPattern(r.prefix, prefix))
+	for _, f := range fn {
+		f(g)
+	}
+	return g
+}
+
+// Route nests routes below pattern, mirroring Chi's Route. It is Group
+// with a required callback.
+func (r *chiRouter) Route(pattern string, fn func(touta.Router)) touta.Router {
+	return r.Group(pattern, fn)
+}
+
+// With returns a router registering routes on r that run middleware after
+// r's own. Middleware added to it with Use only applies to its routes.
+func (r *chiRouter) With(middleware ...touta.MiddlewareFunc) touta.Router {
+	g := r.group(r.prefix)
+	g.Use(middleware...)
+	return g
+}
+
+func (r *chiRouter) group(prefix string) *chiRouter {
+	return &chiRouter{
+		mux:          r.mux,
+		container:    r.container,
+		encoding:     r.encoding,
+		errorHandler: r.errorHandler,
+		debug:        r.debug,
+		routes:       r.routes,
+		prefix:       prefix,
+		parent:       r,
+	}
+}
+
+// Host returns a router for requests whose host matches pattern, such as
+// "api.example.com", "{tenant}.example.com" or "*.example.com", calling fn
+// with it when given. Host parameters are read with Param like path
+// parameters. A request is routed by the first matching host router, plain
+// host names before patterns, instead of by the top-level router, which
+// still runs its middleware for it. Calling Host again with the same
+// pattern returns the same router.
+//
+// Host routers are top-level: called on a group, Host ignores the group's
+// prefix and middleware. It panics on an invalid pattern.
+func (r *chiRouter) Host(pattern string, fn ...func(touta.Router)) touta.Router {
+	root := r.root()
+
+	var h *chiRouter
+	for _, existing := range root.hosts {
+		if existing.host.pattern == pattern {
+			h = existing
+		}
+	}
+	if h == nil {
+		host, err := compileHost(pattern)
+		if err != nil {
+			panic(fmt.Sprintf("router: %v", err))
+		}
+		h = root.group("")
+		h.mux = chi.NewRouter()
+		h.host = host
+		h.initFallbacks()
+		// Chi builds the handler of a mux when its first route is added;
+		// With builds it now, so requests can be routed to empty hosts
+		h.mux.With()
+		root.addHost(h)
+	}
+
+	for _, f := range fn {
+		f(h)
+	}
+	return h
+}
+
+// addHost adds a host router, keeping hosts without parameters or
+// wildcards first so they take precedence over patterns matching them.
+func (r *chiRouter) addHost(h *chiRouter) {
+	i := len(r.hosts)
+	if h.host.static() {
+		for i > 0 && !r.hosts[i-1].host.static() {
+			i--
+		}
+	}
+	r.hosts = append(r.hosts, nil)
+	copy(r.hosts[i+1:], r.hosts[i:])
+	r.hosts[i] = h
+}
+
+// root returns the router created by NewChiRouter.
+func (r *chiRouter) root() *chiRouter {
+	for r.parent != nil {
+		r = r.parent
+	}
+	return r
+}
+
+// top returns the router owning r's Chi tree: its host router or root.
+func (r *chiRouter) top() *chiRouter {
+	for r.parent != nil && r.host == nil {
+		r = r.parent
+	}
+	return r
+}
+
+// hostName returns the host pattern of r's host router, if any.
+func (r *chiRouter) hostName() string {
+	if t := r.top(); t.host != nil {
+		return t.host.pattern
+	}
+	return ""
+}
+
+// hostPattern matches request hosts.
+type hostPattern struct {
+	pattern string
+	re      *regexp.Regexp
+	params  []string
+}
+
+func (p *hostPattern) static() bool {
+	return !strings.ContainsAny(p.pattern, "{*")
+}
+
+func compileHost(pattern string) (*hostPattern, error) {
+	re, params, err := compilePattern(strings.ToLower(pattern), '.', false)
+	if err != nil {
+		return nil, fmt.Errorf("invalid host pattern %s: %w", pattern, err)
+	}
+	return &hostPattern{pattern: pattern, re: re, params: params}, nil
+}
+
+// matchHost returns the host router matching the request, storing the
+// host parameters in the Chi route context. It returns nil when no host
+// router matches.
+func (r *chiRouter) matchHost(req *http.Request) *chiRouter {
+	if len(r.hosts) == 0 {
+		return nil
+	}
+	host := req.Host
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+
+	for _, h := range r.hosts {
+		m := h.host.re.FindStringSubmatch(host)
+		if m == nil {
+			continue
+		}
+		if rctx := chi.RouteContext(req.Context()); rctx != nil {
+			for i, name := range h.host.params {
+				rctx.URLParams.Add(name, m[i+1])
+			}
+		}
+		return h
+	}
+	return nil
+}
+
+// compilePattern compiles a Chi style pattern, in which {param} matches
+// up to the next sep, {param:regexp} matches regexp and * matches the
+// rest. A prefix pattern also matches longer values continuing with sep.
+// The parameter names are returned in the order of their groups.
+func compilePattern(pattern string, sep byte, prefix bool) (*regexp.Regexp, []string, error) {
+	var b strings.Builder
+	var params []string
+	b.WriteString("^")
+
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '{':
+			end := closingBrace(pattern, i)
+			if end < 0 {
+				return nil, nil, fmt.Errorf("unclosed brace")
+			}
+			param, expr, hasExpr := strings.Cut(pattern[i+1:end], ":")
+			if !hasExpr {
+				expr = "[^" + regexp.QuoteMeta(string(sep)) + "]+"
+			}
+			if _, err := regexp.Compile(expr); err != nil {
+				return nil, nil, fmt.Errorf("invalid pattern for param %q: %w", param, err)
+			}
+			b.WriteString("(" + expr + ")")
+			params = append(params, param)
+			i = end
+		case '*':
+			b.WriteString(".*")
+		default:
+			b.WriteString(regexp.QuoteMeta(pattern[i : i+1]))
+		}
+	}
+
+	if prefix {
+		if pattern != "" {
+			b.WriteString("(?:" + regexp.QuoteMeta(string(sep)) + "|$)")
+		}
+	} else {
+		b.WriteString("$")
+	}
+	re, err := regexp.Compile(b.String())
+	return re, params, err
+}
+
+// fallback is a NotFound or MethodNotAllowed handler for the requests
+// below a group prefix.
+type fallback struct {
+	prefix  string
+	re      *regexp.Regexp
+	handler touta.HandlerFunc
+}
+
+// initFallbacks routes the requests the Chi tree of a top-level router
+// cannot serve to the fallback handlers.
+func (r *chiRouter) initFallbacks() {
+	r.mux.NotFound(r.adapt(func(ctx touta.Context) error {
+		return r.fallbackHandler(ctx.Request(), func(t *chiRouter) []fallback { return t.notFound })(ctx)
+	}))
+	r.mux.MethodNotAllowed(r.adapt(func(ctx touta.Context) error {
+		ctx.Response().Header().Set("Allow", strings.Join(r.allowedMethods(ctx.Request()), ", "))
+		return r.fallbackHandler(ctx.Request(), func(t *chiRouter) []fallback { return t.methodNotAllowed })(ctx)
+	}))
+}
+
+// NotFound sets the handler for requests matching no route. On a group it
+// applies to the requests below the group prefix. Its errors go to the
+// error handler; the default handler returns a 404 HTTPError.
+func (r *chiRouter) NotFound(handler touta.HandlerFunc) {
+	t := r.top()
+	t.notFound = setFallback(t.notFound, r.prefix, handler)
+}
+
+// MethodNotAllowed sets the handler for requests matching a route but
+// none of its methods. On a group it applies to the requests below the
+// group prefix. The router sets the Allow header before calling it; the
+// default handler returns a 405 HTTPError.
+func (r *chiRouter) MethodNotAllowed(handler touta.HandlerFunc) {
+	t := r.top()
+	t.methodNotAllowed = setFallback(t.methodNotAllowed, r.prefix, handler)
+}
+
+func setFallback(fallbacks []fallback, prefix string, handler touta.HandlerFunc) []fallback {
+	for i := range fallbacks {
+		if fallbacks[i].prefix == prefix {
+			fallbacks[i].handler = handler
+			return fallbacks
+		}
+	}
+	re, _, err := compilePattern(strings.TrimSuffix(prefix, "/"), '/', true)
+	if err != nil {
+		panic(fmt.Sprintf("router: invalid group prefix %s: %v", prefix, err))
+	}
+	return append(fallbacks, fallback{prefix: prefix, re: re, handler: handler})
+}
+
+// fallbackHandler returns the handler of the innermost group containing
+// the request path, looking at the host router's groups before the
+// top-level router's.
+func (r *chiRouter) fallbackHandler(req *http.Request, fallbacks func(*chiRouter) []fallback) touta.HandlerFunc {
+	path := routingPath(req)
+	for t := r; t != nil; t = t.parent {
+		var best *fallback
+		for i, f := range fallbacks(t) {
+			if f.re.MatchString(path) && (best == nil || len(f.prefix) > len(best.prefix)) {
+				best = &fallbacks(t)[i]
+			}
+		}
+		if best != nil {
+			return best.handler
+		}
+	}
+	return notFound
+}
+
+func notFound(ctx touta.Context) error {
+	return touta.NewHTTPError(http.StatusNotFound, "")
+}
+
+func methodNotAllowed(ctx touta.Context) error {
+	return touta.NewHTTPError(http.StatusMethodNotAllowed, "")
+}
+
+// allowedMethods returns the methods of the routes matching the request
+// path on r's Chi tree.
+func (r *chiRouter) allowedMethods(req *http.Request) []string {
+	path := routingPath(req)
+	var allowed []string
+	for _, method := range standardMethods {
+		if r.mux.Match(chi.NewRouteContext(), method, path) {
+			allowed = append(allowed, method)
+		}
+	}
+	return allowed
+}
+
+// routingPath returns the path Chi routes a request by.
+func routingPath(req *http.Request) string {
+	if req.URL.RawPath != "" {
+		return req.URL.RawPath
+	}
+	return req.URL.Path
+}
@@ -0,0 +1,227 @@
+package router
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/toutaio/toutago/internal/di"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// tracer records the middleware and handlers a request runs through.
+type tracer struct{ calls []string }
+
+func (tr *tracer) mw(name string) touta.MiddlewareFunc {
+	return func(next touta.HandlerFunc) touta.HandlerFunc {
+		return func(ctx touta.Context) error {
+			tr.calls = append(tr.calls, name)
+			return next(ctx)
+		}
+	}
+}
+
+func (tr *tracer) handler(name string) touta.HandlerFunc {
+	return func(ctx touta.Context) error {
+		tr.calls = append(tr.calls, name)
+		return ctx.String(200, name)
+	}
+}
+
+func (tr *tracer) serve(router touta.Router, host, path string) string {
+	tr.calls = nil
+	req := httptest.NewRequest("GET", path, nil)
+	if host != "" {
+		req.Host = host
+	}
+	w := httptest.NewRecorder()
+	router.Native().(*chi.Mux).ServeHTTP(w, req)
+	return strings.Join(tr.calls, ",")
+}
+
+func TestGroup_MiddlewareOrderIndependent(t *testing.T) {
+	tr := &tracer{}
+	router := NewChiRouter(di.NewContainer())
+
+	api := router.Group("/api")
+	api.GET("/users", tr.handler("users"))
+	router.GET("/", tr.handler("home"))
+
+	// Added after the routes, on both the router and the group
+	router.Use(tr.mw("router"))
+	api.Use(tr.mw("api"))
+
+	if got := tr.serve(router, "", "/api/users"); got != "router,api,users" {
+		t.Errorf("group route ran %s", got)
+	}
+	if got := tr.serve(router, "", "/"); got != "router,home" {
+		t.Errorf("top-level route ran %s", got)
+	}
+}
+
+func TestGroup_CallbacksAndNesting(t *testing.T) {
+	tr := &tracer{}
+	router := NewChiRouter(di.NewContainer())
+
+	router.Group("/api", func(api touta.Router) {
+		api.Use(tr.mw("api"))
+		api.Route("/v1", func(v1 touta.Router) {
+			v1.Use(tr.mw("v1"))
+			v1.GET("/users/{id}", func(ctx touta.Context) error {
+				tr.calls = append(tr.calls, "user "+ctx.Param("id"))
+				return nil
+			}).Name("v1.user")
+		})
+		api.GET("/health", tr.handler("health"))
+	})
+
+	if got := tr.serve(router, "", "/api/v1/users/7"); got != "api,v1,user 7" {
+		t.Errorf("nested route ran %s", got)
+	}
+	if got := tr.serve(router, "", "/api/health"); got != "api,health" {
+		t.Errorf("nested middleware leaked: %s", got)
+	}
+	if url, _ := router.URL("v1.user", "id", 7); url != "/api/v1/users/7" {
+		t.Errorf("unexpected URL %s", url)
+	}
+}
+
+func TestGroup_RepeatedPrefix(t *testing.T) {
+	tr := &tracer{}
+	router := NewChiRouter(di.NewContainer())
+
+	users := router.Group("/api")
+	users.Use(tr.mw("users"))
+	users.GET("/users", tr.handler("list users"))
+
+	posts := router.Group("/api")
+	posts.Use(tr.mw("posts"))
+	posts.GET("/posts", tr.handler("list posts"))
+
+	if got := tr.serve(router, "", "/api/users"); got != "users,list users" {
+		t.Errorf("first group ran %s", got)
+	}
+	if got := tr.serve(router, "", "/api/posts"); got != "posts,list posts" {
+		t.Errorf("second group ran %s", got)
+	}
+}
+
+func TestGroup_RootRoute(t *testing.T) {
+	tr := &tracer{}
+	router := NewChiRouter(di.NewContainer())
+
+	api := router.Group("/api")
+	api.Use(tr.mw("api"))
+	api.GET("/", tr.handler("api index"))
+
+	router.GET("/admin", tr.handler("admin"))
+	router.Group("/admin").GET("/", tr.handler("admin index"))
+
+	for _, path := range []string{"/api", "/api/"} {
+		if got := tr.serve(router, "", path); got != "api,api index" {
+			t.Errorf("GET %s ran %s", path, got)
+		}
+	}
+	if got := tr.serve(router, "", "/admin"); got != "admin" {
+		t.Errorf("a route for the bare prefix should be kept, ran %s", got)
+	}
+	if got := tr.serve(router, "", "/admin/"); got != "admin index" {
+		t.Errorf("GET /admin/ ran %s", got)
+	}
+
+	routes, _ := Routes(router)
+	if len(routes) != 3 {
+		t.Errorf("the bare prefix should not be listed as a route of its own, got %+v", routes)
+	}
+}
+
+func TestGroup_Host(t *testing.T) {
+	tr := &tracer{}
+	router := NewChiRouter(di.NewContainer())
+	router.Use(tr.mw("router"))
+	router.GET("/", tr.handler("main"))
+
+	router.Host("{tenant}.example.com", func(tenant touta.Router) {
+		tenant.Use(tr.mw("tenant"))
+		tenant.GET("/", func(ctx touta.Context) error {
+			tr.calls = append(tr.calls, "tenant "+ctx.Param("tenant"))
+			return nil
+		})
+	})
+	router.Host("api.example.com").Group("/v1").GET("/status", tr.handler("status"))
+	router.Host("api.example.com").GET("/", tr.handler("api"))
+
+	tests := []struct{ host, path, want string }{
+		{"example.com", "/", "router,main"},
+		{"acme.example.com:8080", "/", "router,tenant,tenant acme"},
+		{"API.example.com", "/", "router,api"},
+		{"api.example.com", "/v1/status", "router,status"},
+		{"acme.example.com", "/v1/status", "router"}, // 404 in the tenant host
+	}
+	for _, tt := range tests {
+		if got := tr.serve(router, tt.host, tt.path); got != tt.want {
+			t.Errorf("%s%s ran %s, want %s", tt.host, tt.path, got, tt.want)
+		}
+	}
+
+	routes, err := Routes(router)
+	if err != nil {
+		t.Fatalf("Routes failed: %v", err)
+	}
+	var listed []string
+	for _, route := range routes {
+		listed = append(listed, route.String())
+	}
+	want := "GET /,GET api.example.com/,GET api.example.com/v1/status,GET {tenant}.example.com/"
+	if strings.Join(listed, ",") != want {
+		t.Errorf("Routes() = %v, want %s", listed, want)
+	}
+}
+
+func TestGroup_NotFound(t *testing.T) {
+	router := NewChiRouter(di.NewContainer())
+	router.GET("/", noop)
+
+	api := router.Group("/api")
+	api.GET("/users", noop)
+	api.NotFound(func(ctx touta.Context) error {
+		return ctx.String(404, "api not found")
+	})
+
+	w := serve(router, "GET", "/api/missing")
+	if w.Code != 404 || w.Body.String() != "api not found" {
+		t.Errorf("group 404 handler not used: %d %q", w.Code, w.Body.String())
+	}
+	w = serve(router, "GET", "/apis")
+	if w.Code != 404 || !strings.Contains(w.Body.String(), "not_found") {
+		t.Errorf("group 404 handler used outside the group: %d %q", w.Code, w.Body.String())
+	}
+
+	router.NotFound(func(ctx touta.Context) error {
+		return ctx.String(404, "custom")
+	})
+	if w := serve(router, "GET", "/missing"); w.Body.String() != "custom" {
+		t.Errorf("custom 404 handler not used: %q", w.Body.String())
+	}
+	if w := serve(router, "GET", "/api/missing"); w.Body.String() != "api not found" {
+		t.Errorf("group 404 handler replaced: %q", w.Body.String())
+	}
+}
+
+func TestGroup_PatternWithoutSlashPanics(t *testing.T) {
+	for name, register := range map[string]func(r touta.Router){
+		"route": func(r touta.Router) { r.Group("/api").GET("users", noop) },
+		"group": func(r touta.Router) { r.Group("/api").Group("v1") },
+	} {
+		func() {
+			defer func() {
+				if v := recover(); v == nil || !strings.Contains(fmt.Sprint(v), "must begin with '/'") {
+					t.Errorf("%s: expected a panic for a pattern without a leading slash, got %v", name, v)
+				}
+			}()
+			register(NewChiRouter(di.NewContainer()))
+		}()
+	}
+}
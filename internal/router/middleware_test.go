@@ -0,0 +1,127 @@
+package router
+
+import (
+	"errors"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/toutaio/toutago/internal/di"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+func TestMiddleware_SharesContext(t *testing.T) {
+	router := NewChiRouter(di.NewContainer())
+
+	var contexts []touta.Context
+	record := func(next touta.HandlerFunc) touta.HandlerFunc {
+		return func(ctx touta.Context) error {
+			contexts = append(contexts, ctx)
+			return next(ctx)
+		}
+	}
+	router.Use(record, func(next touta.HandlerFunc) touta.HandlerFunc {
+		return func(ctx touta.Context) error {
+			ctx.Set("user", "ada")
+			return next(ctx)
+		}
+	})
+
+	api := router.Group("/api")
+	api.Use(record)
+	api.GET("/me", func(ctx touta.Context) error {
+		contexts = append(contexts, ctx)
+		user, _ := ctx.Get("user").(string)
+		fromRequest, _ := ctx.Request().Context().Value("user").(string)
+		return ctx.String(200, user+","+fromRequest)
+	})
+
+	w := httptest.NewRecorder()
+	router.Native().(*chi.Mux).ServeHTTP(w, httptest.NewRequest("GET", "/api/me", nil))
+
+	if w.Body.String() != "ada,ada" {
+		t.Errorf("Values set in middleware should reach the handler, got %q", w.Body.String())
+	}
+	if len(contexts) != 3 || contexts[0] != contexts[1] || contexts[1] != contexts[2] {
+		t.Errorf("Middleware and handler should share one Context, got %d distinct calls", len(contexts))
+	}
+}
+
+func TestMiddleware_ReceivesDownstreamErrors(t *testing.T) {
+	router := NewChiRouter(di.NewContainer())
+
+	errNotFound := errors.New("record not found")
+	var seen error
+	router.Use(func(next touta.HandlerFunc) touta.HandlerFunc {
+		return func(ctx touta.Context) error {
+			err := next(ctx)
+			seen = err
+			if errors.Is(err, errNotFound) {
+				return touta.NewHTTPError(404, "").Wrap(err)
+			}
+			return err
+		}
+	})
+	router.GET("/missing", func(ctx touta.Context) error {
+		return errNotFound
+	})
+	router.GET("/ok", func(ctx touta.Context) error {
+		return ctx.String(200, "OK")
+	})
+
+	w := httptest.NewRecorder()
+	router.Native().(*chi.Mux).ServeHTTP(w, httptest.NewRequest("GET", "/missing", nil))
+	if !errors.Is(seen, errNotFound) || w.Code != 404 {
+		t.Errorf("Middleware should transform the handler error, got %v and %d", seen, w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	router.Native().(*chi.Mux).ServeHTTP(w, httptest.NewRequest("GET", "/ok", nil))
+	if seen != nil || w.Code != 200 {
+		t.Errorf("Successful handlers should return nil to middleware, got %v", seen)
+	}
+}
+
+func TestMiddleware_CanRecoverErrors(t *testing.T) {
+	router := NewChiRouter(di.NewContainer())
+	router.Use(func(next touta.HandlerFunc) touta.HandlerFunc {
+		return func(ctx touta.Context) error {
+			if err := next(ctx); err != nil {
+				return ctx.String(200, "fallback")
+			}
+			return nil
+		}
+	}, func(next touta.HandlerFunc) touta.HandlerFunc {
+		return func(ctx touta.Context) error {
+			return next(ctx) // errors pass through inner middleware untouched
+		}
+	})
+	router.GET("/", func(ctx touta.Context) error {
+		return errors.New("boom")
+	})
+
+	w := httptest.NewRecorder()
+	router.Native().(*chi.Mux).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != 200 || w.Body.String() != "fallback" {
+		t.Errorf("Outer middleware should handle the error, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestMiddleware_ErrorWithoutCallingNext(t *testing.T) {
+	router := NewChiRouter(di.NewContainer())
+	router.Use(func(next touta.HandlerFunc) touta.HandlerFunc {
+		return func(ctx touta.Context) error {
+			return touta.NewHTTPError(401, "login required")
+		}
+	})
+	router.GET("/", func(ctx touta.Context) error {
+		t.Error("Handler should not run")
+		return nil
+	})
+
+	w := httptest.NewRecorder()
+	router.Native().(*chi.Mux).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+	if w.Code != 401 {
+		t.Errorf("Expected 401, got %d", w.Code)
+	}
+}
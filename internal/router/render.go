@@ -0,0 +1,162 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Encoding configures how a Context encodes JSON and XML responses.
+type Encoding struct {
+	Indent     string // indentation per level, empty for compact output
+	EscapeHTML bool   // escape <, > and & inside JSON strings
+}
+
+// DefaultEncoding returns the encoding for a framework mode: indented
+// output in development and compact output otherwise, with HTML escaping.
+func DefaultEncoding(mode string) Encoding {
+	enc := Encoding{EscapeHTML: true}
+	if mode == "development" {
+		enc.Indent = "  "
+	}
+	return enc
+}
+
+// Option configures a router created by NewChiRouter.
+type Option func(*chiRouter)
+
+// WithEncoding sets the encoding used by the router's contexts.
+func WithEncoding(enc Encoding) Option {
+	return func(r *chiRouter) {
+		r.encoding = enc
+	}
+}
+
+// Media types offered by Negotiate, in order of preference.
+var negotiableTypes = []string{
+	"application/json",
+	"application/xml",
+	"text/xml",
+	"application/yaml",
+	"application/x-yaml",
+	"text/yaml",
+	"text/plain",
+}
+
+// JSON sends a JSON response. Data is encoded before anything is written,
+// so an encoding error leaves the response untouched.
+func (c *defaultContext) JSON(status int, data interface{}) error {
+	out, err := jsonEncode(data, c.encoding)
+	if err != nil {
+		return err
+	}
+	return c.Blob(status, "application/json", out)
+}
+
+func jsonEncode(data interface{}, encoding Encoding) ([]byte, error) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(encoding.EscapeHTML)
+	enc.SetIndent("", encoding.Indent)
+	if err := enc.Encode(data); err != nil {
+		return nil, fmt.Errorf("failed to encode JSON response: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// XML sends an XML response with an XML declaration.
+func (c *defaultContext) XML(status int, data interface{}) error {
+	out, err := c.encodeXML(data)
+	if err != nil {
+		return err
+	}
+	return c.Blob(status, "application/xml; charset=utf-8", out)
+}
+
+// YAML sends a YAML response.
+func (c *defaultContext) YAML(status int, data interface{}) error {
+	out, err := encodeYAML(data)
+	if err != nil {
+		return err
+	}
+	return c.Blob(status, "application/yaml", out)
+}
+
+func (c *defaultContext) encodeXML(data interface{}) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString(xml.Header)
+	enc := xml.NewEncoder(&buf)
+	enc.Indent("", c.encoding.Indent)
+	if err := enc.Encode(data); err != nil {
+		return nil, fmt.Errorf("failed to encode XML response: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+func encodeYAML(data interface{}) (out []byte, err error) {
+	// yaml.v3 panics on some unsupported values instead of returning an error
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("failed to encode YAML response: %v", r)
+		}
+	}()
+
+	out, err = yaml.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode YAML response: %w", err)
+	}
+	return out, nil
+}
+
+// Blob sends raw bytes with the given content type.
+func (c *defaultContext) Blob(status int, contentType string, data []byte) error {
+	c.res.Header().Set("Content-Type", contentType)
+	c.res.WriteHeader(status)
+	_, err := c.res.Write(data)
+	return err
+}
+
+// Stream copies r to the response with the given content type. Headers are
+// sent before the copy starts, so a read error can only end the response
+// early; it is returned for the router to log.
+func (c *defaultContext) Stream(status int, contentType string, r io.Reader) error {
+	c.res.Header().Set("Content-Type", contentType)
+	c.res.WriteHeader(status)
+	if _, err := io.Copy(c.res, r); err != nil {
+		return fmt.Errorf("failed to stream response: %w", err)
+	}
+	return nil
+}
+
+// Negotiate renders data as JSON, XML, YAML or plain text, whichever the
+// request's Accept header prefers. JSON is used when there is no Accept
+// header; 406 Not Acceptable is sent when no format matches.
+func (c *defaultContext) Negotiate(status int, data interface{}) error {
+	c.res.Header().Add("Vary", "Accept")
+
+	// The chosen media type is echoed back, so text/xml is answered as such
+	switch mediaType := negotiate(c.req.Header.Get("Accept"), negotiableTypes); mediaType {
+	case "application/json":
+		return c.JSON(status, data)
+	case "application/xml", "text/xml":
+		out, err := c.encodeXML(data)
+		if err != nil {
+			return err
+		}
+		return c.Blob(status, mediaType+"; charset=utf-8", out)
+	case "application/yaml", "application/x-yaml", "text/yaml":
+		out, err := encodeYAML(data)
+		if err != nil {
+			return err
+		}
+		return c.Blob(status, mediaType, out)
+	case "text/plain":
+		return c.String(status, fmt.Sprint(data))
+	}
+	return c.String(http.StatusNotAcceptable, http.StatusText(http.StatusNotAcceptable))
+}
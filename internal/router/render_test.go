@@ -0,0 +1,133 @@
+package router
+
+import (
+	"errors"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/toutaio/toutago/internal/di"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+type user struct {
+	ID   int    `json:"id" xml:"id" yaml:"id"`
+	Name string `json:"name" xml:"name" yaml:"name"`
+}
+
+func TestContext_JSONEncoding(t *testing.T) {
+	req := httptest.NewRequest("GET", "/", nil)
+	w := httptest.NewRecorder()
+
+	ctx := NewContext(w, req, di.NewContainer())
+	if err := ctx.JSON(200, map[string]string{"html": "<b>"}); err != nil {
+		t.Fatalf("JSON failed: %v", err)
+	}
+	if got := w.Body.String(); got != "{\"html\":\"\\u003cb\\u003e\"}\n" {
+		t.Errorf("Unexpected JSON body %q", got)
+	}
+}
+
+func TestContext_JSONDevelopmentEncoding(t *testing.T) {
+	router := NewChiRouter(di.NewContainer(), WithEncoding(Encoding{Indent: "  "}))
+	router.GET("/", func(ctx touta.Context) error {
+		return ctx.JSON(200, map[string]string{"html": "<b>"})
+	})
+
+	w := httptest.NewRecorder()
+	router.Native().(*chi.Mux).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if got := w.Body.String(); got != "{\n  \"html\": \"<b>\"\n}\n" {
+		t.Errorf("Unexpected JSON body %q", got)
+	}
+}
+
+func TestContext_JSONEncodingError(t *testing.T) {
+	router := NewChiRouter(di.NewContainer())
+	router.GET("/", func(ctx touta.Context) error {
+		return ctx.JSON(200, map[string]interface{}{"fn": func() {}})
+	})
+
+	w := httptest.NewRecorder()
+	router.Native().(*chi.Mux).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != 500 {
+		t.Errorf("Encoding errors should produce a 500 before anything is written, got %d", w.Code)
+	}
+}
+
+func TestContext_XMLAndYAML(t *testing.T) {
+	w := httptest.NewRecorder()
+	ctx := NewContext(w, httptest.NewRequest("GET", "/", nil), di.NewContainer())
+	ctx.XML(200, user{ID: 1, Name: "Ada"})
+
+	if !strings.Contains(w.Body.String(), "<user><id>1</id><name>Ada</name></user>") {
+		t.Errorf("Unexpected XML body %q", w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	ctx = NewContext(w, httptest.NewRequest("GET", "/", nil), di.NewContainer())
+	ctx.YAML(200, user{ID: 1, Name: "Ada"})
+
+	if w.Body.String() != "id: 1\nname: Ada\n" || w.Header().Get("Content-Type") != "application/yaml" {
+		t.Errorf("Unexpected YAML response %q", w.Body.String())
+	}
+}
+
+func TestContext_Negotiate(t *testing.T) {
+	tests := []struct {
+		accept      string
+		status      int
+		contentType string
+	}{
+		{"", 200, "application/json"},
+		{"*/*", 200, "application/json"},
+		{"application/xml", 200, "application/xml; charset=utf-8"},
+		{"text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", 200, "application/xml; charset=utf-8"},
+		{"application/json;q=0.5, application/yaml", 200, "application/yaml"},
+		{"text/*", 200, "text/xml; charset=utf-8"},
+		{"image/png", 406, "text/plain"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/", nil)
+		req.Header.Set("Accept", tt.accept)
+		w := httptest.NewRecorder()
+
+		ctx := NewContext(w, req, di.NewContainer())
+		if err := ctx.Negotiate(200, user{ID: 1, Name: "Ada"}); err != nil {
+			t.Fatalf("Negotiate(%q) failed: %v", tt.accept, err)
+		}
+		if w.Code != tt.status || w.Header().Get("Content-Type") != tt.contentType {
+			t.Errorf("Negotiate(%q) = %d %s, want %d %s", tt.accept, w.Code, w.Header().Get("Content-Type"), tt.status, tt.contentType)
+		}
+	}
+}
+
+func TestContext_StreamErrorAfterHeaders(t *testing.T) {
+	router := NewChiRouter(di.NewContainer())
+	router.GET("/", func(ctx touta.Context) error {
+		return ctx.Stream(200, "text/csv", &failingReader{data: "a,b\n"})
+	})
+
+	w := httptest.NewRecorder()
+	router.Native().(*chi.Mux).ServeHTTP(w, httptest.NewRequest("GET", "/", nil))
+
+	if w.Code != 200 || w.Body.String() != "a,b\n" {
+		t.Errorf("A failed stream must not be followed by an error response, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+type failingReader struct {
+	data string
+	done bool
+}
+
+func (r *failingReader) Read(p []byte) (int, error) {
+	if r.done {
+		return 0, errors.New("disk error")
+	}
+	r.done = true
+	return copy(p, r.data), nil
+}
@@ -0,0 +1,94 @@
+package router
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"net/http"
+)
+
+// responseWriter records whether the response has been started, so the
+// router knows when it is too late to replace it with an error response.
+type responseWriter struct {
+	http.ResponseWriter
+	status  int
+	size    int64
+	written bool
+}
+
+// newResponseWriter wraps w unless it is already wrapped.
+func newResponseWriter(w http.ResponseWriter) *responseWriter {
+	if rw, ok := w.(*responseWriter); ok {
+		return rw
+	}
+	return &responseWriter{ResponseWriter: w}
+}
+
+// WriteHeader sends the status code once.
+func (w *responseWriter) WriteHeader(status int) {
+	if w.written {
+		return
+	}
+	w.status = status
+	w.written = true
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// Write sends the body, writing a 200 status first if none was set.
+func (w *responseWriter) Write(b []byte) (int, error) {
+	if !w.written {
+		w.WriteHeader(http.StatusOK)
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.size += int64(n)
+	return n, err
+}
+
+// Status returns the status code sent, or 0 if the response has not started.
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+// Written reports whether the status line and headers have been sent.
+func (w *responseWriter) Written() bool {
+	return w.written
+}
+
+// Size returns the number of body bytes written.
+func (w *responseWriter) Size() int64 {
+	return w.size
+}
+
+// Flush implements http.Flusher when the underlying writer does.
+func (w *responseWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if !w.written {
+			w.WriteHeader(http.StatusOK)
+		}
+		f.Flush()
+	}
+}
+
+// Hijack implements http.Hijacker when the underlying writer does.
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("response writer %T does not support hijacking", w.ResponseWriter)
+	}
+	w.written = true
+	return h.Hijack()
+}
+
+// Unwrap returns the underlying writer, for http.ResponseController.
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// responseStarted reports whether headers have been sent on w. Writers not
+// wrapped by the router are assumed to be unstarted.
+func responseStarted(w http.ResponseWriter) bool {
+	if rw, ok := w.(*responseWriter); ok {
+		return rw.Written()
+	}
+	return false
+}
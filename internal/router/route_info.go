@@ -0,0 +1,431 @@
+package router
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"reflect"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// RouteInfo describes a route of a router.
+type RouteInfo struct {
+	Host       string   `json:"host,omitempty"`
+	Method     string   `json:"method"`
+	Pattern    string   `json:"pattern"`
+	Name       string   `json:"name,omitempty"`
+	Handler    string   `json:"handler"`
+	Middleware []string `json:"middleware,omitempty"`
+
+	// Conflict explains why the route is not served as registered, e.g.
+	// because another route shadows or replaced it. It is empty for
+	// routes that are served as expected.
+	Conflict string `json:"conflict,omitempty"`
+}
+
+func (i RouteInfo) String() string {
+	return i.Method + " " + i.Host + i.Pattern
+}
+
+// walkedRoute is a route found by walking the Chi routing tree.
+type walkedRoute struct {
+	info    RouteInfo
+	handler http.Handler
+	tree    chi.Routes
+}
+
+// Routes lists the routes of r, its groups and its host routers, sorted
+// by pattern and method. Routes registered through the touta.Router
+// interface report their name and the names of their handler and
+// middleware; routes added to the native Chi router directly report what
+// Chi knows about them.
+//
+// Routes that are registered but never matched are flagged with a
+// Conflict: those replaced by a later registration of the same pattern and
+// those shadowed by a more specific route of a router mounting another.
+func Routes(r touta.Router) ([]RouteInfo, error) {
+	if cr, ok := r.(*chiRouter); ok {
+		return routes(cr, nil), nil
+	}
+	tree, ok := r.Native().(chi.Routes)
+	if !ok {
+		return nil, fmt.Errorf("cannot list routes of %T: not a Chi router", r.Native())
+	}
+	return routes(nil, tree), nil
+}
+
+// routes lists the routes of cr or, when cr is nil, of the native tree.
+func routes(cr *chiRouter, tree chi.Routes) []RouteInfo {
+	var walked []*walkedRoute
+	served := make(map[servedRoute]bool)
+	walk := func(tree chi.Routes, top *chiRouter) {
+		chi.Walk(tree, func(method, pattern string, handler http.Handler, mws ...func(http.Handler) http.Handler) error {
+			w := &walkedRoute{handler: handler, tree: tree}
+			w.info.Method = method
+			w.info.Pattern = pattern
+			if top != nil {
+				w.info.Host = top.hostName()
+			}
+
+			if h, ok := handler.(*routeHandler); ok {
+				if h.alias || (cr != nil && !h.entry.router.within(cr)) {
+					return nil
+				}
+				w.info.Name = h.entry.name
+				w.info.Handler = h.entry.handler
+				w.info.Middleware = h.entry.middlewareChain()
+				served[servedRoute{h.entry, method}] = true
+			} else {
+				if cr != nil && top != cr {
+					return nil
+				}
+				w.info.Handler = handlerName(handler)
+				w.info.Middleware = nativeMiddleware(top, mws)
+			}
+			walked = append(walked, w)
+			return nil
+		})
+	}
+
+	if cr == nil {
+		walk(tree, nil)
+	} else {
+		top := cr.top()
+		walk(top.mux, top)
+		if top.parent == nil {
+			for _, h := range top.hosts {
+				walk(h.mux, h)
+			}
+		}
+	}
+
+	for _, w := range walked {
+		w.info.Conflict = shadowedBy(w, walked)
+	}
+	var routes []RouteInfo
+	if cr != nil {
+		routes = replaced(cr, served, walked)
+	}
+	for _, w := range walked {
+		routes = append(routes, w.info)
+	}
+
+	sort.SliceStable(routes, func(i, j int) bool {
+		if routes[i].Host != routes[j].Host {
+			return routes[i].Host < routes[j].Host
+		}
+		if routes[i].Pattern != routes[j].Pattern {
+			return routes[i].Pattern < routes[j].Pattern
+		}
+		return methodOrder(routes[i].Method) < methodOrder(routes[j].Method)
+	})
+	return routes
+}
+
+// WriteRoutes writes the routes of r as JSON to the file at path.
+func WriteRoutes(r touta.Router, path string) error {
+	routes, err := Routes(r)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(routes, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode routes: %w", err)
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write routes: %w", err)
+	}
+	return nil
+}
+
+// routePattern removes the mount wildcards from a pattern Chi matched,
+// as chi.Walk does.
+func routePattern(raw string) string {
+	return strings.ReplaceAll(raw, "/*/", "/")
+}
+
+// shadowedBy reports the route that matches requests meant for w, when it
+// is not w itself. Chi prefers a route of the enclosing router over a
+// mount, so a group route can be unreachable.
+func shadowedBy(w *walkedRoute, walked []*walkedRoute) string {
+	samples := samplePaths(w.info.Pattern)
+	if len(samples) == 0 {
+		return "" // no value satisfies the patterns of the route
+	}
+
+	var winner http.Handler
+	var pattern string
+	for _, path := range samples {
+		rctx := chi.NewRouteContext()
+		if !w.tree.Match(rctx, w.info.Method, path) {
+			return ""
+		}
+		winner = matchedHandler(w.tree, rctx.RoutePatterns, w.info.Method)
+		if sameHandler(winner, w.handler) {
+			return ""
+		}
+		pattern = routePattern(strings.Join(rctx.RoutePatterns, ""))
+	}
+
+	for _, other := range walked {
+		if other.tree == w.tree && other.info.Pattern == pattern && other.info.Method == w.info.Method &&
+			sameHandler(other.handler, winner) {
+			return fmt.Sprintf("shadowed by %s (%s)", other.info, other.info.Handler)
+		}
+	}
+	return fmt.Sprintf("shadowed by %s", pattern)
+}
+
+// matchedHandler returns the handler Chi serves for method after matching
+// patterns, the route patterns of the tree and the routers it mounts.
+func matchedHandler(tree chi.Routes, patterns []string, method string) http.Handler {
+	for i, pattern := range patterns {
+		var next chi.Routes
+		for _, route := range tree.Routes() {
+			if route.Pattern != pattern {
+				continue
+			}
+			if route.SubRoutes != nil && i < len(patterns)-1 {
+				next = route.SubRoutes
+				break
+			}
+			handler := route.Handlers[method]
+			if handler == nil {
+				handler = route.Handlers["*"]
+			}
+			if chain, ok := handler.(*chi.ChainHandler); ok {
+				return chain.Endpoint
+			}
+			return handler
+		}
+		if next == nil {
+			return nil
+		}
+		tree = next
+	}
+	return nil
+}
+
+// sameHandler reports whether a and b are the same handler. Handlers of
+// function types are compared by their code pointer, as functions are not
+// comparable.
+func sameHandler(a, b http.Handler) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	va, vb := reflect.ValueOf(a), reflect.ValueOf(b)
+	if va.Type() != vb.Type() {
+		return false
+	}
+	if va.Kind() == reflect.Func {
+		return va.Pointer() == vb.Pointer()
+	}
+	if !va.Comparable() {
+		return false
+	}
+	return a == b
+}
+
+// sampleValues are tried for parameters with a regular expression.
+var sampleValues = []string{"0", "1", "a", "x", "A", "0a", "a-0", "a_0"}
+
+// samplePaths builds request paths matching pattern. Plain parameters
+// get values no static route would use; parameters with a regular
+// expression get each sample value the expression accepts.
+func samplePaths(pattern string) []string {
+	paths := []string{""}
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '{':
+			end := closingBrace(pattern, i)
+			if end < 0 {
+				return nil
+			}
+			param, expr, hasExpr := strings.Cut(pattern[i+1:end], ":")
+			values := []string{"~" + param}
+			if hasExpr {
+				re, err := regexp.Compile("^(?:" + expr + ")$")
+				if err != nil {
+					return nil
+				}
+				values = nil
+				for _, v := range sampleValues {
+					if re.MatchString(v) {
+						values = append(values, v)
+					}
+				}
+			}
+			var next []string
+			for _, p := range paths {
+				for _, v := range values {
+					next = append(next, p+v)
+				}
+			}
+			paths = next
+			i = end
+
+		case '*':
+			for j := range paths {
+				paths[j] += "~"
+			}
+
+		default:
+			for j := range paths {
+				paths[j] += pattern[i : i+1]
+			}
+		}
+	}
+	return paths
+}
+
+// servedRoute is a method of a route entry that Chi serves.
+type servedRoute struct {
+	entry  *routeEntry
+	method string
+}
+
+// replaced lists the routes of the table that Chi no longer serves
+// because a later registration of the same pattern replaced them. Both
+// the replaced route and the one that replaced it are flagged.
+func replaced(r *chiRouter, served map[servedRoute]bool, walked []*walkedRoute) []RouteInfo {
+	var routes []RouteInfo
+	for _, e := range r.routes.list() {
+		if !e.router.within(r) {
+			continue
+		}
+		methods := e.methods
+		if methods == nil {
+			methods = standardMethods
+		}
+
+		for _, method := range methods {
+			if served[servedRoute{e, method}] {
+				continue
+			}
+			info := RouteInfo{
+				Host:       e.router.hostName(),
+				Method:     method,
+				Pattern:    e.pattern,
+				Name:       e.name,
+				Handler:    e.handler,
+				Middleware: e.middlewareChain(),
+				Conflict:   "never matched",
+			}
+			for _, w := range walked {
+				if w.info.Method == method && w.info.Host == info.Host && samePattern(w.info.Pattern, e.pattern) {
+					info.Conflict = fmt.Sprintf("replaced by a later registration (%s)", w.info.Handler)
+					if w.info.Conflict == "" {
+						w.info.Conflict = fmt.Sprintf("replaces an earlier registration (%s)", e.handler)
+					}
+				}
+			}
+			routes = append(routes, info)
+		}
+	}
+	return routes
+}
+
+// nativeMiddleware names the middleware of a route added to the Chi tree
+// of top directly. The dispatch middleware stands for the router's own.
+func nativeMiddleware(top *chiRouter, mws []func(http.Handler) http.Handler) []string {
+	var names []string
+	for _, mw := range mws {
+		if top != nil && reflect.ValueOf(mw).Pointer() == reflect.ValueOf(top.root().dispatch).Pointer() {
+			names = append(names, middlewareNames(top.root().middleware)...)
+			continue
+		}
+		names = append(names, middlewareName(mw))
+	}
+	return names
+}
+
+// samePattern reports whether two patterns match the same paths, which is
+// the case when they only differ in parameter names.
+func samePattern(a, b string) bool {
+	return paramNames.ReplaceAllString(a, "{$1") == paramNames.ReplaceAllString(b, "{$1")
+}
+
+var paramNames = regexp.MustCompile(`\{[^{}:]*(:|\})`)
+
+// standardMethods are the methods routes are registered for by Any, in
+// the order routes are listed.
+var standardMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace,
+}
+
+// methodOrder sorts methods in the order they are usually listed.
+func methodOrder(method string) int {
+	for i, m := range standardMethods {
+		if m == method {
+			return i
+		}
+	}
+	return len(method) + 100
+}
+
+// funcName returns the name of a function value without its package path,
+// e.g. "handlers.(*Users).Show".
+func funcName(f interface{}) string {
+	fn := runtime.FuncForPC(reflect.ValueOf(f).Pointer())
+	if fn == nil {
+		return fmt.Sprintf("%T", f)
+	}
+	name := fn.Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return strings.TrimSuffix(name, "-fm")
+}
+
+// middlewareName names a middleware after the function that created it,
+// so middleware.Logger(l) reads "middleware.Logger" rather than the name
+// of the closure it returned.
+func middlewareName(f interface{}) string {
+	name := funcName(f)
+	for {
+		base, last, ok := cutLast(name, ".")
+		if !ok || !isClosureSuffix(last) {
+			return name
+		}
+		name = base
+	}
+}
+
+// handlerName names a plain net/http handler.
+func handlerName(h http.Handler) string {
+	if fn, ok := h.(http.HandlerFunc); ok {
+		return funcName(fn)
+	}
+	return fmt.Sprintf("%T", h)
+}
+
+func cutLast(s, sep string) (string, string, bool) {
+	i := strings.LastIndex(s, sep)
+	if i < 0 {
+		return s, "", false
+	}
+	return s[:i], s[i+len(sep):], true
+}
+
+// isClosureSuffix reports whether a name segment is one the compiler gives
+// closures, such as "func1" or "2".
+func isClosureSuffix(s string) bool {
+	s = strings.TrimPrefix(s, "func")
+	if s == "" {
+		return false
+	}
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,150 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/toutaio/toutago/internal/di"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+func listUsers(ctx touta.Context) error { return nil }
+func showUser(ctx touta.Context) error  { return nil }
+
+func auth(next touta.HandlerFunc) touta.HandlerFunc { return next }
+
+func logging() touta.MiddlewareFunc {
+	return func(next touta.HandlerFunc) touta.HandlerFunc {
+		return func(ctx touta.Context) error { return next(ctx) }
+	}
+}
+
+func TestRoutes(t *testing.T) {
+	router := NewChiRouter(di.NewContainer())
+	router.Use(logging())
+	router.GET("/", noop).Name("home")
+
+	api := router.Group("/api")
+	api.Use(auth)
+	api.GET("/users", listUsers).Name("users.index")
+	api.POST("/users", noop, logging())
+	api.GET("/users/{id}", showUser).Name("users.show")
+
+	routes, err := Routes(router)
+	if err != nil {
+		t.Fatalf("Routes failed: %v", err)
+	}
+
+	want := []RouteInfo{
+		{Method: "GET", Pattern: "/", Name: "home", Handler: "router.noop", Middleware: []string{"router.logging"}},
+		{Method: "GET", Pattern: "/api/users", Name: "users.index", Handler: "router.listUsers", Middleware: []string{"router.logging", "router.auth"}},
+		{Method: "POST", Pattern: "/api/users", Handler: "router.noop", Middleware: []string{"router.logging", "router.auth", "router.logging"}},
+		{Method: "GET", Pattern: "/api/users/{id}", Name: "users.show", Handler: "router.showUser", Middleware: []string{"router.logging", "router.auth"}},
+	}
+	if !reflect.DeepEqual(routes, want) {
+		t.Errorf("Routes() =\n%+v\nwant\n%+v", routes, want)
+	}
+}
+
+func TestRoutes_Conflicts(t *testing.T) {
+	router := NewChiRouter(di.NewContainer())
+	router.GET("/users/{id}", noop)
+	router.GET("/users/{uid}", showUser)
+	router.GET("/api/users", listUsers)
+	router.Group("/api").GET("/users", noop)
+	router.GET("/posts/{id:[0-9]+}", noop)
+	router.GET("/posts/latest", noop)
+
+	legacy := chi.NewRouter()
+	legacy.Get("/status", func(w http.ResponseWriter, r *http.Request) {})
+	router.GET("/legacy/status", showUser)
+	router.Native().(*chi.Mux).Mount("/legacy", legacy)
+
+	routes, err := Routes(router)
+	if err != nil {
+		t.Fatalf("Routes failed: %v", err)
+	}
+
+	conflicts := make(map[string]string)
+	for _, route := range routes {
+		if route.Conflict != "" {
+			conflicts[route.Handler+" "+route.String()] = route.Conflict
+		}
+	}
+	want := map[string]string{
+		"router.noop GET /users/{id}":                          "replaced by a later registration (router.showUser)",
+		"router.showUser GET /users/{uid}":                     "replaces an earlier registration (router.noop)",
+		"router.listUsers GET /api/users":                      "replaced by a later registration (router.noop)",
+		"router.noop GET /api/users":                           "replaces an earlier registration (router.listUsers)",
+		"router.TestRoutes_Conflicts.func1 GET /legacy/status": "shadowed by GET /legacy/status (router.showUser)",
+	}
+	if !reflect.DeepEqual(conflicts, want) {
+		t.Errorf("conflicts = %v, want %v", conflicts, want)
+	}
+}
+
+func TestRoutes_NativeRoutes(t *testing.T) {
+	router := NewChiRouter(di.NewContainer())
+	mux := router.Native().(*chi.Mux)
+	mux.With(func(next http.Handler) http.Handler { return next }).
+		Get("/health", func(w http.ResponseWriter, r *http.Request) {})
+
+	routes, err := Routes(router)
+	if err != nil {
+		t.Fatalf("Routes failed: %v", err)
+	}
+	if len(routes) != 1 {
+		t.Fatalf("expected 1 route, got %+v", routes)
+	}
+	if routes[0].Pattern != "/health" || !strings.HasPrefix(routes[0].Handler, "router.TestRoutes_NativeRoutes") {
+		t.Errorf("unexpected route %+v", routes[0])
+	}
+	if len(routes[0].Middleware) != 1 {
+		t.Errorf("expected the inline middleware, got %v", routes[0].Middleware)
+	}
+}
+
+func TestRoutes_GroupOnly(t *testing.T) {
+	router := NewChiRouter(di.NewContainer())
+	router.GET("/", noop)
+	api := router.Group("/api")
+	api.GET("/users", listUsers)
+
+	routes, err := Routes(api)
+	if err != nil {
+		t.Fatalf("Routes failed: %v", err)
+	}
+	if len(routes) != 1 || routes[0].Pattern != "/api/users" {
+		t.Errorf("expected only the group route, got %+v", routes)
+	}
+}
+
+func TestWriteRoutes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "routes.json")
+
+	router := NewChiRouter(di.NewContainer())
+	router.GET("/users/{id}", showUser).Name("users.show")
+	router.Native().(*chi.Mux).Get("/health", func(w http.ResponseWriter, r *http.Request) {})
+
+	if err := WriteRoutes(router, path); err != nil {
+		t.Fatalf("WriteRoutes failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("routes file not written: %v", err)
+	}
+	var routes []RouteInfo
+	if err := json.Unmarshal(data, &routes); err != nil {
+		t.Fatalf("invalid routes file: %v", err)
+	}
+	if len(routes) != 2 || routes[0].Pattern != "/health" || routes[1].Name != "users.show" {
+		t.Errorf("unexpected routes %+v", routes)
+	}
+}
@@ -0,0 +1,235 @@
+package router
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// routeEntry is a route registered on a router.
+type routeEntry struct {
+	routes     *routeTable
+	router     *chiRouter // router the route was registered on
+	methods    []string   // nil for any method
+	pattern    string     // full pattern, including group prefixes
+	name       string
+	handler    string   // handler function name
+	middleware []string // names of the route's own middleware
+}
+
+// method describes the methods of the route, e.g. "GET" or "GET|POST".
+func (e *routeEntry) method() string {
+	if e.methods == nil {
+		return "*"
+	}
+	return strings.Join(e.methods, "|")
+}
+
+// matches reports whether the route handles method.
+func (e *routeEntry) matches(method string) bool {
+	if e.methods == nil {
+		return true
+	}
+	for _, m := range e.methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// middlewareChain returns the names of the middleware that run for the
+// route, outermost first.
+func (e *routeEntry) middlewareChain() []string {
+	return append(e.router.middlewareChain(), e.middleware...)
+}
+
+// Name names the route so URLs can be built for it. Names must be unique
+// across the router and its groups; reusing one panics, like registering
+// an invalid pattern does.
+func (e *routeEntry) Name(name string) touta.Route {
+	e.routes.setName(e, name)
+	return e
+}
+
+// routeTable holds the routes of a router and its groups.
+type routeTable struct {
+	mu      sync.RWMutex
+	entries []*routeEntry // in registration order
+	named   map[string]*routeEntry
+}
+
+func newRouteTable() *routeTable {
+	return &routeTable{
+		named: make(map[string]*routeEntry),
+	}
+}
+
+// add records a newly registered route.
+func (t *routeTable) add(e *routeEntry) *routeEntry {
+	e.routes = t
+
+	t.mu.Lock()
+	t.entries = append(t.entries, e)
+	t.mu.Unlock()
+	return e
+}
+
+// list returns the recorded routes in registration order.
+func (t *routeTable) list() []*routeEntry {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	return append([]*routeEntry(nil), t.entries...)
+}
+
+func (t *routeTable) setName(e *routeEntry, name string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if existing, ok := t.named[name]; ok && existing != e {
+		panic(fmt.Sprintf("router: route name %q already used by %s %s", name, existing.method(), existing.pattern))
+	}
+	if e.name != "" {
+		delete(t.named, e.name)
+	}
+	e.name = name
+	t.named[name] = e
+}
+
+// url builds the path of the named route. Params are key/value pairs;
+// keys matching a pattern parameter fill it and the others become query
+// parameters.
+func (t *routeTable) url(name string, params ...interface{}) (string, error) {
+	if t == nil {
+		return "", fmt.Errorf("cannot build URL for route %q: context has no router", name)
+	}
+
+	t.mu.RLock()
+	e, ok := t.named[name]
+	t.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("no route named %q", name)
+	}
+
+	if len(params)%2 != 0 {
+		return "", fmt.Errorf("route %q: params must be key/value pairs, got %d values", name, len(params))
+	}
+	values := make(map[string]string, len(params)/2)
+	var keys []string
+	for i := 0; i < len(params); i += 2 {
+		key, ok := params[i].(string)
+		if !ok {
+			return "", fmt.Errorf("route %q: param key %v is not a string", name, params[i])
+		}
+		if params[i+1] == nil {
+			continue // nil counts as missing, e.g. an absent template field
+		}
+		if _, dup := values[key]; !dup {
+			keys = append(keys, key)
+		}
+		values[key] = fmt.Sprint(params[i+1])
+	}
+
+	path, used, err := expand(e.pattern, values)
+	if err != nil {
+		return "", fmt.Errorf("route %q: %w", name, err)
+	}
+
+	query := url.Values{}
+	for _, key := range keys {
+		if !used[key] {
+			query.Add(key, values[key])
+		}
+	}
+	if len(query) > 0 {
+		path += "?" + query.Encode()
+	}
+	return path, nil
+}
+
+// expand substitutes {param}, {param:regexp} and the trailing * wildcard
+// of a Chi pattern. It returns the parameters it used.
+func expand(pattern string, values map[string]string) (string, map[string]bool, error) {
+	used := make(map[string]bool)
+	var b strings.Builder
+
+	for i := 0; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '{':
+			end := closingBrace(pattern, i)
+			if end < 0 {
+				return "", nil, fmt.Errorf("malformed pattern %s", pattern)
+			}
+			param, expr, hasExpr := strings.Cut(pattern[i+1:end], ":")
+			value, ok := values[param]
+			if !ok {
+				return "", nil, fmt.Errorf("missing param %q", param)
+			}
+			if hasExpr {
+				re, err := regexp.Compile("^(?:" + expr + ")$")
+				if err != nil {
+					return "", nil, fmt.Errorf("invalid pattern for param %q: %w", param, err)
+				}
+				if !re.MatchString(value) {
+					return "", nil, fmt.Errorf("param %q value %q does not match %s", param, value, expr)
+				}
+			}
+			b.WriteString(url.PathEscape(value))
+			used[param] = true
+			i = end
+
+		case '*':
+			value := values["*"]
+			used["*"] = true
+			// The wildcard spans segments, so only escape within them
+			segments := strings.Split(value, "/")
+			for j, s := range segments {
+				segments[j] = url.PathEscape(s)
+			}
+			b.WriteString(strings.Join(segments, "/"))
+
+		default:
+			b.WriteByte(pattern[i])
+		}
+	}
+	return b.String(), used, nil
+}
+
+// closingBrace returns the index of the brace closing the one at start,
+// allowing nested braces in regular expressions such as {id:[0-9]{3}}.
+func closingBrace(pattern string, start int) int {
+	depth := 0
+	for i := start; i < len(pattern); i++ {
+		switch pattern[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// joinPattern joins a group prefix and a route pattern. Like Chi, it
+// panics when pattern does not begin with a slash, which would otherwise
+// be glued to the prefix.
+func joinPattern(prefix, pattern string) string {
+	if !strings.HasPrefix(pattern, "/") {
+		panic(fmt.Sprintf("router: routing pattern must begin with '/' in %q", pattern))
+	}
+	if prefix == "" || prefix == "/" {
+		return pattern
+	}
+	prefix = strings.TrimSuffix(prefix, "/")
+	if pattern == "/" {
+		return prefix + "/"
+	}
+	return prefix + pattern
+}
@@ -0,0 +1,107 @@
+package router
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/toutaio/toutago/internal/di"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+func noop(ctx touta.Context) error { return nil }
+
+func TestRouter_URL(t *testing.T) {
+	router := NewChiRouter(di.NewContainer())
+	router.GET("/", noop).Name("home")
+	router.GET("/users/{id}", noop).Name("users.show")
+	router.GET("/posts/{year:[0-9]{4}}/{slug}", noop).Name("posts.show")
+	router.GET("/files/*", noop).Name("files")
+	router.Group("/api").Group("/v1").GET("/users/{id}", noop).Name("api.users.show")
+
+	tests := []struct {
+		name   string
+		params []interface{}
+		want   string
+	}{
+		{"home", nil, "/"},
+		{"users.show", []interface{}{"id", 42}, "/users/42"},
+		{"users.show", []interface{}{"id", "a b/c"}, "/users/a%20b%2Fc"},
+		{"users.show", []interface{}{"id", 1, "tab", "posts"}, "/users/1?tab=posts"},
+		{"posts.show", []interface{}{"year", 2024, "slug", "hello"}, "/posts/2024/hello"},
+		{"files", []interface{}{"*", "docs/a b.txt"}, "/files/docs/a%20b.txt"},
+		{"api.users.show", []interface{}{"id", 7}, "/api/v1/users/7"},
+	}
+
+	for _, tt := range tests {
+		got, err := router.URL(tt.name, tt.params...)
+		if err != nil {
+			t.Errorf("URL(%s, %v) failed: %v", tt.name, tt.params, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("URL(%s, %v) = %s, want %s", tt.name, tt.params, got, tt.want)
+		}
+	}
+}
+
+func TestRouter_URLErrors(t *testing.T) {
+	router := NewChiRouter(di.NewContainer())
+	router.GET("/users/{id}", noop).Name("users.show")
+	router.GET("/posts/{year:[0-9]{4}}", noop).Name("posts.year")
+
+	tests := []struct {
+		name   string
+		params []interface{}
+		errMsg string
+	}{
+		{"missing", nil, `no route named "missing"`},
+		{"users.show", nil, `missing param "id"`},
+		{"users.show", []interface{}{"id"}, "key/value pairs"},
+		{"users.show", []interface{}{1, 2}, "not a string"},
+		{"posts.year", []interface{}{"year", "24"}, "does not match"},
+	}
+
+	for _, tt := range tests {
+		_, err := router.URL(tt.name, tt.params...)
+		if err == nil || !strings.Contains(err.Error(), tt.errMsg) {
+			t.Errorf("URL(%s, %v) error = %v, want %q", tt.name, tt.params, err, tt.errMsg)
+		}
+	}
+}
+
+func TestRouter_DuplicateRouteNamePanics(t *testing.T) {
+	router := NewChiRouter(di.NewContainer())
+	router.GET("/a", noop).Name("dup")
+
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic for a duplicate route name")
+		}
+	}()
+	router.POST("/b", noop).Name("dup")
+}
+
+func TestContext_URL(t *testing.T) {
+	router := NewChiRouter(di.NewContainer())
+	router.GET("/users/{id}", noop).Name("users.show")
+	router.POST("/users", func(ctx touta.Context) error {
+		url, err := ctx.URL("users.show", "id", 9)
+		if err != nil {
+			return err
+		}
+		return ctx.Redirect(303, url)
+	})
+
+	w := httptest.NewRecorder()
+	router.Native().(*chi.Mux).ServeHTTP(w, httptest.NewRequest("POST", "/users", nil))
+	if w.Code != 303 || w.Header().Get("Location") != "/users/9" {
+		t.Errorf("Expected a redirect to /users/9, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+
+	ctx := NewContext(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil), di.NewContainer())
+	if _, err := ctx.URL("users.show", "id", 1); err == nil {
+		t.Error("Contexts without a router cannot build URLs")
+	}
+}
@@ -0,0 +1,415 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/toutaio/toutago/internal/message"
+	"github.com/toutaio/toutago/internal/scheduler"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// Manager routes bus messages to saga instances.
+type Manager interface {
+	// Register adds a saga type; it must be called before Start
+	Register(def Definition) error
+
+	// Instance returns the stored instance for a saga and correlation id
+	Instance(saga, correlationID string) (*Instance, error)
+
+	// CheckTimeouts fails running instances whose deadline has passed
+	CheckTimeouts(ctx context.Context) (int, error)
+
+	// Start subscribes every registered saga to the bus
+	Start(ctx context.Context) error
+
+	// Stop unsubscribes from the bus and stops timeout checks
+	Stop(ctx context.Context) error
+}
+
+// Option configures a manager created by NewManager.
+type Option func(*manager)
+
+// WithStore sets where instance state is persisted.
+func WithStore(store Store) Option {
+	return func(m *manager) {
+		m.store = store
+	}
+}
+
+// WithClock sets the clock used for deadlines and timeout checks.
+func WithClock(clock scheduler.Clock) Option {
+	return func(m *manager) {
+		m.clock = clock
+	}
+}
+
+// WithTimeoutInterval sets how often deadlines are checked (default one second).
+func WithTimeoutInterval(d time.Duration) Option {
+	return func(m *manager) {
+		m.interval = d
+	}
+}
+
+// manager implements Manager.
+type manager struct {
+	bus      touta.MessageBus
+	store    Store
+	clock    scheduler.Clock
+	interval time.Duration
+
+	defs  map[string]*Definition
+	subs  []touta.Subscription
+	locks map[string]*instanceLock
+
+	mu      sync.Mutex
+	locksMu sync.Mutex
+	wg      sync.WaitGroup
+	cancel  context.CancelFunc
+}
+
+// NewManager creates a saga manager driven by bus.
+func NewManager(bus touta.MessageBus, opts ...Option) Manager {
+	m := &manager{
+		bus:      bus,
+		store:    NewMemoryStore(),
+		clock:    scheduler.NewRealClock(),
+		interval: time.Second,
+		defs:     make(map[string]*Definition),
+		locks:    make(map[string]*instanceLock),
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	return m
+}
+
+// Register adds a saga type.
+func (m *manager) Register(def Definition) error {
+	if err := def.validate(); err != nil {
+		return err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, exists := m.defs[def.Name]; exists {
+		return fmt.Errorf("saga %s already registered", def.Name)
+	}
+	m.defs[def.Name] = &def
+	return nil
+}
+
+// Instance returns the stored instance for a saga and correlation id.
+func (m *manager) Instance(saga, correlationID string) (*Instance, error) {
+	inst, err := m.store.Load(saga, correlationID)
+	if err != nil {
+		return nil, err
+	}
+	if inst == nil {
+		return nil, fmt.Errorf("saga %s instance %s not found", saga, correlationID)
+	}
+	return inst, nil
+}
+
+// Start subscribes every registered saga to the bus.
+func (m *manager) Start(ctx context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cancel != nil {
+		return fmt.Errorf("saga manager already started")
+	}
+
+	for _, def := range m.defs {
+		for _, slug := range def.slugs() {
+			sub, err := m.bus.Subscribe(slug, m.handlerFor(def))
+			if err != nil {
+				m.unsubscribe()
+				return fmt.Errorf("failed to subscribe saga %s to %s: %w", def.Name, slug, err)
+			}
+			m.subs = append(m.subs, sub)
+		}
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	m.cancel = cancel
+
+	m.wg.Add(1)
+	go m.watchTimeouts(runCtx)
+	return nil
+}
+
+// Stop unsubscribes from the bus and stops timeout checks.
+func (m *manager) Stop(ctx context.Context) error {
+	m.mu.Lock()
+	if m.cancel == nil {
+		m.mu.Unlock()
+		return nil
+	}
+	m.unsubscribe()
+	m.cancel()
+	m.cancel = nil
+	m.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// unsubscribe removes all bus subscriptions. The caller must hold mu.
+func (m *manager) unsubscribe() {
+	for _, sub := range m.subs {
+		sub.Unsubscribe()
+	}
+	m.subs = nil
+}
+
+// handlerFor adapts a saga definition to a bus handler.
+func (m *manager) handlerFor(def *Definition) touta.MessageHandler {
+	return message.HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		return nil, m.handle(ctx, def, msg)
+	})
+}
+
+// handle routes one message to its saga instance.
+func (m *manager) handle(ctx context.Context, def *Definition, msg touta.Message) error {
+	correlationID := correlationOf(msg, def.CorrelationKey)
+	if correlationID == "" {
+		return fmt.Errorf("saga %s: message %s has no %s metadata", def.Name, msg.Slug(), def.CorrelationKey)
+	}
+
+	unlock := m.lock(def.Name, correlationID)
+	defer unlock()
+
+	inst, err := m.store.Load(def.Name, correlationID)
+	if err != nil {
+		return fmt.Errorf("saga %s: failed to load instance %s: %w", def.Name, correlationID, err)
+	}
+
+	if inst == nil {
+		if !def.startedBy(msg.Slug()) {
+			return nil // nothing to continue
+		}
+		inst = m.newInstance(def, correlationID)
+	}
+
+	if !inst.Active() {
+		return nil
+	}
+	inst.correlationKey = def.CorrelationKey
+
+	handleErr := def.Handle(ctx, inst, msg)
+	if handleErr != nil {
+		// The failed step must not act: only the compensations' messages
+		// are published
+		inst.outgoing = nil
+		m.compensate(ctx, def, inst, StatusCompensated, handleErr)
+	}
+
+	if err := m.save(ctx, inst); err != nil {
+		return fmt.Errorf("saga %s: %w", def.Name, err)
+	}
+
+	if handleErr != nil {
+		return fmt.Errorf("saga %s instance %s failed: %w", def.Name, correlationID, handleErr)
+	}
+	return nil
+}
+
+// CheckTimeouts fails running instances whose deadline has passed.
+func (m *manager) CheckTimeouts(ctx context.Context) (int, error) {
+	active, err := m.store.Active()
+	if err != nil {
+		return 0, fmt.Errorf("failed to list saga instances: %w", err)
+	}
+
+	now := m.clock.Now()
+	expired := 0
+	var errs []error
+
+	for _, candidate := range active {
+		if candidate.Deadline.IsZero() || candidate.Deadline.After(now) {
+			continue
+		}
+
+		m.mu.Lock()
+		def, ok := m.defs[candidate.Saga]
+		m.mu.Unlock()
+		if !ok {
+			continue
+		}
+
+		if err := m.expire(ctx, def, candidate.CorrelationID, now); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		expired++
+	}
+
+	return expired, errors.Join(errs...)
+}
+
+// expire times out a single instance.
+func (m *manager) expire(ctx context.Context, def *Definition, correlationID string, now time.Time) error {
+	unlock := m.lock(def.Name, correlationID)
+	defer unlock()
+
+	// Reload under the lock, a message may have finished the saga meanwhile
+	inst, err := m.store.Load(def.Name, correlationID)
+	if err != nil || inst == nil || !inst.Active() || inst.Deadline.After(now) {
+		return err
+	}
+	inst.correlationKey = def.CorrelationKey
+
+	if def.OnTimeout != nil {
+		if err := def.OnTimeout(ctx, inst); err != nil {
+			inst.outgoing = nil
+			m.compensate(ctx, def, inst, StatusTimedOut, err)
+			return m.save(ctx, inst)
+		}
+	}
+
+	if inst.Active() {
+		m.compensate(ctx, def, inst, StatusTimedOut, fmt.Errorf("saga timed out after %s", def.Timeout))
+	}
+	return m.save(ctx, inst)
+}
+
+// compensate undoes completed steps in reverse order.
+func (m *manager) compensate(ctx context.Context, def *Definition, inst *Instance, status Status, cause error) {
+	var errs []error
+	for i := len(inst.Steps) - 1; i >= 0; i-- {
+		fn, ok := def.Compensations[inst.Steps[i]]
+		if !ok {
+			continue
+		}
+		if err := fn(ctx, inst); err != nil {
+			errs = append(errs, fmt.Errorf("compensation %s: %w", inst.Steps[i], err))
+		}
+	}
+
+	inst.Status = status
+	inst.Error = cause.Error()
+	if len(errs) > 0 {
+		inst.Status = StatusFailed
+		inst.Error = errors.Join(append([]error{cause}, errs...)...).Error()
+	}
+}
+
+// save persists an instance and publishes the messages it queued.
+func (m *manager) save(ctx context.Context, inst *Instance) error {
+	inst.UpdatedAt = m.clock.Now()
+	if err := m.store.Save(inst); err != nil {
+		return fmt.Errorf("failed to save instance %s: %w", inst.CorrelationID, err)
+	}
+
+	outgoing := inst.outgoing
+	inst.outgoing = nil
+
+	var errs []error
+	for _, msg := range outgoing {
+		if err := m.bus.Publish(ctx, msg); err != nil {
+			errs = append(errs, fmt.Errorf("failed to publish %s: %w", msg.Slug(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// newInstance creates a running instance for a correlation id.
+func (m *manager) newInstance(def *Definition, correlationID string) *Instance {
+	now := m.clock.Now()
+	inst := &Instance{
+		ID:            message.NewID(),
+		Saga:          def.Name,
+		CorrelationID: correlationID,
+		Status:        StatusRunning,
+		Data:          make(map[string]interface{}),
+		StartedAt:     now,
+		UpdatedAt:     now,
+	}
+	if def.Timeout > 0 {
+		inst.Deadline = now.Add(def.Timeout)
+	}
+	return inst
+}
+
+// instanceLock is a reference counted per-instance mutex.
+type instanceLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+// lock serialises message handling per instance and returns the unlock func.
+func (m *manager) lock(saga, correlationID string) func() {
+	key := instanceKey(saga, correlationID)
+
+	m.locksMu.Lock()
+	l, ok := m.locks[key]
+	if !ok {
+		l = &instanceLock{}
+		m.locks[key] = l
+	}
+	l.refs++
+	m.locksMu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+
+		m.locksMu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(m.locks, key)
+		}
+		m.locksMu.Unlock()
+	}
+}
+
+// watchTimeouts periodically checks deadlines until ctx is cancelled.
+func (m *manager) watchTimeouts(ctx context.Context) {
+	defer m.wg.Done()
+
+	for {
+		timer := m.clock.NewTimer(m.interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C():
+			if _, err := m.CheckTimeouts(ctx); err != nil {
+				log.Printf("saga: %v", err)
+			}
+		}
+	}
+}
+
+// correlationOf reads the correlation id from message metadata.
+func correlationOf(msg touta.Message, key string) string {
+	meta := msg.Metadata()
+	if meta == nil {
+		return ""
+	}
+
+	switch v := meta[key].(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,292 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/toutaio/toutago/internal/message"
+	"github.com/toutaio/toutago/internal/scheduler"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+func newEvent(slug, orderID string) *message.BaseMessage {
+	return &message.BaseMessage{
+		MessageSlug: slug,
+		MessageType: "event",
+		Meta:        map[string]interface{}{DefaultCorrelationKey: orderID},
+	}
+}
+
+// checkoutSaga reserves stock, charges and ships, releasing stock on failure.
+func checkoutSaga(released *[]string) Definition {
+	return Definition{
+		Name:      "checkout",
+		StartedBy: []string{"order.placed"},
+		Handles:   []string{"stock.reserved", "payment.charged", "payment.failed"},
+		Timeout:   time.Hour,
+		Handle: func(ctx context.Context, inst *Instance, msg touta.Message) error {
+			switch msg.Slug() {
+			case "order.placed":
+				inst.Send(&message.BaseMessage{MessageSlug: "stock.reserve", MessageType: "command"})
+			case "stock.reserved":
+				inst.Step("reserve_stock")
+				inst.Set("reserved", true)
+			case "payment.charged":
+				inst.Complete()
+			case "payment.failed":
+				return errors.New("card declined")
+			}
+			return nil
+		},
+		Compensations: map[string]CompensationFunc{
+			"reserve_stock": func(ctx context.Context, inst *Instance) error {
+				*released = append(*released, inst.CorrelationID)
+				return nil
+			},
+		},
+	}
+}
+
+// startBus returns a running bus that records published slugs.
+func startBus(t *testing.T) (touta.MessageBus, func() []string) {
+	t.Helper()
+
+	bus := message.NewBus()
+	if err := bus.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start bus: %v", err)
+	}
+	t.Cleanup(func() { bus.Stop(context.Background()) })
+
+	var mu sync.Mutex
+	var commands []string
+	bus.Subscribe("command", message.HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		commands = append(commands, msg.Slug())
+		return nil, nil
+	}))
+
+	return bus, func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]string(nil), commands...)
+	}
+}
+
+func TestManager_CompletesSaga(t *testing.T) {
+	bus, commands := startBus(t)
+	var released []string
+
+	m := NewManager(bus)
+	if err := m.Register(checkoutSaga(&released)); err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if err := m.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer m.Stop(context.Background())
+
+	ctx := context.Background()
+	for _, slug := range []string{"order.placed", "stock.reserved", "payment.charged"} {
+		if err := bus.PublishSync(ctx, newEvent(slug, "order-1")); err != nil {
+			t.Fatalf("PublishSync %s failed: %v", slug, err)
+		}
+	}
+
+	inst, err := m.Instance("checkout", "order-1")
+	if err != nil {
+		t.Fatalf("Instance failed: %v", err)
+	}
+
+	if inst.Status != StatusCompleted {
+		t.Errorf("Expected completed, got %s", inst.Status)
+	}
+	if inst.Get("reserved") != true {
+		t.Error("Saga state should be persisted between messages")
+	}
+	if len(released) != 0 {
+		t.Error("Completed saga should not compensate")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(commands()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if got := commands(); len(got) != 1 || got[0] != "stock.reserve" {
+		t.Errorf("Expected stock.reserve command, got %v", got)
+	}
+}
+
+func TestManager_CompensatesOnFailure(t *testing.T) {
+	bus, _ := startBus(t)
+	var released []string
+
+	m := NewManager(bus)
+	m.Register(checkoutSaga(&released))
+	m.Start(context.Background())
+	defer m.Stop(context.Background())
+
+	ctx := context.Background()
+	bus.PublishSync(ctx, newEvent("order.placed", "order-2"))
+	bus.PublishSync(ctx, newEvent("stock.reserved", "order-2"))
+
+	if err := bus.PublishSync(ctx, newEvent("payment.failed", "order-2")); err == nil {
+		t.Error("Failing saga step should surface an error")
+	}
+
+	inst, _ := m.Instance("checkout", "order-2")
+	if inst.Status != StatusCompensated {
+		t.Errorf("Expected compensated, got %s", inst.Status)
+	}
+	if len(released) != 1 || released[0] != "order-2" {
+		t.Errorf("Expected stock release for order-2, got %v", released)
+	}
+
+	// Finished instances ignore further messages
+	if err := bus.PublishSync(ctx, newEvent("payment.charged", "order-2")); err != nil {
+		t.Errorf("Messages for finished sagas should be ignored, got %v", err)
+	}
+}
+
+func TestManager_FailedStepDoesNotSend(t *testing.T) {
+	bus, commands := startBus(t)
+
+	m := NewManager(bus)
+	m.Register(Definition{
+		Name:      "refund",
+		StartedBy: []string{"refund.requested"},
+		Handles:   []string{"refund.approved"},
+		Handle: func(ctx context.Context, inst *Instance, msg touta.Message) error {
+			if msg.Slug() == "refund.requested" {
+				inst.Step("hold_funds")
+				return nil
+			}
+			inst.Send(&message.BaseMessage{MessageSlug: "payment.refund", MessageType: "command"})
+			return errors.New("ledger unavailable")
+		},
+		Compensations: map[string]CompensationFunc{
+			"hold_funds": func(ctx context.Context, inst *Instance) error {
+				inst.Send(&message.BaseMessage{MessageSlug: "funds.release", MessageType: "command"})
+				return nil
+			},
+		},
+	})
+	m.Start(context.Background())
+	defer m.Stop(context.Background())
+
+	ctx := context.Background()
+	bus.PublishSync(ctx, newEvent("refund.requested", "refund-1"))
+	if err := bus.PublishSync(ctx, newEvent("refund.approved", "refund-1")); err == nil {
+		t.Fatal("Failing saga step should surface an error")
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for len(commands()) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if got := commands(); len(got) != 1 || got[0] != "funds.release" {
+		t.Errorf("Expected only the compensation's command, got %v", got)
+	}
+}
+
+func TestManager_IgnoresUnstartedContinuation(t *testing.T) {
+	bus, _ := startBus(t)
+	var released []string
+
+	m := NewManager(bus)
+	m.Register(checkoutSaga(&released))
+	m.Start(context.Background())
+	defer m.Stop(context.Background())
+
+	bus.PublishSync(context.Background(), newEvent("stock.reserved", "unknown"))
+
+	if _, err := m.Instance("checkout", "unknown"); err == nil {
+		t.Error("Continuation slugs should not start a saga")
+	}
+}
+
+func TestManager_Timeout(t *testing.T) {
+	bus, _ := startBus(t)
+	clock := scheduler.NewFakeClock(time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC))
+	var released []string
+
+	m := NewManager(bus, WithClock(clock))
+	m.Register(checkoutSaga(&released))
+	m.Start(context.Background())
+	defer m.Stop(context.Background())
+
+	ctx := context.Background()
+	bus.PublishSync(ctx, newEvent("order.placed", "order-3"))
+	bus.PublishSync(ctx, newEvent("stock.reserved", "order-3"))
+
+	if n, _ := m.CheckTimeouts(ctx); n != 0 {
+		t.Fatalf("No saga should time out yet, got %d", n)
+	}
+
+	clock.Set(time.Date(2026, time.January, 1, 1, 0, 0, 0, time.UTC))
+	n, err := m.CheckTimeouts(ctx)
+	if err != nil || n != 1 {
+		t.Fatalf("Expected 1 timed out saga, got %d (%v)", n, err)
+	}
+
+	inst, _ := m.Instance("checkout", "order-3")
+	if inst.Status != StatusTimedOut {
+		t.Errorf("Expected timed_out, got %s", inst.Status)
+	}
+	if len(released) != 1 {
+		t.Error("Timed out saga should be compensated")
+	}
+}
+
+func TestManager_PersistentState(t *testing.T) {
+	bus, _ := startBus(t)
+	path := filepath.Join(t.TempDir(), "sagas.json")
+	var released []string
+
+	store, err := NewFileStore(path)
+	if err != nil {
+		t.Fatalf("NewFileStore failed: %v", err)
+	}
+
+	first := NewManager(bus, WithStore(store))
+	first.Register(checkoutSaga(&released))
+	first.Start(context.Background())
+	bus.PublishSync(context.Background(), newEvent("order.placed", "order-4"))
+	first.Stop(context.Background())
+
+	// A new manager over the same file continues the instance
+	reopened, _ := NewFileStore(path)
+	second := NewManager(bus, WithStore(reopened))
+	second.Register(checkoutSaga(&released))
+	second.Start(context.Background())
+	defer second.Stop(context.Background())
+
+	bus.PublishSync(context.Background(), newEvent("payment.charged", "order-4"))
+
+	inst, err := second.Instance("checkout", "order-4")
+	if err != nil {
+		t.Fatalf("Instance failed: %v", err)
+	}
+	if inst.Status != StatusCompleted {
+		t.Errorf("Expected completed after restart, got %s", inst.Status)
+	}
+}
+
+func TestManager_RegisterValidation(t *testing.T) {
+	m := NewManager(message.NewBus())
+
+	if err := m.Register(Definition{Name: "empty"}); err == nil {
+		t.Error("Definition without start slugs should be rejected")
+	}
+
+	var released []string
+	m.Register(checkoutSaga(&released))
+	if err := m.Register(checkoutSaga(&released)); err == nil {
+		t.Error("Duplicate saga names should be rejected")
+	}
+}
@@ -0,0 +1,160 @@
+// Package saga coordinates long-running workflows (process managers) that
+// span several messages on a touta.MessageBus.
+//
+// A saga type is declared with a Definition: the slugs that start and
+// continue it, the metadata key correlating messages to an instance, an
+// optional timeout, and compensation steps that undo completed work when the
+// saga fails.
+package saga
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// DefaultCorrelationKey is the metadata key used when a Definition sets none.
+const DefaultCorrelationKey = "correlation_id"
+
+// Status is the lifecycle state of a saga instance.
+type Status string
+
+const (
+	StatusRunning     Status = "running"
+	StatusCompleted   Status = "completed"
+	StatusCompensated Status = "compensated" // failed, all compensations succeeded
+	StatusFailed      Status = "failed"      // failed, some compensations failed too
+	StatusTimedOut    Status = "timed_out"
+)
+
+// HandlerFunc handles a message for a saga instance.
+type HandlerFunc func(ctx context.Context, inst *Instance, msg touta.Message) error
+
+// CompensationFunc undoes a completed step.
+type CompensationFunc func(ctx context.Context, inst *Instance) error
+
+// Definition declares a saga type.
+type Definition struct {
+	// Name identifies the saga type
+	Name string
+
+	// StartedBy lists slugs that create a new instance
+	StartedBy []string
+
+	// Handles lists slugs that continue an existing instance
+	Handles []string
+
+	// CorrelationKey is the metadata key linking messages to an instance
+	CorrelationKey string
+
+	// Timeout fails a running instance after this long (zero disables it)
+	Timeout time.Duration
+
+	// Handle processes every message routed to the saga
+	Handle HandlerFunc
+
+	// OnTimeout is called before a timed out instance is compensated; it may
+	// complete the instance instead
+	OnTimeout func(ctx context.Context, inst *Instance) error
+
+	// Compensations maps step names recorded with Instance.Step to the
+	// action undoing them; they run in reverse order on failure
+	Compensations map[string]CompensationFunc
+}
+
+// validate checks a definition and fills in defaults.
+func (d *Definition) validate() error {
+	if d.Name == "" {
+		return fmt.Errorf("saga name is required")
+	}
+	if len(d.StartedBy) == 0 {
+		return fmt.Errorf("saga %s must be started by at least one slug", d.Name)
+	}
+	if d.Handle == nil {
+		return fmt.Errorf("saga %s has no handler", d.Name)
+	}
+	if d.CorrelationKey == "" {
+		d.CorrelationKey = DefaultCorrelationKey
+	}
+	return nil
+}
+
+// startedBy reports whether slug starts the saga.
+func (d *Definition) startedBy(slug string) bool {
+	for _, s := range d.StartedBy {
+		if s == slug {
+			return true
+		}
+	}
+	return false
+}
+
+// slugs returns every slug the saga subscribes to.
+func (d *Definition) slugs() []string {
+	seen := make(map[string]bool)
+	var slugs []string
+	for _, s := range append(append([]string(nil), d.StartedBy...), d.Handles...) {
+		if !seen[s] {
+			seen[s] = true
+			slugs = append(slugs, s)
+		}
+	}
+	return slugs
+}
+
+// Instance is the persisted state of one running saga.
+type Instance struct {
+	ID            string                 `json:"id"`
+	Saga          string                 `json:"saga"`
+	CorrelationID string                 `json:"correlation_id"`
+	Status        Status                 `json:"status"`
+	Data          map[string]interface{} `json:"data"`
+	Steps         []string               `json:"steps,omitempty"`
+	Error         string                 `json:"error,omitempty"`
+	StartedAt     time.Time              `json:"started_at"`
+	UpdatedAt     time.Time              `json:"updated_at"`
+	Deadline      time.Time              `json:"deadline,omitempty"`
+
+	correlationKey string
+	outgoing       []touta.Message
+}
+
+// Get returns a value from the saga state.
+func (i *Instance) Get(key string) interface{} {
+	return i.Data[key]
+}
+
+// Set stores a value in the saga state.
+func (i *Instance) Set(key string, value interface{}) {
+	if i.Data == nil {
+		i.Data = make(map[string]interface{})
+	}
+	i.Data[key] = value
+}
+
+// Step records a completed step so it is compensated if the saga fails.
+func (i *Instance) Step(name string) {
+	i.Steps = append(i.Steps, name)
+}
+
+// Send queues a message to publish once the instance state is saved.
+// The message is stamped with the saga's correlation id. Messages queued
+// by a Handle or OnTimeout call that returns an error are dropped.
+func (i *Instance) Send(msg touta.Message) {
+	if meta := msg.Metadata(); meta != nil {
+		meta[i.correlationKey] = i.CorrelationID
+	}
+	i.outgoing = append(i.outgoing, msg)
+}
+
+// Complete marks the saga as successfully finished.
+func (i *Instance) Complete() {
+	i.Status = StatusCompleted
+}
+
+// Active reports whether the instance still accepts messages.
+func (i *Instance) Active() bool {
+	return i.Status == StatusRunning
+}
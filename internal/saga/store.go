@@ -0,0 +1,137 @@
+package saga
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Store persists saga instances.
+type Store interface {
+	// Load returns the instance for a saga and correlation id, or nil
+	Load(saga, correlationID string) (*Instance, error)
+
+	// Save creates or replaces an instance
+	Save(inst *Instance) error
+
+	// Active returns all running instances
+	Active() ([]*Instance, error)
+}
+
+// instanceKey identifies an instance within a store.
+func instanceKey(saga, correlationID string) string {
+	return saga + "/" + correlationID
+}
+
+// memoryStore implements Store in memory.
+type memoryStore struct {
+	instances map[string]Instance
+	persist   func(map[string]Instance) error
+	mu        sync.RWMutex
+}
+
+// NewMemoryStore creates an in-memory saga store.
+func NewMemoryStore() Store {
+	return &memoryStore{
+		instances: make(map[string]Instance),
+	}
+}
+
+// Load returns a copy of the stored instance.
+func (s *memoryStore) Load(saga, correlationID string) (*Instance, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	inst, ok := s.instances[instanceKey(saga, correlationID)]
+	if !ok {
+		return nil, nil
+	}
+	return copyInstance(inst), nil
+}
+
+// Save stores a copy of the instance.
+func (s *memoryStore) Save(inst *Instance) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := instanceKey(inst.Saga, inst.CorrelationID)
+	previous, existed := s.instances[key]
+	s.instances[key] = *copyInstance(*inst)
+
+	if s.persist != nil {
+		if err := s.persist(s.instances); err != nil {
+			if existed {
+				s.instances[key] = previous
+			} else {
+				delete(s.instances, key)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// Active returns all running instances.
+func (s *memoryStore) Active() ([]*Instance, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var active []*Instance
+	for _, inst := range s.instances {
+		if inst.Active() {
+			active = append(active, copyInstance(inst))
+		}
+	}
+	return active, nil
+}
+
+// NewFileStore creates a saga store kept in a JSON file.
+func NewFileStore(path string) (Store, error) {
+	s := &memoryStore{
+		instances: make(map[string]Instance),
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read saga file: %w", err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &s.instances); err != nil {
+			return nil, fmt.Errorf("failed to parse saga file: %w", err)
+		}
+	}
+
+	s.persist = func(instances map[string]Instance) error {
+		data, err := json.MarshalIndent(instances, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode sagas: %w", err)
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return fmt.Errorf("failed to create saga directory: %w", err)
+		}
+		tmp := path + ".tmp"
+		if err := os.WriteFile(tmp, data, 0644); err != nil {
+			return fmt.Errorf("failed to write saga file: %w", err)
+		}
+		if err := os.Rename(tmp, path); err != nil {
+			return fmt.Errorf("failed to replace saga file: %w", err)
+		}
+		return nil
+	}
+
+	return s, nil
+}
+
+// copyInstance deep copies the persisted fields of an instance.
+func copyInstance(inst Instance) *Instance {
+	c := inst
+	c.outgoing = nil
+	c.Steps = append([]string(nil), inst.Steps...)
+	c.Data = make(map[string]interface{}, len(inst.Data))
+	for k, v := range inst.Data {
+		c.Data[k] = v
+	}
+	return &c
+}
@@ -0,0 +1,165 @@
+package scheduler
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock abstracts time so schedules can be tested deterministically.
+type Clock interface {
+	// Now returns the current time
+	Now() time.Time
+
+	// NewTimer creates a timer that fires after d
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is the subset of time.Timer used by the scheduler.
+type Timer interface {
+	// C returns the channel on which the fire time is delivered
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing
+	Stop() bool
+}
+
+// realClock implements Clock using the time package.
+type realClock struct{}
+
+// NewRealClock returns a Clock backed by the system time.
+func NewRealClock() Clock {
+	return realClock{}
+}
+
+// Now returns the current system time.
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// NewTimer creates a system timer.
+func (realClock) NewTimer(d time.Duration) Timer {
+	return &realTimer{timer: time.NewTimer(d)}
+}
+
+// realTimer adapts time.Timer to the Timer interface.
+type realTimer struct {
+	timer *time.Timer
+}
+
+// C returns the timer channel.
+func (t *realTimer) C() <-chan time.Time {
+	return t.timer.C
+}
+
+// Stop stops the timer.
+func (t *realTimer) Stop() bool {
+	return t.timer.Stop()
+}
+
+// FakeClock is a manually advanced Clock for tests.
+type FakeClock struct {
+	now     time.Time
+	timers  []*fakeTimer
+	mu      sync.Mutex
+	changed *sync.Cond
+}
+
+// NewFakeClock creates a fake clock set to now.
+func NewFakeClock(now time.Time) *FakeClock {
+	c := &FakeClock{now: now}
+	c.changed = sync.NewCond(&c.mu)
+	return c
+}
+
+// Now returns the fake current time.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer creates a timer that fires once the clock is advanced past d.
+func (c *FakeClock) NewTimer(d time.Duration) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	t := &fakeTimer{
+		clock:    c,
+		deadline: c.now.Add(d),
+		ch:       make(chan time.Time, 1),
+	}
+
+	if d <= 0 {
+		t.ch <- c.now
+		return t
+	}
+
+	c.timers = append(c.timers, t)
+	c.changed.Broadcast()
+	return t
+}
+
+// Advance moves the clock forward and fires all timers that became due.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.Set(c.Now().Add(d))
+}
+
+// Set moves the clock to t and fires all timers that became due.
+func (c *FakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.now = t
+	pending := c.timers[:0]
+	for _, timer := range c.timers {
+		if !timer.deadline.After(t) {
+			timer.ch <- t
+			continue
+		}
+		pending = append(pending, timer)
+	}
+	c.timers = pending
+	c.changed.Broadcast()
+}
+
+// BlockUntil waits until n timers are waiting on the clock.
+func (c *FakeClock) BlockUntil(n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for len(c.timers) != n {
+		c.changed.Wait()
+	}
+}
+
+// stop removes a timer from the clock.
+func (c *FakeClock) stop(t *fakeTimer) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for i, timer := range c.timers {
+		if timer == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			c.changed.Broadcast()
+			return true
+		}
+	}
+	return false
+}
+
+// fakeTimer is a timer driven by a FakeClock.
+type fakeTimer struct {
+	clock    *FakeClock
+	deadline time.Time
+	ch       chan time.Time
+}
+
+// C returns the timer channel.
+func (t *fakeTimer) C() <-chan time.Time {
+	return t.ch
+}
+
+// Stop prevents the timer from firing.
+func (t *fakeTimer) Stop() bool {
+	return t.clock.stop(t)
+}
@@ -0,0 +1,71 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseCron_Next(t *testing.T) {
+	base := time.Date(2026, time.March, 10, 14, 22, 30, 0, time.UTC) // Tuesday
+
+	tests := []struct {
+		expr string
+		want time.Time
+	}{
+		{"* * * * *", time.Date(2026, time.March, 10, 14, 23, 0, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2026, time.March, 10, 14, 30, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2026, time.March, 11, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * MON-FRI", time.Date(2026, time.March, 11, 9, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2026, time.April, 1, 0, 0, 0, 0, time.UTC)},
+		{"30 8 * jan,jun *", time.Date(2026, time.June, 1, 8, 30, 0, 0, time.UTC)},
+		{"0 0 * * 7", time.Date(2026, time.March, 15, 0, 0, 0, 0, time.UTC)},
+		{"0 0 13 * 5", time.Date(2026, time.March, 13, 0, 0, 0, 0, time.UTC)},
+		{"*/10 * * * * *", time.Date(2026, time.March, 10, 14, 22, 40, 0, time.UTC)},
+		{"@hourly", time.Date(2026, time.March, 10, 15, 0, 0, 0, time.UTC)},
+		{"@yearly", time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.expr, func(t *testing.T) {
+			schedule, err := ParseCron(tt.expr)
+			if err != nil {
+				t.Fatalf("ParseCron failed: %v", err)
+			}
+
+			if got := schedule.Next(base); !got.Equal(tt.want) {
+				t.Errorf("Expected %s, got %s", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestParseCron_Invalid(t *testing.T) {
+	invalid := []string{
+		"",
+		"* * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"*/0 * * * *",
+		"10-5 * * * *",
+		"abc * * * *",
+	}
+
+	for _, expr := range invalid {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("Expected error for %q", expr)
+		}
+	}
+}
+
+func TestParseCron_NeverFires(t *testing.T) {
+	schedule, err := ParseCron("0 0 31 2 *")
+	if err != nil {
+		t.Fatalf("ParseCron failed: %v", err)
+	}
+
+	if next := schedule.Next(time.Now()); !next.IsZero() {
+		t.Errorf("February 31st should never fire, got %s", next)
+	}
+}
@@ -0,0 +1,474 @@
+// Package scheduler delivers messages onto a touta.MessageBus at a later
+// time, either once (PublishAt, PublishAfter) or periodically (Cron).
+package scheduler
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/toutaio/toutago/internal/message"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// Scheduler publishes messages onto a message bus at scheduled times.
+type Scheduler interface {
+	// PublishAt schedules msg for delivery at the given time.
+	// The context only bounds registration; delivery uses the scheduler's context.
+	PublishAt(ctx context.Context, msg touta.Message, at time.Time) (string, error)
+
+	// PublishAfter schedules msg for delivery after the given delay
+	PublishAfter(ctx context.Context, msg touta.Message, delay time.Duration) (string, error)
+
+	// Cron publishes msg every time the cron expression fires
+	Cron(expr string, msg touta.Message) (string, error)
+
+	// Cancel removes a pending schedule
+	Cancel(id string) error
+
+	// Pending returns all pending schedules ordered by due time
+	Pending() []Entry
+
+	// Start loads persisted schedules and begins delivering messages
+	Start(ctx context.Context) error
+
+	// Stop halts delivery; pending schedules are kept in the store
+	Stop(ctx context.Context) error
+}
+
+// Option configures a scheduler created by NewScheduler.
+type Option func(*scheduler)
+
+// WithClock sets the clock used to compute due times.
+func WithClock(clock Clock) Option {
+	return func(s *scheduler) {
+		s.clock = clock
+	}
+}
+
+// WithStore persists pending schedules in store.
+func WithStore(store Store) Option {
+	return func(s *scheduler) {
+		s.store = store
+	}
+}
+
+// WithCodec sets the codec used to persist and restore messages.
+func WithCodec(codec *message.Codec) Option {
+	return func(s *scheduler) {
+		s.codec = codec
+	}
+}
+
+// WithRetryDelay sets how long a one-off delivery waits before it is
+// retried after Publish failed (default 5s).
+func WithRetryDelay(delay time.Duration) Option {
+	return func(s *scheduler) {
+		s.retryDelay = delay
+	}
+}
+
+// WithErrorHandler sets a callback for delivery failures.
+func WithErrorHandler(fn func(Entry, error)) Option {
+	return func(s *scheduler) {
+		s.onError = fn
+	}
+}
+
+// job is a pending schedule together with its live message.
+type job struct {
+	entry Entry
+	msg   touta.Message
+	cron  *CronSchedule
+
+	// delivering is set while a one-off delivery is being published; the
+	// job stays persisted until Publish succeeds
+	delivering bool
+}
+
+// scheduler implements Scheduler.
+type scheduler struct {
+	bus     touta.MessageBus
+	clock   Clock
+	store   Store
+	codec   *message.Codec
+	onError func(Entry, error)
+
+	retryDelay time.Duration
+
+	jobs    map[string]*job
+	wake    chan struct{}
+	mu      sync.Mutex
+	wg      sync.WaitGroup
+	cancel  context.CancelFunc
+	running bool
+}
+
+// NewScheduler creates a scheduler that publishes onto bus.
+func NewScheduler(bus touta.MessageBus, opts ...Option) Scheduler {
+	s := &scheduler{
+		bus:   bus,
+		clock: NewRealClock(),
+		codec: message.NewCodec(),
+		jobs:  make(map[string]*job),
+		wake:  make(chan struct{}, 1),
+
+		retryDelay: 5 * time.Second,
+		onError: func(e Entry, err error) {
+			log.Printf("scheduler: failed to deliver %s (%s): %v", e.Message.Slug, e.ID, err)
+		},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// PublishAt schedules msg for delivery at the given time.
+func (s *scheduler) PublishAt(ctx context.Context, msg touta.Message, at time.Time) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	return s.add(msg, at, "", nil)
+}
+
+// PublishAfter schedules msg for delivery after the given delay.
+func (s *scheduler) PublishAfter(ctx context.Context, msg touta.Message, delay time.Duration) (string, error) {
+	return s.PublishAt(ctx, msg, s.clock.Now().Add(delay))
+}
+
+// Cron publishes msg every time the cron expression fires.
+func (s *scheduler) Cron(expr string, msg touta.Message) (string, error) {
+	schedule, err := ParseCron(expr)
+	if err != nil {
+		return "", err
+	}
+
+	next := schedule.Next(s.clock.Now())
+	if next.IsZero() {
+		return "", fmt.Errorf("cron expression %q never fires", expr)
+	}
+	return s.add(msg, next, expr, schedule)
+}
+
+// Cancel removes a pending schedule.
+func (s *scheduler) Cancel(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[id]; !ok {
+		return fmt.Errorf("schedule %s not found", id)
+	}
+	delete(s.jobs, id)
+
+	s.notify()
+	return s.persist()
+}
+
+// Pending returns all pending schedules ordered by due time.
+func (s *scheduler) Pending() []Entry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	entries := make([]Entry, 0, len(s.jobs))
+	for _, entry := range s.entries() {
+		if !s.jobs[entry.ID].delivering {
+			entries = append(entries, entry)
+		}
+	}
+	return entries
+}
+
+// Start loads persisted schedules and begins delivering messages.
+func (s *scheduler) Start(ctx context.Context) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.running {
+		return fmt.Errorf("scheduler already started")
+	}
+
+	if err := s.restore(); err != nil {
+		return err
+	}
+
+	runCtx, cancel := context.WithCancel(context.Background())
+	s.cancel = cancel
+	s.running = true
+
+	s.wg.Add(1)
+	go s.run(runCtx)
+	return nil
+}
+
+// Stop halts delivery.
+func (s *scheduler) Stop(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.running {
+		s.mu.Unlock()
+		return nil
+	}
+	s.running = false
+	s.cancel()
+	s.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// add registers a new job.
+func (s *scheduler) add(msg touta.Message, due time.Time, expr string, schedule *CronSchedule) (string, error) {
+	if msg == nil {
+		return "", fmt.Errorf("message is required")
+	}
+
+	env, err := s.codec.Encode(msg)
+	if err != nil {
+		return "", err
+	}
+
+	j := &job{
+		entry: Entry{
+			ID:      message.NewID(),
+			Due:     due,
+			Cron:    expr,
+			Message: env,
+		},
+		msg:  msg,
+		cron: schedule,
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.jobs[j.entry.ID] = j
+	if err := s.persist(); err != nil {
+		delete(s.jobs, j.entry.ID)
+		return "", err
+	}
+
+	s.notify()
+	return j.entry.ID, nil
+}
+
+// restore loads jobs from the store. The caller must hold mu.
+func (s *scheduler) restore() error {
+	if s.store == nil {
+		return nil
+	}
+
+	entries, err := s.store.Load()
+	if err != nil {
+		return fmt.Errorf("failed to load schedules: %w", err)
+	}
+
+	for _, entry := range entries {
+		if _, ok := s.jobs[entry.ID]; ok {
+			continue
+		}
+
+		msg, err := s.codec.Decode(entry.Message)
+		if err != nil {
+			return fmt.Errorf("failed to restore schedule %s: %w", entry.ID, err)
+		}
+
+		j := &job{entry: entry, msg: msg}
+		if entry.Cron != "" {
+			if j.cron, err = ParseCron(entry.Cron); err != nil {
+				return fmt.Errorf("failed to restore schedule %s: %w", entry.ID, err)
+			}
+		}
+		s.jobs[entry.ID] = j
+	}
+
+	return s.persist()
+}
+
+// run is the delivery loop.
+func (s *scheduler) run(ctx context.Context) {
+	defer s.wg.Done()
+
+	for {
+		s.mu.Lock()
+		next, ok := s.nextDue()
+		s.mu.Unlock()
+
+		var timer Timer
+		var fire <-chan time.Time
+		if ok {
+			timer = s.clock.NewTimer(next.Sub(s.clock.Now()))
+			fire = timer.C()
+		}
+
+		select {
+		case <-ctx.Done():
+			if timer != nil {
+				timer.Stop()
+			}
+			return
+		case <-s.wake:
+			if timer != nil {
+				timer.Stop()
+			}
+		case <-fire:
+			s.deliver(ctx)
+		}
+	}
+}
+
+// deliver publishes every job that is due and reschedules cron jobs.
+// One-off jobs are only removed once Publish succeeded; after a failure
+// they are retried after the retry delay, so a stopped bus or a shutdown
+// never loses a persisted message.
+func (s *scheduler) deliver(ctx context.Context) {
+	now := s.clock.Now()
+
+	s.mu.Lock()
+	var due []*job
+	for id, j := range s.jobs {
+		if j.entry.Due.After(now) || j.delivering {
+			continue
+		}
+		due = append(due, j)
+
+		if j.cron == nil {
+			j.delivering = true
+			continue
+		}
+
+		// Skip runs missed while the scheduler was down
+		next := j.cron.Next(j.entry.Due)
+		if !next.After(now) {
+			next = j.cron.Next(now)
+		}
+		if next.IsZero() {
+			delete(s.jobs, id)
+			continue
+		}
+		updated := *j
+		updated.entry.Due = next
+		s.jobs[id] = &updated
+	}
+	if err := s.persist(); err != nil {
+		log.Printf("scheduler: failed to persist schedules: %v", err)
+	}
+	s.mu.Unlock()
+
+	sort.Slice(due, func(i, k int) bool {
+		return due[i].entry.Due.Before(due[k].entry.Due)
+	})
+
+	for _, j := range due {
+		msg, err := s.message(j)
+		if err == nil {
+			err = s.bus.Publish(ctx, msg)
+		}
+		if j.cron == nil {
+			s.settle(j, err)
+		}
+		if err != nil {
+			s.onError(j.entry, err)
+		}
+	}
+}
+
+// message returns a fresh message for one delivery of j, so every
+// delivery gets its own message ID and trace. The job's message is copied
+// when possible and decoded from its entry otherwise.
+func (s *scheduler) message(j *job) (touta.Message, error) {
+	msg, ok := message.Copy(j.msg)
+	if !ok {
+		var err error
+		if msg, err = s.codec.Decode(j.entry.Message); err != nil {
+			return nil, err
+		}
+	}
+	if j.cron != nil {
+		// Every run of a cron job is a new message
+		if meta := msg.Metadata(); meta != nil {
+			delete(meta, message.MetaMessageID)
+			delete(meta, message.MetaTraceParent)
+		}
+	}
+	return msg, nil
+}
+
+// settle removes a delivered one-off job, or reschedules it after the
+// retry delay when its delivery failed.
+func (s *scheduler) settle(j *job, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.jobs[j.entry.ID] != j {
+		return // cancelled while it was being delivered
+	}
+	if err == nil {
+		delete(s.jobs, j.entry.ID)
+	} else {
+		retry := *j
+		retry.delivering = false
+		retry.entry.Due = s.clock.Now().Add(s.retryDelay)
+		s.jobs[j.entry.ID] = &retry
+		s.notify()
+	}
+	if err := s.persist(); err != nil {
+		log.Printf("scheduler: failed to persist schedules: %v", err)
+	}
+}
+
+// nextDue returns the earliest due time. The caller must hold mu.
+func (s *scheduler) nextDue() (time.Time, bool) {
+	var next time.Time
+	found := false
+	for _, j := range s.jobs {
+		if !found || j.entry.Due.Before(next) {
+			next = j.entry.Due
+			found = true
+		}
+	}
+	return next, found
+}
+
+// entries returns all entries ordered by due time. The caller must hold mu.
+func (s *scheduler) entries() []Entry {
+	entries := make([]Entry, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		entries = append(entries, j.entry)
+	}
+	sort.Slice(entries, func(i, k int) bool {
+		return entries[i].Due.Before(entries[k].Due)
+	})
+	return entries
+}
+
+// persist saves all entries to the store. The caller must hold mu.
+func (s *scheduler) persist() error {
+	if s.store == nil {
+		return nil
+	}
+	if err := s.store.Save(s.entries()); err != nil {
+		return fmt.Errorf("failed to persist schedules: %w", err)
+	}
+	return nil
+}
+
+// notify wakes the delivery loop so it picks up changed schedules.
+func (s *scheduler) notify() {
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
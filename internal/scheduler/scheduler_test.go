@@ -0,0 +1,280 @@
+package scheduler
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/toutaio/toutago/internal/message"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+type reminderMessage struct {
+	message.BaseMessage
+	UserID string `json:"user_id"`
+}
+
+func newReminder(userID string) *reminderMessage {
+	return &reminderMessage{
+		BaseMessage: message.BaseMessage{
+			MessageSlug: "reminder.send",
+			MessageType: "command",
+		},
+		UserID: userID,
+	}
+}
+
+// startBus returns a running bus and a channel receiving every reminder.
+func startBus(t *testing.T) (touta.MessageBus, chan touta.Message) {
+	t.Helper()
+
+	bus := message.NewBus()
+	if err := bus.Start(context.Background()); err != nil {
+		t.Fatalf("Failed to start bus: %v", err)
+	}
+	t.Cleanup(func() { bus.Stop(context.Background()) })
+
+	received := make(chan touta.Message, 10)
+	bus.Subscribe("reminder.send", message.HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		received <- msg
+		return nil, nil
+	}))
+	return bus, received
+}
+
+func expectMessage(t *testing.T, received chan touta.Message) touta.Message {
+	t.Helper()
+
+	select {
+	case msg := <-received:
+		return msg
+	case <-time.After(time.Second):
+		t.Fatal("Expected a message to be delivered")
+		return nil
+	}
+}
+
+func expectNoMessage(t *testing.T, received chan touta.Message) {
+	t.Helper()
+
+	select {
+	case msg := <-received:
+		t.Fatalf("Unexpected message %s", msg.Slug())
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestScheduler_PublishAfter(t *testing.T) {
+	bus, received := startBus(t)
+	clock := NewFakeClock(time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	s := NewScheduler(bus, WithClock(clock))
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop(context.Background())
+
+	if _, err := s.PublishAfter(context.Background(), newReminder("42"), 24*time.Hour); err != nil {
+		t.Fatalf("PublishAfter failed: %v", err)
+	}
+
+	clock.BlockUntil(1)
+	clock.Advance(23 * time.Hour)
+	expectNoMessage(t, received)
+
+	clock.Advance(time.Hour)
+	msg := expectMessage(t, received)
+	if msg.(*reminderMessage).UserID != "42" {
+		t.Errorf("Unexpected message delivered: %+v", msg)
+	}
+
+	if pending := s.Pending(); len(pending) != 0 {
+		t.Errorf("Expected no pending schedules, got %d", len(pending))
+	}
+}
+
+func TestScheduler_Cron(t *testing.T) {
+	bus, received := startBus(t)
+	clock := NewFakeClock(time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	s := NewScheduler(bus, WithClock(clock))
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop(context.Background())
+
+	if _, err := s.Cron("*/5 * * * *", newReminder("cron")); err != nil {
+		t.Fatalf("Cron failed: %v", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(5 * time.Minute)
+		expectMessage(t, received)
+	}
+
+	pending := s.Pending()
+	if len(pending) != 1 {
+		t.Fatalf("Cron schedule should stay pending, got %d entries", len(pending))
+	}
+
+	want := time.Date(2026, time.January, 1, 0, 20, 0, 0, time.UTC)
+	if !pending[0].Due.Equal(want) {
+		t.Errorf("Expected next run at %s, got %s", want, pending[0].Due)
+	}
+}
+
+func TestScheduler_Cancel(t *testing.T) {
+	bus, received := startBus(t)
+	clock := NewFakeClock(time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	s := NewScheduler(bus, WithClock(clock))
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop(context.Background())
+
+	id, _ := s.PublishAfter(context.Background(), newReminder("42"), time.Minute)
+	if err := s.Cancel(id); err != nil {
+		t.Fatalf("Cancel failed: %v", err)
+	}
+
+	clock.BlockUntil(0)
+	clock.Advance(time.Hour)
+	expectNoMessage(t, received)
+
+	if err := s.Cancel(id); err == nil {
+		t.Error("Cancelling an unknown schedule should fail")
+	}
+}
+
+func TestScheduler_Persistence(t *testing.T) {
+	bus, received := startBus(t)
+	clock := NewFakeClock(time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC))
+	store := NewFileStore(filepath.Join(t.TempDir(), "schedules.json"))
+
+	first := NewScheduler(bus, WithClock(clock), WithStore(store))
+	if _, err := first.PublishAfter(context.Background(), newReminder("42"), time.Hour); err != nil {
+		t.Fatalf("PublishAfter failed: %v", err)
+	}
+	if _, err := first.Cron("@daily", newReminder("daily")); err != nil {
+		t.Fatalf("Cron failed: %v", err)
+	}
+
+	// Simulate a restart: a fresh scheduler picks up the stored schedules
+	codec := message.NewCodec()
+	codec.Register(newReminder(""))
+
+	second := NewScheduler(bus, WithClock(clock), WithStore(store), WithCodec(codec))
+	if err := second.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer second.Stop(context.Background())
+
+	if pending := second.Pending(); len(pending) != 2 {
+		t.Fatalf("Expected 2 restored schedules, got %d", len(pending))
+	}
+
+	clock.BlockUntil(1)
+	clock.Advance(time.Hour)
+
+	msg := expectMessage(t, received)
+	reminder, ok := msg.(*reminderMessage)
+	if !ok || reminder.UserID != "42" {
+		t.Fatalf("Expected restored reminder, got %#v", msg)
+	}
+
+	entries, err := store.Load()
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if len(entries) != 1 || entries[0].Cron != "@daily" {
+		t.Errorf("Store should only keep the cron schedule, got %+v", entries)
+	}
+}
+
+func TestScheduler_CronDeliversFreshMessages(t *testing.T) {
+	bus, received := startBus(t)
+	clock := NewFakeClock(time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC))
+
+	s := NewScheduler(bus, WithClock(clock))
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop(context.Background())
+
+	msg := newReminder("cron")
+	if _, err := s.Cron("*/5 * * * *", msg); err != nil {
+		t.Fatalf("Cron failed: %v", err)
+	}
+
+	ids := make(map[interface{}]bool)
+	for i := 0; i < 2; i++ {
+		clock.BlockUntil(1)
+		clock.Advance(5 * time.Minute)
+		delivered := expectMessage(t, received)
+		if delivered == touta.Message(msg) {
+			t.Fatal("each run should publish its own message")
+		}
+		ids[delivered.Metadata()[message.MetaMessageID]] = true
+	}
+	if len(ids) != 2 {
+		t.Errorf("each run should get its own message ID, got %v", ids)
+	}
+	if _, ok := msg.Metadata()[message.MetaMessageID]; ok {
+		t.Error("the registered message must not be stamped")
+	}
+}
+
+func TestScheduler_RetriesFailedDelivery(t *testing.T) {
+	bus := message.NewBus()
+	received := make(chan touta.Message, 1)
+	bus.Subscribe("reminder.send", message.HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		received <- msg
+		return nil, nil
+	}))
+	defer bus.Stop(context.Background())
+
+	clock := NewFakeClock(time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC))
+	store := NewMemoryStore()
+	failed := make(chan error, 1)
+	s := NewScheduler(bus, WithClock(clock), WithStore(store), WithRetryDelay(time.Minute),
+		WithErrorHandler(func(e Entry, err error) { failed <- err }))
+	if err := s.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	defer s.Stop(context.Background())
+
+	s.PublishAfter(context.Background(), newReminder("42"), time.Hour)
+
+	// The bus is not started yet, so the first delivery fails
+	clock.BlockUntil(1)
+	clock.Advance(time.Hour)
+	select {
+	case <-failed:
+	case <-time.After(time.Second):
+		t.Fatal("expected the delivery to fail")
+	}
+
+	clock.BlockUntil(1)
+	if entries, _ := store.Load(); len(entries) != 1 {
+		t.Fatalf("a failed delivery must stay persisted, got %+v", entries)
+	}
+
+	bus.Start(context.Background())
+	clock.Advance(time.Minute)
+	expectMessage(t, received)
+
+	// The entry is removed once Publish returned, which may be after the
+	// handler received the message
+	deadline := time.Now().Add(time.Second)
+	entries, _ := store.Load()
+	for len(entries) != 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+		entries, _ = store.Load()
+	}
+	if len(entries) != 0 {
+		t.Errorf("a delivered message should be removed, got %+v", entries)
+	}
+}
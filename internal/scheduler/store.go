@@ -0,0 +1,112 @@
+package scheduler
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/toutaio/toutago/internal/message"
+)
+
+// Entry is a pending scheduled delivery.
+type Entry struct {
+	ID      string           `json:"id"`
+	Due     time.Time        `json:"due"`
+	Cron    string           `json:"cron,omitempty"` // empty for one-off deliveries
+	Message message.Envelope `json:"message"`
+}
+
+// Store persists pending entries so schedules survive restarts.
+type Store interface {
+	// Load returns all persisted entries
+	Load() ([]Entry, error)
+
+	// Save replaces the persisted entries
+	Save(entries []Entry) error
+}
+
+// memoryStore implements Store in memory.
+type memoryStore struct {
+	entries []Entry
+	mu      sync.RWMutex
+}
+
+// NewMemoryStore creates an in-memory store, mainly useful in tests.
+func NewMemoryStore() Store {
+	return &memoryStore{}
+}
+
+// Load returns a copy of the stored entries.
+func (s *memoryStore) Load() ([]Entry, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]Entry(nil), s.entries...), nil
+}
+
+// Save replaces the stored entries.
+func (s *memoryStore) Save(entries []Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.entries = append([]Entry(nil), entries...)
+	return nil
+}
+
+// fileStore implements Store as a JSON file.
+type fileStore struct {
+	path string
+	mu   sync.Mutex
+}
+
+// NewFileStore creates a store that keeps entries in a JSON file.
+func NewFileStore(path string) Store {
+	return &fileStore{path: path}
+}
+
+// Load reads entries from the file. A missing file yields no entries.
+func (s *fileStore) Load() ([]Entry, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := os.ReadFile(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read schedule file: %w", err)
+	}
+
+	var entries []Entry
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse schedule file: %w", err)
+	}
+	return entries, nil
+}
+
+// Save atomically rewrites the file.
+func (s *fileStore) Save(entries []Entry) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := json.MarshalIndent(entries, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode schedules: %w", err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(s.path), 0755); err != nil {
+		return fmt.Errorf("failed to create schedule directory: %w", err)
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0644); err != nil {
+		return fmt.Errorf("failed to write schedule file: %w", err)
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return fmt.Errorf("failed to replace schedule file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,457 @@
+// Package server runs HTTP servers configured by touta.ServerConfig, with
+// TLS, HTTP/2, HTTP to HTTPS redirects, graceful shutdown and Unix socket
+// or systemd socket activation support.
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/toutaio/toutago/pkg/touta"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+// Defaults used when ServerConfig leaves a timeout at zero.
+const (
+	DefaultReadTimeout     = 15 * time.Second
+	DefaultWriteTimeout    = 15 * time.Second
+	DefaultIdleTimeout     = 60 * time.Second
+	DefaultShutdownTimeout = 30 * time.Second
+)
+
+// DefaultPort is the port listened on when neither an address nor
+// ServerConfig.Port is given.
+const DefaultPort = 8080
+
+// unixPrefix marks a Host as a Unix socket path, e.g. unix:/run/app.sock.
+const unixPrefix = "unix:"
+
+// Option configures a Server.
+type Option func(*Server)
+
+// WithAddr listens on addr, host:port or unix:/path, instead of the
+// configured Host and Port.
+func WithAddr(addr string) Option {
+	return func(s *Server) {
+		s.addr = addr
+	}
+}
+
+// WithListener serves on l instead of opening a listener. It can be given
+// several times.
+func WithListener(l net.Listener) Option {
+	return func(s *Server) {
+		s.listeners = append(s.listeners, l)
+	}
+}
+
+// WithMode sets the framework mode. Outside production a self-signed
+// certificate is generated when TLS is enabled without certificate files.
+func WithMode(mode string) Option {
+	return func(s *Server) {
+		s.mode = mode
+	}
+}
+
+// WithRedirectHTTP also listens for plain HTTP on addr and redirects every
+// request to HTTPS, overriding TLSConfig.RedirectAddr. It only applies when
+// TLS is enabled.
+func WithRedirectHTTP(addr string) Option {
+	return func(s *Server) {
+		s.redirectAddr = addr
+	}
+}
+
+// WithHTTP2 enables or disables HTTP/2 over TLS. It is enabled by default.
+func WithHTTP2(enabled bool) Option {
+	return func(s *Server) {
+		s.http2 = enabled
+	}
+}
+
+// WithH2C enables or disables HTTP/2 without TLS (h2c), both with prior
+// knowledge and by upgrading HTTP/1.1 requests. It only applies when TLS is
+// disabled.
+func WithH2C(enabled bool) Option {
+	return func(s *Server) {
+		s.h2c = enabled
+	}
+}
+
+// WithShutdownTimeout bounds how long Run waits for connections to drain.
+func WithShutdownTimeout(d time.Duration) Option {
+	return func(s *Server) {
+		s.shutdownTimeout = d
+	}
+}
+
+// WithLogger sets the logger for server lifecycle messages.
+func WithLogger(logger *log.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// Server serves a handler on one or more listeners.
+type Server struct {
+	handler         http.Handler
+	cfg             touta.ServerConfig
+	addr            string
+	mode            string
+	redirectAddr    string
+	http2           bool
+	h2c             bool
+	shutdownTimeout time.Duration
+	listeners       []net.Listener
+	logger          *log.Logger
+
+	mu       sync.Mutex
+	servers  []*http.Server
+	shutdown bool
+}
+
+// New creates a server for handler configured by cfg.
+func New(handler http.Handler, cfg touta.ServerConfig, opts ...Option) *Server {
+	s := &Server{
+		handler:         handler,
+		cfg:             cfg,
+		redirectAddr:    cfg.TLS.RedirectAddr,
+		http2:           true,
+		shutdownTimeout: DefaultShutdownTimeout,
+		logger:          log.Default(),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// ListenAndServe listens and serves until Shutdown is called, returning nil
+// after a graceful shutdown. Listeners passed by systemd socket activation
+// take precedence over the configured address.
+func (s *Server) ListenAndServe() error {
+	tlsConfig, err := s.tlsConfig()
+	if err != nil {
+		return err
+	}
+
+	listeners, err := s.listen()
+	if err != nil {
+		return err
+	}
+
+	handler := s.handler
+	if s.h2c && tlsConfig == nil {
+		handler = h2c.NewHandler(handler, &http2.Server{
+			IdleTimeout: seconds(s.cfg.IdleTimeout, DefaultIdleTimeout),
+		})
+	}
+
+	type served struct {
+		srv *http.Server
+		l   net.Listener
+		tls bool
+	}
+	var all []served
+	for _, l := range listeners {
+		srv := s.newHTTPServer(handler)
+		srv.TLSConfig = tlsConfig
+		all = append(all, served{srv: srv, l: l, tls: tlsConfig != nil})
+	}
+	if tlsConfig != nil && s.redirectAddr != "" {
+		l, err := net.Listen("tcp", s.redirectAddr)
+		if err != nil {
+			closeAll(listeners)
+			return fmt.Errorf("failed to listen for HTTP redirects on %s: %w", s.redirectAddr, err)
+		}
+		all = append(all, served{srv: s.newHTTPServer(redirectHandler(httpsPort(listeners))), l: l})
+	}
+
+	s.mu.Lock()
+	if s.shutdown {
+		s.mu.Unlock()
+		for _, sv := range all {
+			sv.l.Close()
+		}
+		return nil
+	}
+	for _, sv := range all {
+		s.servers = append(s.servers, sv.srv)
+	}
+	s.mu.Unlock()
+
+	errCh := make(chan error, len(all))
+	for _, sv := range all {
+		sv := sv
+		scheme := "http"
+		if sv.tls {
+			scheme = "https"
+		}
+		s.logger.Printf("server: listening on %s://%s", scheme, sv.l.Addr())
+
+		go func() {
+			var err error
+			if sv.tls {
+				err = sv.srv.ServeTLS(sv.l, "", "")
+			} else {
+				err = sv.srv.Serve(sv.l)
+			}
+			if errors.Is(err, http.ErrServerClosed) {
+				err = nil
+			}
+			errCh <- err
+		}()
+	}
+
+	// A failing listener stops the others, so the server never runs partially
+	var first error
+	for range all {
+		if err := <-errCh; err != nil && first == nil {
+			first = err
+			go s.Shutdown(context.Background())
+		}
+	}
+	return first
+}
+
+// Shutdown stops accepting connections and waits for active requests to
+// finish or ctx to expire.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	s.shutdown = true
+	servers := s.servers
+	s.mu.Unlock()
+
+	var errs []error
+	for _, srv := range servers {
+		if err := srv.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run serves until ctx is cancelled or the process receives SIGINT or
+// SIGTERM, then shuts down gracefully within the shutdown timeout.
+func (s *Server) Run(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- s.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	s.logger.Printf("server: shutting down, draining connections for up to %s", s.shutdownTimeout)
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), s.shutdownTimeout)
+	defer cancel()
+
+	shutdownErr := s.Shutdown(shutdownCtx)
+	if err := <-errCh; err != nil {
+		return err
+	}
+	if shutdownErr != nil {
+		return fmt.Errorf("failed to shut down gracefully: %w", shutdownErr)
+	}
+	return nil
+}
+
+// newHTTPServer creates an http.Server with the configured limits.
+func (s *Server) newHTTPServer(handler http.Handler) *http.Server {
+	srv := &http.Server{
+		Handler:        handler,
+		ReadTimeout:    seconds(s.cfg.ReadTimeout, DefaultReadTimeout),
+		WriteTimeout:   seconds(s.cfg.WriteTimeout, DefaultWriteTimeout),
+		IdleTimeout:    seconds(s.cfg.IdleTimeout, DefaultIdleTimeout),
+		MaxHeaderBytes: s.cfg.MaxHeaderBytes,
+		ErrorLog:       s.logger,
+	}
+	if !s.http2 {
+		// A non-nil empty map disables HTTP/2 over TLS
+		srv.TLSNextProto = make(map[string]func(*http.Server, *tls.Conn, http.Handler))
+	}
+	return srv
+}
+
+// tlsConfig loads the TLS certificate, or returns nil when TLS is disabled.
+func (s *Server) tlsConfig() (*tls.Config, error) {
+	if !s.cfg.TLS.Enabled {
+		return nil, nil
+	}
+
+	var cert tls.Certificate
+	var err error
+	switch {
+	case s.cfg.TLS.CertFile != "" || s.cfg.TLS.KeyFile != "":
+		cert, err = tls.LoadX509KeyPair(s.cfg.TLS.CertFile, s.cfg.TLS.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+	case s.mode == "production":
+		return nil, fmt.Errorf("TLS is enabled but no cert_file and key_file are configured")
+	default:
+		cert, err = SelfSignedCertificate(s.host())
+		if err != nil {
+			return nil, err
+		}
+		s.logger.Printf("server: using a self-signed certificate for development")
+	}
+
+	return &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	}, nil
+}
+
+// listen returns the listeners to serve on: injected ones, then systemd
+// activated ones, then the configured address.
+func (s *Server) listen() ([]net.Listener, error) {
+	if len(s.listeners) > 0 {
+		return s.listeners, nil
+	}
+
+	activated, err := systemdListeners()
+	if err != nil {
+		return nil, err
+	}
+	if len(activated) > 0 {
+		return activated, nil
+	}
+
+	addr := s.address()
+	if path, ok := strings.CutPrefix(addr, unixPrefix); ok {
+		// Remove a socket left behind by a previous run
+		if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+			os.Remove(path)
+		}
+		l, err := net.Listen("unix", path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to listen on unix socket %s: %w", path, err)
+		}
+		return []net.Listener{l}, nil
+	}
+
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to listen on %s: %w", addr, err)
+	}
+	return []net.Listener{l}, nil
+}
+
+// address returns the configured listen address, using DefaultPort when
+// no port is configured.
+func (s *Server) address() string {
+	if s.addr != "" {
+		return s.addr
+	}
+	if strings.HasPrefix(s.cfg.Host, unixPrefix) {
+		return s.cfg.Host
+	}
+	port := s.cfg.Port
+	if port == 0 {
+		port = DefaultPort
+	}
+	return net.JoinHostPort(s.cfg.Host, strconv.Itoa(port))
+}
+
+// host returns the host name certificates are generated for.
+func (s *Server) host() string {
+	host, _, err := net.SplitHostPort(s.address())
+	if err != nil || host == "" {
+		return "localhost"
+	}
+	return host
+}
+
+// systemdListeners returns the sockets passed by systemd socket activation,
+// as described by the LISTEN_PID and LISTEN_FDS environment variables.
+func systemdListeners() ([]net.Listener, error) {
+	if os.Getenv("LISTEN_PID") != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+
+	// Child processes must not inherit the activation
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	os.Unsetenv("LISTEN_FDNAMES")
+
+	const firstFD = 3
+	return fileListeners(firstFD, count)
+}
+
+// fileListeners creates listeners for count consecutive file descriptors.
+func fileListeners(first, count int) ([]net.Listener, error) {
+	listeners := make([]net.Listener, 0, count)
+	for fd := first; fd < first+count; fd++ {
+		f := os.NewFile(uintptr(fd), "listen-fd-"+strconv.Itoa(fd))
+		l, err := net.FileListener(f)
+		f.Close()
+		if err != nil {
+			closeAll(listeners)
+			return nil, fmt.Errorf("failed to use file descriptor %d as a listener: %w", fd, err)
+		}
+		listeners = append(listeners, l)
+	}
+	return listeners, nil
+}
+
+// redirectHandler redirects requests to the same URL over HTTPS.
+func redirectHandler(port string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		host := req.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+		http.Redirect(w, req, "https://"+host+req.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
+
+// httpsPort returns the port of the first TCP listener.
+func httpsPort(listeners []net.Listener) string {
+	for _, l := range listeners {
+		if addr, ok := l.Addr().(*net.TCPAddr); ok {
+			return strconv.Itoa(addr.Port)
+		}
+	}
+	return ""
+}
+
+func closeAll(listeners []net.Listener) {
+	for _, l := range listeners {
+		l.Close()
+	}
+}
+
+// seconds converts a config value in seconds, using def for zero.
+func seconds(n int, def time.Duration) time.Duration {
+	if n == 0 {
+		return def
+	}
+	return time.Duration(n) * time.Second
+}
@@ -0,0 +1,293 @@
+package server
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/toutaio/toutago/pkg/touta"
+	"golang.org/x/net/http2"
+)
+
+var quiet = WithLogger(log.New(io.Discard, "", 0))
+
+// start serves s in the background and returns a channel with its result.
+func start(t *testing.T, s *Server) chan error {
+	t.Helper()
+	done := make(chan error, 1)
+	go func() {
+		done <- s.ListenAndServe()
+	}()
+	t.Cleanup(func() {
+		s.Shutdown(context.Background())
+	})
+	return done
+}
+
+func listen(t *testing.T) net.Listener {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen failed: %v", err)
+	}
+	t.Cleanup(func() { l.Close() })
+	return l
+}
+
+func TestServer_ConfigLimits(t *testing.T) {
+	s := New(http.NotFoundHandler(), touta.ServerConfig{ReadTimeout: 5, IdleTimeout: 120, MaxHeaderBytes: 4096})
+	srv := s.newHTTPServer(s.handler)
+
+	if srv.ReadTimeout != 5*time.Second || srv.WriteTimeout != DefaultWriteTimeout ||
+		srv.IdleTimeout != 2*time.Minute || srv.MaxHeaderBytes != 4096 {
+		t.Errorf("Unexpected server limits %+v", srv)
+	}
+}
+
+func TestServer_GracefulShutdown(t *testing.T) {
+	started := make(chan struct{})
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		close(started)
+		time.Sleep(100 * time.Millisecond)
+		w.Write([]byte("done"))
+	})
+
+	l := listen(t)
+	s := New(handler, touta.ServerConfig{}, WithListener(l), quiet)
+	done := start(t, s)
+
+	result := make(chan string, 1)
+	go func() {
+		resp, err := http.Get("http://" + l.Addr().String())
+		if err != nil {
+			result <- err.Error()
+			return
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		result <- string(body)
+	}()
+
+	<-started
+	if err := s.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+	if got := <-result; got != "done" {
+		t.Errorf("In-flight requests should complete during shutdown, got %q", got)
+	}
+	if err := <-done; err != nil {
+		t.Errorf("ListenAndServe should return nil after shutdown, got %v", err)
+	}
+}
+
+func TestServer_TLSSelfSignedHTTP2(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+
+	l := listen(t)
+	s := New(handler, touta.ServerConfig{TLS: touta.TLSConfig{Enabled: true}}, WithListener(l), quiet)
+	start(t, s)
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+		ForceAttemptHTTP2: true,
+	}}
+	var resp *http.Response
+	var err error
+	for i := 0; i < 50; i++ {
+		if resp, err = client.Get("https://" + l.Addr().String()); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("HTTPS request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if body, _ := io.ReadAll(resp.Body); string(body) != "HTTP/2.0" {
+		t.Errorf("Expected HTTP/2 over TLS, got %s", body)
+	}
+}
+
+func TestServer_ProductionRequiresCertificate(t *testing.T) {
+	s := New(http.NotFoundHandler(), touta.ServerConfig{TLS: touta.TLSConfig{Enabled: true}}, WithMode("production"), WithListener(listen(t)), quiet)
+	if err := s.ListenAndServe(); err == nil {
+		t.Error("Expected an error for TLS without certificates in production")
+	}
+}
+
+func TestServer_UnixSocket(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.sock")
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("unix"))
+	})
+
+	s := New(handler, touta.ServerConfig{Host: "unix:" + path}, quiet)
+	start(t, s)
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", path)
+		},
+	}}
+	var resp *http.Response
+	var err error
+	for i := 0; i < 50; i++ {
+		if resp, err = client.Get("http://app/"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("Request over unix socket failed: %v", err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); string(body) != "unix" {
+		t.Errorf("Unexpected body %q", body)
+	}
+}
+
+func TestFileListeners(t *testing.T) {
+	l := listen(t).(*net.TCPListener)
+	defer l.Close()
+	f, err := l.File()
+	if err != nil {
+		t.Fatalf("File failed: %v", err)
+	}
+
+	listeners, err := fileListeners(int(f.Fd()), 1)
+	if err != nil {
+		t.Fatalf("fileListeners failed: %v", err)
+	}
+	defer closeAll(listeners)
+	if listeners[0].Addr().String() != l.Addr().String() {
+		t.Errorf("Expected a listener on %s, got %s", l.Addr(), listeners[0].Addr())
+	}
+}
+
+func TestRedirectHandler(t *testing.T) {
+	tests := []struct {
+		port     string
+		host     string
+		location string
+	}{
+		{"443", "example.com", "https://example.com/a?b=1"},
+		{"8443", "example.com:8080", "https://example.com:8443/a?b=1"},
+	}
+
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "http://"+tt.host+"/a?b=1", nil)
+		w := httptest.NewRecorder()
+		redirectHandler(tt.port).ServeHTTP(w, req)
+
+		if w.Code != http.StatusPermanentRedirect || w.Header().Get("Location") != tt.location {
+			t.Errorf("Expected redirect to %s, got %d %s", tt.location, w.Code, w.Header().Get("Location"))
+		}
+	}
+}
+
+func TestServer_RunStopsOnContextCancel(t *testing.T) {
+	s := New(http.NotFoundHandler(), touta.ServerConfig{}, WithListener(listen(t)), quiet)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Run(ctx)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("Run should return nil after a graceful shutdown, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("Run did not return after cancellation")
+	}
+}
+
+func TestServer_H2C(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.Proto))
+	})
+
+	l := listen(t)
+	s := New(handler, touta.ServerConfig{}, WithListener(l), WithH2C(true), quiet)
+	start(t, s)
+
+	// Prior knowledge HTTP/2 over a plain TCP connection
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, _ *tls.Config) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, network, addr)
+		},
+	}}
+	resp, err := client.Get("http://" + l.Addr().String())
+	if err != nil {
+		t.Fatalf("h2c request failed: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if body, _ := io.ReadAll(resp.Body); string(body) != "HTTP/2.0" {
+		t.Errorf("Expected HTTP/2 without TLS, got %s", body)
+	}
+}
+
+func TestServer_RedirectFromConfig(t *testing.T) {
+	redirect := listen(t)
+	addr := redirect.Addr().String()
+	redirect.Close()
+
+	l := listen(t)
+	s := New(http.NotFoundHandler(), touta.ServerConfig{TLS: touta.TLSConfig{Enabled: true, RedirectAddr: addr}}, WithListener(l), quiet)
+	start(t, s)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	var resp *http.Response
+	var err error
+	for i := 0; i < 50; i++ {
+		if resp, err = client.Get("http://" + addr + "/a"); err == nil {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err != nil {
+		t.Fatalf("HTTP request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	_, port, _ := net.SplitHostPort(l.Addr().String())
+	if want := "https://127.0.0.1:" + port + "/a"; resp.Header.Get("Location") != want {
+		t.Errorf("Expected redirect to %s, got %d %s", want, resp.StatusCode, resp.Header.Get("Location"))
+	}
+}
+
+func TestServer_Address(t *testing.T) {
+	tests := []struct {
+		cfg  touta.ServerConfig
+		addr string
+	}{
+		{touta.ServerConfig{}, ":8080"},
+		{touta.ServerConfig{Host: "127.0.0.1"}, "127.0.0.1:8080"},
+		{touta.ServerConfig{Host: "0.0.0.0", Port: 3000}, "0.0.0.0:3000"},
+		{touta.ServerConfig{Host: "unix:/run/app.sock"}, "unix:/run/app.sock"},
+	}
+
+	for _, tt := range tests {
+		if got := New(http.NotFoundHandler(), tt.cfg).address(); got != tt.addr {
+			t.Errorf("Expected address %s for %+v, got %s", tt.addr, tt.cfg, got)
+		}
+	}
+}
@@ -0,0 +1,421 @@
+// Package static serves static files from directories, embed.FS or any
+// fs.FS, with HTTP caching, precompressed variants, SPA fallback and
+// content-hashed asset URLs.
+package static
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// immutableCache is sent for content-hashed URLs, which never change.
+const immutableCache = "public, max-age=31536000, immutable"
+
+// hashLength is the number of hex digits of the content hash in asset URLs.
+const hashLength = 8
+
+// Precompressed variants, in order of preference.
+var precompressed = []struct {
+	encoding string
+	ext      string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// Option configures a FileServer.
+type Option func(*FileServer)
+
+// WithPrefix sets the URL path the files are served under, used by Mount
+// and AssetURL.
+func WithPrefix(prefix string) Option {
+	return func(s *FileServer) {
+		s.prefix = "/" + strings.Trim(prefix, "/")
+	}
+}
+
+// WithMaxAge sets the Cache-Control max-age in seconds. Without it files
+// are served with no-cache, so clients revalidate with ETags.
+func WithMaxAge(seconds int) Option {
+	return func(s *FileServer) {
+		s.maxAge = seconds
+	}
+}
+
+// WithSPAFallback serves index, e.g. index.html, for unknown paths that do
+// not look like files, so client side routers can handle them.
+func WithSPAFallback(index string) Option {
+	return func(s *FileServer) {
+		s.fallback = index
+	}
+}
+
+// WithDirectoryListing enables listings for directories without an
+// index.html. Listings are disabled by default.
+func WithDirectoryListing(enabled bool) Option {
+	return func(s *FileServer) {
+		s.listing = enabled
+	}
+}
+
+// FileServer serves the files of an fs.FS.
+type FileServer struct {
+	fsys     fs.FS
+	prefix   string
+	maxAge   int
+	fallback string
+	listing  bool
+
+	mu     sync.Mutex
+	hashes map[string]fileHash
+}
+
+// fileHash caches the content hash of a file until it changes.
+type fileHash struct {
+	modTime time.Time
+	size    int64
+	hash    string
+}
+
+// New creates a FileServer for fsys, such as an embed.FS or os.DirFS.
+// Use fs.Sub to serve a subdirectory of an embed.FS.
+func New(fsys fs.FS, opts ...Option) *FileServer {
+	s := &FileServer{
+		fsys:   fsys,
+		prefix: "/",
+		hashes: make(map[string]fileHash),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// FromConfig creates a FileServer for a static entry of touta.yaml.
+func FromConfig(cfg touta.StaticConfig) (*FileServer, error) {
+	info, err := os.Stat(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("static directory for %s: %w", cfg.Path, err)
+	}
+	if !info.IsDir() {
+		return nil, fmt.Errorf("static path %s: %s is not a directory", cfg.Path, cfg.Dir)
+	}
+	return New(os.DirFS(cfg.Dir), WithPrefix(cfg.Path), WithMaxAge(cfg.MaxAge)), nil
+}
+
+// Mount registers s on r under its prefix, for GET and HEAD requests.
+func Mount(r touta.Router, s *FileServer) {
+	pattern := strings.TrimSuffix(s.prefix, "/") + "/*"
+	r.Match([]string{http.MethodGet, http.MethodHead}, pattern, func(ctx touta.Context) error {
+		return s.serve(ctx.Response(), ctx.Request(), ctx.Param("*"))
+	})
+}
+
+// MountConfig creates and mounts a FileServer for every static entry of
+// touta.yaml. Routers created with app.NewRouter call it themselves; call
+// it directly to get the servers' asset helpers. The servers are returned so their asset helpers can be
+// registered with the template renderer.
+func MountConfig(r touta.Router, cfgs []touta.StaticConfig) ([]*FileServer, error) {
+	servers := make([]*FileServer, 0, len(cfgs))
+	for _, cfg := range cfgs {
+		s, err := FromConfig(cfg)
+		if err != nil {
+			return nil, err
+		}
+		Mount(r, s)
+		servers = append(servers, s)
+	}
+	return servers, nil
+}
+
+// ServeHTTP serves the file named by the request path below the prefix.
+func (s *FileServer) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	name := strings.TrimPrefix(req.URL.Path, strings.TrimSuffix(s.prefix, "/"))
+	if err := s.serve(w, req, name); err != nil {
+		var httpErr *touta.HTTPError
+		if errors.As(err, &httpErr) {
+			http.Error(w, httpErr.Message, httpErr.Status)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+	}
+}
+
+// serve writes the file name, relative to the root of the file system.
+// Missing files are reported as a 404 HTTPError.
+func (s *FileServer) serve(w http.ResponseWriter, req *http.Request, name string) error {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		return touta.NewHTTPError(http.StatusMethodNotAllowed, "")
+	}
+
+	name = clean(name)
+	cacheControl := s.cacheControl()
+
+	info, err := fs.Stat(s.fsys, name)
+	if errors.Is(err, fs.ErrNotExist) {
+		if original, ok := s.unhash(name); ok {
+			name, cacheControl = original, immutableCache
+			info, err = fs.Stat(s.fsys, name)
+		} else if s.fallback != "" && path.Ext(name) == "" {
+			name, cacheControl = s.fallback, "no-cache"
+			info, err = fs.Stat(s.fsys, name)
+		}
+	}
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return touta.NewHTTPError(http.StatusNotFound, "")
+		}
+		return fmt.Errorf("failed to stat %s: %w", name, err)
+	}
+
+	if info.IsDir() {
+		index := path.Join(name, "index.html")
+		if indexInfo, err := fs.Stat(s.fsys, index); err == nil && !indexInfo.IsDir() {
+			name, info = index, indexInfo
+		} else if s.listing {
+			if !strings.HasSuffix(req.URL.Path, "/") {
+				// Relative links in the listing need the trailing slash
+				http.Redirect(w, req, req.URL.Path+"/", http.StatusMovedPermanently)
+				return nil
+			}
+			return s.serveListing(w, req, name)
+		} else {
+			return touta.NewHTTPError(http.StatusNotFound, "")
+		}
+	}
+
+	header := w.Header()
+	header.Set("Cache-Control", cacheControl)
+	header.Add("Vary", "Accept-Encoding")
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		header.Set("Content-Type", ctype)
+	}
+
+	// Prefer a precompressed variant the client accepts
+	file, served := name, info
+	for _, variant := range precompressed {
+		if !acceptsEncoding(req.Header.Get("Accept-Encoding"), variant.encoding) {
+			continue
+		}
+		if vinfo, err := fs.Stat(s.fsys, name+variant.ext); err == nil && !vinfo.IsDir() {
+			file, served = name+variant.ext, vinfo
+			header.Set("Content-Encoding", variant.encoding)
+			break
+		}
+	}
+
+	if header.Get("Content-Type") == "" && file != name {
+		header.Set("Content-Type", "application/octet-stream")
+	}
+
+	content, err := s.open(file)
+	if err != nil {
+		return err
+	}
+	defer content.Close()
+	hash, err := s.hash(file, served)
+	if err != nil {
+		return err
+	}
+	header.Set("ETag", `"`+hash+`"`)
+
+	http.ServeContent(w, req, name, served.ModTime(), content)
+	return nil
+}
+
+// cacheControl returns the Cache-Control header for regular files.
+func (s *FileServer) cacheControl() string {
+	if s.maxAge > 0 {
+		return "public, max-age=" + strconv.Itoa(s.maxAge)
+	}
+	return "no-cache"
+}
+
+// open returns the content of name as a ReadSeeker for http.ServeContent.
+// Files that cannot seek are read into memory.
+func (s *FileServer) open(name string) (io.ReadSeekCloser, error) {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	if rs, ok := f.(io.ReadSeekCloser); ok {
+		return rs, nil
+	}
+
+	defer f.Close()
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", name, err)
+	}
+	return nopCloser{bytes.NewReader(data)}, nil
+}
+
+type nopCloser struct{ io.ReadSeeker }
+
+func (nopCloser) Close() error { return nil }
+
+// hash returns the content hash of name, recomputing it when the file's
+// size or modification time changed.
+func (s *FileServer) hash(name string, info fs.FileInfo) (string, error) {
+	s.mu.Lock()
+	cached, ok := s.hashes[name]
+	s.mu.Unlock()
+	if ok && cached.size == info.Size() && cached.modTime.Equal(info.ModTime()) {
+		return cached.hash, nil
+	}
+
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return "", fmt.Errorf("failed to open %s: %w", name, err)
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", fmt.Errorf("failed to hash %s: %w", name, err)
+	}
+	sum := hex.EncodeToString(h.Sum(nil))[:16]
+
+	s.mu.Lock()
+	s.hashes[name] = fileHash{modTime: info.ModTime(), size: info.Size(), hash: sum}
+	s.mu.Unlock()
+	return sum, nil
+}
+
+// AssetURL returns the URL of name with its content hash in the file name,
+// e.g. /static/app.3f2a9c1b.css for app.css. The server maps hashed names
+// back to the file and serves them with an immutable Cache-Control, so the
+// URL changes whenever the content does.
+func (s *FileServer) AssetURL(name string) (string, error) {
+	name = clean(name)
+	info, err := fs.Stat(s.fsys, name)
+	if err != nil {
+		return "", fmt.Errorf("asset %s: %w", name, err)
+	}
+	if info.IsDir() {
+		return "", fmt.Errorf("asset %s is a directory", name)
+	}
+	hash, err := s.hash(name, info)
+	if err != nil {
+		return "", err
+	}
+
+	ext := path.Ext(name)
+	hashed := strings.TrimSuffix(name, ext) + "." + hash[:hashLength] + ext
+	return path.Join(s.prefix, hashed), nil
+}
+
+// FuncMap returns the template function "asset", which renders AssetURL:
+//
+//	<link rel="stylesheet" href="{{ asset "css/app.css" }}">
+func (s *FileServer) FuncMap() template.FuncMap {
+	return template.FuncMap{"asset": s.AssetURL}
+}
+
+// unhash maps a content-hashed name back to the file it was built from,
+// provided the hash still matches the file's content.
+func (s *FileServer) unhash(name string) (string, bool) {
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	dot := strings.LastIndex(stem, ".")
+	if dot < 0 || len(stem)-dot-1 != hashLength {
+		return "", false
+	}
+
+	original := stem[:dot] + ext
+	info, err := fs.Stat(s.fsys, original)
+	if err != nil || info.IsDir() {
+		return "", false
+	}
+	hash, err := s.hash(original, info)
+	if err != nil || hash[:hashLength] != stem[dot+1:] {
+		return "", false
+	}
+	return original, true
+}
+
+var listingPage = template.Must(template.New("listing").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Index of {{.Path}}</title></head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<ul>
+{{- range .Entries}}
+<li><a href="{{.}}">{{.}}</a></li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
+
+// serveListing writes an HTML listing of the directory name.
+func (s *FileServer) serveListing(w http.ResponseWriter, req *http.Request, name string) error {
+	entries, err := fs.ReadDir(s.fsys, name)
+	if err != nil {
+		return fmt.Errorf("failed to list %s: %w", name, err)
+	}
+
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if entry.IsDir() {
+			names = append(names, entry.Name()+"/")
+		} else {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Strings(names)
+
+	var buf bytes.Buffer
+	if err := listingPage.Execute(&buf, map[string]interface{}{"Path": req.URL.Path, "Entries": names}); err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-cache")
+	_, err = w.Write(buf.Bytes())
+	return err
+}
+
+// clean turns a request path into a valid fs.FS name.
+func clean(name string) string {
+	name = strings.TrimPrefix(path.Clean("/"+name), "/")
+	if name == "" {
+		return "."
+	}
+	return name
+}
+
+// acceptsEncoding reports whether an Accept-Encoding header allows coding.
+func acceptsEncoding(header, coding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.TrimSpace(name)
+		if !strings.EqualFold(name, coding) && name != "*" {
+			continue
+		}
+		q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !ok {
+			return true
+		}
+		v, err := strconv.ParseFloat(q, 64)
+		return err == nil && v > 0
+	}
+	return false
+}
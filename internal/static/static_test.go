@@ -0,0 +1,184 @@
+package static
+
+import (
+	"html/template"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/toutaio/toutago/internal/di"
+	"github.com/toutaio/toutago/internal/router"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+var modTime = time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func testFS() fstest.MapFS {
+	return fstest.MapFS{
+		"index.html":     {Data: []byte("<h1>app</h1>"), ModTime: modTime},
+		"css/app.css":    {Data: []byte("body{}"), ModTime: modTime},
+		"css/app.css.gz": {Data: []byte("gzipped"), ModTime: modTime},
+		"css/app.css.br": {Data: []byte("brotli"), ModTime: modTime},
+		"docs/a.txt":     {Data: []byte("a"), ModTime: modTime},
+	}
+}
+
+// get mounts s on a router and requests target.
+func get(s *FileServer, target string, headers map[string]string) *httptest.ResponseRecorder {
+	r := router.NewChiRouter(di.NewContainer())
+	Mount(r, s)
+
+	req := httptest.NewRequest("GET", target, nil)
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	w := httptest.NewRecorder()
+	r.Native().(*chi.Mux).ServeHTTP(w, req)
+	return w
+}
+
+func TestFileServer_ServesWithCaching(t *testing.T) {
+	s := New(testFS(), WithPrefix("/static"), WithMaxAge(3600))
+
+	w := get(s, "/static/css/app.css", nil)
+	if w.Code != 200 || w.Body.String() != "body{}" {
+		t.Fatalf("Unexpected response %d %q", w.Code, w.Body.String())
+	}
+	if w.Header().Get("Cache-Control") != "public, max-age=3600" {
+		t.Errorf("Unexpected Cache-Control %q", w.Header().Get("Cache-Control"))
+	}
+	if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/css") {
+		t.Errorf("Unexpected Content-Type %q", w.Header().Get("Content-Type"))
+	}
+	if w.Header().Get("Last-Modified") != modTime.Format("Mon, 02 Jan 2006 15:04:05 GMT") {
+		t.Errorf("Unexpected Last-Modified %q", w.Header().Get("Last-Modified"))
+	}
+
+	etag := w.Header().Get("ETag")
+	if etag == "" {
+		t.Fatal("Expected an ETag")
+	}
+	if w := get(s, "/static/css/app.css", map[string]string{"If-None-Match": etag}); w.Code != 304 {
+		t.Errorf("Expected 304 for a matching ETag, got %d", w.Code)
+	}
+	if w := get(s, "/static/css/app.css", map[string]string{"If-Modified-Since": modTime.Format("Mon, 02 Jan 2006 15:04:05 GMT")}); w.Code != 304 {
+		t.Errorf("Expected 304 for If-Modified-Since, got %d", w.Code)
+	}
+}
+
+func TestFileServer_Precompressed(t *testing.T) {
+	s := New(testFS(), WithPrefix("/static"))
+
+	tests := []struct {
+		acceptEncoding string
+		body           string
+		encoding       string
+	}{
+		{"gzip, br", "brotli", "br"},
+		{"gzip", "gzipped", "gzip"},
+		{"br;q=0, gzip", "gzipped", "gzip"},
+		{"", "body{}", ""},
+	}
+	for _, tt := range tests {
+		w := get(s, "/static/css/app.css", map[string]string{"Accept-Encoding": tt.acceptEncoding})
+		if w.Body.String() != tt.body || w.Header().Get("Content-Encoding") != tt.encoding {
+			t.Errorf("Accept-Encoding %q: got %q with encoding %q", tt.acceptEncoding, w.Body.String(), w.Header().Get("Content-Encoding"))
+		}
+		if !strings.HasPrefix(w.Header().Get("Content-Type"), "text/css") {
+			t.Errorf("Precompressed files keep the original type, got %q", w.Header().Get("Content-Type"))
+		}
+	}
+}
+
+func TestFileServer_NotFoundAndListing(t *testing.T) {
+	s := New(testFS(), WithPrefix("/static"))
+	if w := get(s, "/static/missing.js", nil); w.Code != 404 {
+		t.Errorf("Expected 404, got %d", w.Code)
+	}
+	if w := get(s, "/static/docs/", nil); w.Code != 404 {
+		t.Errorf("Listings are disabled by default, got %d", w.Code)
+	}
+	if w := get(s, "/static/", nil); w.Body.String() != "<h1>app</h1>" {
+		t.Errorf("Directories should serve their index.html, got %q", w.Body.String())
+	}
+
+	s = New(testFS(), WithPrefix("/static"), WithDirectoryListing(true))
+	if w := get(s, "/static/docs", nil); w.Code != 301 || w.Header().Get("Location") != "/static/docs/" {
+		t.Errorf("Expected a redirect to the trailing slash, got %d", w.Code)
+	}
+	if w := get(s, "/static/docs/", nil); w.Code != 200 || !strings.Contains(w.Body.String(), `<a href="a.txt">`) {
+		t.Errorf("Expected a listing, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestFileServer_SPAFallback(t *testing.T) {
+	s := New(testFS(), WithSPAFallback("index.html"))
+
+	w := get(s, "/users/42/edit", nil)
+	if w.Code != 200 || w.Body.String() != "<h1>app</h1>" || w.Header().Get("Cache-Control") != "no-cache" {
+		t.Errorf("Expected the SPA index, got %d %q", w.Code, w.Body.String())
+	}
+	if w := get(s, "/missing.js", nil); w.Code != 404 {
+		t.Errorf("Missing assets must still 404, got %d", w.Code)
+	}
+}
+
+func TestFileServer_AssetURL(t *testing.T) {
+	s := New(testFS(), WithPrefix("/static"), WithMaxAge(60))
+
+	url, err := s.AssetURL("css/app.css")
+	if err != nil {
+		t.Fatalf("AssetURL failed: %v", err)
+	}
+	if !strings.HasPrefix(url, "/static/css/app.") || !strings.HasSuffix(url, ".css") || len(url) != len("/static/css/app..css")+hashLength {
+		t.Fatalf("Unexpected asset URL %q", url)
+	}
+
+	w := get(s, url, nil)
+	if w.Code != 200 || w.Body.String() != "body{}" || w.Header().Get("Cache-Control") != immutableCache {
+		t.Errorf("Hashed URLs should serve the file immutably, got %d %q %q", w.Code, w.Body.String(), w.Header().Get("Cache-Control"))
+	}
+	if w := get(s, "/static/css/app.deadbeef.css", nil); w.Code != 404 {
+		t.Errorf("Stale hashes should 404, got %d", w.Code)
+	}
+	if _, err := s.AssetURL("missing.css"); err == nil {
+		t.Error("Expected an error for a missing asset")
+	}
+
+	var buf strings.Builder
+	tmpl := template.Must(template.New("t").Funcs(s.FuncMap()).Parse(`{{ asset "css/app.css" }}`))
+	if err := tmpl.Execute(&buf, nil); err != nil || buf.String() != url {
+		t.Errorf("Template helper rendered %q, %v", buf.String(), err)
+	}
+}
+
+func TestMountConfig(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "robots.txt"), []byte("User-agent: *"), 0644)
+
+	r := router.NewChiRouter(di.NewContainer())
+	if _, err := MountConfig(r, []touta.StaticConfig{{Path: "/public", Dir: dir, MaxAge: 86400}}); err != nil {
+		t.Fatalf("MountConfig failed: %v", err)
+	}
+
+	w := httptest.NewRecorder()
+	r.Native().(*chi.Mux).ServeHTTP(w, httptest.NewRequest("GET", "/public/robots.txt", nil))
+	if w.Body.String() != "User-agent: *" || w.Header().Get("Cache-Control") != "public, max-age=86400" {
+		t.Errorf("Unexpected response %q %q", w.Body.String(), w.Header().Get("Cache-Control"))
+	}
+
+	w = httptest.NewRecorder()
+	r.Native().(*chi.Mux).ServeHTTP(w, httptest.NewRequest("HEAD", "/public/robots.txt", nil))
+	if w.Code != 200 || w.Body.Len() != 0 || w.Header().Get("Content-Length") != "13" {
+		t.Errorf("Unexpected HEAD response %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+
+	if _, err := MountConfig(r, []touta.StaticConfig{{Path: "/x", Dir: filepath.Join(dir, "missing")}}); err == nil {
+		t.Error("Expected an error for a missing directory")
+	}
+}
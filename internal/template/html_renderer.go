@@ -18,11 +18,28 @@ type htmlRenderer struct {
 	mu        sync.RWMutex
 }
 
+// Option configures an HTML renderer.
+type Option func(*htmlRenderer)
+
+// WithRouter adds the template function "url", which builds links to
+// named routes of r and fails rendering when a param is missing:
+//
+//	<a href="{{ url "users.show" "id" .User.ID }}">Profile</a>
+func WithRouter(r touta.Router) Option {
+	return func(h *htmlRenderer) {
+		h.funcs["url"] = r.URL
+	}
+}
+
 // NewHTMLRenderer creates a new HTML template renderer.
-func NewHTMLRenderer() touta.TemplateRenderer {
-	return &htmlRenderer{
+func NewHTMLRenderer(opts ...Option) touta.TemplateRenderer {
+	r := &htmlRenderer{
 		funcs: make(template.FuncMap),
 	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
 // Render executes a template with the given data.
@@ -5,6 +5,10 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+
+	"github.com/toutaio/toutago/internal/di"
+	"github.com/toutaio/toutago/internal/router"
+	"github.com/toutaio/toutago/pkg/touta"
 )
 
 func TestHTMLRenderer_Parse(t *testing.T) {
@@ -119,3 +123,28 @@ func TestHTMLRenderer_ExecuteWithoutTemplates(t *testing.T) {
 		t.Error("Should fail when no templates loaded")
 	}
 }
+
+func TestHTMLRenderer_URLFunction(t *testing.T) {
+	tmpDir := t.TempDir()
+	os.WriteFile(filepath.Join(tmpDir, "link.html"), []byte(`<a href="{{url "users.show" "id" .ID}}">x</a>`), 0644)
+
+	r := router.NewChiRouter(di.NewContainer())
+	r.GET("/users/{id}", func(ctx touta.Context) error { return nil }).Name("users.show")
+
+	renderer := NewHTMLRenderer(WithRouter(r))
+	if err := renderer.Parse(filepath.Join(tmpDir, "*.html")); err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+
+	result, err := renderer.Render("link.html", map[string]int{"ID": 7})
+	if err != nil {
+		t.Fatalf("Render failed: %v", err)
+	}
+	if string(result) != `<a href="/users/7">x</a>` {
+		t.Errorf("Unexpected link %s", result)
+	}
+
+	if _, err := renderer.Render("link.html", map[string]interface{}{}); err == nil {
+		t.Error("Expected an error for a missing route param")
+	}
+}
@@ -0,0 +1,240 @@
+package transport
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/toutaio/toutago/internal/message"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+// MetaOrigin is the metadata key naming the node that published a message.
+const MetaOrigin = "origin_node"
+
+// BusOption configures a bus created by NewBus.
+type BusOption func(*networkBus)
+
+// WithSubjectPrefix sets the subject prefix messages are published under
+// (default "touta"); a message is sent on "<prefix>.<slug>".
+func WithSubjectPrefix(prefix string) BusOption {
+	return func(b *networkBus) {
+		b.prefix = prefix
+	}
+}
+
+// WithCodec sets the codec used to rebuild messages from other nodes.
+func WithCodec(codec *message.Codec) BusOption {
+	return func(b *networkBus) {
+		b.codec = codec
+	}
+}
+
+// WithLocalBus sets the in-process bus that dispatches to local handlers.
+func WithLocalBus(local touta.MessageBus) BusOption {
+	return func(b *networkBus) {
+		b.local = local
+	}
+}
+
+// WithNodeID sets the identifier stamped on outgoing messages.
+func WithNodeID(id string) BusOption {
+	return func(b *networkBus) {
+		b.nodeID = id
+	}
+}
+
+// networkBus implements touta.MessageBus on top of a Transport.
+//
+// Handlers are registered on a local in-process bus. Published messages are
+// dispatched locally exactly as on the in-process bus and forwarded to the
+// transport; messages received from other nodes are published on the local
+// bus asynchronously. Messages a node sent itself are ignored on receipt.
+type networkBus struct {
+	transport Transport
+	local     touta.MessageBus
+	codec     *message.Codec
+	prefix    string
+	nodeID    string
+
+	sub Unsubscriber
+	mu  sync.Mutex
+}
+
+// NewBus creates a message bus that shares messages with other processes
+// connected to the same transport.
+func NewBus(transport Transport, opts ...BusOption) touta.MessageBus {
+	b := &networkBus{
+		transport: transport,
+		codec:     message.NewCodec(),
+		prefix:    "touta",
+		nodeID:    message.NewID(),
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	if b.local == nil {
+		b.local = message.NewBus()
+	}
+	return b
+}
+
+// Publish dispatches msg to local handlers and forwards it to other nodes.
+func (b *networkBus) Publish(ctx context.Context, msg touta.Message) error {
+	if err := b.local.Publish(ctx, msg); err != nil {
+		return err
+	}
+	return b.forward(ctx, msg)
+}
+
+// PublishSync forwards msg to other nodes and runs local handlers synchronously.
+// Remote handlers always run asynchronously.
+func (b *networkBus) PublishSync(ctx context.Context, msg touta.Message) error {
+	message.EnsureID(msg)
+	message.InjectTrace(ctx, msg)
+	if err := b.forward(ctx, msg); err != nil {
+		return err
+	}
+	return b.local.PublishSync(ctx, msg)
+}
+
+// Request sends msg to local handlers and returns the first reply, see
+// message.Requester. Requests are not forwarded: other nodes have no way
+// to reply, and forwarding would run the request's handlers twice.
+func (b *networkBus) Request(ctx context.Context, msg touta.Message) (touta.Message, error) {
+	return message.Request(ctx, b.local, msg)
+}
+
+// Subscribe registers a local handler.
+func (b *networkBus) Subscribe(pattern string, handler touta.MessageHandler) (touta.Subscription, error) {
+	return b.local.Subscribe(pattern, handler)
+}
+
+// SubscribeOnce registers a local one-shot handler.
+func (b *networkBus) SubscribeOnce(pattern string, handler touta.MessageHandler) (touta.Subscription, error) {
+	return b.local.SubscribeOnce(pattern, handler)
+}
+
+// SubscribeContext registers a local handler bound to ctx.
+func (b *networkBus) SubscribeContext(ctx context.Context, pattern string, handler touta.MessageHandler) (touta.Subscription, error) {
+	return b.local.SubscribeContext(ctx, pattern, handler)
+}
+
+// Unsubscribe removes a local handler.
+func (b *networkBus) Unsubscribe(pattern string, handler touta.MessageHandler) error {
+	return b.local.Unsubscribe(pattern, handler)
+}
+
+// Start starts the local bus, connects the transport and subscribes to
+// every message under the subject prefix.
+func (b *networkBus) Start(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.sub != nil {
+		return fmt.Errorf("message bus already started")
+	}
+
+	if err := b.local.Start(ctx); err != nil {
+		return err
+	}
+	if err := b.transport.Connect(ctx); err != nil {
+		b.local.Stop(ctx)
+		return err
+	}
+
+	sub, err := b.transport.Subscribe(b.prefix+".>", b.receive)
+	if err != nil {
+		b.transport.Close()
+		b.local.Stop(ctx)
+		return err
+	}
+	b.sub = sub
+
+	// Make sure the subscription is active before reporting success
+	if flusher, ok := b.transport.(Flusher); ok {
+		if err := flusher.Flush(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Stop disconnects the transport and stops the local bus.
+func (b *networkBus) Stop(ctx context.Context) error {
+	b.mu.Lock()
+	sub := b.sub
+	b.sub = nil
+	b.mu.Unlock()
+
+	if sub == nil {
+		return nil
+	}
+
+	return errors.Join(
+		sub.Unsubscribe(),
+		b.transport.Close(),
+		b.local.Stop(ctx),
+	)
+}
+
+// forward sends msg to the transport.
+func (b *networkBus) forward(ctx context.Context, msg touta.Message) error {
+	env, err := b.codec.Encode(msg)
+	if err != nil {
+		return err
+	}
+
+	meta := make(map[string]interface{}, len(env.Metadata)+1)
+	for k, v := range env.Metadata {
+		meta[k] = v
+	}
+	meta[MetaOrigin] = b.nodeID
+	env.Metadata = meta
+
+	data, err := json.Marshal(env)
+	if err != nil {
+		return fmt.Errorf("failed to encode message %s: %w", env.Slug, err)
+	}
+
+	if err := b.transport.Publish(ctx, b.prefix+"."+env.Slug, data); err != nil {
+		return fmt.Errorf("failed to forward %s: %w", env.Slug, err)
+	}
+	return nil
+}
+
+// receive publishes a message from another node on the local bus.
+func (b *networkBus) receive(subject string, data []byte) {
+	msg, err := b.codec.Unmarshal(data)
+	if err != nil {
+		log.Printf("transport: dropping message on %s: %v", subject, err)
+		return
+	}
+
+	if origin, _ := msg.Metadata()[MetaOrigin].(string); origin == b.nodeID {
+		return // already dispatched locally
+	}
+
+	if err := b.local.Publish(context.Background(), msg); err != nil {
+		log.Printf("transport: failed to dispatch %s: %v", msg.Slug(), err)
+	}
+}
+
+// Stats returns the metrics of the local bus.
+func (b *networkBus) Stats() message.Stats {
+	if inspector, ok := b.local.(message.Inspector); ok {
+		return inspector.Stats()
+	}
+	return message.Stats{}
+}
+
+// Subscriptions lists the handlers registered on the local bus.
+func (b *networkBus) Subscriptions() []message.SubscriptionInfo {
+	if inspector, ok := b.local.(message.Inspector); ok {
+		return inspector.Subscriptions()
+	}
+	return nil
+}
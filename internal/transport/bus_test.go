@@ -0,0 +1,123 @@
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/toutaio/toutago/internal/message"
+	"github.com/toutaio/toutago/pkg/touta"
+)
+
+type orderPlaced struct {
+	message.BaseMessage
+	OrderID string `json:"order_id"`
+}
+
+func newOrderPlaced(id string) *orderPlaced {
+	return &orderPlaced{
+		BaseMessage: message.BaseMessage{MessageSlug: "order.placed", MessageType: "event"},
+		OrderID:     id,
+	}
+}
+
+func startNode(t *testing.T, addr string) (touta.MessageBus, chan touta.Message) {
+	t.Helper()
+
+	codec := message.NewCodec()
+	codec.Register(newOrderPlaced(""))
+
+	bus := NewBus(NewNATSTransport(addr), WithCodec(codec))
+	if err := bus.Start(context.Background()); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	t.Cleanup(func() { bus.Stop(context.Background()) })
+
+	received := make(chan touta.Message, 10)
+	bus.Subscribe("order.placed", message.HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		received <- msg
+		return nil, nil
+	}))
+	return bus, received
+}
+
+func TestNetworkBus_SharesMessages(t *testing.T) {
+	server := startServer(t)
+	first, firstReceived := startNode(t, server.Addr())
+	_, secondReceived := startNode(t, server.Addr())
+
+	if err := first.Publish(context.Background(), newOrderPlaced("42")); err != nil {
+		t.Fatalf("Publish failed: %v", err)
+	}
+
+	for name, ch := range map[string]chan touta.Message{"first": firstReceived, "second": secondReceived} {
+		select {
+		case msg := <-ch:
+			order, ok := msg.(*orderPlaced)
+			if !ok || order.OrderID != "42" {
+				t.Errorf("%s node received unexpected message %#v", name, msg)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("%s node should receive the message", name)
+		}
+	}
+
+	// The publishing node must not receive its own message a second time
+	select {
+	case <-firstReceived:
+		t.Error("Publishing node received its own message twice")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestNetworkBus_PublishSyncRunsLocalHandlers(t *testing.T) {
+	server := startServer(t)
+	first, firstReceived := startNode(t, server.Addr())
+	_, secondReceived := startNode(t, server.Addr())
+
+	if err := first.PublishSync(context.Background(), newOrderPlaced("7")); err != nil {
+		t.Fatalf("PublishSync failed: %v", err)
+	}
+
+	select {
+	case <-firstReceived:
+	default:
+		t.Fatal("Local handler should have run before PublishSync returned")
+	}
+
+	select {
+	case <-secondReceived:
+	case <-time.After(time.Second):
+		t.Fatal("Remote node should receive the message")
+	}
+}
+
+func TestNetworkBus_RequestStaysLocal(t *testing.T) {
+	server := startServer(t)
+	first, firstReceived := startNode(t, server.Addr())
+	_, secondReceived := startNode(t, server.Addr())
+
+	first.Subscribe("order.placed", message.HandlerFunc(func(ctx context.Context, msg touta.Message) (touta.Message, error) {
+		return newOrderPlaced("reply"), nil
+	}))
+
+	reply, err := message.Request(context.Background(), first, newOrderPlaced("9"))
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	if order, ok := reply.(*orderPlaced); !ok || order.OrderID != "reply" {
+		t.Errorf("unexpected reply %#v", reply)
+	}
+
+	select {
+	case <-firstReceived:
+	default:
+		t.Fatal("Local handler should have run before Request returned")
+	}
+
+	select {
+	case <-secondReceived:
+		t.Error("Requests must not be forwarded to other nodes")
+	case <-time.After(50 * time.Millisecond):
+	}
+}
@@ -0,0 +1,421 @@
+package transport
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// NATSOption configures a transport created by NewNATSTransport.
+type NATSOption func(*natsTransport)
+
+// WithName sets the client name announced to the server.
+func WithName(name string) NATSOption {
+	return func(t *natsTransport) {
+		t.name = name
+	}
+}
+
+// WithCredentials sets the user and password sent on connect.
+func WithCredentials(user, password string) NATSOption {
+	return func(t *natsTransport) {
+		t.user = user
+		t.password = password
+	}
+}
+
+// WithDialTimeout bounds how long Connect waits for the server.
+func WithDialTimeout(d time.Duration) NATSOption {
+	return func(t *natsTransport) {
+		t.dialTimeout = d
+	}
+}
+
+// natsTransport implements Transport over the NATS core text protocol.
+// It does not reconnect on its own; callers Close and Connect again.
+type natsTransport struct {
+	addr        string
+	name        string
+	user        string
+	password    string
+	dialTimeout time.Duration
+
+	conn   net.Conn
+	writer *bufio.Writer
+	wmu    sync.Mutex
+
+	subs    map[int]*natsSubscription
+	nextSID int
+	mu      sync.Mutex
+
+	pongs  chan struct{}
+	done   chan struct{}
+	err    error
+	closed bool
+}
+
+// NewNATSTransport creates a transport for the NATS server at addr (host:port).
+func NewNATSTransport(addr string, opts ...NATSOption) Transport {
+	t := &natsTransport{
+		addr:        addr,
+		name:        "touta",
+		dialTimeout: 5 * time.Second,
+		subs:        make(map[int]*natsSubscription),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// natsConnect is the CONNECT payload.
+type natsConnect struct {
+	Verbose  bool   `json:"verbose"`
+	Pedantic bool   `json:"pedantic"`
+	Name     string `json:"name,omitempty"`
+	User     string `json:"user,omitempty"`
+	Pass     string `json:"pass,omitempty"`
+	Lang     string `json:"lang"`
+	Version  string `json:"version"`
+	Protocol int    `json:"protocol"`
+}
+
+// Connect dials the server and performs the protocol handshake.
+func (t *natsTransport) Connect(ctx context.Context) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.conn != nil {
+		return fmt.Errorf("nats transport already connected")
+	}
+
+	dialer := net.Dialer{Timeout: t.dialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", t.addr)
+	if err != nil {
+		return fmt.Errorf("failed to connect to nats server %s: %w", t.addr, err)
+	}
+
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	} else {
+		conn.SetDeadline(time.Now().Add(t.dialTimeout))
+	}
+
+	reader := bufio.NewReader(conn)
+	line, err := readLine(reader)
+	if err != nil || !strings.HasPrefix(line, "INFO ") {
+		conn.Close()
+		return fmt.Errorf("nats server %s sent no INFO: %v", t.addr, err)
+	}
+
+	connect, _ := json.Marshal(natsConnect{
+		Name:     t.name,
+		User:     t.user,
+		Pass:     t.password,
+		Lang:     "go",
+		Version:  "0.1.0",
+		Protocol: 1,
+	})
+
+	writer := bufio.NewWriter(conn)
+	fmt.Fprintf(writer, "CONNECT %s\r\nPING\r\n", connect)
+	if err := writer.Flush(); err != nil {
+		conn.Close()
+		return fmt.Errorf("failed to send CONNECT: %w", err)
+	}
+
+	// The server answers PING with PONG once CONNECT is accepted
+	for {
+		line, err := readLine(reader)
+		if err != nil {
+			conn.Close()
+			return fmt.Errorf("nats handshake failed: %w", err)
+		}
+		if strings.HasPrefix(line, "-ERR") {
+			conn.Close()
+			return fmt.Errorf("nats server rejected connection: %s", strings.TrimSpace(line[4:]))
+		}
+		if line == "PONG" {
+			break
+		}
+	}
+	conn.SetDeadline(time.Time{})
+
+	t.conn = conn
+	t.writer = writer
+	t.pongs = make(chan struct{}, 8)
+	t.done = make(chan struct{})
+	t.closed = false
+	t.err = nil
+
+	// Re-establish subscriptions made before (re)connecting
+	for sid, sub := range t.subs {
+		fmt.Fprintf(writer, "SUB %s %d\r\n", sub.pattern, sid)
+	}
+	if err := writer.Flush(); err != nil {
+		conn.Close()
+		t.conn = nil
+		return fmt.Errorf("failed to restore subscriptions: %w", err)
+	}
+
+	go t.readLoop(reader, t.done)
+	return nil
+}
+
+// Publish sends data on a subject.
+func (t *natsTransport) Publish(ctx context.Context, subject string, data []byte) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := validSubject(subject, false); err != nil {
+		return err
+	}
+
+	return t.write(func(w *bufio.Writer) {
+		fmt.Fprintf(w, "PUB %s %d\r\n", subject, len(data))
+		w.Write(data)
+		w.WriteString("\r\n")
+	})
+}
+
+// Subscribe delivers data published on matching subjects.
+func (t *natsTransport) Subscribe(pattern string, handler Handler) (Unsubscriber, error) {
+	if err := validSubject(pattern, true); err != nil {
+		return nil, err
+	}
+	if handler == nil {
+		return nil, fmt.Errorf("handler is required")
+	}
+
+	t.mu.Lock()
+	t.nextSID++
+	sub := &natsSubscription{
+		transport: t,
+		sid:       t.nextSID,
+		pattern:   pattern,
+		handler:   handler,
+	}
+	t.subs[sub.sid] = sub
+	connected := t.conn != nil
+	t.mu.Unlock()
+
+	if !connected {
+		return sub, nil // sent on Connect
+	}
+
+	if err := t.write(func(w *bufio.Writer) {
+		fmt.Fprintf(w, "SUB %s %d\r\n", pattern, sub.sid)
+	}); err != nil {
+		t.mu.Lock()
+		delete(t.subs, sub.sid)
+		t.mu.Unlock()
+		return nil, err
+	}
+	return sub, nil
+}
+
+// Flush round-trips a PING so all previous writes reached the server.
+func (t *natsTransport) Flush(ctx context.Context) error {
+	t.mu.Lock()
+	pongs, done := t.pongs, t.done
+	t.mu.Unlock()
+
+	if err := t.write(func(w *bufio.Writer) {
+		w.WriteString("PING\r\n")
+	}); err != nil {
+		return err
+	}
+
+	select {
+	case <-pongs:
+		return nil
+	case <-done:
+		return fmt.Errorf("nats connection closed")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Close terminates the connection.
+func (t *natsTransport) Close() error {
+	t.mu.Lock()
+	conn := t.conn
+	t.conn = nil
+	t.closed = true
+	done := t.done
+	t.mu.Unlock()
+
+	if conn == nil {
+		return nil
+	}
+
+	err := conn.Close()
+	<-done
+	return err
+}
+
+// write serialises a protocol frame onto the connection.
+func (t *natsTransport) write(frame func(w *bufio.Writer)) error {
+	t.mu.Lock()
+	conn, writer, err := t.conn, t.writer, t.err
+	t.mu.Unlock()
+
+	if conn == nil {
+		if err != nil {
+			return fmt.Errorf("nats connection lost: %w", err)
+		}
+		return fmt.Errorf("nats transport not connected")
+	}
+
+	t.wmu.Lock()
+	defer t.wmu.Unlock()
+
+	frame(writer)
+	if err := writer.Flush(); err != nil {
+		return fmt.Errorf("failed to write to nats server: %w", err)
+	}
+	return nil
+}
+
+// readLoop dispatches server frames until the connection closes.
+func (t *natsTransport) readLoop(r *bufio.Reader, done chan struct{}) {
+	defer close(done)
+
+	for {
+		line, err := readLine(r)
+		if err != nil {
+			t.fail(err)
+			return
+		}
+
+		switch {
+		case strings.HasPrefix(line, "MSG "):
+			if err := t.readMessage(r, line); err != nil {
+				t.fail(err)
+				return
+			}
+		case line == "PING":
+			t.write(func(w *bufio.Writer) {
+				w.WriteString("PONG\r\n")
+			})
+		case line == "PONG":
+			select {
+			case t.pongs <- struct{}{}:
+			default:
+			}
+		case strings.HasPrefix(line, "-ERR"):
+			log.Printf("nats: server error: %s", strings.TrimSpace(line[4:]))
+		}
+	}
+}
+
+// readMessage reads the payload of a MSG frame and dispatches it.
+func (t *natsTransport) readMessage(r *bufio.Reader, line string) error {
+	// MSG <subject> <sid> [reply-to] <#bytes>
+	fields := strings.Fields(line)
+	if len(fields) != 4 && len(fields) != 5 {
+		return fmt.Errorf("malformed MSG frame %q", line)
+	}
+
+	sid, err := strconv.Atoi(fields[2])
+	if err != nil {
+		return fmt.Errorf("malformed MSG sid %q", fields[2])
+	}
+	size, err := strconv.Atoi(fields[len(fields)-1])
+	if err != nil || size < 0 {
+		return fmt.Errorf("malformed MSG size %q", fields[len(fields)-1])
+	}
+
+	payload := make([]byte, size+2)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return err
+	}
+
+	t.mu.Lock()
+	sub := t.subs[sid]
+	t.mu.Unlock()
+
+	if sub != nil {
+		sub.handler(fields[1], payload[:size])
+	}
+	return nil
+}
+
+// fail records a read error unless the connection was closed on purpose.
+func (t *natsTransport) fail(err error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.closed {
+		return
+	}
+	t.err = err
+	if t.conn != nil {
+		t.conn.Close()
+		t.conn = nil
+	}
+	log.Printf("nats: connection lost: %v", err)
+}
+
+// natsSubscription implements Unsubscriber.
+type natsSubscription struct {
+	transport *natsTransport
+	sid       int
+	pattern   string
+	handler   Handler
+}
+
+// Unsubscribe stops delivery to the handler.
+func (s *natsSubscription) Unsubscribe() error {
+	t := s.transport
+
+	t.mu.Lock()
+	_, ok := t.subs[s.sid]
+	delete(t.subs, s.sid)
+	connected := t.conn != nil
+	t.mu.Unlock()
+
+	if !ok || !connected {
+		return nil
+	}
+	return t.write(func(w *bufio.Writer) {
+		fmt.Fprintf(w, "UNSUB %d\r\n", s.sid)
+	})
+}
+
+// readLine reads a CRLF terminated protocol line.
+func readLine(r *bufio.Reader) (string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimRight(line, "\r\n"), nil
+}
+
+// validSubject checks a subject (or pattern when wildcards is true).
+func validSubject(subject string, wildcards bool) error {
+	if subject == "" || strings.ContainsAny(subject, " \t\r\n") {
+		return fmt.Errorf("invalid subject %q", subject)
+	}
+
+	tokens := strings.Split(subject, ".")
+	for i, token := range tokens {
+		switch {
+		case token == "":
+			return fmt.Errorf("invalid subject %q: empty token", subject)
+		case !wildcards && (token == "*" || token == ">"):
+			return fmt.Errorf("invalid subject %q: wildcards are not allowed", subject)
+		case token == ">" && i != len(tokens)-1:
+			return fmt.Errorf("invalid subject %q: '>' must be the last token", subject)
+		}
+	}
+	return nil
+}
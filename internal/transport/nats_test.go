@@ -0,0 +1,109 @@
+package transport
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/toutaio/toutago/internal/transport/natstest"
+)
+
+func startServer(t *testing.T) *natstest.Server {
+	t.Helper()
+
+	server, err := natstest.NewServer()
+	if err != nil {
+		t.Fatalf("Failed to start test server: %v", err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return server
+}
+
+func connect(t *testing.T, addr string) Transport {
+	t.Helper()
+
+	tr := NewNATSTransport(addr)
+	if err := tr.Connect(context.Background()); err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	t.Cleanup(func() { tr.Close() })
+	return tr
+}
+
+func TestNATSTransport_PublishSubscribe(t *testing.T) {
+	server := startServer(t)
+	sender := connect(t, server.Addr())
+	receiver := connect(t, server.Addr())
+
+	received := make(chan string, 2)
+	sub, err := receiver.Subscribe("orders.*", func(subject string, data []byte) {
+		received <- subject + ":" + string(data)
+	})
+	if err != nil {
+		t.Fatalf("Subscribe failed: %v", err)
+	}
+	receiver.(Flusher).Flush(context.Background())
+
+	sender.Publish(context.Background(), "orders.placed", []byte("hello\r\nworld"))
+	sender.Publish(context.Background(), "users.created", []byte("ignored"))
+
+	select {
+	case got := <-received:
+		if got != "orders.placed:hello\r\nworld" {
+			t.Errorf("Unexpected delivery %q", got)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected a delivery")
+	}
+
+	sub.Unsubscribe()
+	receiver.(Flusher).Flush(context.Background())
+	sender.Publish(context.Background(), "orders.shipped", []byte("late"))
+	sender.(Flusher).Flush(context.Background())
+
+	select {
+	case got := <-received:
+		t.Errorf("Unexpected delivery after unsubscribe %q", got)
+	case <-time.After(20 * time.Millisecond):
+	}
+}
+
+func TestNATSTransport_Errors(t *testing.T) {
+	tr := NewNATSTransport("127.0.0.1:1", WithDialTimeout(100*time.Millisecond))
+	if err := tr.Connect(context.Background()); err == nil {
+		t.Error("Connect should fail without a server")
+	}
+
+	if err := tr.Publish(context.Background(), "orders.placed", nil); err == nil {
+		t.Error("Publish should fail when not connected")
+	}
+
+	server := startServer(t)
+	conn := connect(t, server.Addr())
+
+	if err := conn.Publish(context.Background(), "orders.*", nil); err == nil {
+		t.Error("Publish should reject wildcard subjects")
+	}
+	if _, err := conn.Subscribe("orders.>.x", func(string, []byte) {}); err == nil {
+		t.Error("Subscribe should reject misplaced '>'")
+	}
+}
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		pattern, subject string
+		want             bool
+	}{
+		{"touta.>", "touta.user.created", true},
+		{"touta.>", "touta", false},
+		{"touta.*", "touta.user", true},
+		{"touta.*", "touta.user.created", false},
+		{"touta.user.created", "touta.user.created", true},
+	}
+
+	for _, tt := range tests {
+		if got := natstest.Match(tt.pattern, tt.subject); got != tt.want {
+			t.Errorf("Match(%q, %q) = %v, want %v", tt.pattern, tt.subject, got, tt.want)
+		}
+	}
+}
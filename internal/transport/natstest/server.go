@@ -0,0 +1,208 @@
+// Package natstest provides an in-process stand-in for a NATS server that
+// speaks enough of the core protocol (PUB, SUB, UNSUB, PING) for tests.
+package natstest
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// Server is a minimal NATS server listening on a loopback port.
+type Server struct {
+	listener net.Listener
+	clients  map[*client]bool
+	mu       sync.Mutex
+	wg       sync.WaitGroup
+}
+
+// client is a connection to the server.
+type client struct {
+	conn net.Conn
+	subs map[string]string // sid -> subject pattern
+	wmu  sync.Mutex
+	w    *bufio.Writer
+}
+
+// NewServer starts a server on 127.0.0.1 with a random port.
+func NewServer() (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		listener: listener,
+		clients:  make(map[*client]bool),
+	}
+
+	s.wg.Add(1)
+	go s.accept()
+	return s, nil
+}
+
+// Addr returns the host:port the server listens on.
+func (s *Server) Addr() string {
+	return s.listener.Addr().String()
+}
+
+// Close stops the server and disconnects all clients.
+func (s *Server) Close() error {
+	err := s.listener.Close()
+
+	s.mu.Lock()
+	for c := range s.clients {
+		c.conn.Close()
+	}
+	s.mu.Unlock()
+
+	s.wg.Wait()
+	return err
+}
+
+// accept serves incoming connections.
+func (s *Server) accept() {
+	defer s.wg.Done()
+
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		c := &client{
+			conn: conn,
+			subs: make(map[string]string),
+			w:    bufio.NewWriter(conn),
+		}
+
+		s.mu.Lock()
+		s.clients[c] = true
+		s.mu.Unlock()
+
+		s.wg.Add(1)
+		go s.serve(c)
+	}
+}
+
+// serve handles one client connection.
+func (s *Server) serve(c *client) {
+	defer s.wg.Done()
+	defer func() {
+		s.mu.Lock()
+		delete(s.clients, c)
+		s.mu.Unlock()
+		c.conn.Close()
+	}()
+
+	c.send(`INFO {"server_id":"natstest","version":"2.10.0","proto":1,"max_payload":1048576}` + "\r\n")
+
+	r := bufio.NewReader(c.conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		line = strings.TrimRight(line, "\r\n")
+
+		op, args, _ := strings.Cut(line, " ")
+		switch strings.ToUpper(op) {
+		case "CONNECT":
+		case "PING":
+			c.send("PONG\r\n")
+		case "PONG":
+		case "SUB":
+			// SUB <subject> [queue group] <sid>
+			fields := strings.Fields(args)
+			if len(fields) < 2 {
+				c.send("-ERR 'Invalid Subscription'\r\n")
+				continue
+			}
+			s.mu.Lock()
+			c.subs[fields[len(fields)-1]] = fields[0]
+			s.mu.Unlock()
+		case "UNSUB":
+			fields := strings.Fields(args)
+			if len(fields) < 1 {
+				continue
+			}
+			s.mu.Lock()
+			delete(c.subs, fields[0])
+			s.mu.Unlock()
+		case "PUB":
+			// PUB <subject> [reply-to] <#bytes>
+			fields := strings.Fields(args)
+			if len(fields) < 2 {
+				c.send("-ERR 'Unknown Protocol Operation'\r\n")
+				return
+			}
+			size, err := strconv.Atoi(fields[len(fields)-1])
+			if err != nil || size < 0 {
+				c.send("-ERR 'Invalid Payload Size'\r\n")
+				return
+			}
+			payload := make([]byte, size+2)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return
+			}
+			s.route(fields[0], payload[:size])
+		default:
+			c.send("-ERR 'Unknown Protocol Operation'\r\n")
+		}
+	}
+}
+
+// route delivers a payload to every matching subscription.
+func (s *Server) route(subject string, payload []byte) {
+	type delivery struct {
+		c   *client
+		sid string
+	}
+
+	s.mu.Lock()
+	var deliveries []delivery
+	for c := range s.clients {
+		for sid, pattern := range c.subs {
+			if Match(pattern, subject) {
+				deliveries = append(deliveries, delivery{c, sid})
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	for _, d := range deliveries {
+		d.c.send(fmt.Sprintf("MSG %s %s %d\r\n%s\r\n", subject, d.sid, len(payload), payload))
+	}
+}
+
+// send writes a frame to the client.
+func (c *client) send(frame string) {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	c.w.WriteString(frame)
+	c.w.Flush()
+}
+
+// Match reports whether subject matches a NATS subject pattern.
+func Match(pattern, subject string) bool {
+	p := strings.Split(pattern, ".")
+	s := strings.Split(subject, ".")
+
+	for i, token := range p {
+		if token == ">" {
+			return len(s) > i
+		}
+		if i >= len(s) {
+			return false
+		}
+		if token != "*" && token != s[i] {
+			return false
+		}
+	}
+	return len(p) == len(s)
+}
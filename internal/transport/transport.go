@@ -0,0 +1,39 @@
+// Package transport carries messages between processes so several
+// application instances can share one logical message bus.
+package transport
+
+import (
+	"context"
+)
+
+// Handler receives raw payloads delivered by a transport.
+type Handler func(subject string, data []byte)
+
+// Transport is a networked publish/subscribe connection.
+type Transport interface {
+	// Connect opens the connection
+	Connect(ctx context.Context) error
+
+	// Publish sends data on a subject
+	Publish(ctx context.Context, subject string, data []byte) error
+
+	// Subscribe delivers data published on subjects matching pattern.
+	// Patterns use NATS syntax: "*" matches one token, ">" the remainder.
+	Subscribe(pattern string, handler Handler) (Unsubscriber, error)
+
+	// Close terminates the connection
+	Close() error
+}
+
+// Unsubscriber cancels a transport subscription.
+type Unsubscriber interface {
+	// Unsubscribe stops delivery to the handler
+	Unsubscribe() error
+}
+
+// Flusher is implemented by transports that can confirm all previous writes
+// were processed by the server.
+type Flusher interface {
+	// Flush blocks until pending writes are acknowledged
+	Flush(ctx context.Context) error
+}
@@ -0,0 +1,278 @@
+package validation
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/mail"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Schema is a JSON Schema document. The commonly used validation keywords
+// are supported: type, enum, const, properties, required,
+// additionalProperties, items, minItems, maxItems, minLength, maxLength,
+// pattern, format (email, date-time, date), minimum and maximum.
+type Schema struct {
+	Type                 SchemaType         `json:"type,omitempty"`
+	Enum                 []interface{}      `json:"enum,omitempty"`
+	Const                interface{}        `json:"const,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Pattern              string             `json:"pattern,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+
+	pattern    *regexp.Regexp
+	once       sync.Once
+	compileErr error
+}
+
+// SchemaType lists the JSON types a value may have.
+type SchemaType []string
+
+// UnmarshalJSON accepts both "type": "string" and "type": ["string", "null"].
+func (t *SchemaType) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = SchemaType{single}
+		return nil
+	}
+	var many []string
+	if err := json.Unmarshal(data, &many); err != nil {
+		return fmt.Errorf("schema type must be a string or an array of strings")
+	}
+	*t = many
+	return nil
+}
+
+// ParseSchema parses and compiles a JSON Schema document.
+func ParseSchema(data []byte) (*Schema, error) {
+	var s Schema
+	if err := json.Unmarshal(data, &s); err != nil {
+		return nil, fmt.Errorf("failed to parse schema: %w", err)
+	}
+	if err := s.prepare(); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// prepare compiles the schema once, so schemas built in code can be used
+// concurrently just like parsed ones.
+func (s *Schema) prepare() error {
+	s.once.Do(func() {
+		s.compileErr = s.compile()
+	})
+	return s.compileErr
+}
+
+// compile prepares regular expressions throughout the schema.
+func (s *Schema) compile() error {
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid schema pattern %q: %w", s.Pattern, err)
+		}
+		s.pattern = re
+	}
+	for _, prop := range s.Properties {
+		if err := prop.compile(); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		return s.Items.compile()
+	}
+	return nil
+}
+
+// ValidateJSON validates a JSON document against the schema.
+func (s *Schema) ValidateJSON(data []byte) error {
+	var value interface{}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return fmt.Errorf("failed to parse JSON: %w", err)
+	}
+	return s.Validate(value)
+}
+
+// Validate validates a decoded JSON value, as produced by encoding/json
+// unmarshalling into interface{}, against the schema.
+func (s *Schema) Validate(value interface{}) error {
+	if err := s.prepare(); err != nil {
+		return err
+	}
+
+	var errs Errors
+	s.validate(value, "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validate appends a FieldError for every keyword value fails.
+func (s *Schema) validate(value interface{}, path string, errs *Errors) {
+	fail := func(rule, param, msg string) {
+		field := path
+		if field == "" {
+			field = "$"
+		}
+		*errs = append(*errs, FieldError{Field: field, Rule: rule, Param: param, Message: msg})
+	}
+
+	if len(s.Type) > 0 && !s.Type.matches(value) {
+		fail("type", strings.Join(s.Type, ","), fmt.Sprintf("must be of type %s", strings.Join(s.Type, " or ")))
+		return
+	}
+
+	if s.Const != nil && !equal(value, s.Const) {
+		fail("const", fmt.Sprint(s.Const), fmt.Sprintf("must be %v", s.Const))
+	}
+	if len(s.Enum) > 0 {
+		found := false
+		for _, option := range s.Enum {
+			if equal(value, option) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			fail("enum", fmt.Sprint(s.Enum), fmt.Sprintf("must be one of %v", s.Enum))
+		}
+	}
+
+	switch v := value.(type) {
+	case string:
+		length := len([]rune(v))
+		if s.MinLength != nil && length < *s.MinLength {
+			fail("minLength", fmt.Sprint(*s.MinLength), fmt.Sprintf("must be at least %d characters", *s.MinLength))
+		}
+		if s.MaxLength != nil && length > *s.MaxLength {
+			fail("maxLength", fmt.Sprint(*s.MaxLength), fmt.Sprintf("must be at most %d characters", *s.MaxLength))
+		}
+		if s.pattern != nil && !s.pattern.MatchString(v) {
+			fail("pattern", s.Pattern, fmt.Sprintf("must match %s", s.Pattern))
+		}
+		if s.Format != "" && !validFormat(s.Format, v) {
+			fail("format", s.Format, fmt.Sprintf("must be a valid %s", s.Format))
+		}
+
+	case float64:
+		if s.Minimum != nil && v < *s.Minimum {
+			fail("minimum", fmt.Sprint(*s.Minimum), fmt.Sprintf("must be at least %v", *s.Minimum))
+		}
+		if s.Maximum != nil && v > *s.Maximum {
+			fail("maximum", fmt.Sprint(*s.Maximum), fmt.Sprintf("must be at most %v", *s.Maximum))
+		}
+
+	case []interface{}:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			fail("minItems", fmt.Sprint(*s.MinItems), fmt.Sprintf("must have at least %d items", *s.MinItems))
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			fail("maxItems", fmt.Sprint(*s.MaxItems), fmt.Sprintf("must have at most %d items", *s.MaxItems))
+		}
+		if s.Items != nil {
+			for i, item := range v {
+				s.Items.validate(item, fmt.Sprintf("%s[%d]", path, i), errs)
+			}
+		}
+
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := v[name]; !ok {
+				*errs = append(*errs, FieldError{Field: join(path, name), Rule: "required", Message: "is required"})
+			}
+		}
+
+		// Sort for stable error order
+		names := make([]string, 0, len(v))
+		for name := range v {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		for _, name := range names {
+			if prop, ok := s.Properties[name]; ok {
+				prop.validate(v[name], join(path, name), errs)
+			} else if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+				*errs = append(*errs, FieldError{Field: join(path, name), Rule: "additionalProperties", Message: "is not allowed"})
+			}
+		}
+	}
+}
+
+// matches reports whether value has one of the listed JSON types.
+func (t SchemaType) matches(value interface{}) bool {
+	for _, typ := range t {
+		switch v := value.(type) {
+		case nil:
+			if typ == "null" {
+				return true
+			}
+		case bool:
+			if typ == "boolean" {
+				return true
+			}
+		case string:
+			if typ == "string" {
+				return true
+			}
+		case float64:
+			if typ == "number" || (typ == "integer" && v == math.Trunc(v)) {
+				return true
+			}
+		case []interface{}:
+			if typ == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if typ == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// validFormat checks the supported string formats; unknown formats pass.
+func validFormat(format, value string) bool {
+	switch format {
+	case "email":
+		addr, err := mail.ParseAddress(value)
+		return err == nil && addr.Address == value
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, value)
+		return err == nil
+	case "date":
+		_, err := time.Parse("2006-01-02", value)
+		return err == nil
+	}
+	return true
+}
+
+// equal compares two decoded JSON values.
+func equal(a, b interface{}) bool {
+	ja, errA := json.Marshal(a)
+	jb, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(ja) == string(jb)
+}
+
+// join appends a property name to a dotted path.
+func join(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
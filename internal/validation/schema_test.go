@@ -0,0 +1,73 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+)
+
+const userSchema = `{
+	"type": "object",
+	"required": ["email", "name"],
+	"additionalProperties": false,
+	"properties": {
+		"name": {"type": "string", "minLength": 2, "maxLength": 20},
+		"email": {"type": "string", "format": "email"},
+		"age": {"type": "integer", "minimum": 0, "maximum": 150},
+		"role": {"enum": ["admin", "user"]},
+		"zip": {"type": "string", "pattern": "^[0-9]{5}$"},
+		"tags": {"type": "array", "maxItems": 2, "items": {"type": "string"}},
+		"nickname": {"type": ["string", "null"]}
+	}
+}`
+
+func TestSchema_Valid(t *testing.T) {
+	schema, err := ParseSchema([]byte(userSchema))
+	if err != nil {
+		t.Fatalf("ParseSchema failed: %v", err)
+	}
+
+	doc := `{"name": "Ada", "email": "ada@example.com", "age": 36, "role": "admin", "zip": "12345", "tags": ["x"], "nickname": null}`
+	if err := schema.ValidateJSON([]byte(doc)); err != nil {
+		t.Errorf("Expected valid document, got %v", err)
+	}
+}
+
+func TestSchema_ReportsEveryViolation(t *testing.T) {
+	schema, _ := ParseSchema([]byte(userSchema))
+
+	doc := `{"name": "A", "age": 1.5, "role": "root", "zip": "abc", "tags": ["x", 2, "z"], "extra": true}`
+	err := schema.ValidateJSON([]byte(doc))
+
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected Errors, got %v", err)
+	}
+
+	want := map[string]string{
+		"email":   "required",
+		"name":    "minLength",
+		"age":     "type",
+		"role":    "enum",
+		"zip":     "pattern",
+		"tags":    "maxItems",
+		"tags[1]": "type",
+		"extra":   "additionalProperties",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for _, fe := range errs {
+		if want[fe.Field] != fe.Rule {
+			t.Errorf("Unexpected error %+v", fe)
+		}
+	}
+}
+
+func TestParseSchema_Invalid(t *testing.T) {
+	if _, err := ParseSchema([]byte(`{"type": 1}`)); err == nil {
+		t.Error("ParseSchema should reject an invalid type")
+	}
+	if _, err := ParseSchema([]byte(`{"pattern": "("}`)); err == nil {
+		t.Error("ParseSchema should reject an invalid pattern")
+	}
+}
@@ -0,0 +1,229 @@
+// Package validation checks values against `validate` struct tags and
+// JSON Schema documents, reporting every failing field at once.
+package validation
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// FieldError describes one failed rule.
+type FieldError struct {
+	Field   string `json:"field"`           // dotted path of the field, using JSON names
+	Rule    string `json:"rule"`            // rule that failed, e.g. required or min
+	Param   string `json:"param,omitempty"` // rule parameter, e.g. 3 for min=3
+	Message string `json:"message"`         // human readable description
+}
+
+// Errors is the error returned when validation fails.
+type Errors []FieldError
+
+// Error implements the error interface.
+func (e Errors) Error() string {
+	msgs := make([]string, len(e))
+	for i, fe := range e {
+		msgs[i] = fe.Field + ": " + fe.Message
+	}
+	return "validation failed: " + strings.Join(msgs, "; ")
+}
+
+// Struct validates the `validate` tags of a struct or pointer to struct.
+// Supported rules are required, email, url, min=N, max=N, len=N and
+// oneof=a b c; min, max and len compare string and slice lengths or
+// numeric values. Nested structs are validated recursively.
+//
+//	type SignUp struct {
+//	    Name  string `json:"name" validate:"required,min=3"`
+//	    Email string `json:"email" validate:"required,email"`
+//	}
+func Struct(v interface{}) error {
+	val := reflect.ValueOf(v)
+	for val.Kind() == reflect.Ptr || val.Kind() == reflect.Interface {
+		if val.IsNil() {
+			return fmt.Errorf("cannot validate nil %T", v)
+		}
+		val = val.Elem()
+	}
+	if val.Kind() != reflect.Struct {
+		return fmt.Errorf("cannot validate %T, expected a struct", v)
+	}
+
+	var errs Errors
+	if err := validateStruct(val, "", &errs); err != nil {
+		return err
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validateStruct checks every tagged field of val.
+func validateStruct(val reflect.Value, prefix string, errs *Errors) error {
+	typ := val.Type()
+	for i := 0; i < val.NumField(); i++ {
+		field := typ.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+		value := val.Field(i)
+
+		name := fieldName(field)
+		if name == "-" {
+			continue
+		}
+		path := name
+		if field.Anonymous && field.Tag.Get("json") == "" {
+			path = strings.TrimSuffix(prefix, ".")
+		} else if prefix != "" {
+			path = prefix + name
+		}
+
+		if tag := field.Tag.Get("validate"); tag != "" && tag != "-" {
+			if err := validateField(value, path, tag, errs); err != nil {
+				return fmt.Errorf("field %s: %w", path, err)
+			}
+		}
+
+		// Recurse into nested structs
+		inner := value
+		for inner.Kind() == reflect.Ptr && !inner.IsNil() {
+			inner = inner.Elem()
+		}
+		if inner.Kind() == reflect.Struct && inner.Type().PkgPath() != "time" {
+			next := path + "."
+			if path == "" {
+				next = ""
+			}
+			if err := validateStruct(inner, next, errs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fieldName returns the JSON name of a field.
+func fieldName(field reflect.StructField) string {
+	if tag := field.Tag.Get("json"); tag != "" {
+		if name := strings.Split(tag, ",")[0]; name != "" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+// validateField applies the comma separated rules in tag to value.
+func validateField(value reflect.Value, path, tag string, errs *Errors) error {
+	for value.Kind() == reflect.Ptr || value.Kind() == reflect.Interface {
+		if value.IsNil() {
+			if strings.Contains(","+tag+",", ",required,") {
+				*errs = append(*errs, FieldError{Field: path, Rule: "required", Message: "is required"})
+			}
+			return nil
+		}
+		value = value.Elem()
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+
+		ok, msg, err := check(value, name, param)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			*errs = append(*errs, FieldError{Field: path, Rule: name, Param: param, Message: msg})
+			if name == "required" {
+				break // other rules are meaningless for a missing value
+			}
+		}
+	}
+	return nil
+}
+
+// check evaluates a single rule.
+func check(value reflect.Value, rule, param string) (bool, string, error) {
+	switch rule {
+	case "required":
+		return !value.IsZero(), "is required", nil
+
+	case "email":
+		s, err := stringOf(value, rule)
+		if err != nil || s == "" {
+			return true, "", err
+		}
+		addr, perr := mail.ParseAddress(s)
+		return perr == nil && addr.Address == s, "must be a valid email address", nil
+
+	case "url":
+		s, err := stringOf(value, rule)
+		if err != nil || s == "" {
+			return true, "", err
+		}
+		u, perr := url.Parse(s)
+		return perr == nil && u.Scheme != "" && u.Host != "", "must be a valid URL", nil
+
+	case "oneof":
+		options := strings.Fields(param)
+		actual := fmt.Sprint(value.Interface())
+		for _, option := range options {
+			if actual == option {
+				return true, "", nil
+			}
+		}
+		return false, "must be one of " + strings.Join(options, ", "), nil
+
+	case "min", "max", "len":
+		limit, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			return false, "", fmt.Errorf("rule %s needs a numeric parameter, got %q", rule, param)
+		}
+		n, isLength, err := measure(value, rule)
+		if err != nil {
+			return false, "", err
+		}
+		unit := ""
+		if isLength {
+			unit = " in length"
+		}
+		switch rule {
+		case "min":
+			return n >= limit, fmt.Sprintf("must be at least %s%s", param, unit), nil
+		case "max":
+			return n <= limit, fmt.Sprintf("must be at most %s%s", param, unit), nil
+		default:
+			return n == limit, fmt.Sprintf("must be exactly %s%s", param, unit), nil
+		}
+	}
+	return false, "", fmt.Errorf("unknown validation rule %q", rule)
+}
+
+// stringOf returns the value of a string field.
+func stringOf(value reflect.Value, rule string) (string, error) {
+	if value.Kind() != reflect.String {
+		return "", fmt.Errorf("rule %s applies to strings, not %s", rule, value.Type())
+	}
+	return value.String(), nil
+}
+
+// measure returns the length of strings and collections or the value of numbers.
+func measure(value reflect.Value, rule string) (float64, bool, error) {
+	switch value.Kind() {
+	case reflect.String:
+		return float64(len([]rune(value.String()))), true, nil
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return float64(value.Len()), true, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(value.Int()), false, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(value.Uint()), false, nil
+	case reflect.Float32, reflect.Float64:
+		return value.Float(), false, nil
+	}
+	return 0, false, fmt.Errorf("rule %s does not apply to %s", rule, value.Type())
+}
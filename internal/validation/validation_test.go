@@ -0,0 +1,97 @@
+package validation
+
+import (
+	"errors"
+	"testing"
+)
+
+type address struct {
+	City string `json:"city" validate:"required"`
+}
+
+type signUp struct {
+	Name     string   `json:"name" validate:"required,min=3"`
+	Email    string   `json:"email" validate:"required,email"`
+	Age      int      `json:"age" validate:"min=18,max=130"`
+	Role     string   `json:"role" validate:"oneof=admin user"`
+	Website  string   `json:"website" validate:"url"`
+	Tags     []string `json:"tags" validate:"max=2"`
+	Address  address  `json:"address"`
+	Nickname *string  `json:"nickname" validate:"required"`
+}
+
+func TestStruct_Valid(t *testing.T) {
+	nick := "ada"
+	err := Struct(&signUp{
+		Name:     "Ada",
+		Email:    "ada@example.com",
+		Age:      36,
+		Role:     "admin",
+		Website:  "https://example.com",
+		Address:  address{City: "London"},
+		Nickname: &nick,
+	})
+	if err != nil {
+		t.Errorf("Expected valid struct, got %v", err)
+	}
+}
+
+func TestStruct_ReportsEveryField(t *testing.T) {
+	err := Struct(signUp{
+		Name:    "Al",
+		Email:   "not-an-email",
+		Age:     12,
+		Role:    "root",
+		Website: "example",
+		Tags:    []string{"a", "b", "c"},
+	})
+
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("Expected Errors, got %v", err)
+	}
+
+	want := map[string]string{
+		"name":         "min",
+		"email":        "email",
+		"age":          "min",
+		"role":         "oneof",
+		"website":      "url",
+		"tags":         "max",
+		"address.city": "required",
+		"nickname":     "required",
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("Expected %d errors, got %d: %v", len(want), len(errs), errs)
+	}
+	for _, fe := range errs {
+		if want[fe.Field] != fe.Rule {
+			t.Errorf("Unexpected error %+v", fe)
+		}
+	}
+}
+
+func TestStruct_RequiredStopsOtherRules(t *testing.T) {
+	err := Struct(&struct {
+		Name string `validate:"required,min=3"`
+	}{})
+
+	var errs Errors
+	errors.As(err, &errs)
+	if len(errs) != 1 || errs[0].Rule != "required" || errs[0].Field != "Name" {
+		t.Errorf("Expected a single required error, got %v", errs)
+	}
+}
+
+func TestStruct_InvalidInput(t *testing.T) {
+	if err := Struct("text"); err == nil {
+		t.Error("Struct should reject non-struct values")
+	}
+
+	err := Struct(&struct {
+		Name string `validate:"shiny"`
+	}{})
+	if err == nil || errors.As(err, new(Errors)) {
+		t.Errorf("Unknown rules should be reported as a usage error, got %v", err)
+	}
+}
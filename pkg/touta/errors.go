@@ -0,0 +1,67 @@
+package touta
+
+import (
+	"net/http"
+	"strings"
+)
+
+// HTTPError is an error with an HTTP status and a message that is safe to
+// show to clients. Handlers return it to control the error response; the
+// wrapped cause is logged but never sent to clients.
+//
+//	return touta.NewHTTPError(404, "user not found").WithCode("user_not_found")
+type HTTPError struct {
+	Status  int         // HTTP status code
+	Message string      // public message
+	Code    string      // machine readable code, e.g. not_found
+	Details interface{} // optional structured details, e.g. failing fields
+	Err     error       // internal cause
+}
+
+// NewHTTPError creates an HTTPError. An empty message defaults to the
+// status text and the code is derived from the status text.
+func NewHTTPError(status int, message string) *HTTPError {
+	if message == "" {
+		message = http.StatusText(status)
+	}
+	return &HTTPError{
+		Status:  status,
+		Message: message,
+		Code:    strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_"),
+	}
+}
+
+// WithCode sets the machine readable code.
+func (e *HTTPError) WithCode(code string) *HTTPError {
+	e.Code = code
+	return e
+}
+
+// WithDetails attaches structured details to the response.
+func (e *HTTPError) WithDetails(details interface{}) *HTTPError {
+	e.Details = details
+	return e
+}
+
+// Wrap records the internal cause of the error.
+func (e *HTTPError) Wrap(err error) *HTTPError {
+	e.Err = err
+	return e
+}
+
+// Error implements the error interface.
+func (e *HTTPError) Error() string {
+	msg := http.StatusText(e.Status)
+	if e.Message != "" && e.Message != msg {
+		msg += ": " + e.Message
+	}
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Unwrap returns the internal cause.
+func (e *HTTPError) Unwrap() error {
+	return e.Err
+}
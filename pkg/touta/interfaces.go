@@ -9,6 +9,7 @@ package touta
 
 import (
 	"context"
+	"io"
 	"net/http"
 )
 
@@ -19,6 +20,8 @@ import (
 // Container manages dependency injection and service resolution.
 // It supports binding interfaces to concrete implementations, singletons,
 // factories, and auto-wiring via reflection.
+// Passing a string as the abstract creates a named binding, e.g.
+// Bind("user.saveProfile", handler), resolved with Make("user.saveProfile").
 type Container interface {
 	// Bind registers an interface to a concrete implementation
 	Bind(abstract interface{}, concrete interface{}) error
@@ -87,9 +90,17 @@ type MessageBus interface {
 	PublishSync(ctx context.Context, msg Message) error
 
 	// Subscribe registers a handler for messages of a specific type or slug
-	Subscribe(pattern string, handler MessageHandler) error
+	Subscribe(pattern string, handler MessageHandler) (Subscription, error)
 
-	// Unsubscribe removes a handler for a specific pattern
+	// SubscribeOnce registers a handler that is removed after its first message
+	SubscribeOnce(pattern string, handler MessageHandler) (Subscription, error)
+
+	// SubscribeContext registers a handler that is removed when ctx is done
+	SubscribeContext(ctx context.Context, pattern string, handler MessageHandler) (Subscription, error)
+
+	// Unsubscribe removes a handler for a specific pattern.
+	// Handlers that are not comparable (e.g. functions) must be removed
+	// through the Subscription returned by Subscribe instead.
 	Unsubscribe(pattern string, handler MessageHandler) error
 
 	// Start begins processing messages (for async bus implementations)
@@ -99,6 +110,18 @@ type MessageBus interface {
 	Stop(ctx context.Context) error
 }
 
+// Subscription is a handle to a handler registered on a MessageBus.
+type Subscription interface {
+	// Pattern returns the slug, type or wildcard the handler is bound to
+	Pattern() string
+
+	// Unsubscribe removes the handler from the bus; calling it twice is a no-op
+	Unsubscribe() error
+
+	// Done returns a channel that is closed once the subscription is removed
+	Done() <-chan struct{}
+}
+
 // ============================================================================
 // Router Interfaces
 // ============================================================================
@@ -112,27 +135,72 @@ type MiddlewareFunc func(HandlerFunc) HandlerFunc
 // Router provides HTTP routing abstraction.
 // The default implementation uses Chi, but other routers can be swapped in.
 type Router interface {
-	// GET registers a handler for GET requests
-	GET(path string, handler HandlerFunc)
+	// GET registers a handler for GET requests. Middleware passed after
+	// the handler only applies to this route
+	GET(path string, handler HandlerFunc, middleware ...MiddlewareFunc) Route
 
 	// POST registers a handler for POST requests
-	POST(path string, handler HandlerFunc)
+	POST(path string, handler HandlerFunc, middleware ...MiddlewareFunc) Route
 
 	// PUT registers a handler for PUT requests
-	PUT(path string, handler HandlerFunc)
+	PUT(path string, handler HandlerFunc, middleware ...MiddlewareFunc) Route
 
 	// DELETE registers a handler for DELETE requests
-	DELETE(path string, handler HandlerFunc)
+	DELETE(path string, handler HandlerFunc, middleware ...MiddlewareFunc) Route
 
 	// PATCH registers a handler for PATCH requests
-	PATCH(path string, handler HandlerFunc)
+	PATCH(path string, handler HandlerFunc, middleware ...MiddlewareFunc) Route
+
+	// HEAD registers a handler for HEAD requests
+	HEAD(path string, handler HandlerFunc, middleware ...MiddlewareFunc) Route
+
+	// OPTIONS registers a handler for OPTIONS requests
+	OPTIONS(path string, handler HandlerFunc, middleware ...MiddlewareFunc) Route
+
+	// CONNECT registers a handler for CONNECT requests
+	CONNECT(path string, handler HandlerFunc, middleware ...MiddlewareFunc) Route
+
+	// TRACE registers a handler for TRACE requests
+	TRACE(path string, handler HandlerFunc, middleware ...MiddlewareFunc) Route
+
+	// Any registers a handler for requests of any method
+	Any(path string, handler HandlerFunc, middleware ...MiddlewareFunc) Route
+
+	// Match registers a handler for requests of the given methods
+	Match(methods []string, path string, handler HandlerFunc, middleware ...MiddlewareFunc) Route
+
+	// Handle registers a net/http handler for requests of any method
+	Handle(path string, handler http.Handler, middleware ...MiddlewareFunc) Route
+
+	// With returns a router that registers routes on this one with
+	// additional middleware
+	With(middleware ...MiddlewareFunc) Router
+
+	// NotFound sets the handler for requests matching no route
+	NotFound(handler HandlerFunc)
+
+	// MethodNotAllowed sets the handler for requests matching a route
+	// but none of its methods
+	MethodNotAllowed(handler HandlerFunc)
+
+	// Group creates a route group with a prefix, calling fn with it when
+	// given. Groups share the router's middleware and may repeat prefixes
+	Group(prefix string, fn ...func(Router)) Router
 
-	// Group creates a route group with a prefix
-	Group(prefix string) Router
+	// Route nests routes below a pattern, like Group with a callback
+	Route(pattern string, fn func(Router)) Router
+
+	// Host returns a router for requests whose host matches pattern,
+	// e.g. "{tenant}.example.com"
+	Host(pattern string, fn ...func(Router)) Router
 
 	// Use adds middleware to the router
 	Use(middleware ...MiddlewareFunc)
 
+	// URL builds the path of a named route. Params are key/value pairs
+	// filling the route's parameters; other pairs become query parameters
+	URL(name string, params ...interface{}) (string, error)
+
 	// Listen starts the HTTP server on the given address
 	Listen(addr string) error
 
@@ -140,6 +208,12 @@ type Router interface {
 	Native() interface{}
 }
 
+// Route is a route registered on a Router.
+type Route interface {
+	// Name names the route, e.g. "users.show", for URL generation
+	Name(name string) Route
+}
+
 // Context provides access to the HTTP request/response and framework services.
 type Context interface {
 	// Request returns the HTTP request
@@ -148,6 +222,14 @@ type Context interface {
 	// Response returns the HTTP response writer
 	Response() http.ResponseWriter
 
+	// SetRequest replaces the request seen by the rest of the chain,
+	// e.g. to attach a deadline to its context
+	SetRequest(req *http.Request)
+
+	// SetResponse replaces the response writer used by the rest of the
+	// chain, e.g. to compress the output
+	SetResponse(w http.ResponseWriter)
+
 	// Param retrieves a URL parameter by name
 	Param(key string) string
 
@@ -163,6 +245,10 @@ type Context interface {
 	// Container returns the DI container
 	Container() Container
 
+	// Bind decodes the request body, path parameters, query string and
+	// headers into dst and validates it against its `validate` tags
+	Bind(dst interface{}) error
+
 	// JSON sends a JSON response
 	JSON(status int, data interface{}) error
 
@@ -172,6 +258,24 @@ type Context interface {
 	// HTML sends an HTML response
 	HTML(status int, html string) error
 
+	// XML sends an XML response
+	XML(status int, data interface{}) error
+
+	// YAML sends a YAML response
+	YAML(status int, data interface{}) error
+
+	// Blob sends raw bytes with the given content type
+	Blob(status int, contentType string, data []byte) error
+
+	// Stream copies a reader to the response with the given content type
+	Stream(status int, contentType string, r io.Reader) error
+
+	// Negotiate renders data in the format preferred by the Accept header
+	Negotiate(status int, data interface{}) error
+
+	// URL builds the path of a named route
+	URL(name string, params ...interface{}) (string, error)
+
 	// Redirect redirects to another URL
 	Redirect(status int, url string) error
 
@@ -206,6 +310,9 @@ type Config struct {
 	// Server settings
 	Server ServerConfig `yaml:"server"`
 
+	// Message bus settings
+	MessageBus MessageBusConfig `yaml:"message_bus"`
+
 	// Packages and components
 	Packages map[string]interface{} `yaml:"packages"`
 
@@ -267,11 +374,20 @@ type StaticConfig struct {
 	MaxAge int    `yaml:"max_age"` // cache max age in seconds
 }
 
+// MessageBusConfig contains message bus settings.
+type MessageBusConfig struct {
+	Router string   `yaml:"router"` // config-based or code-based
+	Routes []string `yaml:"routes"` // routes.yaml files, used when config-based
+}
+
 // TLSConfig contains TLS/SSL settings.
 type TLSConfig struct {
 	Enabled  bool   `yaml:"enabled"`
 	CertFile string `yaml:"cert_file"`
 	KeyFile  string `yaml:"key_file"`
+	// RedirectAddr, when set, also listens for plain HTTP on this address
+	// and redirects every request to HTTPS.
+	RedirectAddr string `yaml:"redirect_addr"`
 }
 
 // ============================================================================